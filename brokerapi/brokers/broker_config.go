@@ -16,6 +16,7 @@ package brokers
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/brokerpak"
@@ -28,6 +29,19 @@ type BrokerConfig struct {
 	HttpConfig *jwt.Config
 	ProjectId  string
 	Registry   broker.BrokerRegistry
+
+	// CleanupRegistry removes the files used by the services in Registry once
+	// it has been replaced by a reload, it may be nil.
+	CleanupRegistry func()
+
+	// LoadRegistry builds a fresh registry and a function to clean it up when
+	// the broker is reloaded, if it's nil the broker can't be reloaded.
+	LoadRegistry func() (broker.BrokerRegistry, func(), error)
+
+	// CleanupTimeout is how long to wait after a reload for Terraform jobs
+	// that may be using the replaced registry's files before removing them.
+	// The files are kept if jobs are still running.
+	CleanupTimeout time.Duration
 }
 
 func NewBrokerConfigFromEnv() (*BrokerConfig, error) {
@@ -41,14 +55,29 @@ func NewBrokerConfigFromEnv() (*BrokerConfig, error) {
 		return nil, err
 	}
 
-	registry := builtin.BuiltinBrokerRegistry()
-	if err := brokerpak.RegisterAll(registry); err != nil {
-		return nil, fmt.Errorf("Error loading brokerpaks: %v", err)
+	registry, cleanup, err := NewRegistryFromEnv()
+	if err != nil {
+		return nil, err
 	}
 
 	return &BrokerConfig{
-		ProjectId:  projectId,
-		HttpConfig: conf,
-		Registry:   registry,
+		ProjectId:       projectId,
+		HttpConfig:      conf,
+		Registry:        registry,
+		CleanupRegistry: cleanup,
+		LoadRegistry:    NewRegistryFromEnv,
 	}, nil
 }
+
+// NewRegistryFromEnv creates a registry with the builtin services and the
+// services from every configured brokerpak. The returned function removes the
+// files extracted from the brokerpaks once the registry is no longer used.
+func NewRegistryFromEnv() (broker.BrokerRegistry, func(), error) {
+	registry := builtin.BuiltinBrokerRegistry()
+	cleanup, err := brokerpak.RegisterAll(registry)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error loading brokerpaks: %v", err)
+	}
+
+	return registry, cleanup, nil
+}
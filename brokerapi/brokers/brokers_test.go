@@ -18,9 +18,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	. "github.com/GoogleCloudPlatform/gcp-service-broker/brokerapi/brokers"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service"
@@ -30,9 +32,11 @@ import (
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/builtin"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/builtin/base"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/builtin/storage"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/varcontext"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/utils"
 	"github.com/pivotal-cf/brokerapi"
+	"github.com/spf13/viper"
 	"google.golang.org/api/googleapi"
 
 	"code.cloudfoundry.org/lager"
@@ -169,6 +173,29 @@ func newStubbedBroker(t *testing.T, registry broker.BrokerRegistry) (broker *GCP
 	return
 }
 
+// startOperation records an unfinished asynchronous operation on the instance.
+func startOperation(t *testing.T, stub *serviceStub, operationType string) {
+	t.Helper()
+
+	details, err := db_service.GetServiceInstanceDetailsById(context.Background(), fakeInstanceId)
+	failIfErr(t, "getting instance details", err)
+
+	details.OperationType = operationType
+	details.OperationId = "in-flight-operation"
+	failIfErr(t, "saving instance details", db_service.SaveServiceInstanceDetails(context.Background(), details))
+
+	stub.Provider.PollInstanceReturns(false, nil)
+}
+
+// recordOperationState saves a Terraform deployment for the operation started
+// by startOperation with the given state.
+func recordOperationState(t *testing.T, state string) {
+	t.Helper()
+
+	deployment := models.TerraformDeployment{ID: "in-flight-operation", LastOperationState: state}
+	failIfErr(t, "saving deployment", db_service.CreateTerraformDeployment(context.Background(), &deployment))
+}
+
 // failIfErr is a test helper function which stops the test immediately if the
 // error is set.
 func failIfErr(t *testing.T, action string, err error) {
@@ -270,6 +297,25 @@ func TestGCPServiceBroker_Provision(t *testing.T) {
 				assertEqual(t, "provision calls should match", 1, stub.Provider.ProvisionCallCount())
 			},
 		},
+		"dashboard-url": {
+			ServiceState: StateNone,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				spec, err := broker.Provision(context.Background(), fakeInstanceId, stub.ProvisionDetails(), true)
+				failIfErr(t, "provisioning", err)
+
+				assertEqual(t, "dashboard url should match", "https://console.cloud.google.com/storage/browser/?project=stub-project", spec.DashboardURL)
+			},
+		},
+		"async-dashboard-url": {
+			AsyncService: true,
+			ServiceState: StateNone,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				spec, err := broker.Provision(context.Background(), fakeInstanceId, stub.ProvisionDetails(), true)
+				failIfErr(t, "provisioning", err)
+
+				assertEqual(t, "dashboard url should be empty until the instance is provisioned", "", spec.DashboardURL)
+			},
+		},
 		"duplicate-request": {
 			ServiceState: StateProvisioned,
 			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
@@ -364,6 +410,77 @@ func TestGCPServiceBroker_Deprovision(t *testing.T) {
 			},
 		},
 
+		"provision-in-progress": {
+			AsyncService: true,
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				startOperation(t, stub, models.ProvisionOperationType)
+
+				_, err := broker.Deprovision(context.Background(), fakeInstanceId, stub.DeprovisionDetails(), true)
+				assertEqual(t, "errors should match", ErrOperationInProgress, err)
+				assertEqual(t, "deprovision calls should match", 0, stub.Provider.DeprovisionCallCount())
+			},
+		},
+		"provision-retrying": {
+			AsyncService: true,
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				startOperation(t, stub, models.ProvisionOperationType)
+				stub.Provider.PollInstanceReturns(false, &googleapi.Error{Code: 503})
+
+				_, err := broker.Deprovision(context.Background(), fakeInstanceId, stub.DeprovisionDetails(), true)
+				assertEqual(t, "errors should match", ErrOperationInProgress, err)
+			},
+		},
+		"provision-failed": {
+			AsyncService: true,
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				startOperation(t, stub, models.ProvisionOperationType)
+				stub.Provider.PollInstanceReturns(false, errors.New("provision failed"))
+
+				_, err := broker.Deprovision(context.Background(), fakeInstanceId, stub.DeprovisionDetails(), true)
+				failIfErr(t, "deprovisioning", err)
+				assertEqual(t, "deprovision calls should match", 1, stub.Provider.DeprovisionCallCount())
+			},
+		},
+		"provision-finished": {
+			AsyncService: true,
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				startOperation(t, stub, models.ProvisionOperationType)
+				stub.Provider.PollInstanceReturns(true, nil)
+
+				_, err := broker.Deprovision(context.Background(), fakeInstanceId, stub.DeprovisionDetails(), true)
+				failIfErr(t, "deprovisioning", err)
+			},
+		},
+		"provision-recorded-in-progress": {
+			AsyncService: true,
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				startOperation(t, stub, models.ProvisionOperationType)
+				recordOperationState(t, tf.InProgress)
+				stub.Provider.PollInstanceReturns(true, nil)
+
+				_, err := broker.Deprovision(context.Background(), fakeInstanceId, stub.DeprovisionDetails(), true)
+				assertEqual(t, "errors should match", ErrOperationInProgress, err)
+				assertEqual(t, "poll calls should match", 0, stub.Provider.PollInstanceCallCount())
+			},
+		},
+		"provision-recorded-failed": {
+			AsyncService: true,
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				startOperation(t, stub, models.ProvisionOperationType)
+				recordOperationState(t, tf.Failed)
+
+				_, err := broker.Deprovision(context.Background(), fakeInstanceId, stub.DeprovisionDetails(), true)
+				failIfErr(t, "deprovisioning", err)
+				assertEqual(t, "poll calls should match", 0, stub.Provider.PollInstanceCallCount())
+				assertEqual(t, "deprovision calls should match", 1, stub.Provider.DeprovisionCallCount())
+			},
+		},
 		"async-deprovision-updates-db": {
 			AsyncService: true,
 			ServiceState: StateProvisioned,
@@ -412,6 +529,17 @@ func TestGCPServiceBroker_Bind(t *testing.T) {
 				assertEqual(t, "errors should match", expectedErr, err.Error())
 			},
 		},
+		"provision-in-progress": {
+			AsyncService: true,
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				startOperation(t, stub, models.ProvisionOperationType)
+
+				_, err := broker.Bind(context.Background(), fakeInstanceId, fakeBindingId, stub.BindDetails(), true)
+				assertEqual(t, "errors should match", ErrOperationInProgress, err)
+				assertEqual(t, "BindCallCount should match", 0, stub.Provider.BindCallCount())
+			},
+		},
 		"bad-request-json": {
 			ServiceState: StateProvisioned,
 			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
@@ -536,10 +664,36 @@ func TestGCPServiceBroker_GetInstance(t *testing.T) {
 	cases := BrokerEndpointTestSuite{
 		"called-while-provisioned": {
 			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				spec, err := broker.GetInstance(context.Background(), fakeInstanceId)
+				failIfErr(t, "getting instance", err)
+
+				expected := brokerapi.GetInstanceDetailsSpec{
+					ServiceID:    stub.ServiceId,
+					PlanID:       stub.PlanId,
+					DashboardURL: "https://console.cloud.google.com/storage/browser/?project=stub-project",
+				}
+				assertEqual(t, "expect instance details", expected, spec)
+			},
+		},
+		"called-while-provisioning": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				details, err := db_service.GetServiceInstanceDetailsById(context.Background(), fakeInstanceId)
+				failIfErr(t, "getting instance details", err)
+				details.OperationType = models.ProvisionOperationType
+				failIfErr(t, "saving instance details", db_service.SaveServiceInstanceDetails(context.Background(), details))
+
+				_, err = broker.GetInstance(context.Background(), fakeInstanceId)
+				assertEqual(t, "expect instance not found err", ErrInstanceNotFound, err)
+			},
+		},
+		"called-while-deprovisioned": {
+			ServiceState: StateDeprovisioned,
 			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
 				_, err := broker.GetInstance(context.Background(), fakeInstanceId)
 
-				assertEqual(t, "expect get instances not supported err", ErrGetInstancesUnsupported, err)
+				assertEqual(t, "expect instance not found err", ErrInstanceNotFound, err)
 			},
 		},
 	}
@@ -562,3 +716,370 @@ func TestGCPServiceBroker_LastBindingOperation(t *testing.T) {
 
 	cases.Run(t)
 }
+
+// newReloadableBroker creates a broker serving the stub's service that calls
+// cleanup when its registry is replaced and reloads to the next registry.
+func newReloadableBroker(t *testing.T, stub *serviceStub, cleanup func(), next broker.BrokerRegistry, cleanupNext func()) *GCPServiceBroker {
+	reloadable, err := New(&BrokerConfig{
+		ProjectId:       "stub-project",
+		Registry:        registryOf(t, stub.ServiceDefinition),
+		CleanupRegistry: cleanup,
+		LoadRegistry: func() (broker.BrokerRegistry, func(), error) {
+			return next, cleanupNext, nil
+		},
+	}, utils.NewLogger("brokers-test"))
+	if err != nil {
+		t.Fatalf("couldn't create broker: %v", err)
+	}
+
+	return reloadable
+}
+
+// registryOf creates a registry holding the given definitions.
+func registryOf(t *testing.T, defns ...*broker.ServiceDefinition) broker.BrokerRegistry {
+	registry := broker.BrokerRegistry{}
+	for _, defn := range defns {
+		if err := registry.TryRegister(defn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return registry
+}
+
+func TestGCPServiceBroker_ReplaceRegistry(t *testing.T) {
+	withoutPlan := func(stub *serviceStub) *broker.ServiceDefinition {
+		defn := *stub.ServiceDefinition
+		defn.Plans = nil
+		for _, plan := range stub.ServiceDefinition.Plans {
+			if plan.ID != stub.PlanId {
+				defn.Plans = append(defn.Plans, plan)
+			}
+		}
+
+		return &defn
+	}
+
+	BrokerEndpointTestSuite{
+		"drop service without instances": {
+			ServiceState: StateNone,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				err := broker.ReplaceRegistry(context.Background(), registryOf(t))
+				failIfErr(t, "replacing registry", err)
+				assertEqual(t, "registry should be replaced", 0, len(broker.Registry()))
+			},
+		},
+		"drop service with live instance": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				err := broker.ReplaceRegistry(context.Background(), registryOf(t))
+				expected := fmt.Sprintf("refusing to reload, instances still exist for: service %q", stub.ServiceId)
+				assertEqual(t, "errors should match", expected, fmt.Sprint(err))
+				assertEqual(t, "registry should be kept", 1, len(broker.Registry()))
+			},
+		},
+		"drop service with deprovisioned instance": {
+			ServiceState: StateDeprovisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				err := broker.ReplaceRegistry(context.Background(), registryOf(t))
+				failIfErr(t, "replacing registry", err)
+			},
+		},
+		"drop plan with live instance": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				err := broker.ReplaceRegistry(context.Background(), registryOf(t, withoutPlan(stub)))
+				expected := fmt.Sprintf("refusing to reload, instances still exist for: plan %q of service %q", stub.PlanId, stub.ServiceDefinition.Name)
+				assertEqual(t, "errors should match", expected, fmt.Sprint(err))
+			},
+		},
+		"keep service with live instance": {
+			ServiceState: StateBound,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				next := registryOf(t, stub.ServiceDefinition)
+				err := broker.ReplaceRegistry(context.Background(), next)
+				failIfErr(t, "replacing registry", err)
+
+				_, err = broker.GetInstance(context.Background(), fakeInstanceId)
+				failIfErr(t, "getting instance", err)
+			},
+		},
+		"reload cleans up previous registry": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, _ *GCPServiceBroker, stub *serviceStub) {
+				previousCleaned := make(chan struct{})
+				reloadable := newReloadableBroker(t, stub, func() { close(previousCleaned) }, registryOf(t, stub.ServiceDefinition), func() {
+					t.Error("the current registry shouldn't be cleaned up")
+				})
+
+				failIfErr(t, "reloading", reloadable.Reload(context.Background()))
+
+				select {
+				case <-previousCleaned:
+				case <-time.After(5 * time.Second):
+					t.Fatal("Expected the previous registry to be cleaned up")
+				}
+			},
+		},
+		"failed reload cleans up next registry": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, _ *GCPServiceBroker, stub *serviceStub) {
+				nextCleaned := false
+				reloadable := newReloadableBroker(t, stub, func() {
+					t.Error("the current registry shouldn't be cleaned up")
+				}, registryOf(t), func() { nextCleaned = true })
+
+				if err := reloadable.Reload(context.Background()); err == nil {
+					t.Fatal("Expected dropping a service with instances to fail")
+				}
+				assertEqual(t, "the next registry should be cleaned up", true, nextCleaned)
+			},
+		},
+		"reload unsupported": {
+			ServiceState: StateNone,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				err := broker.Reload(context.Background())
+				assertEqual(t, "errors should match", ErrReloadUnsupported, err)
+			},
+		},
+	}.Run(t)
+}
+
+// upgradingProvider is a fake ServiceProvider that can upgrade instances.
+type upgradingProvider struct {
+	*brokerfakes.FakeServiceProvider
+	operationId *string
+	upgraded    []string
+}
+
+func (p *upgradingProvider) UpgradeInstance(ctx context.Context, instance models.ServiceInstanceDetails) (*string, error) {
+	p.upgraded = append(p.upgraded, instance.ID)
+	return p.operationId, nil
+}
+
+// updatingProvider is a fake ServiceProvider that can change the parameters
+// of instances.
+type updatingProvider struct {
+	*brokerfakes.FakeServiceProvider
+	operationId string
+	vars        map[string]interface{}
+	changed     []string
+}
+
+func (p *updatingProvider) UpdateInstance(ctx context.Context, instance models.ServiceInstanceDetails, vars *varcontext.VarContext, changed []string) (*string, error) {
+	p.vars = vars.ToMap()
+	p.changed = changed
+	return &p.operationId, nil
+}
+
+func TestGCPServiceBroker_Update(t *testing.T) {
+	version := brokerapi.MaintenanceInfo{Public: map[string]string{"brokerpak": "test", "version": "2.0"}}
+
+	// upgradable makes the stub advertise the version and upgrade instances
+	// using the returned provider.
+	upgradable := func(stub *serviceStub, operationId *string) *upgradingProvider {
+		viper.Set("compatibility.enable-maintenance-info", true)
+
+		info := version
+		stub.ServiceDefinition.MaintenanceInfo = &info
+
+		provider := &upgradingProvider{FakeServiceProvider: stub.Provider, operationId: operationId}
+		stub.ServiceDefinition.ProviderBuilder = func(projectId string, auth *jwt.Config, logger lager.Logger) broker.ServiceProvider {
+			return provider
+		}
+
+		return provider
+	}
+
+	updateDetails := func(stub *serviceStub, info brokerapi.MaintenanceInfo) brokerapi.UpdateDetails {
+		return brokerapi.UpdateDetails{
+			ServiceID:       stub.ServiceId,
+			PlanID:          stub.PlanId,
+			MaintenanceInfo: info,
+		}
+	}
+
+	// updatable makes force_delete updatable and changes parameters using the
+	// returned provider.
+	updatable := func(stub *serviceStub) *updatingProvider {
+		for i, v := range stub.ServiceDefinition.ProvisionInputVariables {
+			if v.FieldName == "force_delete" {
+				stub.ServiceDefinition.ProvisionInputVariables[i].Updatable = true
+			}
+		}
+
+		provider := &updatingProvider{FakeServiceProvider: stub.Provider, operationId: "update-operation"}
+		stub.ServiceDefinition.ProviderBuilder = func(projectId string, auth *jwt.Config, logger lager.Logger) broker.ServiceProvider {
+			return provider
+		}
+
+		return provider
+	}
+
+	BrokerEndpointTestSuite{
+		"plan change": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				_, err := broker.Update(context.Background(), fakeInstanceId, updateDetails(stub, brokerapi.MaintenanceInfo{}), true)
+				assertEqual(t, "errors should match", brokerapi.ErrPlanChangeNotSupported, err)
+			},
+		},
+		"parameters with maintenance info": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				provider := upgradable(stub, nil)
+				defer viper.Reset()
+
+				details := updateDetails(stub, version)
+				details.RawParameters = json.RawMessage(`{"location":"us-east1"}`)
+				_, err := broker.Update(context.Background(), fakeInstanceId, details, true)
+				assertEqual(t, "errors should match", ErrUpdateParameters, err)
+				assertEqual(t, "instance shouldn't be upgraded", []string(nil), provider.upgraded)
+			},
+		},
+		"update parameters": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				provider := updatable(stub)
+
+				details := updateDetails(stub, brokerapi.MaintenanceInfo{})
+				details.RawParameters = json.RawMessage(`{"force_delete":"true"}`)
+				spec, err := broker.Update(context.Background(), fakeInstanceId, details, true)
+				failIfErr(t, "updating", err)
+				assertEqual(t, "update should be async", true, spec.IsAsync)
+				assertEqual(t, "operation should be returned", provider.operationId, spec.OperationData)
+				assertEqual(t, "changed parameters should be passed", []string{"force_delete"}, provider.changed)
+				assertEqual(t, "new value should be resolved", "true", provider.vars["force_delete"])
+
+				instance, err := db_service.GetServiceInstanceDetailsById(context.Background(), fakeInstanceId)
+				failIfErr(t, "getting instance details", err)
+				assertEqual(t, "operation type should be saved", models.UpdateOperationType, instance.OperationType)
+
+				request, err := db_service.GetProvisionRequestDetailsByServiceInstanceId(context.Background(), fakeInstanceId)
+				failIfErr(t, "getting provision request", err)
+				assertEqual(t, "parameters should be saved", `{"force_delete":"true"}`, request.RequestDetails)
+			},
+		},
+		"update parameters that aren't updatable": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				provider := updatable(stub)
+
+				details := updateDetails(stub, brokerapi.MaintenanceInfo{})
+				details.RawParameters = json.RawMessage(`{"location":"us-east1"}`)
+				_, err := broker.Update(context.Background(), fakeInstanceId, details, true)
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				assertEqual(t, "provider shouldn't be called", []string(nil), provider.changed)
+			},
+		},
+		"update parameters async required": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				updatable(stub)
+
+				details := updateDetails(stub, brokerapi.MaintenanceInfo{})
+				details.RawParameters = json.RawMessage(`{"force_delete":"true"}`)
+				_, err := broker.Update(context.Background(), fakeInstanceId, details, false)
+				assertEqual(t, "errors should match", brokerapi.ErrAsyncRequired, err)
+			},
+		},
+		"empty parameters with maintenance info": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				provider := upgradable(stub, nil)
+				defer viper.Reset()
+
+				details := updateDetails(stub, version)
+				details.RawParameters = json.RawMessage(`{}`)
+				_, err := broker.Update(context.Background(), fakeInstanceId, details, true)
+				failIfErr(t, "updating", err)
+				assertEqual(t, "instance should be checked", []string{fakeInstanceId}, provider.upgraded)
+			},
+		},
+		"maintenance info not advertised": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				_, err := broker.Update(context.Background(), fakeInstanceId, updateDetails(stub, version), true)
+				assertEqual(t, "errors should match", brokerapi.ErrMaintenanceInfoConflict, err)
+			},
+		},
+		"maintenance info mismatch": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				upgradable(stub, nil)
+				defer viper.Reset()
+
+				old := brokerapi.MaintenanceInfo{Public: map[string]string{"brokerpak": "test", "version": "1.0"}}
+				_, err := broker.Update(context.Background(), fakeInstanceId, updateDetails(stub, old), true)
+				assertEqual(t, "errors should match", brokerapi.ErrMaintenanceInfoConflict, err)
+			},
+		},
+		"upgrade unsupported": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				viper.Set("compatibility.enable-maintenance-info", true)
+				defer viper.Reset()
+				info := version
+				stub.ServiceDefinition.MaintenanceInfo = &info
+
+				_, err := broker.Update(context.Background(), fakeInstanceId, updateDetails(stub, version), true)
+				assertEqual(t, "errors should match", brokerapi.ErrPlanChangeNotSupported, err)
+			},
+		},
+		"async required": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				upgradable(stub, nil)
+				defer viper.Reset()
+
+				_, err := broker.Update(context.Background(), fakeInstanceId, updateDetails(stub, version), false)
+				assertEqual(t, "errors should match", brokerapi.ErrAsyncRequired, err)
+			},
+		},
+		"up to date": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				provider := upgradable(stub, nil)
+				defer viper.Reset()
+
+				spec, err := broker.Update(context.Background(), fakeInstanceId, updateDetails(stub, version), true)
+				failIfErr(t, "updating", err)
+				assertEqual(t, "update should be synchronous", brokerapi.UpdateServiceSpec{}, spec)
+				assertEqual(t, "instance should be checked", []string{fakeInstanceId}, provider.upgraded)
+			},
+		},
+		"operation in progress": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				operationId := "upgrade-operation"
+				provider := upgradable(stub, &operationId)
+				defer viper.Reset()
+				startOperation(t, stub, models.ProvisionOperationType)
+
+				_, err := broker.Update(context.Background(), fakeInstanceId, updateDetails(stub, version), true)
+				assertEqual(t, "errors should match", ErrOperationInProgress, err)
+				assertEqual(t, "instance shouldn't be upgraded", []string(nil), provider.upgraded)
+			},
+		},
+		"upgrade": {
+			ServiceState: StateProvisioned,
+			Check: func(t *testing.T, broker *GCPServiceBroker, stub *serviceStub) {
+				operationId := "upgrade-operation"
+				upgradable(stub, &operationId)
+				defer viper.Reset()
+
+				spec, err := broker.Update(context.Background(), fakeInstanceId, updateDetails(stub, version), true)
+				failIfErr(t, "updating", err)
+				assertEqual(t, "update should be async", true, spec.IsAsync)
+				assertEqual(t, "operation should be returned", operationId, spec.OperationData)
+
+				details, err := db_service.GetServiceInstanceDetailsById(context.Background(), fakeInstanceId)
+				failIfErr(t, "getting instance details", err)
+				assertEqual(t, "operation type should be saved", models.UpgradeOperationType, details.OperationType)
+				assertEqual(t, "operation id should be saved", operationId, details.OperationId)
+			},
+		},
+	}.Run(t)
+}
@@ -19,6 +19,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
 
 	"code.cloudfoundry.org/lager"
 	"github.com/pivotal-cf/brokerapi"
@@ -30,21 +34,40 @@ import (
 	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service/models"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/varcontext"
 )
 
 var (
-	invalidUserInputMsg        = "User supplied paramaters must be in the form of a valid JSON map."
-	ErrInvalidUserInput        = brokerapi.NewFailureResponse(errors.New(invalidUserInputMsg), http.StatusBadRequest, "parsing-user-request")
-	ErrGetInstancesUnsupported = brokerapi.NewFailureResponse(errors.New("the service_instances endpoint is unsupported"), http.StatusBadRequest, "unsupported")
-	ErrGetBindingsUnsupported  = brokerapi.NewFailureResponse(errors.New("the service_bindings endpoint is unsupported"), http.StatusBadRequest, "unsupported")
+	invalidUserInputMsg       = "User supplied paramaters must be in the form of a valid JSON map."
+	ErrInvalidUserInput       = brokerapi.NewFailureResponse(errors.New(invalidUserInputMsg), http.StatusBadRequest, "parsing-user-request")
+	ErrGetBindingsUnsupported = brokerapi.NewFailureResponse(errors.New("the service_bindings endpoint is unsupported"), http.StatusBadRequest, "unsupported")
+	ErrInstanceNotFound       = brokerapi.NewFailureResponse(errors.New("instance does not exist or is still being provisioned"), http.StatusNotFound, "get-instance")
+	ErrOperationInProgress    = brokerapi.ErrConcurrentInstanceAccess.Build()
+	ErrUpdateParameters       = brokerapi.NewFailureResponse(errors.New("this service's parameters can't be changed by updating an instance"), http.StatusUnprocessableEntity, "update-parameters-not-supported")
 )
 
 // GCPServiceBroker is a brokerapi.ServiceBroker that can be used to generate an OSB compatible service broker.
 type GCPServiceBroker struct {
-	registry  broker.BrokerRegistry
 	jwtConfig *jwt.Config
 	projectId string
 
+	// registry is replaced when the broker is reloaded, registryMu guards it.
+	registry     broker.BrokerRegistry
+	registryMu   sync.RWMutex
+	loadRegistry func() (broker.BrokerRegistry, func(), error)
+
+	// cleanupRegistry removes the files used by the current registry, it's
+	// guarded by reloadMu.
+	cleanupRegistry func()
+	cleanupTimeout  time.Duration
+
+	// reloadMu is held for writing while reloading and for reading by
+	// operations that use a service's provider so a reload can't remove a
+	// service while an instance of it is being created, or remove the files
+	// a provider is using.
+	reloadMu sync.RWMutex
+
 	Logger lager.Logger
 }
 
@@ -52,10 +75,13 @@ type GCPServiceBroker struct {
 // Exactly one of GCPServiceBroker or error will be nil when returned.
 func New(cfg *BrokerConfig, logger lager.Logger) (*GCPServiceBroker, error) {
 	return &GCPServiceBroker{
-		registry:  cfg.Registry,
-		jwtConfig: cfg.HttpConfig,
-		projectId: cfg.ProjectId,
-		Logger:    logger,
+		registry:        cfg.Registry,
+		cleanupRegistry: cfg.CleanupRegistry,
+		cleanupTimeout:  cfg.CleanupTimeout,
+		loadRegistry:    cfg.LoadRegistry,
+		jwtConfig:       cfg.HttpConfig,
+		projectId:       cfg.ProjectId,
+		Logger:          logger,
 	}, nil
 }
 
@@ -64,7 +90,8 @@ func New(cfg *BrokerConfig, logger lager.Logger) (*GCPServiceBroker, error) {
 func (gcpBroker *GCPServiceBroker) Services(ctx context.Context) ([]brokerapi.Service, error) {
 	svcs := []brokerapi.Service{}
 
-	enabledServices, err := gcpBroker.registry.GetEnabledServices()
+	registry := gcpBroker.Registry()
+	enabledServices, err := registry.GetEnabledServices()
 	if err != nil {
 		return nil, err
 	}
@@ -81,7 +108,7 @@ func (gcpBroker *GCPServiceBroker) Services(ctx context.Context) ([]brokerapi.Se
 }
 
 func (gcpBroker *GCPServiceBroker) getDefinitionAndProvider(serviceId string) (*broker.ServiceDefinition, broker.ServiceProvider, error) {
-	defn, err := gcpBroker.registry.GetServiceById(serviceId)
+	defn, err := gcpBroker.Registry().GetServiceById(serviceId)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -99,6 +126,9 @@ func (gcpBroker *GCPServiceBroker) Provision(ctx context.Context, instanceID str
 		"details":            details,
 	})
 
+	gcpBroker.reloadMu.RLock()
+	defer gcpBroker.reloadMu.RUnlock()
+
 	// make sure that instance hasn't already been provisioned
 	exists, err := db_service.ExistsServiceInstanceDetailsById(ctx, instanceID)
 	if err != nil {
@@ -152,7 +182,7 @@ func (gcpBroker *GCPServiceBroker) Provision(ctx context.Context, instanceID str
 
 	err = db_service.CreateServiceInstanceDetails(ctx, &instanceDetails)
 	if err != nil {
-		return brokerapi.ProvisionedServiceSpec{}, fmt.Errorf("Error saving instance details to database: %s. WARNING: this instance cannot be deprovisioned through cf. Contact your operator for cleanup", err)
+		return brokerapi.ProvisionedServiceSpec{}, fmt.Errorf("Error saving instance details to database: %s. WARNING: this instance cannot be deprovisioned through cf, its resources must be removed manually. Terraform backed services can be inspected with GET /admin/tf/tf:%s:", err, instanceID)
 	}
 
 	// save provision request details
@@ -164,7 +194,28 @@ func (gcpBroker *GCPServiceBroker) Provision(ctx context.Context, instanceID str
 		return brokerapi.ProvisionedServiceSpec{}, fmt.Errorf("Error saving provision request details to database: %s. Services relying on async provisioning will not be able to complete provisioning", err)
 	}
 
-	return brokerapi.ProvisionedServiceSpec{IsAsync: shouldProvisionAsync, DashboardURL: "", OperationData: instanceDetails.OperationId}, nil
+	spec := brokerapi.ProvisionedServiceSpec{IsAsync: shouldProvisionAsync, OperationData: instanceDetails.OperationId}
+
+	// The outputs of async instances aren't known until the operation finishes
+	// so the dashboard URL is only available through GetInstance.
+	if !shouldProvisionAsync {
+		spec.DashboardURL = gcpBroker.dashboardUrl(brokerService, instanceDetails)
+	}
+
+	return spec, nil
+}
+
+// dashboardUrl computes the dashboard URL for the instance. Failures are logged
+// rather than returned because the dashboard is informational and shouldn't
+// fail the request.
+func (gcpBroker *GCPServiceBroker) dashboardUrl(defn *broker.ServiceDefinition, instance models.ServiceInstanceDetails) string {
+	url, err := defn.DashboardUrl(instance, gcpBroker.projectId)
+	if err != nil {
+		gcpBroker.Logger.Error("dashboard-url", err, lager.Data{"instance_id": instance.ID})
+		return ""
+	}
+
+	return url
 }
 
 // Deprovision destroys an existing instance of a service.
@@ -177,6 +228,9 @@ func (gcpBroker *GCPServiceBroker) Deprovision(ctx context.Context, instanceID s
 		"details":            details,
 	})
 
+	gcpBroker.reloadMu.RLock()
+	defer gcpBroker.reloadMu.RUnlock()
+
 	// make sure that instance actually exists
 	instance, err := db_service.GetServiceInstanceDetailsById(ctx, instanceID)
 	if err != nil {
@@ -188,6 +242,10 @@ func (gcpBroker *GCPServiceBroker) Deprovision(ctx context.Context, instanceID s
 		return response, err
 	}
 
+	if err := checkNoOperationInProgress(ctx, serviceProvider, *instance); err != nil {
+		return response, err
+	}
+
 	// if async deprovisioning isn't allowed but this service needs it, throw an error
 	if serviceProvider.DeprovisionsAsync() && !clientSupportsAsync {
 		return response, brokerapi.ErrAsyncRequired
@@ -203,7 +261,7 @@ func (gcpBroker *GCPServiceBroker) Deprovision(ctx context.Context, instanceID s
 		// if it's an async operation we can't delete from the db until we're sure delete succeeded, so this is
 		// handled internally to LastOperation
 		if err := db_service.DeleteServiceInstanceDetailsById(ctx, instanceID); err != nil {
-			return response, fmt.Errorf("Error deleting instance details from database: %s. WARNING: this instance will remain visible in cf. Contact your operator for cleanup", err)
+			return response, fmt.Errorf("Error deleting instance details from database: %s. WARNING: this instance will remain visible in cf. An operator can remove it with DELETE /admin/instances/%s", err, instanceID)
 		}
 		return response, nil
 	} else {
@@ -213,7 +271,7 @@ func (gcpBroker *GCPServiceBroker) Deprovision(ctx context.Context, instanceID s
 		instance.OperationType = models.DeprovisionOperationType
 		instance.OperationId = *operationId
 		if err := db_service.SaveServiceInstanceDetails(ctx, instance); err != nil {
-			return response, fmt.Errorf("Error saving instance details to database: %s. WARNING: this instance will remain visible in cf. Contact your operator for cleanup.", err)
+			return response, fmt.Errorf("Error saving instance details to database: %s. WARNING: this instance will remain visible in cf. An operator can remove it with DELETE /admin/instances/%s", err, instanceID)
 		}
 		return response, nil
 	}
@@ -228,6 +286,9 @@ func (gcpBroker *GCPServiceBroker) Bind(ctx context.Context, instanceID, binding
 		"details":     details,
 	})
 
+	gcpBroker.reloadMu.RLock()
+	defer gcpBroker.reloadMu.RUnlock()
+
 	// check for existing binding
 	exists, err := db_service.ExistsServiceBindingCredentialsByServiceInstanceIdAndBindingId(ctx, instanceID, bindingID)
 	if err != nil {
@@ -248,6 +309,10 @@ func (gcpBroker *GCPServiceBroker) Bind(ctx context.Context, instanceID, binding
 		return brokerapi.Binding{}, err
 	}
 
+	if err := checkNoOperationInProgress(ctx, serviceProvider, *instanceRecord); err != nil {
+		return brokerapi.Binding{}, err
+	}
+
 	// verify the service exists and the plan exists
 	plan, err := serviceDefinition.GetPlanById(details.PlanID)
 	if err != nil {
@@ -274,7 +339,7 @@ func (gcpBroker *GCPServiceBroker) Bind(ctx context.Context, instanceID, binding
 
 	serializedCreds, err := json.Marshal(credsDetails)
 	if err != nil {
-		return brokerapi.Binding{}, fmt.Errorf("Error serializing credentials: %s. WARNING: these credentials cannot be unbound through cf. Please contact your operator for cleanup", err)
+		return brokerapi.Binding{}, fmt.Errorf("Error serializing credentials: %s. WARNING: these credentials cannot be unbound through cf, they must be revoked manually. Terraform backed services can be inspected with GET /admin/tf/tf:%s:%s", err, instanceID, bindingID)
 	}
 
 	// save binding to database
@@ -286,8 +351,8 @@ func (gcpBroker *GCPServiceBroker) Bind(ctx context.Context, instanceID, binding
 	}
 
 	if err := db_service.CreateServiceBindingCredentials(ctx, &newCreds); err != nil {
-		return brokerapi.Binding{}, fmt.Errorf("Error saving credentials to database: %s. WARNING: these credentials cannot be unbound through cf. Please contact your operator for cleanup",
-			err)
+		return brokerapi.Binding{}, fmt.Errorf("Error saving credentials to database: %s. WARNING: these credentials cannot be unbound through cf, they must be revoked manually. Terraform backed services can be inspected with GET /admin/tf/tf:%s:%s",
+			err, instanceID, bindingID)
 	}
 
 	binding, err := serviceProvider.BuildInstanceCredentials(ctx, newCreds, *instanceRecord)
@@ -314,13 +379,40 @@ func (broker *GCPServiceBroker) GetBinding(ctx context.Context, instanceID, bind
 // GetInstance fetches information about a service instance
 // GET /v2/service_instances/{instance_id}
 //
-// NOTE: This functionality is not implemented.
+// Instances that are still being provisioned are reported as not found as
+// required by the OSB spec.
 func (broker *GCPServiceBroker) GetInstance(ctx context.Context, instanceID string) (brokerapi.GetInstanceDetailsSpec, error) {
 	broker.Logger.Info("GetInstance", lager.Data{
 		"instance_id": instanceID,
 	})
 
-	return brokerapi.GetInstanceDetailsSpec{}, ErrGetInstancesUnsupported
+	exists, err := db_service.ExistsServiceInstanceDetailsById(ctx, instanceID)
+	if err != nil {
+		return brokerapi.GetInstanceDetailsSpec{}, fmt.Errorf("Database error checking for existing instance: %s", err)
+	}
+	if !exists {
+		return brokerapi.GetInstanceDetailsSpec{}, ErrInstanceNotFound
+	}
+
+	instance, err := db_service.GetServiceInstanceDetailsById(ctx, instanceID)
+	if err != nil {
+		return brokerapi.GetInstanceDetailsSpec{}, fmt.Errorf("Database error retrieving instance: %s", err)
+	}
+
+	if instance.OperationType == models.ProvisionOperationType {
+		return brokerapi.GetInstanceDetailsSpec{}, ErrInstanceNotFound
+	}
+
+	defn, err := broker.Registry().GetServiceById(instance.ServiceId)
+	if err != nil {
+		return brokerapi.GetInstanceDetailsSpec{}, err
+	}
+
+	return brokerapi.GetInstanceDetailsSpec{
+		ServiceID:    instance.ServiceId,
+		PlanID:       instance.PlanId,
+		DashboardURL: broker.dashboardUrl(defn, *instance),
+	}, nil
 }
 
 // LastBindingOperation fetches last operation state for a service binding.
@@ -348,6 +440,9 @@ func (gcpBroker *GCPServiceBroker) Unbind(ctx context.Context, instanceID, bindi
 		"details":     details,
 	})
 
+	gcpBroker.reloadMu.RLock()
+	defer gcpBroker.reloadMu.RUnlock()
+
 	_, serviceProvider, err := gcpBroker.getDefinitionAndProvider(details.ServiceID)
 	if err != nil {
 		return brokerapi.UnbindSpec{}, err
@@ -372,7 +467,7 @@ func (gcpBroker *GCPServiceBroker) Unbind(ctx context.Context, instanceID, bindi
 
 	// remove binding from database
 	if err := db_service.DeleteServiceBindingCredentials(ctx, existingBinding); err != nil {
-		return brokerapi.UnbindSpec{}, fmt.Errorf("Error soft-deleting credentials from database: %s. WARNING: these credentials will remain visible in cf. Contact your operator for cleanup", err)
+		return brokerapi.UnbindSpec{}, fmt.Errorf("Error soft-deleting credentials from database: %s. WARNING: these credentials will remain visible in cf. An operator can remove them with DELETE /admin/bindings/%s", err, bindingID)
 	}
 
 	return brokerapi.UnbindSpec{}, nil
@@ -389,6 +484,9 @@ func (gcpBroker *GCPServiceBroker) LastOperation(ctx context.Context, instanceID
 		"operation_data": details.OperationData,
 	})
 
+	gcpBroker.reloadMu.RLock()
+	defer gcpBroker.reloadMu.RUnlock()
+
 	instance, err := db_service.GetServiceInstanceDetailsById(ctx, instanceID)
 	if err != nil {
 		return brokerapi.LastOperation{}, brokerapi.ErrInstanceDoesNotExist
@@ -428,12 +526,54 @@ func (gcpBroker *GCPServiceBroker) LastOperation(ctx context.Context, instanceID
 	return brokerapi.LastOperation{State: brokerapi.Succeeded}, updateErr
 }
 
+// checkNoOperationInProgress returns ErrOperationInProgress if an asynchronous
+// operation on the instance hasn't finished yet. Request locks are only held
+// while a request is being served, so without this check e.g. a deprovision
+// could start while Terraform is still provisioning the instance.
+// Failed operations are finished, so they don't stop the instance from being
+// deprovisioned.
+//
+// Terraform jobs record their state in the database, so it's used directly.
+// The provider is only polled if the operation has no recorded state.
+func checkNoOperationInProgress(ctx context.Context, service broker.ServiceProvider, instance models.ServiceInstanceDetails) error {
+	if instance.OperationType == models.ClearOperationType {
+		return nil
+	}
+
+	if instance.OperationId != "" {
+		if deployment, err := db_service.GetTerraformDeploymentById(ctx, instance.OperationId); err == nil {
+			switch deployment.LastOperationState {
+			case tf.InProgress:
+				return ErrOperationInProgress
+			case tf.Succeeded, tf.Failed:
+				return nil
+			}
+		}
+	}
+
+	done, err := service.PollInstance(ctx, instance)
+	if err != nil {
+		// the state of the operation is unknown if the poll can be retried
+		if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == 503 {
+			return ErrOperationInProgress
+		}
+
+		return nil
+	}
+
+	if !done {
+		return ErrOperationInProgress
+	}
+
+	return nil
+}
+
 // updateStateOnOperationCompletion handles updating/cleaning-up resources that need to be changed
 // once lastOperation finishes successfully.
 func (gcpBroker *GCPServiceBroker) updateStateOnOperationCompletion(ctx context.Context, service broker.ServiceProvider, lastOperationType, instanceID string) error {
 	if lastOperationType == models.DeprovisionOperationType {
 		if err := db_service.DeleteServiceInstanceDetailsById(ctx, instanceID); err != nil {
-			return fmt.Errorf("Error deleting instance details from database: %s. WARNING: this instance will remain visible in cf. Contact your operator for cleanup", err)
+			return fmt.Errorf("Error deleting instance details from database: %s. WARNING: this instance will remain visible in cf. An operator can remove it with DELETE /admin/instances/%s", err, instanceID)
 		}
 
 		return nil
@@ -459,10 +599,181 @@ func (gcpBroker *GCPServiceBroker) updateStateOnOperationCompletion(ctx context.
 	return nil
 }
 
-// Update a service instance plan.
-// This functionality is not implemented and will return an error indicating that plan changes are not supported.
+// instanceUpgrader is implemented by service providers that can upgrade
+// instances to the version of the service advertised in the catalog.
+type instanceUpgrader interface {
+	UpgradeInstance(ctx context.Context, instance models.ServiceInstanceDetails) (operationId *string, err error)
+}
+
+// instanceUpdater is implemented by service providers that can change the
+// updatable parameters of existing instances. vars holds all the instance's
+// resolved variables and changed the names of the ones the update sets.
+type instanceUpdater interface {
+	UpdateInstance(ctx context.Context, instance models.ServiceInstanceDetails, vars *varcontext.VarContext, changed []string) (operationId *string, err error)
+}
+
+// Update changes the updatable parameters of a service instance, or upgrades
+// it to the version in the plan's maintenance_info.
+// It is bound to the `PATCH /v2/service_instances/:instance_id` endpoint and can be called using the `cf update-service -c` or `cf update-service --upgrade` commands.
+// Plan changes are not supported and will return an error. Requests that set
+// parameters only change them, the instance must already be up to date.
 func (gcpBroker *GCPServiceBroker) Update(ctx context.Context, instanceID string, details brokerapi.UpdateDetails, asyncAllowed bool) (brokerapi.UpdateServiceSpec, error) {
-	return brokerapi.UpdateServiceSpec{}, brokerapi.ErrPlanChangeNotSupported
+	gcpBroker.Logger.Info("Updating", lager.Data{
+		"instance_id":        instanceID,
+		"accepts_incomplete": asyncAllowed,
+		"details":            details,
+	})
+
+	params, err := parseUpdateParameters(details.GetRawParameters())
+	if err != nil {
+		return brokerapi.UpdateServiceSpec{}, err
+	}
+
+	noMaintenanceInfo := reflect.DeepEqual(details.MaintenanceInfo, brokerapi.MaintenanceInfo{})
+	if noMaintenanceInfo && len(params) == 0 {
+		return brokerapi.UpdateServiceSpec{}, brokerapi.ErrPlanChangeNotSupported
+	}
+
+	gcpBroker.reloadMu.RLock()
+	defer gcpBroker.reloadMu.RUnlock()
+
+	instance, err := db_service.GetServiceInstanceDetailsById(ctx, instanceID)
+	if err != nil {
+		return brokerapi.UpdateServiceSpec{}, brokerapi.ErrInstanceDoesNotExist
+	}
+
+	if details.PlanID != "" && details.PlanID != instance.PlanId {
+		return brokerapi.UpdateServiceSpec{}, brokerapi.ErrPlanChangeNotSupported
+	}
+
+	brokerService, serviceProvider, err := gcpBroker.getDefinitionAndProvider(instance.ServiceId)
+	if err != nil {
+		return brokerapi.UpdateServiceSpec{}, err
+	}
+
+	if err := checkNoOperationInProgress(ctx, serviceProvider, *instance); err != nil {
+		return brokerapi.UpdateServiceSpec{}, err
+	}
+
+	if !noMaintenanceInfo {
+		advertised := brokerService.AdvertisedMaintenanceInfo()
+		if advertised == nil || !reflect.DeepEqual(*advertised, details.MaintenanceInfo) {
+			return brokerapi.UpdateServiceSpec{}, brokerapi.ErrMaintenanceInfoConflict
+		}
+	}
+
+	var operationId *string
+	var operationType string
+	if len(params) > 0 {
+		operationType = models.UpdateOperationType
+		operationId, err = gcpBroker.updateParameters(ctx, brokerService, serviceProvider, instance, details, params, asyncAllowed)
+	} else {
+		operationType = models.UpgradeOperationType
+		operationId, err = upgradeInstance(ctx, serviceProvider, instance, asyncAllowed)
+	}
+
+	if err != nil {
+		return brokerapi.UpdateServiceSpec{}, err
+	}
+
+	// the instance is already up to date
+	if operationId == nil {
+		return brokerapi.UpdateServiceSpec{}, nil
+	}
+
+	instance.OperationType = operationType
+	instance.OperationId = *operationId
+	if err := db_service.SaveServiceInstanceDetails(ctx, instance); err != nil {
+		return brokerapi.UpdateServiceSpec{}, fmt.Errorf("Error saving instance details to database: %s", err)
+	}
+
+	return brokerapi.UpdateServiceSpec{
+		IsAsync:       true,
+		DashboardURL:  gcpBroker.dashboardUrl(brokerService, *instance),
+		OperationData: *operationId,
+	}, nil
+}
+
+// upgradeInstance starts upgrading the instance if the provider supports it.
+func upgradeInstance(ctx context.Context, serviceProvider broker.ServiceProvider, instance *models.ServiceInstanceDetails, asyncAllowed bool) (*string, error) {
+	upgrader, ok := serviceProvider.(instanceUpgrader)
+	if !ok {
+		return nil, brokerapi.ErrPlanChangeNotSupported
+	}
+
+	if !asyncAllowed {
+		return nil, brokerapi.ErrAsyncRequired
+	}
+
+	return upgrader.UpgradeInstance(ctx, *instance)
+}
+
+// updateParameters starts changing the instance's parameters if the provider
+// supports it and stores the new parameters so later updates and upgrades
+// use them.
+func (gcpBroker *GCPServiceBroker) updateParameters(ctx context.Context, brokerService *broker.ServiceDefinition, serviceProvider broker.ServiceProvider, instance *models.ServiceInstanceDetails, details brokerapi.UpdateDetails, updated map[string]interface{}, asyncAllowed bool) (*string, error) {
+	updater, ok := serviceProvider.(instanceUpdater)
+	if !ok {
+		return nil, ErrUpdateParameters
+	}
+
+	if !asyncAllowed {
+		return nil, brokerapi.ErrAsyncRequired
+	}
+
+	plan, err := brokerService.GetPlanById(instance.PlanId)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := db_service.GetProvisionRequestDetailsByServiceInstanceId(ctx, instance.ID)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving provision request details: %s", err)
+	}
+
+	vars, params, err := brokerService.UpdateVariables(*instance, json.RawMessage(request.RequestDetails), details, *plan)
+	if err != nil {
+		return nil, brokerapi.NewFailureResponse(err, http.StatusBadRequest, "update-parameters")
+	}
+
+	var changed []string
+	for name := range updated {
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+
+	operationId, err := updater.UpdateInstance(ctx, *instance, vars, changed)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := models.ProvisionRequestDetails{
+		ServiceInstanceId: instance.ID,
+		RequestDetails:    string(params),
+	}
+	if err := db_service.CreateProvisionRequestDetails(ctx, &pr); err != nil {
+		return nil, fmt.Errorf("Error saving provision request details to database: %s. The update is running but later updates and upgrades will use the previous parameters", err)
+	}
+
+	return operationId, nil
+}
+
+// parseUpdateParameters parses the parameters of an update request.
+func parseUpdateParameters(rawParameters json.RawMessage) (map[string]interface{}, error) {
+	if !isValidOrEmptyJSON(rawParameters) {
+		return nil, ErrInvalidUserInput
+	}
+
+	if len(rawParameters) == 0 {
+		return nil, nil
+	}
+
+	var params map[string]interface{}
+	if err := json.Unmarshal(rawParameters, &params); err != nil {
+		return nil, ErrInvalidUserInput
+	}
+
+	return params, nil
 }
 
 func isValidOrEmptyJSON(msg json.RawMessage) bool {
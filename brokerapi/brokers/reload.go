@@ -0,0 +1,146 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package brokers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf"
+)
+
+// ErrReloadUnsupported is returned when reloading a broker that wasn't
+// configured with a way to load a new registry.
+var ErrReloadUnsupported = errors.New("the broker wasn't configured to reload its services")
+
+// Registry gets the services the broker is currently serving.
+func (gcpBroker *GCPServiceBroker) Registry() broker.BrokerRegistry {
+	gcpBroker.registryMu.RLock()
+	defer gcpBroker.registryMu.RUnlock()
+
+	return gcpBroker.registry
+}
+
+// Reload loads a fresh registry, including re-reading every brokerpak, and
+// replaces the broker's registry with it.
+func (gcpBroker *GCPServiceBroker) Reload(ctx context.Context) error {
+	if gcpBroker.loadRegistry == nil {
+		return ErrReloadUnsupported
+	}
+
+	next, cleanup, err := gcpBroker.loadRegistry()
+	if err != nil {
+		return err
+	}
+
+	if err := gcpBroker.replaceRegistry(ctx, next, cleanup); err != nil {
+		if cleanup != nil {
+			cleanup()
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// ReplaceRegistry atomically swaps the broker's registry for the next one.
+// The swap is refused if the next registry would drop a service or plan that
+// still has instances.
+func (gcpBroker *GCPServiceBroker) ReplaceRegistry(ctx context.Context, next broker.BrokerRegistry) error {
+	return gcpBroker.replaceRegistry(ctx, next, nil)
+}
+
+// replaceRegistry swaps the registry like ReplaceRegistry. If the swap
+// succeeds, cleanup is kept to remove the next registry's files when it's
+// replaced and the previous registry's files are removed.
+func (gcpBroker *GCPServiceBroker) replaceRegistry(ctx context.Context, next broker.BrokerRegistry, cleanup func()) error {
+	gcpBroker.reloadMu.Lock()
+	defer gcpBroker.reloadMu.Unlock()
+
+	for _, svc := range next.GetAllServices() {
+		if err := svc.Validate(); err != nil {
+			return fmt.Errorf("invalid service %q: %v", svc.Name, err)
+		}
+	}
+
+	instances, err := db_service.ListServiceInstanceDetails(ctx)
+	if err != nil {
+		return fmt.Errorf("Database error listing instances: %s", err)
+	}
+
+	orphaned := make(map[string]bool)
+	for _, instance := range instances {
+		svc, err := next.GetServiceById(instance.ServiceId)
+		if err != nil {
+			orphaned[fmt.Sprintf("service %q", instance.ServiceId)] = true
+			continue
+		}
+
+		if _, err := svc.GetPlanById(instance.PlanId); err != nil {
+			orphaned[fmt.Sprintf("plan %q of service %q", instance.PlanId, svc.Name)] = true
+		}
+	}
+
+	if len(orphaned) > 0 {
+		var missing []string
+		for k := range orphaned {
+			missing = append(missing, k)
+		}
+		sort.Strings(missing)
+
+		return fmt.Errorf("refusing to reload, instances still exist for: %s", strings.Join(missing, ", "))
+	}
+
+	gcpBroker.registryMu.Lock()
+	previous := gcpBroker.registry
+	gcpBroker.registry = next
+	gcpBroker.registryMu.Unlock()
+
+	gcpBroker.Logger.Info("reloaded", lager.Data{
+		"previous-services": len(previous),
+		"services":          len(next),
+	})
+
+	if previousCleanup := gcpBroker.cleanupRegistry; previousCleanup != nil {
+		// Terraform jobs started before the swap may still be running the
+		// previous registry's binaries.
+		timeout := gcpBroker.cleanupTimeout
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			if running := tf.WaitForRunningJobs(ctx); len(running) > 0 {
+				gcpBroker.Logger.Info("skipped-previous-registry-cleanup", lager.Data{
+					"timeout": timeout.String(),
+					"jobs":    running,
+				})
+				return
+			}
+
+			previousCleanup()
+			gcpBroker.Logger.Info("cleaned-up-previous-registry")
+		}()
+	}
+	gcpBroker.cleanupRegistry = cleanup
+
+	return nil
+}
@@ -15,8 +15,13 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
+	"io"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 
@@ -45,7 +50,8 @@ func init() {
 		Long: `A CLI client for the service broker.
 
 The client commands use the same configuration values as the server and operate
-on localhost using the HTTP protocol.
+on localhost using the HTTP protocol. Set client.tls.enabled to connect using
+HTTPS instead.
 
 Configuration Params:
 
@@ -53,6 +59,10 @@ Configuration Params:
  - api.password
  - api.port
  - api.hostname (default: localhost)
+ - client.tls.enabled (default: false)
+ - client.tls.ca_file (optional, CA bundle to verify the server with)
+ - client.tls.cert_file (optional, client certificate to authenticate with)
+ - client.tls.key_file (optional, key for the client certificate)
 
 Environment Variables:
 
@@ -60,6 +70,10 @@ Environment Variables:
  - GSB_API_PASSWORD
  - GSB_API_PORT
  - GSP_API_HOSTNAME
+ - GSB_CLIENT_TLS_ENABLED
+ - GSB_CLIENT_TLS_CA_FILE
+ - GSB_CLIENT_TLS_CERT_FILE
+ - GSB_CLIENT_TLS_KEY_FILE
 
 The client commands return formatted JSON when run if the exit code is 0:
 
@@ -111,12 +125,18 @@ user-defined plans.
 		return client.Update(instanceId, serviceId, planId, json.RawMessage(parametersJson))
 	})
 
+	exampleFlags := &exampleRunFlags{}
 	runExamplesCmd := &cobra.Command{
 		Use:   "run-examples",
 		Short: "Run all examples in the use command.",
 		Long: `Run all examples generated by the use command through a
 	provision/bind/unbind/deprovision cycle.
 
+	Use --parallelism to run several examples at once and --continue-on-failure
+	to keep going after an example fails. Interrupting the run stops new
+	examples from starting but still cleans up the ones in progress, interrupt
+	again to exit immediately.
+
 	Exits with a 0 if all examples were successful, 1 otherwise.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			apiClient, err := client.NewClientFromEnv()
@@ -126,15 +146,20 @@ user-defined plans.
 
 			if exampleName != "" && serviceName == "" {
 				log.Fatalf("If an example name is specified, you must provide an accompanying service name.")
-			} else if fileName != "" {
-				if err := client.RunExamplesFromFile(apiClient, fileName, serviceName, exampleName); err != nil {
+			}
+
+			allExamples := server.GetExamplesFromServer()
+			if fileName != "" {
+				allExamples, err = client.ReadExamplesFromFile(fileName)
+				if err != nil {
 					log.Fatalf("Error executing examples from file: %v", err)
 				}
-			} else if err := client.RunExamplesForService(server.GetExamplesFromServer(), apiClient, serviceName, exampleName); err != nil {
-				log.Fatalf("Error executing examples: %v", err)
 			}
 
-			log.Println("Success")
+			examples := client.FilterMatchingServiceExamples(allExamples, serviceName, exampleName)
+			exampleFlags.run(func(ctx context.Context, opts client.ExampleRunOptions) (*client.ExampleReport, error) {
+				return client.RunExamples(ctx, apiClient, examples, opts), nil
+			})
 		},
 	}
 
@@ -159,6 +184,76 @@ user-defined plans.
 	runExamplesCmd.Flags().StringVarP(&serviceName, "service-name", "", "", "name of the service to run tests for")
 	runExamplesCmd.Flags().StringVarP(&exampleName, "example-name", "", "", "only run examples matching this name")
 	runExamplesCmd.Flags().StringVarP(&fileName, "filename", "", "", "json file that contains list of CompleteServiceExamples")
+	exampleFlags.register(runExamplesCmd)
+}
+
+// exampleRunFlags holds the flags shared by the sub-commands that run examples.
+type exampleRunFlags struct {
+	options     client.ExampleRunOptions
+	junitReport string
+	jsonReport  string
+}
+
+func (erf *exampleRunFlags) register(cmd *cobra.Command) {
+	cmd.Flags().IntVarP(&erf.options.Parallelism, "parallelism", "", 1, "number of examples to run at once")
+	cmd.Flags().BoolVarP(&erf.options.ContinueOnFailure, "continue-on-failure", "", false, "keep starting examples after one fails")
+	cmd.Flags().BoolVarP(&erf.options.RunSmokeChecks, "run-smoke-checks", "", false, "run the smoke check commands defined by the examples")
+	cmd.Flags().StringVarP(&erf.junitReport, "junit-report", "", "", "write a JUnit XML report of the run to this file")
+	cmd.Flags().StringVarP(&erf.jsonReport, "json-report", "", "", "write a JSON report of the run to this file")
+}
+
+// run executes the examples, writes the requested reports, and exits with a
+// non-zero status if any example didn't pass. The first SIGINT or SIGTERM
+// stops new examples from starting while the running ones clean up, a
+// second exits immediately.
+func (erf *exampleRunFlags) run(runExamples func(ctx context.Context, opts client.ExampleRunOptions) (*client.ExampleReport, error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("Got %s, cleaning up running examples; send it again to exit immediately", sig)
+		cancel()
+
+		sig = <-signals
+		log.Fatalf("Got %s again, exiting without cleaning up", sig)
+	}()
+
+	report, err := runExamples(ctx, erf.options)
+	if err != nil {
+		log.Fatalf("Error executing examples: %v", err)
+	}
+
+	writeExampleReport(erf.junitReport, report.WriteJUnit)
+	writeExampleReport(erf.jsonReport, report.WriteJSON)
+
+	if err := report.Err(); err != nil {
+		log.Fatalf("Error executing examples: %v", err)
+	}
+
+	log.Println("Success")
+}
+
+func writeExampleReport(path string, write func(io.Writer) error) {
+	if path == "" {
+		return
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatalf("Error creating report: %v", err)
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		log.Fatalf("Error writing report %q: %v", path, err)
+	}
+
+	if err := f.Close(); err != nil {
+		log.Fatalf("Error writing report %q: %v", path, err)
+	}
 }
 
 func newClientCommand(use, short string, run func(*client.Client) *client.BrokerResponse) *cobra.Command {
@@ -0,0 +1,211 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/brokerapi/brokers"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/varcontext"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/utils"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/spf13/cobra"
+)
+
+// provisionDefinitionPreviewer is implemented by providers that can show the
+// definition a provision would apply without running it.
+type provisionDefinitionPreviewer interface {
+	ProvisionDefinition(vars *varcontext.VarContext) (json.RawMessage, error)
+}
+
+func init() {
+	explainCmd := &cobra.Command{
+		Use:   "explain",
+		Short: "Explain how the broker resolves request variables",
+		Long: `Explain how the broker resolves the variables of a request without calling any
+provider.
+
+Variables are merged from operator defaults, user parameters, plan overrides,
+input defaults, plan properties and computed inputs. The explanation shows
+which of these layers set each variable, the template it was evaluated from
+and any values it overwrote.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	rootCmd.AddCommand(explainCmd)
+
+	var service, plan, params, instance string
+	provisionCmd := &cobra.Command{
+		Use:     "provision",
+		Short:   "Explain the variables of a provision request",
+		Example: `  gcp-service-broker explain provision --service google-storage --plan standard --params '{"name": "my-bucket"}'`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := explainProvision(os.Stdout, service, plan, params, instance); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	provisionCmd.Flags().StringVar(&service, "service", "", "name or ID of the service")
+	provisionCmd.Flags().StringVar(&plan, "plan", "", "name or ID of the plan")
+	provisionCmd.Flags().StringVar(&params, "params", "{}", "JSON object of user parameters")
+	provisionCmd.Flags().StringVar(&instance, "instance-id", "explain-instance", "ID of the instance to use in templates")
+	provisionCmd.MarkFlagRequired("service")
+	provisionCmd.MarkFlagRequired("plan")
+	explainCmd.AddCommand(provisionCmd)
+}
+
+func explainProvision(out io.Writer, serviceNameOrId, planNameOrId, params, instanceId string) error {
+	registry, cleanup, err := brokers.NewRegistryFromEnv()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	svc, err := findService(registry, serviceNameOrId)
+	if err != nil {
+		return err
+	}
+
+	plan, err := findPlan(svc, planNameOrId)
+	if err != nil {
+		return err
+	}
+
+	details := brokerapi.ProvisionDetails{
+		ServiceID:     svc.Id,
+		PlanID:        plan.ID,
+		RawParameters: json.RawMessage(params),
+	}
+
+	vc, trace, resolveErr := svc.ExplainProvision(instanceId, details, *plan)
+
+	if resolveErr == nil {
+		fmt.Fprintln(out, "Variables")
+		writeExplainedVariables(out, vc.Redacted(), trace)
+		fmt.Fprintln(out)
+	}
+
+	fmt.Fprintln(out, "Trace")
+	writeTrace(out, trace)
+	fmt.Fprintln(out)
+
+	if resolveErr != nil {
+		return fmt.Errorf("couldn't resolve the variables: %v", resolveErr)
+	}
+
+	// the provider is only built to render the definition, it's never called
+	previewer, ok := svc.ProviderBuilder("", nil, utils.NewLogger("explain")).(provisionDefinitionPreviewer)
+	if !ok {
+		fmt.Fprintf(out, "%s isn't backed by Terraform, the variables are passed to its provider as-is.\n", svc.Name)
+		return nil
+	}
+
+	definition, err := previewer.ProvisionDefinition(vc)
+	if err != nil {
+		return fmt.Errorf("couldn't create the Terraform definition: %v", err)
+	}
+
+	pretty, err := json.MarshalIndent(json.RawMessage(definition), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "Terraform")
+	fmt.Fprintln(out, string(pretty))
+
+	return nil
+}
+
+func findService(registry broker.BrokerRegistry, nameOrId string) (*broker.ServiceDefinition, error) {
+	for _, svc := range registry.GetAllServices() {
+		if svc.Id == nameOrId || svc.Name == nameOrId {
+			return svc, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no service with the name or ID %q", nameOrId)
+}
+
+func findPlan(svc *broker.ServiceDefinition, nameOrId string) (*broker.ServicePlan, error) {
+	catalogEntry, err := svc.CatalogEntry()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, plan := range catalogEntry.Plans {
+		if plan.ID == nameOrId || plan.Name == nameOrId {
+			return &plan, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no plan with the name or ID %q in service %s", nameOrId, svc.Name)
+}
+
+// writeExplainedVariables writes the final value of each variable and the
+// layer that set it.
+func writeExplainedVariables(out io.Writer, vars map[string]interface{}, trace varcontext.Trace) {
+	var keys []string
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.StripEscape)
+	fmt.Fprintln(w, "NAME\tVALUE\tSET BY\tTEMPLATE")
+	for _, k := range keys {
+		entry, _ := trace.SetBy(k)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", k, explainValue(vars[k]), entry.Layer, entry.Template)
+	}
+	w.Flush()
+}
+
+// writeTrace writes every change to the variables in the order they happened.
+func writeTrace(out io.Writer, trace varcontext.Trace) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.StripEscape)
+	fmt.Fprintln(w, "LAYER\tNAME\tCHANGE\tTEMPLATE")
+	for _, entry := range trace {
+		var change string
+		switch {
+		case entry.Error != "":
+			change = "failed: " + entry.Error
+		case entry.Skipped:
+			change = "skipped, already set"
+		case entry.Overwrote:
+			change = fmt.Sprintf("overwrote %s with %s", explainValue(entry.Previous), explainValue(entry.Value))
+		default:
+			change = "set " + explainValue(entry.Value)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Layer, entry.Key, change, entry.Template)
+	}
+	w.Flush()
+}
+
+func explainValue(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return string(encoded)
+}
@@ -16,9 +16,12 @@ package cmd
 
 import (
 	"fmt"
+	"log"
 
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/brokerpak"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/generator"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/builtin"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/varcontext/interpolation"
 	"github.com/spf13/cobra"
 )
 
@@ -64,12 +67,37 @@ func init() {
 	})
 
 	generateCmd.AddCommand(&cobra.Command{
+		Use:   "functions",
+		Short: "Generate expression language function documentation",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Print(interpolation.FunctionDocumentation())
+		},
+	})
+
+	var tileBrokerpaks []string
+	tileCmd := &cobra.Command{
 		Use:   "tile",
 		Short: "Generate tile.yml file",
+		Long: `Generates the tile.yml file.
+
+	Each brokerpak passed with --brokerpak gets a form for operators to set its
+	parameters and credentials.`,
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Print(generator.GenerateTile())
+			var forms []generator.Form
+			for _, pak := range tileBrokerpaks {
+				form, err := brokerpak.TileForm(pak)
+				if err != nil {
+					log.Fatalf("couldn't create form for brokerpak %q: %v", pak, err)
+				}
+
+				forms = append(forms, *form)
+			}
+
+			fmt.Print(generator.GenerateTile(forms...))
 		},
-	})
+	}
+	tileCmd.Flags().StringSliceVar(&tileBrokerpaks, "brokerpak", nil, "Brokerpak to add a parameters form for, may be repeated")
+	generateCmd.AddCommand(tileCmd)
 
 	generateCmd.AddCommand(&cobra.Command{
 		Use:   "manifest",
@@ -15,12 +15,15 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/brokerpak"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/brokerpak/paktest"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/client"
 	"github.com/spf13/cobra"
 )
 
@@ -65,6 +68,36 @@ dependencies, services it provides, and the contents.
 
 	gcp-service-broker pak info my-pak.brokerpak
 
+Test the examples offline with a fake Terraform to check your variables and
+templates are wired together correctly:
+
+	gcp-service-broker pak test my-pak.brokerpak
+
+Lint packs that will be loaded together to catch conflicting IDs and
+templates that reference undefined variables:
+
+	gcp-service-broker pak lint my-pak.brokerpak other-pak.brokerpak
+
+Before releasing a new version, check what changed since the last one:
+
+	gcp-service-broker pak diff my-pak-1.0.0.brokerpak my-pak-1.1.0.brokerpak
+
+Brokers only load packs signed by a key they trust. Generate a key pair,
+give the public key to your operators and sign packs with the private key:
+
+	gcp-service-broker pak keygen my-signing.key
+	gcp-service-broker pak sign my-pak.brokerpak my-signing.key
+
+This will produce a detached signature that must be published next to the pack:
+
+	my-pak.brokerpak.sig
+
+To build without network access, download the pack's artifacts into a cache
+directory on a connected machine, then build from the cache:
+
+	gcp-service-broker pak vendor --cache-dir ./cache my-pak
+	gcp-service-broker pak build --cache-dir ./cache --offline my-pak
+
 `,
 		Run: func(cmd *cobra.Command, args []string) {
 			cmd.Help()
@@ -89,7 +122,9 @@ dependencies, services it provides, and the contents.
 		},
 	})
 
-	pakCmd.AddCommand(&cobra.Command{
+	var signingKey, cacheDir string
+	var offline, updateLockfile bool
+	buildCmd := &cobra.Command{
 		Use:   "build [path/to/pack/directory]",
 		Short: "bundle up the service definition files and Terraform resources into a brokerpak",
 		Args:  cobra.MaximumNArgs(1),
@@ -99,7 +134,12 @@ dependencies, services it provides, and the contents.
 				directory = args[0]
 			}
 
-			pakPath, err := brokerpak.Pack(directory)
+			cache, err := brokerpak.NewArtifactCache(cacheDir, offline)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			pakPath, err := brokerpak.Pack(directory, cache)
 			if err != nil {
 				log.Fatalf("error while packing %q: %v", directory, err)
 			}
@@ -109,6 +149,88 @@ dependencies, services it provides, and the contents.
 			} else {
 				fmt.Printf("created: %v\n", pakPath)
 			}
+
+			if updateLockfile {
+				if err := brokerpak.UpdateLockfile(pakPath, directory); err != nil {
+					log.Fatalf("error updating the lockfile: %v", err)
+				}
+
+				fmt.Println("updated: brokerpak.lock")
+			}
+
+			if signingKey != "" {
+				sigPath, err := brokerpak.Sign(pakPath, signingKey)
+				if err != nil {
+					log.Fatalf("error signing %q: %v", pakPath, err)
+				}
+
+				fmt.Printf("signed: %v\n", sigPath)
+			}
+		},
+	}
+	buildCmd.Flags().StringVar(&signingKey, "signing-key", "", "sign the brokerpak with the private key at this path")
+	buildCmd.Flags().StringVar(&cacheDir, "cache-dir", "", "cache downloaded artifacts in this directory")
+	buildCmd.Flags().BoolVar(&offline, "offline", false, "fail rather than download artifacts that aren't in the cache")
+	buildCmd.Flags().BoolVar(&updateLockfile, "update-lockfile", false, "write the brokerpak's lockfile next to the manifest so later builds verify artifacts against it")
+	pakCmd.AddCommand(buildCmd)
+
+	vendorCmd := &cobra.Command{
+		Use:   "vendor [path/to/pack/directory]",
+		Short: "download the brokerpak's sources and Terraform resources into a cache for offline builds",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			directory := ""
+			if len(args) == 1 {
+				directory = args[0]
+			}
+
+			cache, err := brokerpak.NewArtifactCache(cacheDir, false)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if err := brokerpak.Vendor(directory, cache); err != nil {
+				log.Fatalf("error vendoring %q: %v", directory, err)
+			}
+
+			fmt.Printf("vendored: %v\n", cacheDir)
+		},
+	}
+	vendorCmd.Flags().StringVar(&cacheDir, "cache-dir", "", "the directory to download artifacts into")
+	vendorCmd.MarkFlagRequired("cache-dir")
+	pakCmd.AddCommand(vendorCmd)
+
+	pakCmd.AddCommand(&cobra.Command{
+		Use:   "keygen [path/to/signing.key]",
+		Short: "generate a key pair for signing brokerpaks",
+		Long: `Generates an ed25519 key pair for signing brokerpaks.
+
+The private key is written to the given path and MUST be kept secret.
+The public key is written next to it with a .pub extension, operators add it
+to brokerpak.trusted_keys so the broker will load brokerpaks signed with the
+private key.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			pubPath, err := brokerpak.GenerateSigningKey(args[0])
+			if err != nil {
+				log.Fatalf("error generating key: %v", err)
+			}
+
+			fmt.Printf("created: %v, %v\n", args[0], pubPath)
+		},
+	})
+
+	pakCmd.AddCommand(&cobra.Command{
+		Use:   "sign [pack.brokerpak] [path/to/signing.key]",
+		Short: "create a detached signature for a brokerpak",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			sigPath, err := brokerpak.Sign(args[0], args[1])
+			if err != nil {
+				log.Fatalf("error signing %q: %v", args[0], err)
+			}
+
+			fmt.Printf("signed: %v\n", sigPath)
 		},
 	})
 
@@ -123,6 +245,60 @@ dependencies, services it provides, and the contents.
 		},
 	})
 
+	pakCmd.AddCommand(&cobra.Command{
+		Use:   "diff [old.brokerpak] [new.brokerpak]",
+		Short: "show the changes between two versions of a brokerpak",
+		Long: `Lists the changes between two versions of a brokerpak, including services,
+plans, user inputs, outputs, Terraform binaries and templates.
+
+Changes that could break existing instances, bindings or users, like removing
+a plan or changing its ID, are marked BREAKING. If there are any the command
+exits with status 2 so it can gate releases in CI. Other errors exit with
+status 1.`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			breaking, err := brokerpak.Diff(args[0], args[1], os.Stdout)
+			if err != nil {
+				log.Fatalf("error comparing %q and %q: %v", args[0], args[1], err)
+			}
+
+			if breaking {
+				log.Println("found breaking changes")
+				os.Exit(2)
+			}
+		},
+	})
+
+	pakCmd.AddCommand(&cobra.Command{
+		Use:   "lint [pack.brokerpak...]",
+		Short: "check brokerpaks for problems validation can't find",
+		Long: `Checks brokerpaks that will be loaded together for problems that validation
+can't find: service and plan IDs duplicated across brokerpaks, examples that
+use plans that don't exist, enums and defaults that don't match their type or
+constraints and templates that reference undefined variables.
+
+Errors are problems that will stop a brokerpak from loading or its services
+from working, if there are any the command exits with status 1. Warnings are
+printed but don't change the exit status.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			result, err := brokerpak.Lint(args...)
+			if err != nil {
+				log.Fatalf("error linting brokerpaks: %v", err)
+			}
+
+			if result.Warnings != nil {
+				log.Printf("Warnings:\n%v\n", result.Warnings)
+			}
+
+			if result.Errors != nil {
+				log.Fatalf("Errors:\n%v\n", result.Errors)
+			}
+
+			log.Println("No errors found")
+		},
+	})
+
 	pakCmd.AddCommand(&cobra.Command{
 		Use:   "validate [pack.brokerpak]",
 		Short: "validate a brokerpak",
@@ -136,18 +312,19 @@ dependencies, services it provides, and the contents.
 		},
 	})
 
-	pakCmd.AddCommand(&cobra.Command{
+	exampleFlags := &exampleRunFlags{}
+	runExamplesCmd := &cobra.Command{
 		Use:   "run-examples [pack.brokerpak]",
 		Short: "run the examples from a brokerpak",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := brokerpak.RunExamples(args[0]); err != nil {
-				log.Fatalf("Error executing examples: %v", err)
-			}
-
-			log.Println("Success")
+			exampleFlags.run(func(ctx context.Context, opts client.ExampleRunOptions) (*client.ExampleReport, error) {
+				return brokerpak.RunExamples(ctx, args[0], opts)
+			})
 		},
-	})
+	}
+	exampleFlags.register(runExamplesCmd)
+	pakCmd.AddCommand(runExamplesCmd)
 
 	pakCmd.AddCommand(&cobra.Command{
 		Use:     "docs [pack.brokerpak]",
@@ -159,34 +336,79 @@ dependencies, services it provides, and the contents.
 		},
 	})
 
-	pakCmd.AddCommand(&cobra.Command{
-		Use:   "test",
-		Short: "Run an integration test for the workflow",
-		Args:  cobra.NoArgs,
-		Run: func(cmd *cobra.Command, args []string) {
-			// Runs a quick and dirty e2e test for the development pattern
-			td, err := ioutil.TempDir("", "test-brokerpak")
-			if err != nil {
-				log.Fatalf("couldn't initialize temp directory: %v", err)
-			}
-			defer os.RemoveAll(td)
+	var fixturesPath string
+	testCmd := &cobra.Command{
+		Use:   "test [pack.brokerpak]",
+		Short: "run the examples in a brokerpak offline",
+		Long: `Provisions, binds, unbinds and deprovisions every example in the brokerpak
+through the broker with an in-memory database and a fake Terraform, so no
+resources are created and no credentials are needed.
+
+The fake Terraform writes a stubbed value for each output unless the fixtures
+file sets one, for example recorded from a real run. Each step must succeed,
+the Terraform inputs must match the fixtures and the binding credentials must
+match the service's output schema.
+
+Fixtures are JSON objects keyed by "service-name/example-name":
+
+	{
+	  "my-service/basic": {
+	    "provision": {
+	      "outputs": {"bucket_name": "my-bucket"},
+	      "inputs": {"location": "US"}
+	    },
+	    "bind": {
+	      "inputs": {"bucket": "my-bucket"}
+	    }
+	  }
+	}
 
-			if err := brokerpak.Init(td); err != nil {
-				log.Fatalf("couldn't initialize brokerpak: %v", err)
+If no brokerpak is given, a new one is initialized, built and tested to check
+the development workflow.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var fixtures map[string]paktest.Fixture
+			if fixturesPath != "" {
+				var err error
+				if fixtures, err = paktest.ReadFixtures(fixturesPath); err != nil {
+					log.Fatal(err)
+				}
 			}
 
-			// Edit the manifest to point to our local server
-			packname, err := brokerpak.Pack(td)
-			defer os.Remove(packname)
-			if err != nil {
-				log.Fatalf("couldn't pack brokerpak: %v", err)
+			packname := ""
+			if len(args) == 1 {
+				packname = args[0]
+			} else {
+				// Runs a quick and dirty e2e test for the development pattern
+				td, err := ioutil.TempDir("", "test-brokerpak")
+				if err != nil {
+					log.Fatalf("couldn't initialize temp directory: %v", err)
+				}
+				defer os.RemoveAll(td)
+
+				if err := brokerpak.Init(td); err != nil {
+					log.Fatalf("couldn't initialize brokerpak: %v", err)
+				}
+
+				packname, err = brokerpak.Pack(td, nil)
+				defer os.Remove(packname)
+				if err != nil {
+					log.Fatalf("couldn't pack brokerpak: %v", err)
+				}
+
+				if err := brokerpak.Validate(packname); err != nil {
+					log.Fatalf("couldn't validate brokerpak: %v", err)
+				}
 			}
 
-			if err := brokerpak.Validate(packname); err != nil {
-				log.Fatalf("couldn't validate brokerpak: %v", err)
+			if err := paktest.Run(packname, fixtures, os.Stdout); err != nil {
+				log.Fatalf("error testing %q: %v", packname, err)
 			}
 
 			log.Println("success!")
 		},
-	})
+	}
+
+	testCmd.Flags().StringVar(&fixturesPath, "fixtures", "", "JSON file with the Terraform outputs to use and inputs to expect for each example")
+	pakCmd.AddCommand(testCmd)
 }
@@ -18,18 +18,25 @@ import (
 	"context"
 	"database/sql"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"code.cloudfoundry.org/lager"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/brokerapi/brokers"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/brokerpak"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/naming"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/builtin"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/server"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/toggles"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/utils"
 	"github.com/gorilla/mux"
 	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/middlewares/originating_identity_header"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -38,6 +45,8 @@ const (
 	apiUserProp     = "api.user"
 	apiPasswordProp = "api.password"
 	apiPortProp     = "api.port"
+
+	apiShutdownTimeoutProp = "api.shutdown_timeout"
 )
 
 var cfCompatibilityToggle = toggles.Features.Toggle("enable-cf-sharing", false, `Set all services to have the Sharable flag so they can be shared
@@ -65,22 +74,41 @@ func init() {
 	viper.BindEnv(apiUserProp, "SECURITY_USER_NAME")
 	viper.BindEnv(apiPasswordProp, "SECURITY_USER_PASSWORD")
 	viper.BindEnv(apiPortProp, "PORT")
+	viper.SetDefault(apiShutdownTimeoutProp, 30*time.Second)
 }
 
 func serve() {
 	logger := utils.NewLogger("gcp-service-broker")
 	db := db_service.New(logger)
+	naming.SetTakenFunc(func(name, instanceId string) (bool, error) {
+		return db_service.ExistsServiceInstanceDetailsByNameExcludingId(context.Background(), name, instanceId)
+	})
+
+	if err := tf.RecoverInterruptedJobs(context.Background(), logger); err != nil {
+		logger.Error("recovering interrupted Terraform jobs", err)
+	}
 
 	// init broker
 	cfg, err := brokers.NewBrokerConfigFromEnv()
 	if err != nil {
 		logger.Fatal("Error initializing service broker config: %s", err)
 	}
-	var serviceBroker brokerapi.ServiceBroker
-	serviceBroker, err = brokers.New(cfg, logger)
+	cfg.CleanupTimeout = viper.GetDuration(apiShutdownTimeoutProp)
+	gcpBroker, err := brokers.New(cfg, logger)
 	if err != nil {
 		logger.Fatal("Error initializing service broker: %s", err)
 	}
+	var serviceBroker brokerapi.ServiceBroker = gcpBroker
+
+	stopWatching, err := brokerpak.WatchBuiltin(logger, func() {
+		if err := gcpBroker.Reload(context.Background()); err != nil {
+			logger.Error("reloading brokerpaks", err)
+		}
+	})
+	if err != nil {
+		logger.Fatal("Error watching brokerpaks", err)
+	}
+	defer stopWatching()
 
 	credentials := brokerapi.BrokerCredentials{
 		Username: viper.GetString(apiUserProp),
@@ -92,29 +120,51 @@ func serve() {
 		serviceBroker = server.NewCfSharingWrapper(serviceBroker)
 	}
 
+	serviceBroker = server.NewInstanceLockWrapper(serviceBroker)
+
+	rateLimits := server.NewRateLimitConfigFromEnv()
+	if err := rateLimits.Validate(); err != nil {
+		logger.Fatal("Invalid rate limit configuration", err)
+	}
+
 	services, err := serviceBroker.Services(context.Background())
 	if err != nil {
 		logger.Error("creating service catalog", err)
 	}
 	logger.Info("service catalog", lager.Data{"catalog": services})
 
-	brokerAPI := brokerapi.New(serviceBroker, logger, credentials)
+	brokerAPI := mux.NewRouter()
+	brokerapi.AttachRoutes(brokerAPI, serviceBroker, logger)
+	brokerAPI.Use(server.NewAuthMiddleware(credentials))
+	if rateLimits.Enabled() {
+		logger.Info("Enabling rate limits", lager.Data{"default": rateLimits.Default, "endpoints": rateLimits.Endpoints})
+		brokerAPI.Use(server.NewRateLimitMiddleware(rateLimits))
+	}
+	brokerAPI.Use(originating_identity_header.AddToContext)
+
+	adminAPI := server.NewAuthMiddleware(credentials)(server.NewAdminHandler(gcpBroker, cfg.ProjectId, cfg.HttpConfig, logger))
 
-	startServer(cfg.Registry, db.DB(), brokerAPI)
+	startServer(gcpBroker.Registry, db.DB(), brokerAPI, adminAPI)
 }
 
 func serveDocs() {
 	logger := utils.NewLogger("gcp-service-broker")
 	// init broker
 	registry := builtin.BuiltinBrokerRegistry()
-	if err := brokerpak.RegisterAll(registry); err != nil {
+	cleanup, err := brokerpak.RegisterAll(registry)
+	if err != nil {
 		logger.Error("loading brokerpaks", err)
+	} else {
+		defer cleanup()
 	}
 
-	startServer(registry, nil, nil)
+	startServer(func() broker.BrokerRegistry { return registry }, nil, nil, nil)
 }
 
-func startServer(registry broker.BrokerRegistry, db *sql.DB, brokerapi http.Handler) {
+// startServer serves the APIs along with the docs and examples for the
+// registry returned by getRegistry, which is called for each request so they
+// stay up to date when brokerpaks are reloaded.
+func startServer(getRegistry func() broker.BrokerRegistry, db *sql.DB, brokerapi, adminAPI http.Handler) {
 	logger := utils.NewLogger("gcp-service-broker")
 
 	router := mux.NewRouter()
@@ -124,11 +174,74 @@ func startServer(registry broker.BrokerRegistry, db *sql.DB, brokerapi http.Hand
 		router.PathPrefix("/v2").Handler(brokerapi)
 	}
 
-	server.AddDocsHandler(router, registry)
-	router.HandleFunc("/examples", server.NewExampleHandler(registry))
+	if adminAPI != nil {
+		router.PathPrefix("/admin").Handler(adminAPI)
+	}
+
+	server.AddDocsHandler(router, getRegistry)
+	router.HandleFunc("/examples", server.NewExampleHandler(getRegistry))
 	server.AddHealthHandler(router, db)
 
 	port := viper.GetString(apiPortProp)
-	logger.Info("Serving", lager.Data{"port": port})
-	http.ListenAndServe(":"+port, router)
+	httpServer := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
+	}
+
+	tlsConfig := server.NewTLSConfigFromEnv()
+	if err := tlsConfig.Validate(); err != nil {
+		logger.Fatal("Invalid TLS configuration", err)
+	}
+
+	serveErrors := make(chan error, 1)
+	if !tlsConfig.Enabled() {
+		logger.Info("Serving", lager.Data{"port": port})
+		go func() { serveErrors <- httpServer.ListenAndServe() }()
+	} else {
+		serverTLS, err := tlsConfig.ServerConfig()
+		if err != nil {
+			logger.Fatal("Invalid TLS configuration", err)
+		}
+		httpServer.TLSConfig = serverTLS
+
+		logger.Info("Serving TLS", lager.Data{
+			"port":                  port,
+			"min-version":           tlsConfig.MinVersion,
+			"verifies-client-certs": tlsConfig.VerifiesClients(),
+		})
+
+		// The certificate is already loaded into the TLSConfig so no files are passed.
+		go func() { serveErrors <- httpServer.ListenAndServeTLS("", "") }()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serveErrors:
+		logger.Fatal("Serving", err)
+	case sig := <-signals:
+		shutdown(logger, httpServer, sig)
+	}
+}
+
+// shutdown stops the server from accepting new requests then waits for
+// in-flight requests and background Terraform jobs to finish, up to the
+// configured timeout.
+func shutdown(logger lager.Logger, httpServer *http.Server, sig os.Signal) {
+	timeout := viper.GetDuration(apiShutdownTimeoutProp)
+	logger.Info("Shutting down", lager.Data{"signal": sig.String(), "timeout": timeout.String()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := httpServer.Shutdown(ctx); err != nil {
+		logger.Error("draining HTTP requests", err)
+	}
+
+	if err := tf.WaitForJobs(ctx, logger); err != nil {
+		logger.Error("draining Terraform jobs", err)
+	}
+
+	logger.Info("Shutdown complete")
 }
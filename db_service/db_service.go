@@ -17,10 +17,12 @@
 package db_service
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
 	"code.cloudfoundry.org/lager"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service/models"
 	"github.com/jinzhu/gorm"
 
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
@@ -50,3 +52,117 @@ func defaultDatastore() *SqlDatastore {
 type SqlDatastore struct {
 	db *gorm.DB
 }
+
+// ListTerraformDeploymentsByState gets all Terraform deployments whose last
+// operation is in the given state.
+func ListTerraformDeploymentsByState(ctx context.Context, state string) ([]models.TerraformDeployment, error) {
+	return defaultDatastore().ListTerraformDeploymentsByState(ctx, state)
+}
+func (ds *SqlDatastore) ListTerraformDeploymentsByState(ctx context.Context, state string) ([]models.TerraformDeployment, error) {
+	var records []models.TerraformDeployment
+	if err := ds.db.Where("last_operation_state = ?", state).Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// UpdateTerraformDeploymentMessage sets the LastOperationMessage of the
+// Terraform deployment only if its last operation is still in the given
+// state. Only the message column is written so a job that finishes
+// concurrently can't have its results overwritten. It returns true if the
+// deployment was updated.
+func UpdateTerraformDeploymentMessage(ctx context.Context, id, state, message string) (bool, error) {
+	return defaultDatastore().UpdateTerraformDeploymentMessage(ctx, id, state, message)
+}
+func (ds *SqlDatastore) UpdateTerraformDeploymentMessage(ctx context.Context, id, state, message string) (bool, error) {
+	result := ds.db.Model(&models.TerraformDeployment{}).
+		Where("id = ? AND last_operation_state = ?", id, state).
+		UpdateColumn("last_operation_message", message)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// ListServiceInstanceDetails gets all service instances.
+func ListServiceInstanceDetails(ctx context.Context) ([]models.ServiceInstanceDetails, error) {
+	return defaultDatastore().ListServiceInstanceDetails(ctx)
+}
+func (ds *SqlDatastore) ListServiceInstanceDetails(ctx context.Context) ([]models.ServiceInstanceDetails, error) {
+	var records []models.ServiceInstanceDetails
+	if err := ds.db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// ExistsServiceInstanceDetailsByNameExcludingId checks whether a service
+// instance other than the one with the given ID has the name.
+func ExistsServiceInstanceDetailsByNameExcludingId(ctx context.Context, name, id string) (bool, error) {
+	return defaultDatastore().ExistsServiceInstanceDetailsByNameExcludingId(ctx, name, id)
+}
+func (ds *SqlDatastore) ExistsServiceInstanceDetailsByNameExcludingId(ctx context.Context, name, id string) (bool, error) {
+	var count int
+	if err := ds.db.Model(&models.ServiceInstanceDetails{}).Where("name = ? AND id <> ?", name, id).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// ListServiceBindingCredentials gets all service bindings.
+func ListServiceBindingCredentials(ctx context.Context) ([]models.ServiceBindingCredentials, error) {
+	return defaultDatastore().ListServiceBindingCredentials(ctx)
+}
+func (ds *SqlDatastore) ListServiceBindingCredentials(ctx context.Context) ([]models.ServiceBindingCredentials, error) {
+	var records []models.ServiceBindingCredentials
+	if err := ds.db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// ListServiceBindingCredentialsByServiceInstanceId gets all bindings for the
+// given service instance.
+func ListServiceBindingCredentialsByServiceInstanceId(ctx context.Context, serviceInstanceId string) ([]models.ServiceBindingCredentials, error) {
+	return defaultDatastore().ListServiceBindingCredentialsByServiceInstanceId(ctx, serviceInstanceId)
+}
+func (ds *SqlDatastore) ListServiceBindingCredentialsByServiceInstanceId(ctx context.Context, serviceInstanceId string) ([]models.ServiceBindingCredentials, error) {
+	var records []models.ServiceBindingCredentials
+	if err := ds.db.Where("service_instance_id = ?", serviceInstanceId).Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// GetProvisionRequestDetailsByServiceInstanceId gets the parameters of the
+// latest provision request for the given service instance.
+func GetProvisionRequestDetailsByServiceInstanceId(ctx context.Context, serviceInstanceId string) (*models.ProvisionRequestDetails, error) {
+	return defaultDatastore().GetProvisionRequestDetailsByServiceInstanceId(ctx, serviceInstanceId)
+}
+func (ds *SqlDatastore) GetProvisionRequestDetailsByServiceInstanceId(ctx context.Context, serviceInstanceId string) (*models.ProvisionRequestDetails, error) {
+	record := models.ProvisionRequestDetails{}
+	if err := ds.db.Where("service_instance_id = ?", serviceInstanceId).Order("id desc").First(&record).Error; err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// ListTerraformDeployments gets all Terraform deployments.
+func ListTerraformDeployments(ctx context.Context) ([]models.TerraformDeployment, error) {
+	return defaultDatastore().ListTerraformDeployments(ctx)
+}
+func (ds *SqlDatastore) ListTerraformDeployments(ctx context.Context) ([]models.TerraformDeployment, error) {
+	var records []models.TerraformDeployment
+	if err := ds.db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
@@ -0,0 +1,236 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db_service
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service/models"
+)
+
+func TestSqlDatastore_ListTerraformDeploymentsByState(t *testing.T) {
+	ds := newInMemoryDatastore(t)
+	ctx := context.Background()
+
+	deployments := map[string]string{
+		"tf:a:": "in progress",
+		"tf:b:": "succeeded",
+		"tf:c:": "in progress",
+		"tf:d:": "failed",
+	}
+
+	for id, state := range deployments {
+		if err := ds.CreateTerraformDeployment(ctx, &models.TerraformDeployment{ID: id, LastOperationState: state}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := map[string][]string{
+		"in progress": {"tf:a:", "tf:c:"},
+		"failed":      {"tf:d:"},
+		"unknown":     nil,
+	}
+
+	for state, expected := range cases {
+		t.Run(state, func(t *testing.T) {
+			results, err := ds.ListTerraformDeploymentsByState(ctx, state)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var actual []string
+			for _, result := range results {
+				actual = append(actual, result.ID)
+			}
+			sort.Strings(actual)
+
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("Expected deployments: %v got: %v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestSqlDatastore_UpdateTerraformDeploymentMessage(t *testing.T) {
+	ds := newInMemoryDatastore(t)
+	ctx := context.Background()
+
+	deployments := []models.TerraformDeployment{
+		{ID: "tf:running:", LastOperationState: "in progress", Workspace: "old"},
+		{ID: "tf:finished:", LastOperationState: "succeeded", Workspace: "new", LastOperationMessage: "done"},
+	}
+
+	for i := range deployments {
+		if err := ds.CreateTerraformDeployment(ctx, &deployments[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := map[string]struct {
+		Updated         bool
+		ExpectedMessage string
+	}{
+		"tf:running:":  {Updated: true, ExpectedMessage: "interrupted"},
+		"tf:finished:": {Updated: false, ExpectedMessage: "done"},
+	}
+
+	for id, tc := range cases {
+		t.Run(id, func(t *testing.T) {
+			updated, err := ds.UpdateTerraformDeploymentMessage(ctx, id, "in progress", "interrupted")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if updated != tc.Updated {
+				t.Errorf("Expected updated to be %t, got %t", tc.Updated, updated)
+			}
+
+			actual, err := ds.GetTerraformDeploymentById(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if actual.LastOperationMessage != tc.ExpectedMessage {
+				t.Errorf("Expected message %q, got %q", tc.ExpectedMessage, actual.LastOperationMessage)
+			}
+
+			if actual.Workspace == "" {
+				t.Error("Expected the workspace to be left alone")
+			}
+		})
+	}
+}
+
+func TestSqlDatastore_ListServiceBindingCredentialsByServiceInstanceId(t *testing.T) {
+	ds := newInMemoryDatastore(t)
+	ctx := context.Background()
+
+	bindings := []models.ServiceBindingCredentials{
+		{ServiceInstanceId: "instance-a", BindingId: "binding-1"},
+		{ServiceInstanceId: "instance-b", BindingId: "binding-2"},
+		{ServiceInstanceId: "instance-a", BindingId: "binding-3"},
+	}
+
+	for i := range bindings {
+		if err := ds.CreateServiceBindingCredentials(ctx, &bindings[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := ds.ListServiceBindingCredentials(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Errorf("Expected 3 bindings, got: %d", len(all))
+	}
+
+	cases := map[string][]string{
+		"instance-a": {"binding-1", "binding-3"},
+		"instance-b": {"binding-2"},
+		"instance-c": nil,
+	}
+
+	for instanceId, expected := range cases {
+		t.Run(instanceId, func(t *testing.T) {
+			results, err := ds.ListServiceBindingCredentialsByServiceInstanceId(ctx, instanceId)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var actual []string
+			for _, result := range results {
+				actual = append(actual, result.BindingId)
+			}
+			sort.Strings(actual)
+
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("Expected bindings: %v got: %v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestSqlDatastore_GetProvisionRequestDetailsByServiceInstanceId(t *testing.T) {
+	ds := newInMemoryDatastore(t)
+	ctx := context.Background()
+
+	requests := []models.ProvisionRequestDetails{
+		{ServiceInstanceId: "instance-a", RequestDetails: `{"name":"first"}`},
+		{ServiceInstanceId: "instance-b", RequestDetails: `{"name":"other"}`},
+		{ServiceInstanceId: "instance-a", RequestDetails: `{"name":"latest"}`},
+	}
+
+	for i := range requests {
+		if err := ds.CreateProvisionRequestDetails(ctx, &requests[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	actual, err := ds.GetProvisionRequestDetailsByServiceInstanceId(ctx, "instance-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual.RequestDetails != `{"name":"latest"}` {
+		t.Errorf("Expected the latest request, got %q", actual.RequestDetails)
+	}
+
+	if _, err := ds.GetProvisionRequestDetailsByServiceInstanceId(ctx, "missing"); err == nil {
+		t.Error("Expected an error for a missing instance")
+	}
+}
+
+func TestSqlDatastore_ExistsServiceInstanceDetailsByNameExcludingId(t *testing.T) {
+	ds := newInMemoryDatastore(t)
+	ctx := context.Background()
+
+	instances := []models.ServiceInstanceDetails{
+		{ID: "instance-a", Name: "name-a"},
+		{ID: "instance-b", Name: "name-b"},
+	}
+
+	for i := range instances {
+		if err := ds.CreateServiceInstanceDetails(ctx, &instances[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := map[string]struct {
+		Name     string
+		Id       string
+		Expected bool
+	}{
+		"used by other":  {Name: "name-a", Id: "instance-b", Expected: true},
+		"used by itself": {Name: "name-a", Id: "instance-a", Expected: false},
+		"unused":         {Name: "name-c", Id: "instance-c", Expected: false},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			actual, err := ds.ExistsServiceInstanceDetailsByNameExcludingId(ctx, tc.Name, tc.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if actual != tc.Expected {
+				t.Errorf("Expected exists? %t got: %t", tc.Expected, actual)
+			}
+		})
+	}
+}
@@ -26,6 +26,7 @@ const (
 	ProvisionOperationType   = "provision"
 	DeprovisionOperationType = "deprovision"
 	UpdateOperationType      = "update"
+	UpgradeOperationType     = "upgrade"
 	ClearOperationType       = ""
 )
 
@@ -20,5 +20,6 @@ go build -mod=mod -o gcp-service-broker
 ./gcp-service-broker generate tile > tile.yml
 ./gcp-service-broker generate manifest > manifest.yml
 ./gcp-service-broker generate customization > docs/customization.md
+./gcp-service-broker generate functions > docs/expression-functions.md
 ./gcp-service-broker generate use --destination-dir="docs/"
 ./gcp-service-broker generate use > docs/use.md
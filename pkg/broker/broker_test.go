@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"testing"
 	"os"
 
@@ -255,6 +256,40 @@ func TestServiceDefinition_CatalogEntry(t *testing.T) {
 	}
 }
 
+func TestServiceDefinition_CatalogEntry_maintenanceInfo(t *testing.T) {
+	info := &brokerapi.MaintenanceInfo{Public: map[string]string{"version": "1.0.0"}}
+	service := ServiceDefinition{
+		Id:              "00000000-0000-0000-0000-000000000000",
+		Name:            "left-handed-smoke-sifter",
+		Plans:           []ServicePlan{{ServicePlan: brokerapi.ServicePlan{ID: "builtin-plan", Name: "Builtin!"}}},
+		MaintenanceInfo: info,
+	}
+
+	cases := map[string]struct {
+		Enabled  bool
+		Expected *brokerapi.MaintenanceInfo
+	}{
+		"disabled": {Enabled: false, Expected: nil},
+		"enabled":  {Enabled: true, Expected: info},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			viper.Set("compatibility.enable-maintenance-info", tc.Enabled)
+			defer viper.Reset()
+
+			srvc, err := service.CatalogEntry()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if actual := srvc.Plans[0].MaintenanceInfo; !reflect.DeepEqual(actual, tc.Expected) {
+				t.Errorf("Expected maintenance info %v, got %v", tc.Expected, actual)
+			}
+		})
+	}
+}
+
 func ExampleServiceDefinition_CatalogEntry() {
 	service := ServiceDefinition{
 		Id:   "00000000-0000-0000-0000-000000000000",
@@ -286,7 +321,7 @@ func ExampleServiceDefinition_CatalogEntry() {
 		panic(err)
 	}
 
-	eq := reflect.DeepEqual(srvc.ToPlain().Plans[0].Schemas, service.createSchemas())
+	eq := reflect.DeepEqual(srvc.ToPlain().Plans[0].Schemas, service.createSchemas(srvc.Plans[0]))
 
 	fmt.Println("schema was generated?", eq)
 
@@ -414,10 +449,24 @@ func TestServiceDefinition_ProvisionVariables(t *testing.T) {
 				"maybe-missing": "default",
 			},
 		},
+		"operator defaults resolve secret references": {
+			UserParams:        "",
+			DefaultOverride:   `{"location":{"$ref":"env://BROKER_TEST_LOCATION"}}`,
+			ServiceProperties: map[string]string{},
+			ExpectedContext: map[string]interface{}{
+				"location":      "ca",
+				"name":          "name-ca",
+				"maybe-missing": "default",
+			},
+		},
 		"invalid-request": {
 			UserParams:    `{"name":"some-name-that-is-longer-than-thirty-characters"}`,
 			ExpectedError: errors.New("1 error(s) occurred: name: String length must be less than or equal to 30"),
 		},
+		"invalid computed value": {
+			UserParams:    `{"location":"abcdefghijklmnopqrstuvwxyz"}`,
+			ExpectedError: errors.New(`1 error(s) occurred: name: String length must be less than or equal to 30 (computed from template "name-${location}")`),
+		},
 		"provision_overrides override user params but not computed defaults": {
 			UserParams:         `{"location":"us"}`,
 			DefaultOverride:    "{}",
@@ -431,6 +480,9 @@ func TestServiceDefinition_ProvisionVariables(t *testing.T) {
 		},
 	}
 
+	os.Setenv("BROKER_TEST_LOCATION", "ca")
+	defer os.Unsetenv("BROKER_TEST_LOCATION")
+
 	for tn, tc := range cases {
 		t.Run(tn, func(t *testing.T) {
 			viper.Set(service.ProvisionDefaultOverrideProperty(), tc.DefaultOverride)
@@ -449,6 +501,128 @@ func TestServiceDefinition_ProvisionVariables(t *testing.T) {
 	}
 }
 
+func TestServiceDefinition_UpdateVariables(t *testing.T) {
+	service := ServiceDefinition{
+		Id:   "00000000-0000-0000-0000-000000000000",
+		Name: "left-handed-smoke-sifter",
+		ProvisionInputVariables: []BrokerVariable{
+			{FieldName: "location", Type: JsonTypeString, Required: true},
+			{FieldName: "size", Type: JsonTypeInteger, Default: 1, Updatable: true},
+		},
+	}
+	instance := models.ServiceInstanceDetails{ID: "instance-id"}
+
+	cases := map[string]struct {
+		UpdateParams    string
+		ExpectedErr     string
+		ExpectedContext map[string]interface{}
+		ExpectedParams  string
+	}{
+		"updatable": {
+			UpdateParams:    `{"size": 3}`,
+			ExpectedContext: map[string]interface{}{"location": "us", "size": float64(3)},
+			ExpectedParams:  `{"location":"us","size":3}`,
+		},
+		"not updatable": {
+			UpdateParams: `{"location": "eu", "size": 3}`,
+			ExpectedErr:  "parameters that aren't updatable can't be changed: location",
+		},
+		"invalid": {
+			UpdateParams: `{"size": "large"}`,
+			ExpectedErr:  "1 error(s) occurred: size: Invalid type. Expected: integer, given: string",
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			details := brokerapi.UpdateDetails{RawParameters: json.RawMessage(tc.UpdateParams)}
+			vars, params, err := service.UpdateVariables(instance, json.RawMessage(`{"location":"us"}`), details, ServicePlan{})
+			if tc.ExpectedErr != "" {
+				if err == nil || err.Error() != tc.ExpectedErr {
+					t.Fatalf("Expected error %q, got: %v", tc.ExpectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(vars.ToMap(), tc.ExpectedContext) {
+				t.Errorf("Expected context %v, got %v", tc.ExpectedContext, vars.ToMap())
+			}
+
+			if string(params) != tc.ExpectedParams {
+				t.Errorf("Expected merged params %s, got %s", tc.ExpectedParams, params)
+			}
+		})
+	}
+}
+
+func TestServiceDefinition_ExplainProvision(t *testing.T) {
+	service := ServiceDefinition{
+		Id:   "00000000-0000-0000-0000-000000000000",
+		Name: "left-handed-smoke-sifter",
+		ProvisionInputVariables: []BrokerVariable{
+			{FieldName: "location", Type: JsonTypeString, Default: "us"},
+			{FieldName: "name", Type: JsonTypeString, Default: "name-${location}", Constraints: validation.NewConstraintBuilder().MaxLength(30).Build()},
+		},
+		ProvisionComputedVariables: []varcontext.DefaultVariable{
+			{Name: "location", Default: "${str.truncate(2, location)}", Overwrite: true},
+		},
+	}
+
+	plan := ServicePlan{
+		ServiceProperties:  map[string]string{"tier": "gold"},
+		ProvisionOverrides: map[string]interface{}{"location": "europe"},
+	}
+
+	t.Run("explains final values", func(t *testing.T) {
+		details := brokerapi.ProvisionDetails{RawParameters: json.RawMessage(`{"location": "asia", "name": "my-name"}`)}
+		vc, trace, err := service.ExplainProvision("instance-id-here", details, plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected, err := service.ProvisionVariables("instance-id-here", details, plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(vc.ToMap(), expected.ToMap()) {
+			t.Errorf("Expected the same context as ProvisionVariables %v, got %v", expected.ToMap(), vc.ToMap())
+		}
+
+		expectedLayers := map[string]string{
+			"location": "computed inputs",
+			"name":     "user parameters",
+			"tier":     "plan properties",
+		}
+
+		for key, layer := range expectedLayers {
+			if entry, ok := trace.SetBy(key); !ok || entry.Layer != layer {
+				t.Errorf("Expected %q to be set by %q, got: %#v", key, layer, entry)
+			}
+		}
+
+		if locations := trace.ForKey("location"); len(locations) != 4 {
+			t.Errorf("Expected location to be set by the user, plan, skipped default and computed input, got: %#v", locations)
+		}
+	})
+
+	t.Run("explains failures", func(t *testing.T) {
+		details := brokerapi.ProvisionDetails{RawParameters: json.RawMessage(`{"name": "some-name-that-is-longer-than-thirty-characters"}`)}
+		_, trace, err := service.ExplainProvision("instance-id-here", details, plan)
+		if err == nil {
+			t.Fatal("Expected an error")
+		}
+
+		if entry, ok := trace.SetBy("name"); !ok || entry.Layer != "user parameters" {
+			t.Errorf("Expected the invalid name to be traced to the user, got: %#v", entry)
+		}
+	})
+}
+
 func TestServiceDefinition_BindVariables(t *testing.T) {
 	service := ServiceDefinition{
 		Id:   "00000000-0000-0000-0000-000000000000",
@@ -616,10 +790,101 @@ func TestServiceDefinition_BindVariables(t *testing.T) {
 	}
 }
 
+func TestServiceDefinition_DashboardUrl(t *testing.T) {
+	instance := models.ServiceInstanceDetails{
+		ID:           "instance-id",
+		Name:         "my-bucket",
+		Location:     "us-central1",
+		PlanId:       "plan-id",
+		ServiceId:    "service-id",
+		OtherDetails: `{"console_path":"storage/browser"}`,
+	}
+
+	cases := map[string]struct {
+		Template    string
+		ExpectedUrl string
+		ExpectErr   bool
+	}{
+		"no template": {
+			Template:    "",
+			ExpectedUrl: "",
+		},
+		"static": {
+			Template:    "https://example.com/dashboard",
+			ExpectedUrl: "https://example.com/dashboard",
+		},
+		"instance fields": {
+			Template:    "https://example.com/${instance.location}/${instance.name}?id=${instance.id}&plan=${instance.plan_id}&service=${instance.service_id}",
+			ExpectedUrl: "https://example.com/us-central1/my-bucket?id=instance-id&plan=plan-id&service=service-id",
+		},
+		"details and project": {
+			Template:    `https://console.cloud.google.com/${instance.details["console_path"]}?project=${broker.project_id}`,
+			ExpectedUrl: "https://console.cloud.google.com/storage/browser?project=my-project",
+		},
+		"missing detail": {
+			Template:  `https://example.com/${instance.details["missing"]}`,
+			ExpectErr: true,
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			service := ServiceDefinition{Name: "dashboard-service", DashboardUrlTemplate: tc.Template}
+			url, err := service.DashboardUrl(instance, "my-project")
+
+			if (err != nil) != tc.ExpectErr {
+				t.Fatalf("Expected error? %t, got: %v", tc.ExpectErr, err)
+			}
+
+			if url != tc.ExpectedUrl {
+				t.Errorf("Expected url: %q got: %q", tc.ExpectedUrl, url)
+			}
+		})
+	}
+}
+
+func TestTemplateVariables(t *testing.T) {
+	cases := map[string]struct {
+		Constants map[string]interface{}
+		Expected  []string
+	}{
+		"provision": {
+			Constants: provisionConstants("instance-id", brokerapi.ProvisionDetails{}),
+			Expected:  ProvisionTemplateVariables,
+		},
+		"bind": {
+			Constants: bindConstants(models.ServiceInstanceDetails{}, nil, "binding-id", brokerapi.BindDetails{}, &ServicePlan{}),
+			Expected:  BindTemplateVariables,
+		},
+		"dashboard url": {
+			Constants: dashboardUrlConstants(models.ServiceInstanceDetails{}, nil, "my-project"),
+			Expected:  DashboardUrlTemplateVariables,
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			var actual []string
+			for k := range tc.Constants {
+				actual = append(actual, k)
+			}
+
+			sort.Strings(actual)
+			expected := append([]string{}, tc.Expected...)
+			sort.Strings(expected)
+
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("Expected template variables: %v got: %v", expected, actual)
+			}
+		})
+	}
+}
+
 func TestServiceDefinition_createSchemas(t *testing.T) {
 	service := ServiceDefinition{
-		Id:   "00000000-0000-0000-0000-000000000000",
-		Name: "left-handed-smoke-sifter",
+		Id:          "00000000-0000-0000-0000-000000000000",
+		Name:        "left-handed-smoke-sifter",
+		DisplayName: "Smoke Sifter",
 		Plans: []ServicePlan{
 			{ServicePlan: brokerapi.ServicePlan{ID: "builtin-plan", Name: "Builtin!"}},
 		},
@@ -629,39 +894,166 @@ func TestServiceDefinition_createSchemas(t *testing.T) {
 		BindInputVariables: []BrokerVariable{
 			{FieldName: "name", Type: JsonTypeString, Default: "name"},
 		},
+		Examples: []ServiceExample{
+			{Name: "basic", PlanId: "builtin-plan", BindParams: map[string]interface{}{"name": "x"}},
+			{Name: "no bind", PlanId: "builtin-plan", ProvisionParams: map[string]interface{}{"location": "eu"}},
+			{Name: "other plan", PlanId: "other-plan", ProvisionParams: map[string]interface{}{"location": "asia"}},
+			{Name: "invalid", PlanId: "builtin-plan", ProvisionParams: map[string]interface{}{"location": 42}, ExpectedProvisionError: "location"},
+		},
 	}
 
-	schemas := service.createSchemas()
+	schemas := service.createSchemas(service.Plans[0])
 	if schemas == nil {
 		t.Fatal("Schemas was nil, expected non-nil value")
 	}
 
-	// it populates the instance create schema with the fields in ProvisionInputVariables
-	instanceCreate := schemas.Instance.Create
-	if instanceCreate.Parameters == nil {
-		t.Error("instance create params were nil, expected a schema")
-	}
-
+	// it populates the instance create schema with the fields in
+	// ProvisionInputVariables and the examples for the plan that should work
 	expectedCreateParams := CreateJsonSchema(service.ProvisionInputVariables)
-	if !reflect.DeepEqual(instanceCreate.Parameters, expectedCreateParams) {
-		t.Errorf("expected create params to be: %v got %v", expectedCreateParams, instanceCreate.Parameters)
+	expectedCreateParams["title"] = "Create a Smoke Sifter instance"
+	expectedCreateParams["examples"] = []interface{}{
+		map[string]interface{}{},
+		map[string]interface{}{"location": "eu"},
+	}
+	if !reflect.DeepEqual(schemas.Instance.Create.Parameters, expectedCreateParams) {
+		t.Errorf("expected create params to be: %v got %v", expectedCreateParams, schemas.Instance.Create.Parameters)
 	}
 
-	// It leaves the instance update schema blank.
-	instanceUpdate := schemas.Instance.Update
-	if instanceUpdate.Parameters != nil {
+	// It leaves the instance update schema blank if nothing is updatable.
+	if schemas.Instance.Update.Parameters != nil {
 		t.Error("instance update params were not nil, expected nil")
 	}
 
-	// it populates the binding create schema with the fields in BindInputVariables.
-	bindCreate := schemas.Binding.Create
-	if bindCreate.Parameters == nil {
-		t.Error("bind create params were not nil, expected a schema")
+	// it populates the binding create schema with the fields in
+	// BindInputVariables and the examples that bind
+	expectedBindCreateParams := CreateJsonSchema(service.BindInputVariables)
+	expectedBindCreateParams["title"] = "Bind to a Smoke Sifter instance"
+	expectedBindCreateParams["examples"] = []interface{}{
+		map[string]interface{}{"name": "x"},
 	}
+	if !reflect.DeepEqual(schemas.Binding.Create.Parameters, expectedBindCreateParams) {
+		t.Errorf("expected bind params to be: %v got %v", expectedBindCreateParams, schemas.Binding.Create.Parameters)
+	}
+}
 
-	expectedBindCreateParams := CreateJsonSchema(service.BindInputVariables)
-	if !reflect.DeepEqual(bindCreate.Parameters, expectedBindCreateParams) {
-		t.Errorf("expected create params to be: %v got %v", expectedBindCreateParams, bindCreate.Parameters)
+func TestServiceDefinition_createSchemas_planConditions(t *testing.T) {
+	service := ServiceDefinition{
+		Id:   "00000000-0000-0000-0000-000000000000",
+		Name: "left-handed-smoke-sifter",
+		PlanVariables: []BrokerVariable{
+			{FieldName: "tier", Type: JsonTypeString, Required: true},
+		},
+		ProvisionInputVariables: []BrokerVariable{
+			{FieldName: "replica_count", Type: JsonTypeInteger, OnlyIf: map[string]interface{}{"tier": "HA"}},
+			{FieldName: "failover_zone", Type: JsonTypeString, RequiredIf: map[string]interface{}{"tier": "HA"}},
+		},
+	}
+
+	cases := map[string]struct {
+		Tier     string
+		Params   map[string]interface{}
+		Expected bool
+	}{
+		"ha with replicas":       {Tier: "HA", Params: map[string]interface{}{"replica_count": 2, "failover_zone": "b"}, Expected: true},
+		"ha missing required":    {Tier: "HA", Params: map[string]interface{}{"replica_count": 2}, Expected: false},
+		"basic without replicas": {Tier: "BASIC", Params: map[string]interface{}{}, Expected: true},
+		"basic with replicas":    {Tier: "BASIC", Params: map[string]interface{}{"replica_count": 2}, Expected: false},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			plan := ServicePlan{ServiceProperties: map[string]string{"tier": tc.Tier}}
+			schema := service.createSchemas(plan).Instance.Create.Parameters
+
+			err := ValidateVariablesAgainstSchema(tc.Params, schema)
+			if valid := err == nil; valid != tc.Expected {
+				t.Errorf("Expected valid? %t, got error: %v", tc.Expected, err)
+			}
+		})
+	}
+}
+
+func TestServiceDefinition_createSchemas_update(t *testing.T) {
+	service := ServiceDefinition{
+		Id:   "00000000-0000-0000-0000-000000000000",
+		Name: "left-handed-smoke-sifter",
+		ProvisionInputVariables: []BrokerVariable{
+			{FieldName: "location", Type: JsonTypeString, Required: true},
+			{FieldName: "size", Type: JsonTypeInteger, Required: true, Updatable: true},
+		},
+	}
+
+	expected := map[string]interface{}{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title":   "Update a left-handed-smoke-sifter instance",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"size": map[string]interface{}{"title": "Size", "type": JsonTypeInteger},
+		},
+	}
+
+	actual := service.createSchemas(ServicePlan{}).Instance.Update.Parameters
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected update params to be: %v got %v", expected, actual)
+	}
+}
+
+func TestServiceDefinition_BindingResponseSchema(t *testing.T) {
+	service := ServiceDefinition{
+		Id:          "00000000-0000-0000-0000-000000000000",
+		Name:        "left-handed-smoke-sifter",
+		DisplayName: "Smoke Sifter",
+		Bindable:    true,
+		Plans: []ServicePlan{
+			{ServicePlan: brokerapi.ServicePlan{ID: "builtin-plan", Name: "Builtin!"}},
+		},
+		BindOutputVariables: []BrokerVariable{
+			{FieldName: "uri", Type: JsonTypeString, Required: true},
+		},
+	}
+
+	expected := map[string]interface{}{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title":   "Smoke Sifter binding credentials",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"uri": map[string]interface{}{"title": "URI", "type": JsonTypeString, "readOnly": true},
+		},
+		"required": []string{"uri"},
+	}
+
+	if actual := service.BindingResponseSchema(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected response schema to be: %v got %v", expected, actual)
+	}
+
+	viper.Set("compatibility.enable-catalog-schemas", true)
+	defer viper.Reset()
+
+	entry, err := service.CatalogEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := entry.Metadata.AdditionalMetadata["bindingResponseSchema"]; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected the catalog to advertise the response schema %v got %v", expected, actual)
+	}
+}
+
+func TestServiceDefinition_Validate_updatable(t *testing.T) {
+	service := ServiceDefinition{
+		Id:   "00000000-0000-0000-0000-000000000000",
+		Name: "left-handed-smoke-sifter",
+		ProvisionInputVariables: []BrokerVariable{
+			{FieldName: "size", Type: JsonTypeInteger, Details: "Size.", Updatable: true},
+		},
+		BindInputVariables: []BrokerVariable{
+			{FieldName: "role", Type: JsonTypeString, Details: "Role.", Updatable: true},
+		},
+	}
+
+	expected := "must not set the field(s): BindInputVariables[0].updatable"
+	if err := service.Validate(); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
 	}
 }
 
@@ -14,7 +14,17 @@
 
 package broker
 
-import "github.com/GoogleCloudPlatform/gcp-service-broker/pkg/validation"
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/validation"
+)
+
+// DefaultSmokeCheckTimeout is how long smoke checks can run if they don't set
+// a timeout.
+const DefaultSmokeCheckTimeout = 5 * time.Minute
 
 // ServiceExample holds example configurations for a service that _should_
 // work.
@@ -32,15 +42,259 @@ type ServiceExample struct {
 	// BindParams is the JSON object that will be passed to bind. If nil,
 	// this example DOES NOT include a bind portion.
 	BindParams map[string]interface{} `json:"bind_params" yaml:"bind_params"`
+
+	// ExpectedProvisionError makes this an example of a provision that
+	// _shouldn't_ work. The provision must fail with an error matching this
+	// regular expression, and the example doesn't bind.
+	ExpectedProvisionError string `json:"expected_provision_error,omitempty" yaml:"expected_provision_error,omitempty"`
+
+	// ExpectedCredentials are checked against the binding credentials.
+	ExpectedCredentials []CredentialAssertion `json:"expected_credentials,omitempty" yaml:"expected_credentials,omitempty"`
+
+	// SmokeChecks are local commands run with the binding credentials before
+	// the example unbinds.
+	SmokeChecks []SmokeCheck `json:"smoke_checks,omitempty" yaml:"smoke_checks,omitempty"`
 }
 
 var _ validation.Validatable = (*ServiceExample)(nil)
 
 // Validate implements validation.Validatable.
 func (action *ServiceExample) Validate() (errs *validation.FieldError) {
-	return errs.Also(
+	errs = errs.Also(
 		validation.ErrIfBlank(action.Name, "name"),
 		validation.ErrIfBlank(action.Description, "description"),
 		validation.ErrIfBlank(action.PlanId, "plan_id"),
 	)
+
+	if action.ExpectsProvisionFailure() {
+		errs = errs.Also(errIfNotRegexp(action.ExpectedProvisionError, "expected_provision_error"))
+
+		if len(action.ExpectedCredentials) > 0 {
+			errs = errs.Also(validation.ErrDisallowedFields("expected_credentials"))
+		}
+
+		if len(action.SmokeChecks) > 0 {
+			errs = errs.Also(validation.ErrDisallowedFields("smoke_checks"))
+		}
+	}
+
+	for i, assertion := range action.ExpectedCredentials {
+		errs = errs.Also(assertion.Validate().ViaFieldIndex("expected_credentials", i))
+	}
+
+	for i, check := range action.SmokeChecks {
+		errs = errs.Also(check.Validate().ViaFieldIndex("smoke_checks", i))
+	}
+
+	return errs
+}
+
+// ExpectsProvisionFailure returns true if the example's provision should fail.
+func (action *ServiceExample) ExpectsProvisionFailure() bool {
+	return action.ExpectedProvisionError != ""
+}
+
+// CheckProvisionError returns an error if the result of provisioning doesn't
+// match the example's ExpectedProvisionError.
+func (action *ServiceExample) CheckProvisionError(provisionErr error) error {
+	if provisionErr == nil {
+		return fmt.Errorf("expected provision to fail with an error matching %q but it succeeded", action.ExpectedProvisionError)
+	}
+
+	re, err := regexp.Compile(action.ExpectedProvisionError)
+	if err != nil {
+		return err
+	}
+
+	if !re.MatchString(provisionErr.Error()) {
+		return fmt.Errorf("expected provision to fail with an error matching %q, got: %v", action.ExpectedProvisionError, provisionErr)
+	}
+
+	return nil
+}
+
+// CredentialAssertion checks the value a JSONPath expression selects from the
+// binding credentials. Exactly one of Equals, Matches or Exists must be set.
+type CredentialAssertion struct {
+	// Path selects the value to check e.g. $.uri or $.hosts[0]. Only child and
+	// array index selectors are supported.
+	Path string `json:"path" yaml:"path"`
+	// Equals is the value the path must hold.
+	Equals interface{} `json:"equals,omitempty" yaml:"equals,omitempty"`
+	// Matches is a regular expression the value must match, values other than
+	// strings are matched against their JSON encoding.
+	Matches string `json:"matches,omitempty" yaml:"matches,omitempty"`
+	// Exists is whether the path must select a value.
+	Exists *bool `json:"exists,omitempty" yaml:"exists,omitempty"`
+}
+
+var _ validation.Validatable = (*CredentialAssertion)(nil)
+
+// UnmarshalYAML implements yaml.Unmarshaler. YAML decodes objects as
+// map[interface{}]interface{} so Equals is made comparable with JSON.
+func (ca *CredentialAssertion) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain CredentialAssertion
+	if err := unmarshal((*plain)(ca)); err != nil {
+		return err
+	}
+
+	ca.Equals = jsonCompatible(ca.Equals)
+	return nil
+}
+
+// Validate implements validation.Validatable.
+func (ca *CredentialAssertion) Validate() (errs *validation.FieldError) {
+	if ca.Path == "" {
+		errs = errs.Also(validation.ErrMissingField("path"))
+	} else if _, err := parseJSONPath(ca.Path); err != nil {
+		errs = errs.Also(&validation.FieldError{
+			Message: "invalid JSONPath",
+			Paths:   []string{"path"},
+			Details: err.Error(),
+		})
+	}
+
+	var set []string
+	if ca.Equals != nil {
+		set = append(set, "equals")
+	}
+
+	if ca.Matches != "" {
+		set = append(set, "matches")
+		errs = errs.Also(errIfNotRegexp(ca.Matches, "matches"))
+	}
+
+	if ca.Exists != nil {
+		set = append(set, "exists")
+	}
+
+	switch {
+	case len(set) == 0:
+		errs = errs.Also(validation.ErrMissingOneOf("equals", "matches", "exists"))
+	case len(set) > 1:
+		errs = errs.Also(validation.ErrMultipleOneOf(set...))
+	}
+
+	return errs
+}
+
+// String describes the assertion e.g. `$.port equals 3306`.
+func (ca *CredentialAssertion) String() string {
+	switch {
+	case ca.Exists != nil && *ca.Exists:
+		return fmt.Sprintf("%s exists", ca.Path)
+	case ca.Exists != nil:
+		return fmt.Sprintf("%s doesn't exist", ca.Path)
+	case ca.Matches != "":
+		return fmt.Sprintf("%s matches %q", ca.Path, ca.Matches)
+	default:
+		return fmt.Sprintf("%s equals %s", ca.Path, jsonString(ca.Equals))
+	}
+}
+
+// Check returns an error if the credentials don't satisfy the assertion.
+// The credentials should be decoded from JSON.
+func (ca *CredentialAssertion) Check(credentials interface{}) error {
+	path, err := parseJSONPath(ca.Path)
+	if err != nil {
+		return err
+	}
+
+	actual, found := path.get(credentials)
+	switch {
+	case ca.Exists != nil:
+		if found == *ca.Exists {
+			return nil
+		}
+
+		if found {
+			return fmt.Errorf("expected %s not to exist, got %s", ca.Path, jsonString(actual))
+		}
+
+		return fmt.Errorf("expected %s to exist", ca.Path)
+
+	case !found:
+		return fmt.Errorf("expected %s to exist", ca.Path)
+
+	case ca.Matches != "":
+		re, err := regexp.Compile(ca.Matches)
+		if err != nil {
+			return err
+		}
+
+		value, ok := actual.(string)
+		if !ok {
+			value = jsonString(actual)
+		}
+
+		if !re.MatchString(value) {
+			return fmt.Errorf("expected %s to match %q, got %q", ca.Path, ca.Matches, value)
+		}
+
+		return nil
+
+	default:
+		// Compare the JSON encodings so numbers from YAML and JSON are equal.
+		expected, got := jsonString(ca.Equals), jsonString(actual)
+		if expected != got {
+			return fmt.Errorf("expected %s to equal %s, got %s", ca.Path, expected, got)
+		}
+
+		return nil
+	}
+}
+
+// SmokeCheck is a local command run against the binding credentials.
+//
+// The command gets the credentials as a JSON object on stdin and in the
+// CREDENTIALS environment variable, and the IDs of the instance and binding
+// in INSTANCE_ID and BINDING_ID. It passes if it exits with status 0.
+type SmokeCheck struct {
+	// Name describes the check in reports.
+	Name string `json:"name" yaml:"name"`
+	// Command is the executable followed by its arguments.
+	Command []string `json:"command" yaml:"command"`
+	// Timeout is how long the command can run for e.g. 30s, defaults to 5m.
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+var _ validation.Validatable = (*SmokeCheck)(nil)
+
+// Validate implements validation.Validatable.
+func (sc *SmokeCheck) Validate() (errs *validation.FieldError) {
+	errs = errs.Also(validation.ErrIfBlank(sc.Name, "name"))
+
+	if len(sc.Command) == 0 || sc.Command[0] == "" {
+		errs = errs.Also(validation.ErrMissingField("command"))
+	}
+
+	if sc.Timeout != "" {
+		if d, err := time.ParseDuration(sc.Timeout); err != nil || d <= 0 {
+			errs = errs.Also(validation.ErrInvalidValue(sc.Timeout, "timeout"))
+		}
+	}
+
+	return errs
+}
+
+// GetTimeout returns the parsed Timeout or DefaultSmokeCheckTimeout if it's
+// blank or invalid.
+func (sc *SmokeCheck) GetTimeout() time.Duration {
+	if d, err := time.ParseDuration(sc.Timeout); err == nil && d > 0 {
+		return d
+	}
+
+	return DefaultSmokeCheckTimeout
+}
+
+func errIfNotRegexp(value, field string) *validation.FieldError {
+	if _, err := regexp.Compile(value); err != nil {
+		return &validation.FieldError{
+			Message: "invalid regular expression",
+			Paths:   []string{field},
+			Details: err.Error(),
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,261 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/validation"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestServiceExample_Validate(t *testing.T) {
+	exists := true
+
+	cases := map[string]validation.ValidatableTest{
+		"empty": {
+			Object: &ServiceExample{},
+			Expect: errors.New("missing field(s): description, name, plan_id"),
+		},
+		"good": {
+			Object: &ServiceExample{
+				Name:        "name",
+				Description: "description",
+				PlanId:      "plan",
+				ExpectedCredentials: []CredentialAssertion{
+					{Path: "$.uri", Matches: "^https://"},
+					{Path: "$['private-key']", Exists: &exists},
+					{Path: "$.hosts[0].port", Equals: 3306},
+				},
+				SmokeChecks: []SmokeCheck{
+					{Name: "connect", Command: []string{"./connect.sh"}, Timeout: "30s"},
+				},
+			},
+			Expect: nil,
+		},
+		"expected provision error": {
+			Object: &ServiceExample{
+				Name:                   "name",
+				Description:            "description",
+				PlanId:                 "plan",
+				ExpectedProvisionError: "name is required",
+			},
+			Expect: nil,
+		},
+		"bad expected provision error": {
+			Object: &ServiceExample{
+				Name:                   "name",
+				Description:            "description",
+				PlanId:                 "plan",
+				ExpectedProvisionError: "(",
+				ExpectedCredentials:    []CredentialAssertion{{Path: "$.uri", Exists: &exists}},
+				SmokeChecks:            []SmokeCheck{{Name: "connect", Command: []string{"./connect.sh"}}},
+			},
+			Expect: errors.New("invalid regular expression: expected_provision_error\nerror parsing regexp: missing closing ): `(`\nmust not set the field(s): expected_credentials, smoke_checks"),
+		},
+		"bad assertions and checks": {
+			Object: &ServiceExample{
+				Name:        "name",
+				Description: "description",
+				PlanId:      "plan",
+				ExpectedCredentials: []CredentialAssertion{
+					{Path: "uri", Matches: "("},
+					{Path: "$.uri"},
+					{Path: "$.uri", Equals: "a", Exists: &exists},
+				},
+				SmokeChecks: []SmokeCheck{
+					{Timeout: "soon"},
+				},
+			},
+			Expect: errors.New(`expected exactly one, got both: expected_credentials[2].equals, expected_credentials[2].exists
+expected exactly one, got neither: expected_credentials[1].equals, expected_credentials[1].exists, expected_credentials[1].matches
+invalid JSONPath: expected_credentials[0].path
+JSONPath "uri" must start with $
+invalid regular expression: expected_credentials[0].matches
+error parsing regexp: missing closing ): ` + "`(`" + `
+invalid value: soon: smoke_checks[0].timeout
+missing field(s): smoke_checks[0].command, smoke_checks[0].name`),
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			tc.Assert(t)
+		})
+	}
+}
+
+func TestServiceExample_CheckProvisionError(t *testing.T) {
+	example := ServiceExample{ExpectedProvisionError: "^name is required$"}
+
+	cases := map[string]struct {
+		ProvisionErr error
+		ExpectedErr  error
+	}{
+		"matching error": {
+			ProvisionErr: errors.New("name is required"),
+		},
+		"other error": {
+			ProvisionErr: errors.New("name is too long"),
+			ExpectedErr:  errors.New(`expected provision to fail with an error matching "^name is required$", got: name is too long`),
+		},
+		"no error": {
+			ExpectedErr: errors.New(`expected provision to fail with an error matching "^name is required$" but it succeeded`),
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			expectError(t, tc.ExpectedErr, example.CheckProvisionError(tc.ProvisionErr))
+		})
+	}
+}
+
+func TestCredentialAssertion_Check(t *testing.T) {
+	var credentials interface{}
+	if err := json.Unmarshal([]byte(`{
+		"uri": "mysql://user@host:3306/db",
+		"port": 3306,
+		"private-key": "secret",
+		"hosts": [{"name": "a", "port": 1}, {"name": "b", "port": 2}],
+		"tls": {"enabled": true, "ca": null}
+	}`), &credentials); err != nil {
+		t.Fatal(err)
+	}
+
+	yes, no := true, false
+
+	cases := map[string]struct {
+		Assertion   CredentialAssertion
+		Description string
+		ExpectedErr error
+	}{
+		"matches": {
+			Assertion:   CredentialAssertion{Path: "$.uri", Matches: "^mysql://"},
+			Description: `$.uri matches "^mysql://"`,
+		},
+		"doesn't match": {
+			Assertion:   CredentialAssertion{Path: "$.uri", Matches: "^postgres://"},
+			Description: `$.uri matches "^postgres://"`,
+			ExpectedErr: errors.New(`expected $.uri to match "^postgres://", got "mysql://user@host:3306/db"`),
+		},
+		"matches non-string": {
+			Assertion:   CredentialAssertion{Path: "$.port", Matches: "^33"},
+			Description: `$.port matches "^33"`,
+		},
+		"equals number": {
+			Assertion:   CredentialAssertion{Path: "$.port", Equals: 3306},
+			Description: "$.port equals 3306",
+		},
+		"equals object": {
+			Assertion:   CredentialAssertion{Path: "$.hosts[1]", Equals: map[string]interface{}{"port": 2, "name": "b"}},
+			Description: `$.hosts[1] equals {"name":"b","port":2}`,
+		},
+		"not equal": {
+			Assertion:   CredentialAssertion{Path: "$.tls.enabled", Equals: false},
+			Description: "$.tls.enabled equals false",
+			ExpectedErr: errors.New("expected $.tls.enabled to equal false, got true"),
+		},
+		"quoted names": {
+			Assertion:   CredentialAssertion{Path: `$['private-key']`, Equals: "secret"},
+			Description: `$['private-key'] equals "secret"`,
+		},
+		"dotted names with dashes": {
+			Assertion:   CredentialAssertion{Path: "$.private-key", Exists: &yes},
+			Description: "$.private-key exists",
+		},
+		"null exists": {
+			Assertion:   CredentialAssertion{Path: `$.tls["ca"]`, Exists: &yes},
+			Description: `$.tls["ca"] exists`,
+		},
+		"missing": {
+			Assertion:   CredentialAssertion{Path: "$.hosts[2].name", Exists: &yes},
+			Description: "$.hosts[2].name exists",
+			ExpectedErr: errors.New("expected $.hosts[2].name to exist"),
+		},
+		"doesn't exist": {
+			Assertion:   CredentialAssertion{Path: "$.password", Exists: &no},
+			Description: "$.password doesn't exist",
+		},
+		"exists but shouldn't": {
+			Assertion:   CredentialAssertion{Path: "$.hosts[0].name", Exists: &no},
+			Description: "$.hosts[0].name doesn't exist",
+			ExpectedErr: errors.New(`expected $.hosts[0].name not to exist, got "a"`),
+		},
+		"missing value for comparison": {
+			Assertion:   CredentialAssertion{Path: "$.uri.host", Equals: "host"},
+			Description: `$.uri.host equals "host"`,
+			ExpectedErr: errors.New("expected $.uri.host to exist"),
+		},
+		"wildcards aren't supported": {
+			Assertion:   CredentialAssertion{Path: "$.hosts[*].name", Exists: &yes},
+			Description: "$.hosts[*].name exists",
+			ExpectedErr: errors.New(`JSONPath "$.hosts[*].name" has an unsupported selector [*] at offset 7, expected a quoted name or non-negative index`),
+		},
+		"recursive descent isn't supported": {
+			Assertion:   CredentialAssertion{Path: "$..name", Exists: &yes},
+			Description: "$..name exists",
+			ExpectedErr: errors.New(`JSONPath "$..name" is missing a name at offset 2`),
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			if actual := tc.Assertion.String(); actual != tc.Description {
+				t.Errorf("Expected description %q, got %q", tc.Description, actual)
+			}
+
+			expectError(t, tc.ExpectedErr, tc.Assertion.Check(credentials))
+		})
+	}
+}
+
+func TestCredentialAssertion_UnmarshalYAML(t *testing.T) {
+	var assertion CredentialAssertion
+	if err := yaml.Unmarshal([]byte("path: $.hosts[0]\nequals: {name: a, port: 1}"), &assertion); err != nil {
+		t.Fatal(err)
+	}
+
+	credentials := map[string]interface{}{
+		"hosts": []interface{}{map[string]interface{}{"name": "a", "port": 1.0}},
+	}
+
+	if err := assertion.Check(credentials); err != nil {
+		t.Errorf("Expected YAML objects to be comparable to JSON, got: %v", err)
+	}
+}
+
+func TestSmokeCheck_GetTimeout(t *testing.T) {
+	cases := map[string]struct {
+		Timeout  string
+		Expected time.Duration
+	}{
+		"blank":   {Timeout: "", Expected: DefaultSmokeCheckTimeout},
+		"invalid": {Timeout: "soon", Expected: DefaultSmokeCheckTimeout},
+		"set":     {Timeout: "30s", Expected: 30 * time.Second},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			check := SmokeCheck{Timeout: tc.Timeout}
+			if actual := check.GetTimeout(); actual != tc.Expected {
+				t.Errorf("Expected %s, got %s", tc.Expected, actual)
+			}
+		})
+	}
+}
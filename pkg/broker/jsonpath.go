@@ -0,0 +1,124 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package broker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a parsed JSONPath expression. Only the root, child and array
+// index selectors are supported e.g. $.credentials['private-key'] or
+// $.hosts[0].port, so each path selects at most one value.
+type jsonPath []interface{}
+
+// parseJSONPath parses a JSONPath expression into a list of steps, which are
+// either object keys (strings) or array indexes (ints).
+func parseJSONPath(path string) (jsonPath, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("JSONPath %q must start with $", path)
+	}
+
+	var steps jsonPath
+	for i := 1; i < len(path); {
+		switch path[i] {
+		case '.':
+			end := i + 1
+			for end < len(path) && isJSONPathNameChar(path[end]) {
+				end++
+			}
+
+			if end == i+1 {
+				return nil, fmt.Errorf("JSONPath %q is missing a name at offset %d", path, i+1)
+			}
+
+			steps = append(steps, path[i+1:end])
+			i = end
+
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("JSONPath %q has an unclosed [ at offset %d", path, i)
+			}
+
+			selector := path[i+1 : i+end]
+			step, err := parseJSONPathSelector(selector)
+			if err != nil {
+				return nil, fmt.Errorf("JSONPath %q has an unsupported selector [%s] at offset %d, %v", path, selector, i, err)
+			}
+
+			steps = append(steps, step)
+			i += end + 1
+
+		default:
+			return nil, fmt.Errorf("JSONPath %q has an unexpected %q at offset %d", path, path[i], i)
+		}
+	}
+
+	return steps, nil
+}
+
+func isJSONPathNameChar(c byte) bool {
+	return c == '_' || c == '-' ||
+		('a' <= c && c <= 'z') ||
+		('A' <= c && c <= 'Z') ||
+		('0' <= c && c <= '9')
+}
+
+func parseJSONPathSelector(selector string) (interface{}, error) {
+	if len(selector) >= 2 {
+		quote := selector[0]
+		if (quote == '\'' || quote == '"') && selector[len(selector)-1] == quote {
+			return selector[1 : len(selector)-1], nil
+		}
+	}
+
+	index, err := strconv.Atoi(selector)
+	if err != nil || index < 0 {
+		return nil, fmt.Errorf("expected a quoted name or non-negative index")
+	}
+
+	return index, nil
+}
+
+// get returns the value the path selects from the JSON value and whether it
+// was found.
+func (jp jsonPath) get(value interface{}) (interface{}, bool) {
+	for _, step := range jp {
+		switch s := step.(type) {
+		case string:
+			obj, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+
+			value, ok = obj[s]
+			if !ok {
+				return nil, false
+			}
+
+		case int:
+			arr, ok := value.([]interface{})
+			if !ok || s >= len(arr) {
+				return nil, false
+			}
+
+			value = arr[s]
+		}
+	}
+
+	return value, true
+}
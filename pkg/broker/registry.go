@@ -43,24 +43,35 @@ var (
 type BrokerRegistry map[string]*ServiceDefinition
 
 // Registers a ServiceDefinition with the service registry that various commands
-// poll to create the catalog, documentation, etc.
+// poll to create the catalog, documentation, etc. The process exits if the
+// service is invalid, use TryRegister to get an error instead.
 func (brokerRegistry BrokerRegistry) Register(service *ServiceDefinition) {
+	if err := brokerRegistry.TryRegister(service); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// TryRegister registers a ServiceDefinition with the service registry,
+// returning an error if it's invalid or a service with the same name was
+// already registered.
+func (brokerRegistry BrokerRegistry) TryRegister(service *ServiceDefinition) error {
 	name := service.Name
 
 	if _, ok := brokerRegistry[name]; ok {
-		log.Fatalf("Tried to register multiple instances of: %q", name)
+		return fmt.Errorf("Tried to register multiple instances of: %q", name)
 	}
 
 	// Test deserializing the user defined plans and service definition
 	if _, err := service.CatalogEntry(); err != nil {
-		log.Fatalf("Error registering service %q, %s", name, err)
+		return fmt.Errorf("Error registering service %q, %s", name, err)
 	}
 
 	if err := service.Validate(); err != nil {
-		log.Fatalf("Error validating service %q, %s", name, err)
+		return fmt.Errorf("Error validating service %q, %s", name, err)
 	}
 
 	brokerRegistry[name] = service
+	return nil
 }
 
 // GetEnabledServices returns a list of all registered brokers that the user
@@ -98,3 +98,72 @@ func TestRegistry_GetEnabledServices(t *testing.T) {
 		})
 	}
 }
+
+func TestRegistry_TryRegister(t *testing.T) {
+	newService := func() *ServiceDefinition {
+		return &ServiceDefinition{
+			Id:   "b9e4332e-b42b-4680-bda5-ea1506797474",
+			Name: "test-service",
+			Plans: []ServicePlan{
+				{
+					ServicePlan: brokerapi.ServicePlan{
+						ID:          "e1d11f65-da66-46ad-977c-6d56513baf43",
+						Name:        "Builtin!",
+						Description: "Standard storage class",
+					},
+				},
+			},
+		}
+	}
+
+	cases := map[string]struct {
+		Service     func() *ServiceDefinition
+		ExpectedErr string
+	}{
+		"new service": {
+			Service: func() *ServiceDefinition {
+				svc := newService()
+				svc.Name = "other-service"
+				return svc
+			},
+		},
+		"duplicate name": {
+			Service:     newService,
+			ExpectedErr: `Tried to register multiple instances of: "test-service"`,
+		},
+		"invalid service": {
+			Service: func() *ServiceDefinition {
+				svc := newService()
+				svc.Name = "invalid-service"
+				svc.Id = "not-a-uuid"
+				return svc
+			},
+			ExpectedErr: `Error validating service "invalid-service", field must be a UUID: Id`,
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			registry := BrokerRegistry{}
+			if err := registry.TryRegister(newService()); err != nil {
+				t.Fatal(err)
+			}
+
+			err := registry.TryRegister(tc.Service())
+			switch {
+			case tc.ExpectedErr == "" && err != nil:
+				t.Fatalf("Expected no error, got: %v", err)
+			case tc.ExpectedErr != "" && (err == nil || err.Error() != tc.ExpectedErr):
+				t.Fatalf("Expected error: %q, got: %v", tc.ExpectedErr, err)
+			}
+
+			expectedCount := 2
+			if tc.ExpectedErr != "" {
+				expectedCount = 1
+			}
+			if len(registry) != expectedCount {
+				t.Errorf("Expected %d registered services, got: %d", expectedCount, len(registry))
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	"code.cloudfoundry.org/lager"
@@ -25,13 +26,20 @@ import (
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/toggles"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/validation"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/varcontext"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/varcontext/interpolation"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/utils"
 	"github.com/pivotal-cf/brokerapi"
+	"github.com/spf13/cast"
 	"github.com/spf13/viper"
 	"golang.org/x/oauth2/jwt"
 )
 
-var enableCatalogSchemas = toggles.Features.Toggle("enable-catalog-schemas", false, `Enable generating JSONSchema for the service catalog.`)
+var enableCatalogSchemas = toggles.Features.Toggle("enable-catalog-schemas", false, `Enable generating JSONSchema for the service catalog.
+Plans get draft-07 schemas for creating, updating and binding to instances,
+and services advertise the schema of their binding credentials in their metadata.`)
+
+var enableMaintenanceInfo = toggles.Features.Toggle("enable-maintenance-info", false, `Advertise the brokerpak version of services as maintenance_info so platforms
+can upgrade existing instances when a new version is loaded.`)
 
 // ServiceDefinition holds the necessary details to describe an OSB service and
 // provision it.
@@ -57,6 +65,15 @@ type ServiceDefinition struct {
 	Examples                   []ServiceExample
 	DefaultRoleWhitelist       []string
 
+	// DashboardUrlTemplate is an optional HIL template for a URL users can visit
+	// to manage an instance. It's evaluated against the instance's details, see
+	// DashboardUrl for the available variables.
+	DashboardUrlTemplate string
+
+	// MaintenanceInfo is advertised on every plan, if enabled, so platforms can
+	// offer to upgrade instances created by a different version of the service.
+	MaintenanceInfo *brokerapi.MaintenanceInfo
+
 	// ProviderBuilder creates a new provider given the project, auth, and logger.
 	ProviderBuilder func(projectId string, auth *jwt.Config, logger lager.Logger) ServiceProvider
 
@@ -66,6 +83,18 @@ type ServiceDefinition struct {
 
 var _ validation.Validatable = (*ServiceDefinition)(nil)
 
+// The names of the constants available to HIL templates in each context.
+var (
+	// ProvisionTemplateVariables are available to provision templates.
+	ProvisionTemplateVariables = []string{"request.plan_id", "request.service_id", "request.instance_id", "request.default_labels"}
+
+	// BindTemplateVariables are available to bind templates.
+	BindTemplateVariables = []string{"request.binding_id", "request.instance_id", "request.plan_id", "request.service_id", "request.app_guid", "request.plan_properties", "instance.name", "instance.details"}
+
+	// DashboardUrlTemplateVariables are available to DashboardUrlTemplate.
+	DashboardUrlTemplateVariables = []string{"instance.id", "instance.name", "instance.location", "instance.url", "instance.plan_id", "instance.service_id", "instance.details", "broker.project_id"}
+)
+
 // Validate implements validation.Validatable.
 func (sd *ServiceDefinition) Validate() (errs *validation.FieldError) {
 	errs = errs.Also(
@@ -85,6 +114,10 @@ func (sd *ServiceDefinition) Validate() (errs *validation.FieldError) {
 		errs = errs.Also(validation.ErrIfNotURL(sd.SupportUrl, "SupportUrl"))
 	}
 
+	if sd.DashboardUrlTemplate != "" {
+		errs = errs.Also(validation.ErrIfNotHIL(sd.DashboardUrlTemplate, "DashboardUrlTemplate"))
+	}
+
 	for i, v := range sd.ProvisionInputVariables {
 		errs = errs.Also(v.Validate().ViaFieldIndex("ProvisionInputVariables", i))
 	}
@@ -94,11 +127,17 @@ func (sd *ServiceDefinition) Validate() (errs *validation.FieldError) {
 	}
 
 	for i, v := range sd.BindInputVariables {
-		errs = errs.Also(v.Validate().ViaFieldIndex("BindInputVariables", i))
+		errs = errs.Also(
+			v.Validate().ViaFieldIndex("BindInputVariables", i),
+			errIfUpdatable(v).ViaFieldIndex("BindInputVariables", i),
+		)
 	}
 
 	for i, v := range sd.BindOutputVariables {
-		errs = errs.Also(v.Validate().ViaFieldIndex("BindOutputVariables", i))
+		errs = errs.Also(
+			v.Validate().ViaFieldIndex("BindOutputVariables", i),
+			errIfUpdatable(v).ViaFieldIndex("BindOutputVariables", i),
+		)
 	}
 
 	for i, v := range sd.BindComputedVariables {
@@ -106,12 +145,25 @@ func (sd *ServiceDefinition) Validate() (errs *validation.FieldError) {
 	}
 
 	for i, v := range sd.PlanVariables {
-		errs = errs.Also(v.Validate().ViaFieldIndex("PlanVariables", i))
+		errs = errs.Also(
+			v.Validate().ViaFieldIndex("PlanVariables", i),
+			errIfUpdatable(v).ViaFieldIndex("PlanVariables", i),
+		)
 	}
 
 	return errs
 }
 
+// errIfUpdatable returns an error if a variable that isn't a provision input
+// is marked updatable.
+func errIfUpdatable(v BrokerVariable) *validation.FieldError {
+	if v.Updatable {
+		return validation.ErrDisallowedFields("updatable")
+	}
+
+	return nil
+}
+
 // UserDefinedPlansProperty computes the Viper property name for the JSON list
 // of user-defined service plans.
 func (svc *ServiceDefinition) UserDefinedPlansProperty() string {
@@ -157,6 +209,16 @@ func (svc *ServiceDefinition) TileUserDefinedPlansVariable() string {
 	return v + "_CUSTOM_PLANS"
 }
 
+// AdvertisedMaintenanceInfo gets the maintenance info advertised in the
+// catalog or nil if there is none or advertising it is disabled.
+func (svc *ServiceDefinition) AdvertisedMaintenanceInfo() *brokerapi.MaintenanceInfo {
+	if !enableMaintenanceInfo.IsActive() {
+		return nil
+	}
+
+	return svc.MaintenanceInfo
+}
+
 // CatalogEntry returns the service broker catalog entry for this service, it
 // has metadata about the service so operators and programmers know which
 // service and plan will work best for their purposes.
@@ -179,37 +241,159 @@ func (svc *ServiceDefinition) CatalogEntry() (*Service, error) {
 				ImageUrl:         svc.ImageUrl,
 				SupportUrl:       svc.SupportUrl,
 			},
-			Tags:          svc.Tags,
-			Bindable:      svc.Bindable,
-			PlanUpdatable: svc.PlanUpdateable,
+			Tags:                 svc.Tags,
+			Bindable:             svc.Bindable,
+			PlanUpdatable:        svc.PlanUpdateable,
+			InstancesRetrievable: true,
 		},
-		Plans: append(svc.Plans, userPlans...),
+		// copy the plans so filling in their schemas and maintenance info
+		// doesn't modify the service definition
+		Plans: append(append([]ServicePlan{}, svc.Plans...), userPlans...),
 	}
 
 	if enableCatalogSchemas.IsActive() {
 		for i, _ := range sd.Plans {
-			sd.Plans[i].Schemas = svc.createSchemas()
+			sd.Plans[i].Schemas = svc.createSchemas(sd.Plans[i])
+		}
+
+		// OSB schemas don't have a place for the binding response so it's
+		// advertised in the service metadata.
+		if svc.Bindable && len(svc.BindOutputVariables) > 0 {
+			sd.Metadata.AdditionalMetadata = map[string]interface{}{
+				"bindingResponseSchema": svc.BindingResponseSchema(),
+			}
+		}
+	}
+
+	if info := svc.AdvertisedMaintenanceInfo(); info != nil {
+		for i := range sd.Plans {
+			sd.Plans[i].MaintenanceInfo = info
 		}
 	}
 
 	return sd, nil
 }
 
-// createSchemas creates JSONSchemas compatible with the OSB spec for provision and bind.
-// It leaves the instance update schema empty to indicate updates are not supported.
-func (svc *ServiceDefinition) createSchemas() *brokerapi.ServiceSchemas {
-	return &brokerapi.ServiceSchemas{
+// DashboardUrl evaluates the service's DashboardUrlTemplate for the given
+// instance. It returns a blank string if the service doesn't have a dashboard.
+//
+// The following variables are available to the template:
+//
+// - instance.id, instance.name, instance.location and instance.url from the instance
+// - instance.plan_id and instance.service_id from the instance
+// - instance.details, a map of the instance's other details e.g. Terraform outputs
+// - broker.project_id, the project the broker creates resources in
+func (svc *ServiceDefinition) DashboardUrl(instance models.ServiceInstanceDetails, projectId string) (string, error) {
+	if svc.DashboardUrlTemplate == "" {
+		return "", nil
+	}
+
+	otherDetails := make(map[string]interface{})
+	if err := instance.GetOtherDetails(&otherDetails); err != nil {
+		return "", err
+	}
+
+	result, err := interpolation.Eval(svc.DashboardUrlTemplate, dashboardUrlConstants(instance, otherDetails, projectId))
+	if err != nil {
+		return "", fmt.Errorf("couldn't compute the dashboard URL for %q: %v", svc.Name, err)
+	}
+
+	return cast.ToStringE(result)
+}
+
+// dashboardUrlConstants gets the variables available to DashboardUrlTemplate,
+// its keys MUST be DashboardUrlTemplateVariables.
+func dashboardUrlConstants(instance models.ServiceInstanceDetails, otherDetails map[string]interface{}, projectId string) map[string]interface{} {
+	return map[string]interface{}{
+		"instance.id":         instance.ID,
+		"instance.name":       instance.Name,
+		"instance.location":   instance.Location,
+		"instance.url":        instance.Url,
+		"instance.plan_id":    instance.PlanId,
+		"instance.service_id": instance.ServiceId,
+		"instance.details":    otherDetails,
+		"broker.project_id":   projectId,
+	}
+}
+
+// createSchemas creates JSONSchemas compatible with the OSB spec for provision,
+// update and bind. The create schemas include the plan's examples, other than
+// ones that are expected to fail.
+// Conditions on the plan's properties are resolved for the plan.
+// It leaves the instance update schema empty to indicate updates are not
+// supported if none of the provision variables are updatable.
+func (svc *ServiceDefinition) createSchemas(plan ServicePlan) *brokerapi.ServiceSchemas {
+	var provisionExamples, bindExamples []interface{}
+	for _, example := range svc.Examples {
+		if example.PlanId != plan.ID || example.ExpectsProvisionFailure() {
+			continue
+		}
+
+		provisionExamples = append(provisionExamples, exampleParams(example.ProvisionParams))
+		if example.BindParams != nil {
+			bindExamples = append(bindExamples, exampleParams(example.BindParams))
+		}
+	}
+
+	instanceCreate := CreateJsonSchema(resolvePlanConditions(svc.ProvisionInputVariables, plan))
+	instanceCreate[validation.KeyTitle] = fmt.Sprintf("Create a %s instance", svc.displayName())
+	if len(provisionExamples) > 0 {
+		instanceCreate[validation.KeyExamples] = provisionExamples
+	}
+
+	bindingCreate := CreateJsonSchema(resolvePlanConditions(svc.BindInputVariables, plan))
+	bindingCreate[validation.KeyTitle] = fmt.Sprintf("Bind to a %s instance", svc.displayName())
+	if len(bindExamples) > 0 {
+		bindingCreate[validation.KeyExamples] = bindExamples
+	}
+
+	schemas := &brokerapi.ServiceSchemas{
 		Instance: brokerapi.ServiceInstanceSchema{
-			Create: brokerapi.Schema{
-				Parameters: CreateJsonSchema(svc.ProvisionInputVariables),
-			},
+			Create: brokerapi.Schema{Parameters: instanceCreate},
 		},
 		Binding: brokerapi.ServiceBindingSchema{
-			Create: brokerapi.Schema{
-				Parameters: CreateJsonSchema(svc.BindInputVariables),
-			},
+			Create: brokerapi.Schema{Parameters: bindingCreate},
 		},
 	}
+
+	for _, v := range svc.ProvisionInputVariables {
+		if v.Updatable {
+			instanceUpdate := CreateUpdateJsonSchema(svc.ProvisionInputVariables)
+			instanceUpdate[validation.KeyTitle] = fmt.Sprintf("Update a %s instance", svc.displayName())
+			schemas.Instance.Update = brokerapi.Schema{Parameters: instanceUpdate}
+			break
+		}
+	}
+
+	return schemas
+}
+
+// BindingResponseSchema creates a JSONSchema for the credentials returned
+// when binding to an instance of the service.
+func (svc *ServiceDefinition) BindingResponseSchema() map[string]interface{} {
+	schema := CreateResponseJsonSchema(svc.BindOutputVariables)
+	schema[validation.KeyTitle] = fmt.Sprintf("%s binding credentials", svc.displayName())
+
+	return schema
+}
+
+// displayName gets the human-readable name of the service for schema titles.
+func (svc *ServiceDefinition) displayName() string {
+	if svc.DisplayName != "" {
+		return svc.DisplayName
+	}
+
+	return svc.Name
+}
+
+// exampleParams gets the parameters of an example as a schema example, a nil
+// map is sent as an empty object.
+func exampleParams(params map[string]interface{}) map[string]interface{} {
+	if params == nil {
+		return map[string]interface{}{}
+	}
+
+	return params
 }
 
 // GetPlanById finds a plan in this service by its UUID.
@@ -350,24 +534,110 @@ func (svc *ServiceDefinition) bindDefaults() []varcontext.DefaultVariable {
 // Therefore, they get executed conditionally if a user-provided variable does not exist.
 // Computed variables get executed either unconditionally or conditionally for greater flexibility.
 func (svc *ServiceDefinition) ProvisionVariables(instanceId string, details brokerapi.ProvisionDetails, plan ServicePlan) (*varcontext.VarContext, error) {
+	builder := svc.mergeProvisionVariables(varcontext.Builder(), instanceId, details, plan)
+
+	return buildAndValidate(builder, svc.ProvisionInputVariables)
+}
+
+// UpdateVariables gets the variable resolution context for an update request
+// that changes an instance's parameters. The update's parameters are merged
+// over provisionParams, the parameters the instance currently has, and
+// resolved like ProvisionVariables. Only updatable provision inputs can be
+// changed.
+// The merged parameters are returned so they can be stored for later updates.
+func (svc *ServiceDefinition) UpdateVariables(instance models.ServiceInstanceDetails, provisionParams json.RawMessage, details brokerapi.UpdateDetails, plan ServicePlan) (*varcontext.VarContext, json.RawMessage, error) {
+	params := make(map[string]interface{})
+	if raw := details.GetRawParameters(); len(raw) > 0 {
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	updatable := make(map[string]bool)
+	for _, v := range svc.ProvisionInputVariables {
+		updatable[v.FieldName] = v.Updatable
+	}
+
+	var fixed []string
+	for name := range params {
+		if !updatable[name] {
+			fixed = append(fixed, name)
+		}
+	}
+
+	if len(fixed) > 0 {
+		sort.Strings(fixed)
+		return nil, nil, fmt.Errorf("parameters that aren't updatable can't be changed: %s", strings.Join(fixed, ", "))
+	}
+
+	if err := ValidateVariablesAgainstSchema(params, CreateUpdateJsonSchema(svc.ProvisionInputVariables)); err != nil {
+		return nil, nil, err
+	}
+
+	merged := make(map[string]interface{})
+	if len(provisionParams) > 0 {
+		if err := json.Unmarshal(provisionParams, &merged); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for name, value := range params {
+		merged[name] = value
+	}
+
+	rawMerged, err := json.Marshal(merged)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vars, err := svc.ProvisionVariables(instance.ID, brokerapi.ProvisionDetails{
+		ServiceID:        instance.ServiceId,
+		PlanID:           instance.PlanId,
+		OrganizationGUID: instance.OrganizationGuid,
+		SpaceGUID:        instance.SpaceGuid,
+		RawParameters:    rawMerged,
+	}, plan)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return vars, rawMerged, nil
+}
+
+// ExplainProvision resolves the variables for a provision request like
+// ProvisionVariables and also returns a trace of which layer set each one.
+// The trace is returned even if resolution fails so the failure can be
+// explained.
+func (svc *ServiceDefinition) ExplainProvision(instanceId string, details brokerapi.ProvisionDetails, plan ServicePlan) (*varcontext.VarContext, varcontext.Trace, error) {
+	builder := svc.mergeProvisionVariables(varcontext.Builder().EnableTrace(), instanceId, details, plan)
+	vc, err := buildAndValidate(builder, svc.ProvisionInputVariables)
+
+	return vc, builder.Trace(), err
+}
+
+// mergeProvisionVariables merges the layers of a provision request into the
+// builder in the order described by ProvisionVariables.
+func (svc *ServiceDefinition) mergeProvisionVariables(builder *varcontext.ContextBuilder, instanceId string, details brokerapi.ProvisionDetails, plan ServicePlan) *varcontext.ContextBuilder {
+	return builder.
+		SetEvalConstants(provisionConstants(instanceId, details)).
+		Layer("operator defaults").ResolveReferences().MergeMap(svc.ProvisionDefaultOverrides()).
+		Layer("user parameters").MergeJsonObject(details.GetRawParameters()).
+		Layer("plan overrides").MergeMap(plan.ProvisionOverrides).
+		Layer("input defaults").MergeDefaults(svc.provisionDefaults()).
+		Layer("plan properties").MergeMap(plan.GetServiceProperties()).
+		Layer("computed inputs").MergeDefaults(svc.ProvisionComputedVariables)
+}
+
+// provisionConstants gets the variables available to provision templates, its
+// keys MUST be ProvisionTemplateVariables.
+func provisionConstants(instanceId string, details brokerapi.ProvisionDetails) map[string]interface{} {
 	// The namespaces of these values roughly align with the OSB spec.
-	constants := map[string]interface{}{
+	return map[string]interface{}{
 		"request.plan_id":        details.PlanID,
 		"request.service_id":     details.ServiceID,
 		"request.instance_id":    instanceId,
 		"request.default_labels": utils.ExtractDefaultLabels(instanceId, details),
 	}
-
-	builder := varcontext.Builder().
-		SetEvalConstants(constants).
-		MergeMap(svc.ProvisionDefaultOverrides()).
-		MergeJsonObject(details.GetRawParameters()).
-		MergeMap(plan.ProvisionOverrides).
-		MergeDefaults(svc.provisionDefaults()).
-		MergeMap(plan.GetServiceProperties()).
-		MergeDefaults(svc.ProvisionComputedVariables)
-
-	return buildAndValidate(builder, svc.ProvisionInputVariables)
 }
 
 // BindVariables gets the variable resolution context for a bind request.
@@ -386,13 +656,27 @@ func (svc *ServiceDefinition) BindVariables(instance models.ServiceInstanceDetai
 		return nil, err
 	}
 
+	builder := varcontext.Builder().
+		SetEvalConstants(bindConstants(instance, otherDetails, bindingID, details, plan)).
+		Layer("operator defaults").ResolveReferences().MergeMap(svc.BindDefaultOverrides()).
+		Layer("user parameters").MergeJsonObject(details.GetRawParameters()).
+		Layer("plan overrides").MergeMap(plan.BindOverrides).
+		Layer("input defaults").MergeDefaults(svc.bindDefaults()).
+		Layer("computed inputs").MergeDefaults(svc.BindComputedVariables)
+
+	return buildAndValidate(builder, svc.BindInputVariables)
+}
+
+// bindConstants gets the variables available to bind templates, its keys MUST
+// be BindTemplateVariables.
+func bindConstants(instance models.ServiceInstanceDetails, otherDetails map[string]interface{}, bindingID string, details brokerapi.BindDetails, plan *ServicePlan) map[string]interface{} {
 	appGuid := ""
 	if details.BindResource != nil {
 		appGuid = details.BindResource.AppGuid
 	}
 
 	// The namespaces of these values roughly align with the OSB spec.
-	constants := map[string]interface{}{
+	return map[string]interface{}{
 		// specified in the URL
 		"request.binding_id":  bindingID,
 		"request.instance_id": instance.ID,
@@ -410,16 +694,6 @@ func (svc *ServiceDefinition) BindVariables(instance models.ServiceInstanceDetai
 		"instance.name":    instance.Name,
 		"instance.details": otherDetails,
 	}
-
-	builder := varcontext.Builder().
-		SetEvalConstants(constants).
-		MergeMap(svc.BindDefaultOverrides()).
-		MergeJsonObject(details.GetRawParameters()).
-		MergeMap(plan.BindOverrides).
-		MergeDefaults(svc.bindDefaults()).
-		MergeDefaults(svc.BindComputedVariables)
-
-	return buildAndValidate(builder, svc.BindInputVariables)
 }
 
 // buildAndValidate builds the varcontext and if it's valid validates the
@@ -431,7 +705,7 @@ func buildAndValidate(builder *varcontext.ContextBuilder, vars []BrokerVariable)
 		return nil, err
 	}
 
-	if err := ValidateVariables(vc.ToMap(), vars); err != nil {
+	if err := ValidateComputedVariables(vc.ToMap(), vars, builder.TemplateFor); err != nil {
 		return nil, err
 	}
 
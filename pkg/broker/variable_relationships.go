@@ -0,0 +1,399 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/validation"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/utils"
+)
+
+// validateRelationships checks the relationships of the variable don't
+// contradict its other settings.
+func (bv *BrokerVariable) validateRelationships() (errs *validation.FieldError) {
+	if bv.Default != nil && len(bv.DependsOn) > 0 {
+		errs = errs.Also(&validation.FieldError{
+			Message: "depends_on can't be combined with a default",
+			Paths:   []string{"default"},
+			Details: "the default would always set the variable so the variables it depends on would always be required",
+		})
+	}
+
+	if bv.Default != nil && len(bv.RequiredIf) > 0 {
+		errs = errs.Also(&validation.FieldError{
+			Message: "required_if can't be combined with a default",
+			Paths:   []string{"default"},
+			Details: "the default would always set the variable so the condition would never be checked",
+		})
+	}
+
+	if bv.Default != nil && len(bv.OnlyIf) > 0 {
+		errs = errs.Also(&validation.FieldError{
+			Message: "only_if can't be combined with a default",
+			Paths:   []string{"default"},
+			Details: "the default would always set the variable, use a computed input to set it conditionally",
+		})
+	}
+
+	if bv.Default != nil && len(bv.OneOf) > 0 {
+		errs = errs.Also(&validation.FieldError{
+			Message: "one_of can't be combined with a default",
+			Paths:   []string{"default"},
+			Details: "the default would always set the variable so its alternatives could never be used",
+		})
+	}
+
+	notSelf := func(name string) bool {
+		return name != bv.FieldName
+	}
+
+	return errs.Also(bv.validateReferences(notSelf, notSelf))
+}
+
+// validateReferences checks exists returns true for every variable the
+// relationships refer to. The conditions of required_if and only_if are
+// checked with conditionExists instead because they can also refer to plan
+// variables.
+func (bv *BrokerVariable) validateReferences(exists, conditionExists func(name string) bool) (errs *validation.FieldError) {
+	for i, name := range bv.DependsOn {
+		if !exists(name) {
+			errs = errs.Also(errInvalidReference(name).ViaFieldIndex("depends_on", i))
+		}
+	}
+
+	for i, name := range bv.OneOf {
+		if !exists(name) {
+			errs = errs.Also(errInvalidReference(name).ViaFieldIndex("one_of", i))
+		}
+	}
+
+	for _, name := range sortedKeys(bv.RequiredIf) {
+		if !conditionExists(name) {
+			errs = errs.Also(errInvalidReference(name).ViaFieldKey("required_if", name))
+		}
+	}
+
+	for _, name := range sortedKeys(bv.OnlyIf) {
+		if !conditionExists(name) {
+			errs = errs.Also(errInvalidReference(name).ViaFieldKey("only_if", name))
+		}
+	}
+
+	return errs
+}
+
+func errInvalidReference(name string) *validation.FieldError {
+	return &validation.FieldError{
+		Message: fmt.Sprintf("invalid reference to variable %q", name),
+		Paths:   []string{validation.CurrentField},
+		Details: "relationships must refer to other variables in the same list, conditions can also refer to plan variables",
+	}
+}
+
+// ValidateVariableRelationships checks that the relationships between the
+// variables only refer to other variables in the list. The conditions of
+// required_if and only_if can also refer to the plan variables so inputs can
+// depend on the plan, for example only allowing replicas on HA plans.
+func ValidateVariableRelationships(variables, planVariables []BrokerVariable) (errs *validation.FieldError) {
+	names := utils.NewStringSet()
+	for _, v := range variables {
+		names.Add(v.FieldName)
+	}
+
+	conditionNames := utils.NewStringSet(names.ToSlice()...)
+	for _, v := range planVariables {
+		conditionNames.Add(v.FieldName)
+	}
+
+	for i, v := range variables {
+		errs = errs.Also(v.validateReferences(names.Contains, conditionNames.Contains).ViaIndex(i))
+	}
+
+	return errs
+}
+
+// resolvePlanConditions gets a copy of the variables where conditions on the
+// plan's properties that hold for the plan are removed, so the schema for
+// the plan only checks the parameters users can set. Conditions that don't
+// hold are kept, users can't set plan properties so they never match.
+// A required_if condition that only depended on the plan makes the variable
+// required.
+func resolvePlanConditions(variables []BrokerVariable, plan ServicePlan) []BrokerVariable {
+	var out []BrokerVariable
+	for _, v := range variables {
+		v.RequiredIf = resolveConditions(v.RequiredIf, plan.ServiceProperties)
+		if v.RequiredIf != nil && len(v.RequiredIf) == 0 {
+			v.RequiredIf = nil
+			v.Required = true
+		}
+
+		v.OnlyIf = resolveConditions(v.OnlyIf, plan.ServiceProperties)
+		if len(v.OnlyIf) == 0 {
+			v.OnlyIf = nil
+		}
+
+		out = append(out, v)
+	}
+
+	return out
+}
+
+// resolveConditions removes the conditions on plan properties if all of them
+// hold, otherwise the conditions are returned as-is.
+func resolveConditions(conditions map[string]interface{}, planProperties map[string]string) map[string]interface{} {
+	if conditions == nil {
+		return nil
+	}
+
+	out := make(map[string]interface{})
+	for name, expected := range conditions {
+		actual, ok := planProperties[name]
+		switch {
+		case !ok:
+			out[name] = expected
+		case !valuesEqual(actual, expected):
+			return conditions
+		}
+	}
+
+	return out
+}
+
+// DescribeRelationships gets a human-readable sentence for each relationship
+// of the variable.
+func (bv *BrokerVariable) DescribeRelationships() []string {
+	var out []string
+
+	if len(bv.DependsOn) > 0 {
+		out = append(out, fmt.Sprintf("Requires %s to be set.", joinNames(bv.DependsOn, "and")))
+	}
+
+	if len(bv.RequiredIf) > 0 {
+		out = append(out, fmt.Sprintf("Required when %s.", describeConditions(bv.RequiredIf)))
+	}
+
+	if len(bv.OnlyIf) > 0 {
+		out = append(out, fmt.Sprintf("Can only be set when %s.", describeConditions(bv.OnlyIf)))
+	}
+
+	if len(bv.OneOf) > 0 {
+		out = append(out, fmt.Sprintf("Exactly one of %s must be set.", joinNames(bv.oneOfGroup(), "or")))
+	}
+
+	return out
+}
+
+// oneOfGroup gets the sorted names of the variable and its alternatives.
+func (bv *BrokerVariable) oneOfGroup() []string {
+	group := utils.NewStringSet(bv.OneOf...)
+	group.Add(bv.FieldName)
+
+	return group.ToSlice()
+}
+
+// addRelationships adds the relationships between the variables to the
+// schema. Variables that depend on others are listed under "dependencies",
+// and conditions and groups of alternatives are combined with "allOf".
+func addRelationships(schema map[string]interface{}, variables []BrokerVariable) {
+	dependencies := make(map[string]interface{})
+	var allOf []interface{}
+	seenGroups := utils.NewStringSet()
+
+	for _, v := range variables {
+		if len(v.DependsOn) > 0 {
+			dependencies[v.FieldName] = utils.NewStringSet(v.DependsOn...).ToSlice()
+		}
+
+		if len(v.RequiredIf) > 0 {
+			allOf = append(allOf, map[string]interface{}{
+				validation.KeyIf:   conditionSchema(v.RequiredIf),
+				validation.KeyThen: map[string]interface{}{validation.KeyRequired: []string{v.FieldName}},
+			})
+		}
+
+		if len(v.OnlyIf) > 0 {
+			allOf = append(allOf, map[string]interface{}{
+				validation.KeyIf: conditionSchema(v.OnlyIf),
+				validation.KeyElse: map[string]interface{}{
+					validation.KeyNot: map[string]interface{}{validation.KeyRequired: []string{v.FieldName}},
+				},
+			})
+		}
+
+		if len(v.OneOf) > 0 {
+			group := v.oneOfGroup()
+			key := strings.Join(group, ",")
+			if seenGroups.Contains(key) {
+				continue
+			}
+			seenGroups.Add(key)
+
+			var alternatives []interface{}
+			for _, name := range group {
+				alternatives = append(alternatives, map[string]interface{}{validation.KeyRequired: []string{name}})
+			}
+			allOf = append(allOf, map[string]interface{}{validation.KeyOneOf: alternatives})
+		}
+	}
+
+	if len(dependencies) > 0 {
+		schema[validation.KeyDependencies] = dependencies
+	}
+
+	if len(allOf) > 0 {
+		schema[validation.KeyAllOf] = allOf
+	}
+}
+
+// conditionSchema creates a schema that matches objects where every key in
+// conditions is set to its value.
+func conditionSchema(conditions map[string]interface{}) map[string]interface{} {
+	names := sortedKeys(conditions)
+	properties := make(map[string]interface{})
+	for _, name := range names {
+		properties[name] = map[string]interface{}{validation.KeyEnum: []interface{}{conditions[name]}}
+	}
+
+	return map[string]interface{}{
+		validation.KeyProperties: properties,
+		validation.KeyRequired:   names,
+	}
+}
+
+// relationshipErrors checks the parameters satisfy the relationships between
+// the variables.
+func relationshipErrors(parameters map[string]interface{}, variables []BrokerVariable) []error {
+	var errs []error
+	seenGroups := utils.NewStringSet()
+
+	for _, v := range variables {
+		_, set := parameters[v.FieldName]
+
+		if set {
+			var missing []string
+			for _, name := range v.DependsOn {
+				if _, ok := parameters[name]; !ok {
+					missing = append(missing, name)
+				}
+			}
+
+			if len(missing) > 0 {
+				errs = append(errs, fmt.Errorf("%s: %s requires %s to be set", v.FieldName, v.FieldName, joinNames(missing, "and")))
+			}
+		}
+
+		if !set && len(v.RequiredIf) > 0 && conditionsHold(parameters, v.RequiredIf) {
+			errs = append(errs, fmt.Errorf("%s: %s is required when %s", v.FieldName, v.FieldName, describeConditions(v.RequiredIf)))
+		}
+
+		if set && len(v.OnlyIf) > 0 && !conditionsHold(parameters, v.OnlyIf) {
+			errs = append(errs, fmt.Errorf("%s: %s can only be set when %s", v.FieldName, v.FieldName, describeConditions(v.OnlyIf)))
+		}
+
+		if len(v.OneOf) > 0 {
+			group := v.oneOfGroup()
+			key := strings.Join(group, ",")
+			if seenGroups.Contains(key) {
+				continue
+			}
+			seenGroups.Add(key)
+
+			var setNames []string
+			for _, name := range group {
+				if _, ok := parameters[name]; ok {
+					setNames = append(setNames, name)
+				}
+			}
+
+			switch len(setNames) {
+			case 0:
+				errs = append(errs, fmt.Errorf("%s: exactly one of %s must be set, got none", v.FieldName, joinNames(group, "or")))
+			case 1:
+				// valid
+			default:
+				errs = append(errs, fmt.Errorf("%s: exactly one of %s must be set, got %s", v.FieldName, joinNames(group, "or"), joinNames(setNames, "and")))
+			}
+		}
+	}
+
+	return errs
+}
+
+// conditionsHold checks every key in conditions is set to its value in the
+// parameters, see valuesEqual.
+func conditionsHold(parameters map[string]interface{}, conditions map[string]interface{}) bool {
+	for name, expected := range conditions {
+		actual, ok := parameters[name]
+		if !ok || !valuesEqual(actual, expected) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// valuesEqual compares the values as JSON. Plan properties are always
+// strings so a string also equals a value whose JSON it holds e.g. "3"
+// equals 3.
+func valuesEqual(actual, expected interface{}) bool {
+	if str, ok := actual.(string); ok && str == jsonString(expected) {
+		return true
+	}
+
+	return jsonString(actual) == jsonString(expected)
+}
+
+// describeConditions gets a human-readable description of the conditions
+// like: tier is "HA" and backups_enabled is true
+func describeConditions(conditions map[string]interface{}) string {
+	var parts []string
+	for _, name := range sortedKeys(conditions) {
+		parts = append(parts, fmt.Sprintf("%s is %s", name, jsonString(conditions[name])))
+	}
+
+	return strings.Join(parts, " and ")
+}
+
+func jsonString(value interface{}) string {
+	out, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return string(out)
+}
+
+// joinNames joins the names in a list like: a, b or c
+func joinNames(names []string, conjunction string) string {
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+
+	return fmt.Sprintf("%s %s %s", strings.Join(names[:len(names)-1], ", "), conjunction, names[len(names)-1])
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -34,8 +34,15 @@ const (
 	JsonTypeNumeric JsonType = "number"
 	JsonTypeInteger JsonType = "integer"
 	JsonTypeBoolean JsonType = "boolean"
+	JsonTypeObject  JsonType = "object"
+	JsonTypeArray   JsonType = "array"
 )
 
+// jsonSchemaDraft is the JSON Schema version of generated schemas. Draft 7
+// is needed for if/then/else, numeric exclusive bounds, readOnly and
+// writeOnly.
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
 type JsonType string
 
 type BrokerVariable struct {
@@ -56,7 +63,84 @@ type BrokerVariable struct {
 	// Keys are valid JSON Schema validation keywords, and values are their
 	// associated values.
 	// http://json-schema.org/latest/json-schema-validation.html
-	Constraints map[string]interface{} `yaml:"constraints,omitempty"`
+	Constraints validation.ConstraintBuilder `yaml:"constraints,omitempty"`
+	// Updatable variables are included in the instance update schema.
+	Updatable bool `yaml:"updatable,omitempty"`
+
+	// Properties holds the fields of object variables. Their field names are
+	// the keys of the object.
+	Properties []BrokerVariable `yaml:"properties,omitempty"`
+	// Items describes the elements of array variables, its field name is
+	// ignored.
+	Items *BrokerVariable `yaml:"items,omitempty"`
+
+	// DependsOn holds the names of variables that must be set if this one is.
+	DependsOn []string `yaml:"depends_on,omitempty"`
+	// RequiredIf makes the variable required when the variables named by the
+	// keys all have the given values.
+	RequiredIf map[string]interface{} `yaml:"required_if,omitempty"`
+	// OnlyIf only allows the variable to be set when the variables named by the
+	// keys all have the given values.
+	OnlyIf map[string]interface{} `yaml:"only_if,omitempty"`
+	// OneOf holds the names of alternatives to this variable, exactly one of
+	// them or this variable must be set.
+	OneOf []string `yaml:"one_of,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler. YAML decodes objects as
+// map[interface{}]interface{} which can't be converted to JSON so they're
+// replaced with map[string]interface{}.
+func (bv *BrokerVariable) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain BrokerVariable
+	if err := unmarshal((*plain)(bv)); err != nil {
+		return err
+	}
+
+	bv.Default = jsonCompatible(bv.Default)
+	bv.Constraints = jsonCompatibleMap(bv.Constraints)
+	bv.RequiredIf = jsonCompatibleMap(bv.RequiredIf)
+	bv.OnlyIf = jsonCompatibleMap(bv.OnlyIf)
+
+	return nil
+}
+
+// jsonCompatible replaces maps with non-string keys in the value with
+// map[string]interface{}.
+func jsonCompatible(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{})
+		for key, elem := range v {
+			out[fmt.Sprintf("%v", key)] = jsonCompatible(elem)
+		}
+		return out
+
+	case map[string]interface{}:
+		return jsonCompatibleMap(v)
+
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, elem := range v {
+			out[i] = jsonCompatible(elem)
+		}
+		return out
+
+	default:
+		return value
+	}
+}
+
+func jsonCompatibleMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+
+	out := make(map[string]interface{})
+	for key, elem := range m {
+		out[key] = jsonCompatible(elem)
+	}
+
+	return out
 }
 
 var _ validation.Validatable = (*ServiceDefinition)(nil)
@@ -65,11 +149,61 @@ var _ validation.Validatable = (*ServiceDefinition)(nil)
 func (bv *BrokerVariable) Validate() (errs *validation.FieldError) {
 	return errs.Also(
 		validation.ErrIfBlank(bv.FieldName, "field_name"),
-		validation.ErrIfNotJSONSchemaType(string(bv.Type), "type"),
 		validation.ErrIfBlank(bv.Details, "details"),
+		bv.validateType(),
+		bv.validateRelationships(),
 	)
 }
 
+// validateType checks the type of the variable and the schemas nested in it.
+func (bv *BrokerVariable) validateType() (errs *validation.FieldError) {
+	errs = errs.Also(
+		validation.ErrIfNotJSONSchemaType(string(bv.Type), "type"),
+		bv.Constraints.Validate().ViaField("constraints"),
+	)
+
+	if len(bv.Properties) > 0 && bv.Type != JsonTypeObject {
+		errs = errs.Also(&validation.FieldError{
+			Message: "properties can only be set on object variables",
+			Paths:   []string{"properties"},
+		})
+	}
+
+	if bv.Items != nil && bv.Type != JsonTypeArray {
+		errs = errs.Also(&validation.FieldError{
+			Message: "items can only be set on array variables",
+			Paths:   []string{"items"},
+		})
+	}
+
+	for i, prop := range bv.Properties {
+		errs = errs.Also(
+			validation.ErrIfBlank(prop.FieldName, "field_name").ViaFieldIndex("properties", i),
+			prop.validateNested().ViaFieldIndex("properties", i),
+		)
+	}
+
+	if bv.Items != nil {
+		errs = errs.Also(bv.Items.validateNested().ViaField("items"))
+	}
+
+	return errs
+}
+
+// validateNested checks a schema nested in an object or array variable.
+// Relationships are only checked between top level variables so they can't
+// be used in nested schemas.
+func (bv *BrokerVariable) validateNested() (errs *validation.FieldError) {
+	if len(bv.DependsOn) > 0 || len(bv.RequiredIf) > 0 || len(bv.OnlyIf) > 0 || len(bv.OneOf) > 0 {
+		errs = errs.Also(&validation.FieldError{
+			Message: "relationships can only be set on top level variables",
+			Paths:   []string{validation.CurrentField},
+		})
+	}
+
+	return errs.Also(bv.validateType())
+}
+
 // ToSchema converts the BrokerVariable into the value part of a JSON Schema.
 func (bv *BrokerVariable) ToSchema() map[string]interface{} {
 	schema := map[string]interface{}{}
@@ -106,6 +240,26 @@ func (bv *BrokerVariable) ToSchema() map[string]interface{} {
 		schema[validation.KeyType] = bv.Type
 	}
 
+	if len(bv.Properties) > 0 {
+		properties := make(map[string]interface{})
+		required := utils.NewStringSet()
+		for _, prop := range bv.Properties {
+			properties[prop.FieldName] = prop.ToSchema()
+			if prop.Required {
+				required.Add(prop.FieldName)
+			}
+		}
+
+		schema[validation.KeyProperties] = properties
+		if !required.IsEmpty() {
+			schema[validation.KeyRequired] = required.ToSlice()
+		}
+	}
+
+	if bv.Items != nil {
+		schema[validation.KeyItems] = bv.Items.ToSchema()
+	}
+
 	if bv.Default != nil {
 		// HIL values shouldn't get set as Defaults, instead they should be added to the description field.
 		if defaultString, ok := bv.Default.(string); ok && interpolation.IsHILExpression(defaultString) {
@@ -154,37 +308,144 @@ func ApplyDefaults(parameters map[string]interface{}, variables []BrokerVariable
 
 }
 
+// ValidateVariables validates the parameters against the JSON Schema of the
+// BrokerVariables and the relationships between them.
 func ValidateVariables(parameters map[string]interface{}, variables []BrokerVariable) error {
-	schema := CreateJsonSchema(variables)
-	return ValidateVariablesAgainstSchema(parameters, schema)
+	return validateVariables(parameters, variables, nil)
+}
+
+// ValidateVariableSchemas validates the parameters against the JSON Schema of
+// the BrokerVariables without checking the relationships between them.
+func ValidateVariableSchemas(parameters map[string]interface{}, variables []BrokerVariable) error {
+	return ValidateVariablesAgainstSchema(parameters, createPropertiesSchema(variables))
 }
 
 // ValidateVariables validates a list of BrokerVariables are adhering to their JSONSchema.
 func ValidateVariablesAgainstSchema(parameters map[string]interface{}, schema map[string]interface{}) error {
+	errs, err := schemaErrors(parameters, schema, nil)
+	if err != nil {
+		return err
+	}
 
-	result, err := gojsonschema.Validate(gojsonschema.NewGoLoader(schema), gojsonschema.NewGoLoader(parameters))
+	return toMultiError(errs)
+}
+
+// ValidateComputedVariables validates the parameters against the
+// BrokerVariables like ValidateVariables. Errors for values computed from a
+// template include the template, templateFor gets the template for a key if
+// its value was computed from one.
+func ValidateComputedVariables(parameters map[string]interface{}, variables []BrokerVariable, templateFor func(key string) (string, bool)) error {
+	return validateVariables(parameters, variables, templateFor)
+}
+
+// validateVariables checks the relationships between variables separately
+// from the rest of the schema so the errors name the variables involved
+// rather than the JSON Schema keywords that failed.
+func validateVariables(parameters map[string]interface{}, variables []BrokerVariable, templateFor func(key string) (string, bool)) error {
+	errs, err := schemaErrors(parameters, createPropertiesSchema(variables), templateFor)
 	if err != nil {
 		return err
 	}
 
-	resultErrors := result.Errors()
-	if len(resultErrors) == 0 {
-		return nil
+	errs = append(errs, relationshipErrors(parameters, variables)...)
+	return toMultiError(errs)
+}
+
+func schemaErrors(parameters map[string]interface{}, schema map[string]interface{}, templateFor func(key string) (string, bool)) ([]error, error) {
+
+	result, err := gojsonschema.Validate(gojsonschema.NewGoLoader(schema), gojsonschema.NewGoLoader(parameters))
+	if err != nil {
+		return nil, err
 	}
 
-	allErrors := &multierror.Error{
-		ErrorFormat: utils.SingleLineErrorFormatter,
+	var errs []error
+	for _, r := range result.Errors() {
+		field := errorField(r)
+		msg := fmt.Sprintf("%s: %s", field, r.Description())
+
+		// nested fields like a.b are reported on the top level variable
+		variable := strings.SplitN(field, ".", 2)[0]
+		if templateFor != nil {
+			if template, ok := templateFor(variable); ok {
+				msg = fmt.Sprintf("%s (computed from template %q)", msg, template)
+			}
+		}
+
+		errs = append(errs, errors.New(msg))
+	}
+
+	return errs, nil
+}
+
+// errorField gets the path to the field a schema error is about. Errors about
+// a property, like it being required, are reported by gojsonschema with the
+// property name only so the path of the object is added for nested objects.
+func errorField(r gojsonschema.ResultError) string {
+	context := strings.TrimPrefix(r.Context().String(), gojsonschema.STRING_ROOT_SCHEMA_PROPERTY)
+	context = strings.TrimPrefix(context, ".")
+
+	property, ok := r.Details()["property"].(string)
+	switch {
+	case !ok && context == "":
+		return gojsonschema.STRING_ROOT_SCHEMA_PROPERTY
+	case !ok:
+		return context
+	case context == "":
+		return property
+	default:
+		return context + "." + property
 	}
+}
 
-	for _, r := range resultErrors {
-		multierror.Append(allErrors, errors.New(r.String()))
+func toMultiError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
 	}
 
-	return allErrors
+	return &multierror.Error{
+		Errors:      errs,
+		ErrorFormat: utils.SingleLineErrorFormatter,
+	}
 }
 
 // CreateJsonSchema outputs a JSONSchema given a list of BrokerVariables
 func CreateJsonSchema(schemaVariables []BrokerVariable) map[string]interface{} {
+	schema := createPropertiesSchema(schemaVariables)
+	addRelationships(schema, schemaVariables)
+
+	return schema
+}
+
+// CreateUpdateJsonSchema outputs a JSONSchema for the variables that can be
+// changed when updating an instance. Updates only contain the values being
+// changed so nothing is required and relationships aren't included.
+func CreateUpdateJsonSchema(schemaVariables []BrokerVariable) map[string]interface{} {
+	var updatable []BrokerVariable
+	for _, variable := range schemaVariables {
+		if variable.Updatable {
+			variable.Required = false
+			updatable = append(updatable, variable)
+		}
+	}
+
+	return createPropertiesSchema(updatable)
+}
+
+// CreateResponseJsonSchema outputs a JSONSchema for values the broker returns,
+// like binding credentials. Every property is marked readOnly.
+func CreateResponseJsonSchema(schemaVariables []BrokerVariable) map[string]interface{} {
+	schema := CreateJsonSchema(schemaVariables)
+
+	for _, property := range schema[validation.KeyProperties].(map[string]interface{}) {
+		property.(map[string]interface{})[validation.KeyReadOnly] = true
+	}
+
+	return schema
+}
+
+// createPropertiesSchema creates a JSONSchema for the BrokerVariables without
+// the relationships between them.
+func createPropertiesSchema(schemaVariables []BrokerVariable) map[string]interface{} {
 	required := utils.NewStringSet()
 	properties := make(map[string]interface{})
 
@@ -196,7 +457,7 @@ func CreateJsonSchema(schemaVariables []BrokerVariable) map[string]interface{} {
 	}
 
 	schema := map[string]interface{}{
-		"$schema":    "http://json-schema.org/draft-04/schema#",
+		"$schema":    jsonSchemaDraft,
 		"type":       "object",
 		"properties": properties,
 	}
@@ -15,11 +15,14 @@
 package broker
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"reflect"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/validation"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func TestBrokerVariable_ToSchema(t *testing.T) {
@@ -60,6 +63,36 @@ func TestBrokerVariable_ToSchema(t *testing.T) {
 				"description": `Some value. If you do not specify this field, it will be generated by the template "${33}"`,
 			},
 		},
+		"object properties": {
+			BrokerVariable{
+				Type: JsonTypeObject,
+				Properties: []BrokerVariable{
+					{FieldName: "name", Type: JsonTypeString, Required: true},
+					{FieldName: "size", Type: JsonTypeInteger},
+				},
+			},
+			map[string]interface{}{
+				"type": JsonTypeObject,
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{"title": "Name", "type": JsonTypeString},
+					"size": map[string]interface{}{"title": "Size", "type": JsonTypeInteger},
+				},
+				"required": []string{"name"},
+			},
+		},
+		"array items": {
+			BrokerVariable{
+				Type:  JsonTypeArray,
+				Items: &BrokerVariable{Type: JsonTypeString, Details: "A CIDR."},
+			},
+			map[string]interface{}{
+				"type": JsonTypeArray,
+				"items": map[string]interface{}{
+					"type":        JsonTypeString,
+					"description": "A CIDR.",
+				},
+			},
+		},
 		"full test": {
 			BrokerVariable{
 				FieldName: "full_test_field_name",
@@ -182,6 +215,35 @@ func TestBrokerVariable_ValidateVariables(t *testing.T) {
 			},
 			Expected: errors.New("1 error(s) occurred: test: test is required"),
 		},
+		"nested object": {
+			Parameters: map[string]interface{}{
+				"test": map[string]interface{}{"size": "large"},
+			},
+			Variables: []BrokerVariable{
+				{
+					FieldName: "test",
+					Type:      JsonTypeObject,
+					Properties: []BrokerVariable{
+						{FieldName: "name", Type: JsonTypeString, Required: true},
+						{FieldName: "size", Type: JsonTypeInteger},
+					},
+				},
+			},
+			Expected: errors.New("2 error(s) occurred: test.name: name is required; test.size: Invalid type. Expected: integer, given: string"),
+		},
+		"array items": {
+			Parameters: map[string]interface{}{
+				"test": []interface{}{"a", 1},
+			},
+			Variables: []BrokerVariable{
+				{
+					FieldName: "test",
+					Type:      JsonTypeArray,
+					Items:     &BrokerVariable{Type: JsonTypeString},
+				},
+			},
+			Expected: errors.New("1 error(s) occurred: test.1: Invalid type. Expected: string, given: integer"),
+		},
 		"test incorrect schema": {
 			Parameters: map[string]interface{}{},
 			Variables: []BrokerVariable{
@@ -292,3 +354,310 @@ func TestFieldNameToLabel(t *testing.T) {
 		})
 	}
 }
+
+func relationshipTestVariables() []BrokerVariable {
+	return []BrokerVariable{
+		{FieldName: "tier", Type: JsonTypeString, Details: "The tier.", Default: "BASIC"},
+		{FieldName: "replica_count", Type: JsonTypeInteger, Details: "Replicas.", OnlyIf: map[string]interface{}{"tier": "HA"}},
+		{FieldName: "backups_enabled", Type: JsonTypeBoolean, Details: "Backups.", Default: false},
+		{FieldName: "backups_start_time", Type: JsonTypeString, Details: "Start time.", RequiredIf: map[string]interface{}{"backups_enabled": true}},
+		{FieldName: "backups_location", Type: JsonTypeString, Details: "Location.", DependsOn: []string{"backups_enabled"}},
+		{FieldName: "authorized_networks", Type: JsonTypeString, Details: "Networks.", OneOf: []string{"private_network"}},
+		{FieldName: "private_network", Type: JsonTypeString, Details: "Network.", OneOf: []string{"authorized_networks"}},
+	}
+}
+
+func TestCreateJsonSchema_relationships(t *testing.T) {
+	schema := CreateJsonSchema(relationshipTestVariables())
+
+	if schema["$schema"] != "http://json-schema.org/draft-07/schema#" {
+		t.Errorf("Expected conditional schemas to use draft 7, got %v", schema["$schema"])
+	}
+
+	expectedDependencies := map[string]interface{}{"backups_location": []string{"backups_enabled"}}
+	if !reflect.DeepEqual(schema["dependencies"], expectedDependencies) {
+		t.Errorf("Expected dependencies %v, got %v", expectedDependencies, schema["dependencies"])
+	}
+
+	expectedAllOf := []interface{}{
+		map[string]interface{}{
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{"tier": map[string]interface{}{"enum": []interface{}{"HA"}}},
+				"required":   []string{"tier"},
+			},
+			"else": map[string]interface{}{"not": map[string]interface{}{"required": []string{"replica_count"}}},
+		},
+		map[string]interface{}{
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{"backups_enabled": map[string]interface{}{"enum": []interface{}{true}}},
+				"required":   []string{"backups_enabled"},
+			},
+			"then": map[string]interface{}{"required": []string{"backups_start_time"}},
+		},
+		map[string]interface{}{
+			"oneOf": []interface{}{
+				map[string]interface{}{"required": []string{"authorized_networks"}},
+				map[string]interface{}{"required": []string{"private_network"}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(schema["allOf"], expectedAllOf) {
+		t.Errorf("Expected allOf %v, got %v", expectedAllOf, schema["allOf"])
+	}
+
+	// The schema published in the catalog enforces the same rules.
+	valid := map[string]interface{}{"tier": "HA", "replica_count": 2, "backups_enabled": false, "private_network": "default"}
+	if err := ValidateVariablesAgainstSchema(valid, schema); err != nil {
+		t.Errorf("Expected valid parameters to pass the schema, got: %v", err)
+	}
+
+	invalid := map[string]interface{}{"tier": "BASIC", "replica_count": 2, "backups_enabled": false, "private_network": "default"}
+	if err := ValidateVariablesAgainstSchema(invalid, schema); err == nil {
+		t.Error("Expected invalid parameters to fail the schema")
+	}
+}
+
+func TestValidateVariables_relationships(t *testing.T) {
+	cases := map[string]struct {
+		Parameters map[string]interface{}
+		Expected   error
+	}{
+		"valid": {
+			Parameters: map[string]interface{}{"tier": "HA", "replica_count": 2, "backups_enabled": true, "backups_start_time": "04:00", "backups_location": "us", "private_network": "default"},
+			Expected:   nil,
+		},
+		"only if": {
+			Parameters: map[string]interface{}{"tier": "BASIC", "replica_count": 2, "backups_enabled": false, "private_network": "default"},
+			Expected:   errors.New(`1 error(s) occurred: replica_count: replica_count can only be set when tier is "HA"`),
+		},
+		"required if": {
+			Parameters: map[string]interface{}{"tier": "BASIC", "backups_enabled": true, "private_network": "default"},
+			Expected:   errors.New(`1 error(s) occurred: backups_start_time: backups_start_time is required when backups_enabled is true`),
+		},
+		"depends on": {
+			Parameters: map[string]interface{}{"tier": "BASIC", "backups_location": "us", "private_network": "default"},
+			Expected:   errors.New(`1 error(s) occurred: backups_location: backups_location requires backups_enabled to be set`),
+		},
+		"one of missing": {
+			Parameters: map[string]interface{}{"tier": "BASIC", "backups_enabled": false},
+			Expected:   errors.New(`1 error(s) occurred: authorized_networks: exactly one of authorized_networks or private_network must be set, got none`),
+		},
+		"one of both": {
+			Parameters: map[string]interface{}{"tier": "BASIC", "backups_enabled": false, "authorized_networks": "0.0.0.0/0", "private_network": "default"},
+			Expected:   errors.New(`1 error(s) occurred: authorized_networks: exactly one of authorized_networks or private_network must be set, got authorized_networks and private_network`),
+		},
+		"strings match values by JSON": {
+			Parameters: map[string]interface{}{"tier": "3", "backups_enabled": false, "private_network": "default"},
+			Expected:   errors.New(`1 error(s) occurred: size: size is required when tier is 3`),
+		},
+		"numbers compare by value": {
+			Parameters: map[string]interface{}{"tier": "BASIC", "backups_enabled": false, "private_network": "default", "size": 3.0},
+			Expected:   nil,
+		},
+	}
+
+	variables := append(relationshipTestVariables(), BrokerVariable{FieldName: "size", Type: JsonTypeNumeric, Details: "Size.", RequiredIf: map[string]interface{}{"tier": 3}})
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			actual := ValidateVariables(tc.Parameters, variables)
+			if fmt.Sprint(actual) != fmt.Sprint(tc.Expected) {
+				t.Errorf("Expected error %v, got %v", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func TestValidateVariableSchemas(t *testing.T) {
+	variables := []BrokerVariable{
+		{FieldName: "backups_location", Type: JsonTypeString, Details: "Location.", DependsOn: []string{"backups_enabled"}},
+	}
+
+	if err := ValidateVariableSchemas(map[string]interface{}{"backups_location": "us"}, variables); err != nil {
+		t.Errorf("Expected relationships to be ignored, got %v", err)
+	}
+
+	expected := "1 error(s) occurred: backups_location: Invalid type. Expected: string, given: integer"
+	if err := ValidateVariableSchemas(map[string]interface{}{"backups_location": 42}, variables); fmt.Sprint(err) != expected {
+		t.Errorf("Expected error %v, got %v", expected, err)
+	}
+}
+
+func TestBrokerVariable_Validate_relationships(t *testing.T) {
+	cases := map[string]validation.ValidatableTest{
+		"valid": {
+			Object: &BrokerVariable{FieldName: "a", Type: JsonTypeString, Details: "A.", OnlyIf: map[string]interface{}{"b": "c"}},
+			Expect: nil,
+		},
+		"only if with default": {
+			Object: &BrokerVariable{FieldName: "a", Type: JsonTypeString, Details: "A.", Default: "x", OnlyIf: map[string]interface{}{"b": "c"}},
+			Expect: errors.New("only_if can't be combined with a default: default\nthe default would always set the variable, use a computed input to set it conditionally"),
+		},
+		"depends on with default": {
+			Object: &BrokerVariable{FieldName: "a", Type: JsonTypeString, Details: "A.", Default: "x", DependsOn: []string{"b"}},
+			Expect: errors.New("depends_on can't be combined with a default: default\nthe default would always set the variable so the variables it depends on would always be required"),
+		},
+		"required if with default": {
+			Object: &BrokerVariable{FieldName: "a", Type: JsonTypeString, Details: "A.", Default: "x", RequiredIf: map[string]interface{}{"b": "c"}},
+			Expect: errors.New("required_if can't be combined with a default: default\nthe default would always set the variable so the condition would never be checked"),
+		},
+		"one of with default": {
+			Object: &BrokerVariable{FieldName: "a", Type: JsonTypeString, Details: "A.", Default: "x", OneOf: []string{"b"}},
+			Expect: errors.New("one_of can't be combined with a default: default\nthe default would always set the variable so its alternatives could never be used"),
+		},
+		"self reference": {
+			Object: &BrokerVariable{FieldName: "a", Type: JsonTypeString, Details: "A.", DependsOn: []string{"a"}},
+			Expect: errors.New(`invalid reference to variable "a": depends_on[0]` + "\nrelationships must refer to other variables in the same list, conditions can also refer to plan variables"),
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			tc.Assert(t)
+		})
+	}
+}
+
+func TestBrokerVariable_Validate_types(t *testing.T) {
+	cases := map[string]validation.ValidatableTest{
+		"object": {
+			Object: &BrokerVariable{FieldName: "a", Type: JsonTypeObject, Details: "A.", Properties: []BrokerVariable{{FieldName: "b", Type: JsonTypeString}}},
+			Expect: nil,
+		},
+		"array": {
+			Object: &BrokerVariable{FieldName: "a", Type: JsonTypeArray, Details: "A.", Items: &BrokerVariable{Type: JsonTypeString}},
+			Expect: nil,
+		},
+		"properties on a string": {
+			Object: &BrokerVariable{FieldName: "a", Type: JsonTypeString, Details: "A.", Properties: []BrokerVariable{{FieldName: "b", Type: JsonTypeString}}},
+			Expect: errors.New("properties can only be set on object variables: properties"),
+		},
+		"items on an object": {
+			Object: &BrokerVariable{FieldName: "a", Type: JsonTypeObject, Details: "A.", Items: &BrokerVariable{Type: JsonTypeString}},
+			Expect: errors.New("items can only be set on array variables: items"),
+		},
+		"unnamed property": {
+			Object: &BrokerVariable{FieldName: "a", Type: JsonTypeObject, Details: "A.", Properties: []BrokerVariable{{Type: JsonTypeString}}},
+			Expect: errors.New("missing field(s): properties[0].field_name"),
+		},
+		"bad item type": {
+			Object: &BrokerVariable{FieldName: "a", Type: JsonTypeArray, Details: "A.", Items: &BrokerVariable{Type: "list"}},
+			Expect: errors.New("field must match '^(|object|boolean|array|number|string|integer)$': items.type"),
+		},
+		"bad constraints": {
+			Object: &BrokerVariable{FieldName: "a", Type: JsonTypeString, Details: "A.", Constraints: validation.ConstraintBuilder{"maxlength": 3}},
+			Expect: errors.New(`invalid key name "maxlength": constraints` + "\nthe key isn't a supported JSON Schema constraint"),
+		},
+		"nested relationships": {
+			Object: &BrokerVariable{FieldName: "a", Type: JsonTypeArray, Details: "A.", Items: &BrokerVariable{Type: JsonTypeString, DependsOn: []string{"b"}}},
+			Expect: errors.New("relationships can only be set on top level variables: items"),
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			tc.Assert(t)
+		})
+	}
+}
+
+func TestBrokerVariable_UnmarshalYAML(t *testing.T) {
+	doc := `
+field_name: flags
+type: object
+details: Flags.
+default:
+  general_log: "on"
+constraints:
+  additionalProperties:
+    type: string
+required_if:
+  tier: HA
+properties:
+- field_name: nested
+  type: array
+  details: Nested.
+  default: [{a: 1}]
+  items:
+    type: object
+    details: Item.
+`
+	var actual BrokerVariable
+	if err := yaml.Unmarshal([]byte(doc), &actual); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := BrokerVariable{
+		FieldName:   "flags",
+		Type:        JsonTypeObject,
+		Details:     "Flags.",
+		Default:     map[string]interface{}{"general_log": "on"},
+		Constraints: map[string]interface{}{"additionalProperties": map[string]interface{}{"type": "string"}},
+		RequiredIf:  map[string]interface{}{"tier": "HA"},
+		Properties: []BrokerVariable{
+			{
+				FieldName: "nested",
+				Type:      JsonTypeArray,
+				Details:   "Nested.",
+				Default:   []interface{}{map[string]interface{}{"a": 1}},
+				Items:     &BrokerVariable{Type: JsonTypeObject, Details: "Item."},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %#v, got %#v", expected, actual)
+	}
+
+	if _, err := json.Marshal(actual.ToSchema()); err != nil {
+		t.Errorf("Expected the schema to be JSON compatible, got %v", err)
+	}
+}
+
+func TestValidateVariableRelationships(t *testing.T) {
+	variables := []BrokerVariable{
+		{FieldName: "a", RequiredIf: map[string]interface{}{"b": true}},
+		{FieldName: "b", OneOf: []string{"c"}, DependsOn: []string{"a"}},
+	}
+
+	err := ValidateVariableRelationships(variables, nil)
+	expected := `invalid reference to variable "c": [1].one_of[0]` + "\nrelationships must refer to other variables in the same list, conditions can also refer to plan variables"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+}
+
+func TestValidateVariableRelationships_planVariables(t *testing.T) {
+	planVariables := []BrokerVariable{{FieldName: "tier"}}
+	variables := []BrokerVariable{
+		{FieldName: "replica_count", OnlyIf: map[string]interface{}{"tier": "HA"}},
+		{FieldName: "failover_zone", RequiredIf: map[string]interface{}{"tier": "HA"}, DependsOn: []string{"tier"}},
+	}
+
+	err := ValidateVariableRelationships(variables, planVariables)
+	expected := `invalid reference to variable "tier": [1].depends_on[0]` + "\nrelationships must refer to other variables in the same list, conditions can also refer to plan variables"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+}
+
+func TestBrokerVariable_DescribeRelationships(t *testing.T) {
+	variable := BrokerVariable{
+		FieldName:  "a",
+		DependsOn:  []string{"b", "c"},
+		RequiredIf: map[string]interface{}{"d": true, "e": "x"},
+		OnlyIf:     map[string]interface{}{"f": 1},
+		OneOf:      []string{"g"},
+	}
+
+	expected := []string{
+		"Requires b and c to be set.",
+		`Required when d is true and e is "x".`,
+		"Can only be set when f is 1.",
+		"Exactly one of a or g must be set.",
+	}
+
+	if actual := variable.DescribeRelationships(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
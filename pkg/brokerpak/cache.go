@@ -0,0 +1,164 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package brokerpak
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/utils/stream"
+)
+
+// ArtifactCache is a local content-addressed store of downloaded artifacts so
+// brokerpaks can be built without network access.
+//
+// Artifacts are stored under sha256/<sum> and an index under urls/ maps the
+// SHA-256 sum of each URL to the sum of the artifact downloaded from it.
+type ArtifactCache struct {
+	// Dir is the directory the cache is stored in.
+	Dir string
+
+	// Offline prevents artifacts that aren't in the cache from being
+	// downloaded.
+	Offline bool
+}
+
+// NewArtifactCache creates a cache in the given directory. If the directory is
+// blank and the cache isn't offline, nil is returned which downloads every
+// artifact.
+func NewArtifactCache(dir string, offline bool) (*ArtifactCache, error) {
+	switch {
+	case dir == "" && offline:
+		return nil, errors.New("offline builds require a cache directory")
+	case dir == "":
+		return nil, nil
+	}
+
+	return &ArtifactCache{Dir: dir, Offline: offline}, nil
+}
+
+// fetch copies the artifact at src to dest, downloading it into the cache
+// first if necessary. If expectedSha256 isn't blank the artifact MUST match
+// it. The hex encoded SHA-256 sum of the artifact is returned.
+func (c *ArtifactCache) fetch(src, dest, expectedSha256 string) (string, error) {
+	if c == nil {
+		return fetchVerifiedArchive(src, dest, expectedSha256)
+	}
+
+	blob, sum, err := c.ensure(src, expectedSha256)
+	if err != nil {
+		return "", err
+	}
+
+	return sum, stream.Copy(stream.FromFile(blob), stream.ToFile(dest))
+}
+
+// ensure makes sure the artifact at src is in the cache and returns its path
+// in the cache along with its hex encoded SHA-256 sum.
+func (c *ArtifactCache) ensure(src, expectedSha256 string) (string, string, error) {
+	sum := strings.ToLower(expectedSha256)
+	if sum == "" {
+		sum = c.lookupUrl(src)
+	}
+
+	if sum != "" {
+		blob := c.blobPath(sum)
+		if _, err := os.Stat(blob); err == nil {
+			if err := c.verifyBlob(blob, sum); err != nil {
+				return "", "", err
+			}
+
+			return blob, sum, c.recordUrl(src, sum)
+		}
+	}
+
+	if c.Offline {
+		return "", "", fmt.Errorf("%q isn't in the cache at %q and can't be downloaded while offline, run pak vendor first", src, c.Dir)
+	}
+
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return "", "", err
+	}
+
+	// Download within the cache so the artifact can be atomically moved into
+	// place once it's been verified.
+	tmp, err := ioutil.TempDir(c.Dir, "download")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	downloaded := filepath.Join(tmp, "artifact")
+	sum, err = fetchVerifiedArchive(src, downloaded, expectedSha256)
+	if err != nil {
+		return "", "", err
+	}
+
+	blob := c.blobPath(sum)
+	if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+		return "", "", err
+	}
+
+	if err := os.Rename(downloaded, blob); err != nil {
+		return "", "", err
+	}
+
+	return blob, sum, c.recordUrl(src, sum)
+}
+
+// verifyBlob checks a cached artifact hasn't been modified since it was
+// stored.
+func (c *ArtifactCache) verifyBlob(blob, sum string) error {
+	digest, err := fileDigest(blob)
+	if err != nil {
+		return err
+	}
+
+	if actual := hex.EncodeToString(digest); actual != sum {
+		return fmt.Errorf("cached artifact %q is corrupt: expected sha256 %s got %s, remove it and try again", blob, sum, actual)
+	}
+
+	return nil
+}
+
+// lookupUrl gets the sum of the artifact last downloaded from the URL or a
+// blank string if it hasn't been downloaded.
+func (c *ArtifactCache) lookupUrl(src string) string {
+	contents, err := ioutil.ReadFile(c.urlPath(src))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(contents))
+}
+
+func (c *ArtifactCache) recordUrl(src, sum string) error {
+	return stream.Copy(stream.FromString(sum+"\n"), stream.ToFile(c.urlPath(src)))
+}
+
+func (c *ArtifactCache) blobPath(sum string) string {
+	return filepath.Join(c.Dir, "sha256", sum)
+}
+
+func (c *ArtifactCache) urlPath(src string) string {
+	digest := sha256.Sum256([]byte(src))
+	return filepath.Join(c.Dir, "urls", hex.EncodeToString(digest[:]))
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package brokerpak
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewArtifactCache(t *testing.T) {
+	cases := map[string]struct {
+		Dir         string
+		Offline     bool
+		ExpectNil   bool
+		ExpectedErr string
+	}{
+		"no cache":         {ExpectNil: true},
+		"cache":            {Dir: "cache"},
+		"offline cache":    {Dir: "cache", Offline: true},
+		"offline no cache": {Offline: true, ExpectNil: true, ExpectedErr: "offline builds require a cache directory"},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			cache, err := NewArtifactCache(tc.Dir, tc.Offline)
+
+			switch {
+			case tc.ExpectedErr == "" && err != nil:
+				t.Fatalf("Expected no error, got: %v", err)
+			case tc.ExpectedErr != "" && (err == nil || err.Error() != tc.ExpectedErr):
+				t.Fatalf("Expected error: %q, got: %v", tc.ExpectedErr, err)
+			}
+
+			if (cache == nil) != tc.ExpectNil {
+				t.Errorf("Expected nil cache? %t, got: %v", tc.ExpectNil, cache)
+			}
+		})
+	}
+}
+
+func TestArtifactCache_fetch(t *testing.T) {
+	cases := map[string]struct {
+		// Setup is called after the artifact has been fetched once by an online
+		// cache.
+		Setup       func(t *testing.T, cache *ArtifactCache, src, srcPath string)
+		ExpectedErr string
+	}{
+		"cached": {
+			Setup: func(t *testing.T, cache *ArtifactCache, src, srcPath string) {
+				os.Remove(srcPath)
+			},
+		},
+		"offline cached": {
+			Setup: func(t *testing.T, cache *ArtifactCache, src, srcPath string) {
+				os.Remove(srcPath)
+				cache.Offline = true
+			},
+		},
+		"offline not cached": {
+			Setup: func(t *testing.T, cache *ArtifactCache, src, srcPath string) {
+				cache.Offline = true
+				os.RemoveAll(cache.Dir)
+			},
+			ExpectedErr: "can't be downloaded while offline",
+		},
+		"upstream changed": {
+			Setup: func(t *testing.T, cache *ArtifactCache, src, srcPath string) {
+				if err := ioutil.WriteFile(srcPath, []byte("changed-contents"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		"corrupt": {
+			Setup: func(t *testing.T, cache *ArtifactCache, src, srcPath string) {
+				if err := ioutil.WriteFile(cache.blobPath(cache.lookupUrl(src)), []byte("corrupt"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			ExpectedErr: "is corrupt",
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "cache-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			srcPath := filepath.Join(dir, "artifact.zip")
+			if err := ioutil.WriteFile(srcPath, []byte("artifact-contents"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			src := "file://" + srcPath
+
+			cache := &ArtifactCache{Dir: filepath.Join(dir, "cache")}
+			sum, err := cache.fetch(src, filepath.Join(dir, "first"), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tc.Setup(t, cache, src, srcPath)
+
+			dest := filepath.Join(dir, "second")
+			secondSum, err := cache.fetch(src, dest, "")
+
+			switch {
+			case tc.ExpectedErr == "" && err != nil:
+				t.Fatalf("Expected no error, got: %v", err)
+			case tc.ExpectedErr != "" && (err == nil || !strings.Contains(err.Error(), tc.ExpectedErr)):
+				t.Fatalf("Expected error containing %q, got: %v", tc.ExpectedErr, err)
+			case tc.ExpectedErr != "":
+				return
+			}
+
+			if secondSum != sum {
+				t.Errorf("Expected sum %s, got %s", sum, secondSum)
+			}
+
+			contents, err := ioutil.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(contents) != "artifact-contents" {
+				t.Errorf("Expected the cached artifact, got: %q", contents)
+			}
+		})
+	}
+}
+
+func TestManifest_Vendor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendor-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	manifest, err := writeFakeBrokerpakSources(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offline := &ArtifactCache{Dir: filepath.Join(dir, "cache"), Offline: true}
+	dest := filepath.Join(dir, "out.brokerpak")
+	if err := manifest.Pack(dir, dest, offline); err == nil {
+		t.Fatal("Expected an offline build with an empty cache to fail")
+	}
+
+	if err := manifest.Vendor(dir, &ArtifactCache{Dir: offline.Dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Builds MUST succeed without the originals once they're vendored.
+	if err := os.Remove(filepath.Join(dir, "terraform")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := manifest.Pack(dir, dest, offline); err != nil {
+		t.Fatalf("Expected offline build to succeed, got: %v", err)
+	}
+}
@@ -15,17 +15,22 @@
 package brokerpak
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/client"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/generator"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf/wrapper"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/server"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/utils"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/utils/stream"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/utils/ziputil"
 )
@@ -48,16 +53,58 @@ func Init(directory string) error {
 
 // Pack creates a new brokerpak from the given directory which MUST contain a
 // manifest.yml file. If the pack was successful, the returned string will be
-// the path to the created brokerpak.
-func Pack(directory string) (string, error) {
+// the path to the created brokerpak. Artifacts are fetched through the cache
+// if it's not nil.
+func Pack(directory string, cache *ArtifactCache) (string, error) {
+	manifest, err := readManifest(directory)
+	if err != nil {
+		return "", err
+	}
+
+	packname := fmt.Sprintf("%s-%s.brokerpak", manifest.Name, manifest.Version)
+	return packname, manifest.Pack(directory, packname, cache)
+}
+
+// UpdateLockfile writes the lockfile from the brokerpak into the directory
+// next to its manifest so later builds verify their artifacts against it.
+func UpdateLockfile(pack, directory string) error {
+	brokerPak, err := OpenBrokerPak(pack)
+	if err != nil {
+		return err
+	}
+	defer brokerPak.Close()
+
+	lock, err := brokerPak.Lockfile()
+	if err != nil {
+		return err
+	}
+
+	return lock.write(directory)
+}
+
+// Vendor downloads the artifacts needed to build the brokerpak in the given
+// directory into the cache.
+func Vendor(directory string, cache *ArtifactCache) error {
+	if cache == nil {
+		return errors.New("a cache directory is required to vendor artifacts")
+	}
+
+	manifest, err := readManifest(directory)
+	if err != nil {
+		return err
+	}
+
+	return manifest.Vendor(directory, cache)
+}
+
+func readManifest(directory string) (*Manifest, error) {
 	manifestPath := filepath.Join(directory, manifestName)
 	manifest := &Manifest{}
 	if err := stream.Copy(stream.FromFile(manifestPath), stream.ToYaml(manifest)); err != nil {
-		return "", err
+		return nil, err
 	}
 
-	packname := fmt.Sprintf("%s-%s.brokerpak", manifest.Name, manifest.Version)
-	return packname, manifest.Pack(directory, packname)
+	return manifest, nil
 }
 
 // Info writes out human-readable information about the brokerpak.
@@ -88,6 +135,7 @@ func finfo(pack string, out io.Writer) error {
 		fmt.Fprintf(w, "format\t%d\n", mf.PackVersion)
 		fmt.Fprintf(w, "name\t%s\n", mf.Name)
 		fmt.Fprintf(w, "version\t%s\n", mf.Version)
+		fmt.Fprintf(w, "google credentials\t%t\n", mf.GoogleCredentials)
 		fmt.Fprintln(w, "platforms")
 		for _, arch := range mf.Platforms {
 			fmt.Fprintf(w, "\t%s\n", arch.String())
@@ -104,9 +152,31 @@ func finfo(pack string, out io.Writer) error {
 	{
 		fmt.Fprintln(out, "Parameters")
 		w := cmdTabWriter(out)
-		fmt.Fprintln(w, "NAME\tDESCRIPTION")
+		fmt.Fprintln(w, "NAME\tTYPE\tREQUIRED\tSENSITIVE\tDEFAULT\tALLOWED\tDESCRIPTION")
 		for _, param := range mf.Parameters {
-			fmt.Fprintf(w, "%s\t%s\n", param.Name, param.Description)
+			defaultValue := ""
+			if param.Default != nil {
+				defaultValue = fmt.Sprintf("%v", param.Default)
+			}
+
+			var allowed []string
+			for _, value := range param.Enum {
+				allowed = append(allowed, fmt.Sprintf("%v", value))
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%t\t%t\t%s\t%s\t%s\n", param.Name, param.TypeOrDefault(), param.Required, param.Sensitive, defaultValue, strings.Join(allowed, ", "), param.Description)
+		}
+		w.Flush()
+		fmt.Fprintln(out)
+	}
+	{
+		fmt.Fprintln(out, "Credentials")
+		w := cmdTabWriter(out)
+		fmt.Fprintln(w, "NAME\tPROVIDER\tDESCRIPTION")
+		for _, resource := range mf.TerraformResources {
+			for _, credential := range resource.Credentials {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", credential.Name, resource.Name, credential.Description)
+			}
 		}
 		w.Flush()
 		fmt.Fprintln(out)
@@ -140,6 +210,49 @@ func finfo(pack string, out io.Writer) error {
 	return nil
 }
 
+// TileForm creates a tile form for operators to set the brokerpak's parameters
+// and credentials. The values are passed to the broker as environment
+// variables and used if the brokerpak configuration doesn't set them.
+func TileForm(pack string) (*generator.Form, error) {
+	brokerPak, err := OpenBrokerPak(pack)
+	if err != nil {
+		return nil, err
+	}
+	defer brokerPak.Close()
+
+	mf, err := brokerPak.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	params := append([]ManifestParameter{}, mf.Parameters...)
+	for _, resource := range mf.TerraformResources {
+		for _, credential := range resource.Credentials {
+			credential.Required = true
+			credential.Sensitive = true
+			params = append(params, credential)
+		}
+	}
+
+	form := &generator.Form{
+		Name:        "brokerpak_parameters_" + strings.ToLower(utils.PropertyToEnvReplacer.Replace(mf.Name)),
+		Label:       fmt.Sprintf("Brokerpak Parameters: %s", mf.Name),
+		Description: fmt.Sprintf("Parameters for the %s brokerpak. Values in the brokerpak configuration take precedence over these.", mf.Name),
+	}
+
+	for _, param := range params {
+		prop := generator.BrokerVariableToFormProperty(param.ToBrokerVariable())
+		prop.Name = strings.ToLower(utils.PropertyToEnv(parameterPropertyName(param.Name)))
+		if param.Sensitive && len(param.Enum) == 0 {
+			prop.Type = "secret"
+		}
+
+		form.Properties = append(form.Properties, prop)
+	}
+
+	return form, nil
+}
+
 func cmdTabWriter(out io.Writer) *tabwriter.Writer {
 	// args: output, minwidth, tabwidth, padding, padchar, flags
 	return tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.StripEscape)
@@ -157,34 +270,41 @@ func Validate(pack string) error {
 }
 
 // RegisterAll fetches all brokerpaks from the settings file and registers them
-// with the given registry.
-func RegisterAll(registry broker.BrokerRegistry) error {
+// with the given registry. The returned function removes the files extracted
+// from the brokerpaks, call it once the registry is no longer in use.
+func RegisterAll(registry broker.BrokerRegistry) (cleanup func(), err error) {
 	pakConfig, err := NewServerConfigFromEnv()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	registrar := NewRegistrar(pakConfig)
+	if err := registrar.Register(registry); err != nil {
+		registrar.Cleanup()
+		return nil, err
 	}
 
-	return NewRegistrar(pakConfig).Register(registry)
+	return registrar.Cleanup, nil
 }
 
 // RunExamples executes the examples from a brokerpak.
-func RunExamples(pack string) error {
+func RunExamples(ctx context.Context, pack string, opts client.ExampleRunOptions) (*client.ExampleReport, error) {
 	registry, err := registryFromLocalBrokerpak(pack)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	apiClient, err := client.NewClientFromEnv()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	allExamples, err := server.GetAllCompleteServiceExamples(registry)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return client.RunExamplesForService(allExamples, apiClient, "", "")
+	return client.RunExamples(ctx, apiClient, allExamples, opts), nil
 }
 
 // Docs generates the markdown usage docs for the given pack and writes them to stdout.
@@ -199,10 +319,25 @@ func Docs(pack string) error {
 }
 
 func registryFromLocalBrokerpak(packPath string) (broker.BrokerRegistry, error) {
-	config := newLocalFileServerConfig(packPath)
+	return RegistryWithExecutor(packPath, nil)
+}
+
+// RegistryWithExecutor registers the services in a local brokerpak with a new
+// registry. If executor isn't nil it runs Terraform for the services instead
+// of the binaries in the brokerpak.
+func RegistryWithExecutor(packPath string, executor wrapper.TerraformExecutor) (broker.BrokerRegistry, error) {
+	// brokerpak sources are relative to the executable, local ones are
+	// relative to the working directory
+	absPath, err := filepath.Abs(packPath)
+	if err != nil {
+		return nil, err
+	}
+
+	registrar := NewRegistrar(newLocalFileServerConfig(absPath))
+	registrar.executor = executor
 
 	registry := broker.BrokerRegistry{}
-	if err := NewRegistrar(config).Register(registry); err != nil {
+	if err := registrar.Register(registry); err != nil {
 		return nil, err
 	}
 
@@ -23,6 +23,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/utils/stream"
 )
@@ -34,9 +35,19 @@ func fakeBrokerpak() (string, error) {
 	}
 	defer os.RemoveAll(dir)
 
+	if _, err := writeFakeBrokerpakSources(dir); err != nil {
+		return "", err
+	}
+
+	return Pack(dir, nil)
+}
+
+// writeFakeBrokerpakSources writes a manifest, service definition and dummy
+// Terraform resources to the directory and returns the manifest.
+func writeFakeBrokerpakSources(dir string) (*Manifest, error) {
 	tfSrc := filepath.Join(dir, "terraform")
 	if err := stream.Copy(stream.FromString("dummy-file"), stream.ToFile(tfSrc)); err != nil {
-		return "", err
+		return nil, err
 	}
 
 	exampleManifest := &Manifest{
@@ -68,20 +79,21 @@ func fakeBrokerpak() (string, error) {
 		ServiceDefinitions: []string{"example-service-definition.yml"},
 		Parameters: []ManifestParameter{
 			{Name: "TEST_PARAM", Description: "An example paramater that will be injected into Terraform's environment variables."},
+			{Name: "TEST_PORT", Description: "A typed parameter.", Type: broker.JsonTypeInteger, Default: 8080},
 		},
 	}
 
 	if err := stream.Copy(stream.FromYaml(exampleManifest), stream.ToFile(dir, manifestName)); err != nil {
-		return "", err
+		return nil, err
 	}
 
 	for _, path := range exampleManifest.ServiceDefinitions {
 		if err := stream.Copy(stream.FromYaml(tf.NewExampleTfServiceDefinition()), stream.ToFile(dir, path)); err != nil {
-			return "", err
+			return nil, err
 		}
 	}
 
-	return Pack(dir)
+	return exampleManifest, nil
 }
 
 func ExampleValidate() {
@@ -123,6 +135,10 @@ func TestFinfo(t *testing.T) {
 
 		"Parameters", // heading
 		"TEST_PARAM", // value
+		"TEST_PORT",  // value
+		"integer",    // type
+
+		"Credentials", // heading
 
 		"Dependencies",                   // heading
 		"terraform",                      // dependency
@@ -148,6 +164,33 @@ func TestFinfo(t *testing.T) {
 	}
 }
 
+func TestTileForm(t *testing.T) {
+	pk, err := fakeBrokerpak()
+	defer os.Remove(pk)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form, err := TileForm(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if form.Name != "brokerpak_parameters_my_services_pack" {
+		t.Errorf("Expected form name to be sanitized, got: %q", form.Name)
+	}
+
+	if len(form.Properties) != 2 {
+		t.Fatalf("Expected a property per parameter, got: %v", form.Properties)
+	}
+
+	port := form.Properties[1]
+	if port.Name != "gsb_brokerpak_parameters_test_port" || port.Type != "integer" || port.Default != 8080 || !port.Optional {
+		t.Errorf("Expected the port property to match the parameter, got: %#v", port)
+	}
+}
+
 func TestRegistryFromLocalBrokerpak(t *testing.T) {
 	pk, err := fakeBrokerpak()
 	defer os.Remove(pk)
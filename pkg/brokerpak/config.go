@@ -15,6 +15,7 @@
 package brokerpak
 
 import (
+	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -36,9 +37,18 @@ const (
 	brokerpakSourcesKey     = "brokerpak.sources"
 	brokerpakConfigKey      = "brokerpak.config"
 	brokerpakBuiltinPathKey = "brokerpak.builtin.path"
+	brokerpakTrustedKeysKey = "brokerpak.trusted_keys"
+	brokerpakParametersKey  = "brokerpak.parameters"
 )
 
-var loadBuiltinToggle = toggles.Features.Toggle("enable-builtin-brokerpaks", true, `Load brokerpaks that are built-in to the software.`)
+var loadBuiltinToggle = toggles.Features.Toggle("enable-builtin-brokerpaks", true, `Load brokerpaks that are built-in to the software.
+Their signatures aren't checked because they're installed with the broker rather than downloaded.`)
+
+var allowUnsignedToggle = toggles.Features.Toggle("allow-unsigned-brokerpaks", false, `Load brokerpaks that aren't signed by a trusted key.
+Brokerpaks contain binaries the broker runs, so only enable this if you control where they're loaded from.`)
+
+var googleCredentialsForAllToggle = toggles.Features.Toggle("google-credentials-for-all-brokerpaks", false, `Give every brokerpak the broker's Google credentials, not only the ones that opt in
+with google_credentials. Enable this for brokerpaks built before the opt-in existed.`)
 
 func init() {
 	viper.SetDefault(brokerpakSourcesKey, "{}")
@@ -58,6 +68,14 @@ type BrokerpakSourceConfig struct {
 	Config string `json:"config"`
 	// Notes holds user-defined notes about the Brokerpak and shouldn't be used programatically.
 	Notes string `json:"notes"`
+	// SignatureUri holds an optional URI for loading the Brokerpak's detached
+	// signature. It defaults to the BrokerpakUri with a .sig extension.
+	SignatureUri string `json:"signature_uri"`
+
+	// trusted is set by NewBrokerpakSourceConfigFromPath for paks the broker
+	// loads from its own filesystem e.g. the builtin paks, their signatures
+	// aren't checked.
+	trusted bool
 }
 
 var _ validation.Validatable = (*BrokerpakSourceConfig)(nil)
@@ -76,6 +94,19 @@ func (b *BrokerpakSourceConfig) Validate() (errs *validation.FieldError) {
 	return errs
 }
 
+// SignatureUriOrDefault gets the URI of the Brokerpak's detached signature.
+// If SignatureUri isn't set, the signature is expected next to the Brokerpak
+// with the same name and a .sig extension.
+func (b *BrokerpakSourceConfig) SignatureUriOrDefault() string {
+	if b.SignatureUri != "" {
+		return b.SignatureUri
+	}
+
+	// Query parameters like checksums apply to the Brokerpak so they're dropped.
+	pakUri := strings.SplitN(b.BrokerpakUri, "?", 2)[0]
+	return pakUri + SignatureExtension
+}
+
 // ExcludedServicesSlice gets the ExcludedServices as a slice of UUIDs.
 func (b *BrokerpakSourceConfig) ExcludedServicesSlice() []string {
 	return utils.SplitNewlineDelimitedList(b.ExcludedServices)
@@ -91,6 +122,7 @@ func NewBrokerpakSourceConfigFromPath(path string) BrokerpakSourceConfig {
 	return BrokerpakSourceConfig{
 		BrokerpakUri: path,
 		Config:       "{}",
+		trusted:      true,
 	}
 }
 
@@ -101,6 +133,14 @@ type ServerConfig struct {
 
 	// Brokerpaks holds list of brokerpaks to load.
 	Brokerpaks map[string]BrokerpakSourceConfig
+
+	// TrustedKeys holds the base64 encoded ed25519 public keys brokerpaks
+	// must be signed with.
+	TrustedKeys []string
+
+	// AllowUnsigned is true if brokerpaks that aren't signed by a trusted key
+	// can be loaded.
+	AllowUnsigned bool
 }
 
 var _ validation.Validatable = (*ServerConfig)(nil)
@@ -114,9 +154,27 @@ func (cfg *ServerConfig) Validate() (errs *validation.FieldError) {
 		errs = errs.Also(v.Validate().ViaFieldKey("Brokerpaks", k))
 	}
 
+	for i, key := range cfg.TrustedKeys {
+		if _, err := ParsePublicKey(key); err != nil {
+			errs = errs.Also(validation.ErrInvalidValue(key, "").ViaFieldIndex("TrustedKeys", i))
+		}
+	}
+
 	return errs
 }
 
+// trustedPublicKeys parses the TrustedKeys. The config MUST be validated first.
+func (cfg *ServerConfig) trustedPublicKeys() []ed25519.PublicKey {
+	var out []ed25519.PublicKey
+	for _, key := range cfg.TrustedKeys {
+		if parsed, err := ParsePublicKey(key); err == nil {
+			out = append(out, parsed)
+		}
+	}
+
+	return out
+}
+
 // NewServerConfigFromEnv loads the global Brokerpak config from Viper.
 func NewServerConfigFromEnv() (*ServerConfig, error) {
 	paks := map[string]BrokerpakSourceConfig{}
@@ -126,8 +184,10 @@ func NewServerConfigFromEnv() (*ServerConfig, error) {
 	}
 
 	cfg := ServerConfig{
-		Config:     viper.GetString(brokerpakConfigKey),
-		Brokerpaks: paks,
+		Config:        viper.GetString(brokerpakConfigKey),
+		Brokerpaks:    paks,
+		TrustedKeys:   utils.SplitNewlineDelimitedList(viper.GetString(brokerpakTrustedKeysKey)),
+		AllowUnsigned: allowUnsignedToggle.IsActive(),
 	}
 
 	if err := cfg.Validate(); err != nil {
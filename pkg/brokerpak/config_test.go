@@ -66,6 +66,16 @@ func ExampleBrokerpakSourceConfig_SetExcludedServices() {
 	// plan2
 }
 
+func ExampleBrokerpakSourceConfig_SignatureUriOrDefault() {
+	fmt.Println((&BrokerpakSourceConfig{BrokerpakUri: "gs://bucket/my.brokerpak"}).SignatureUriOrDefault())
+	fmt.Println((&BrokerpakSourceConfig{BrokerpakUri: "https://example.com/my.brokerpak?checksum=md5:abc"}).SignatureUriOrDefault())
+	fmt.Println((&BrokerpakSourceConfig{BrokerpakUri: "gs://bucket/my.brokerpak", SignatureUri: "gs://sigs/my.sig"}).SignatureUriOrDefault())
+
+	// Output: gs://bucket/my.brokerpak.sig
+	// https://example.com/my.brokerpak.sig
+	// gs://sigs/my.sig
+}
+
 func TestServiceConfig_Validate(t *testing.T) {
 	cases := map[string]struct {
 		Cfg ServerConfig
@@ -106,6 +116,13 @@ func TestServiceConfig_Validate(t *testing.T) {
 			},
 			Err: "invalid JSON: Brokerpaks[good-key].config",
 		},
+		"bad trusted key": {
+			Cfg: ServerConfig{
+				Config:      "{}",
+				TrustedKeys: []string{"c2hvcnQ="},
+			},
+			Err: "invalid value: c2hvcnQ=: TrustedKeys[0]",
+		},
 	}
 
 	for tn, tc := range cases {
@@ -134,9 +151,27 @@ func ExampleNewServerConfigFromEnv() {
 
 	fmt.Println("global config:", cfg.Config)
 	fmt.Println("num services:", len(cfg.Brokerpaks))
+	fmt.Println("allow unsigned:", cfg.AllowUnsigned)
 
 	// Output: global config: {}
 	// num services: 1
+	// allow unsigned: false
+}
+
+func ExampleNewServerConfigFromEnv_trustedKeys() {
+	viper.Set("brokerpak.sources", `{}`)
+	viper.Set("brokerpak.config", `{}`)
+	viper.Set("brokerpak.trusted_keys", "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\n\nAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=\n")
+	defer viper.Reset() // cleanup
+
+	cfg, err := NewServerConfigFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println("trusted keys:", len(cfg.TrustedKeys))
+
+	// Output: trusted keys: 2
 }
 
 func ExampleNewServerConfigFromEnv_customBuiltin() {
@@ -0,0 +1,420 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package brokerpak
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf"
+)
+
+// PakChange is a difference between two versions of a brokerpak.
+type PakChange struct {
+	// Field is the path to the changed field,
+	// e.g. services[my-service].plans[small].id
+	Field string
+
+	// Message describes the change.
+	Message string
+
+	// Breaking is true if the change could break existing instances, bindings
+	// or users of the service.
+	Breaking bool
+
+	// Diff holds a line diff of changed templates.
+	Diff string
+}
+
+func (c PakChange) String() string {
+	kind := "changed"
+	if c.Breaking {
+		kind = "BREAKING"
+	}
+
+	return fmt.Sprintf("%s\t%s\t%s", kind, c.Field, c.Message)
+}
+
+// Diff writes the changes between two brokerpaks to out and reports whether
+// any of them are breaking.
+func Diff(oldPack, newPack string, out io.Writer) (breaking bool, err error) {
+	changes, err := diffPakFiles(oldPack, newPack)
+	if err != nil {
+		return false, err
+	}
+
+	w := cmdTabWriter(out)
+	for _, change := range changes {
+		fmt.Fprintln(w, change.String())
+		breaking = breaking || change.Breaking
+	}
+	w.Flush()
+
+	for _, change := range changes {
+		if change.Diff != "" {
+			fmt.Fprintf(out, "\n--- %s\n%s", change.Field, change.Diff)
+		}
+	}
+
+	return breaking, nil
+}
+
+func diffPakFiles(oldPack, newPack string) ([]PakChange, error) {
+	oldPak, err := OpenBrokerPak(oldPack)
+	if err != nil {
+		return nil, err
+	}
+	defer oldPak.Close()
+
+	newPak, err := OpenBrokerPak(newPack)
+	if err != nil {
+		return nil, err
+	}
+	defer newPak.Close()
+
+	oldManifest, err := oldPak.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	newManifest, err := newPak.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	oldServices, err := oldPak.Services()
+	if err != nil {
+		return nil, err
+	}
+
+	newServices, err := newPak.Services()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := diffManifests(oldManifest, newManifest)
+	return append(changes, diffServices(oldServices, newServices)...), nil
+}
+
+// diffManifests compares the metadata and Terraform binaries of two
+// brokerpaks.
+func diffManifests(oldManifest, newManifest *Manifest) (changes []PakChange) {
+	if oldManifest.Name != newManifest.Name {
+		changes = append(changes, PakChange{
+			Field:   "name",
+			Message: fmt.Sprintf("renamed from %q to %q", oldManifest.Name, newManifest.Name),
+		})
+	}
+
+	if oldManifest.Version != newManifest.Version {
+		changes = append(changes, PakChange{
+			Field:   "version",
+			Message: fmt.Sprintf("changed from %q to %q", oldManifest.Version, newManifest.Version),
+		})
+	}
+
+	oldResources := make(map[string]TerraformResource)
+	for _, resource := range oldManifest.TerraformResources {
+		oldResources[resource.Name] = resource
+	}
+
+	newResources := make(map[string]TerraformResource)
+	for _, resource := range newManifest.TerraformResources {
+		newResources[resource.Name] = resource
+	}
+
+	for _, name := range sortedKeys(oldResources, newResources) {
+		field := fmt.Sprintf("terraform_binaries[%s]", name)
+		oldResource, inOld := oldResources[name]
+		newResource, inNew := newResources[name]
+
+		switch {
+		case !inNew:
+			changes = append(changes, PakChange{Field: field, Message: fmt.Sprintf("removed version %s", oldResource.Version)})
+		case !inOld:
+			changes = append(changes, PakChange{Field: field, Message: fmt.Sprintf("added version %s", newResource.Version)})
+		case oldResource.Version != newResource.Version:
+			changes = append(changes, PakChange{
+				Field:   field + ".version",
+				Message: fmt.Sprintf("changed from %s to %s", oldResource.Version, newResource.Version),
+			})
+		}
+	}
+
+	return changes
+}
+
+// diffServices compares the service definitions of two brokerpaks, services
+// are matched by their ID.
+func diffServices(oldServices, newServices []tf.TfServiceDefinitionV1) (changes []PakChange) {
+	oldById := make(map[string]tf.TfServiceDefinitionV1)
+	for _, svc := range oldServices {
+		oldById[svc.Id] = svc
+	}
+
+	newById := make(map[string]tf.TfServiceDefinitionV1)
+	for _, svc := range newServices {
+		newById[svc.Id] = svc
+	}
+
+	for _, id := range sortedKeys(oldById, newById) {
+		oldSvc, inOld := oldById[id]
+		newSvc, inNew := newById[id]
+
+		switch {
+		case !inNew:
+			changes = append(changes, PakChange{
+				Field:    fmt.Sprintf("services[%s]", oldSvc.Name),
+				Message:  fmt.Sprintf("removed service %s", id),
+				Breaking: true,
+			})
+		case !inOld:
+			changes = append(changes, PakChange{
+				Field:   fmt.Sprintf("services[%s]", newSvc.Name),
+				Message: fmt.Sprintf("added service %s", id),
+			})
+		default:
+			changes = append(changes, diffService(oldSvc, newSvc)...)
+		}
+	}
+
+	return changes
+}
+
+func diffService(oldSvc, newSvc tf.TfServiceDefinitionV1) (changes []PakChange) {
+	field := fmt.Sprintf("services[%s]", newSvc.Name)
+
+	if oldSvc.Name != newSvc.Name {
+		changes = append(changes, PakChange{
+			Field:   field + ".name",
+			Message: fmt.Sprintf("renamed from %q to %q", oldSvc.Name, newSvc.Name),
+		})
+	}
+
+	changes = append(changes, diffPlans(field, oldSvc.Plans, newSvc.Plans)...)
+
+	for _, action := range []struct {
+		name     string
+		old, new tf.TfServiceDefinitionV1Action
+	}{
+		{name: "provision", old: oldSvc.ProvisionSettings, new: newSvc.ProvisionSettings},
+		{name: "bind", old: oldSvc.BindSettings, new: newSvc.BindSettings},
+	} {
+		actionField := fmt.Sprintf("%s.%s", field, action.name)
+		changes = append(changes, diffInputs(actionField+".user_inputs", action.old.UserInputs, action.new.UserInputs)...)
+		changes = append(changes, diffOutputs(actionField+".outputs", action.old.Outputs, action.new.Outputs)...)
+
+		if action.old.Template != action.new.Template {
+			changes = append(changes, PakChange{
+				Field:   actionField + ".template",
+				Message: "template changed",
+				Diff:    lineDiff(action.old.Template, action.new.Template),
+			})
+		}
+	}
+
+	return changes
+}
+
+// diffPlans matches plans by ID and reports plans that keep their name but
+// change their ID because existing instances would lose their plan.
+func diffPlans(field string, oldPlans, newPlans []tf.TfServiceDefinitionV1Plan) (changes []PakChange) {
+	newById := make(map[string]tf.TfServiceDefinitionV1Plan)
+	newByName := make(map[string]tf.TfServiceDefinitionV1Plan)
+	for _, plan := range newPlans {
+		newById[plan.Id] = plan
+		newByName[plan.Name] = plan
+	}
+
+	oldIds := make(map[string]bool)
+	oldNames := make(map[string]bool)
+	for _, oldPlan := range oldPlans {
+		oldIds[oldPlan.Id] = true
+		oldNames[oldPlan.Name] = true
+		planField := fmt.Sprintf("%s.plans[%s]", field, oldPlan.Name)
+
+		if newPlan, ok := newById[oldPlan.Id]; ok {
+			if newPlan.Name != oldPlan.Name {
+				changes = append(changes, PakChange{
+					Field:   planField + ".name",
+					Message: fmt.Sprintf("renamed from %q to %q", oldPlan.Name, newPlan.Name),
+				})
+			}
+			continue
+		}
+
+		if newPlan, ok := newByName[oldPlan.Name]; ok {
+			changes = append(changes, PakChange{
+				Field:    planField + ".id",
+				Message:  fmt.Sprintf("changed from %s to %s", oldPlan.Id, newPlan.Id),
+				Breaking: true,
+			})
+			continue
+		}
+
+		changes = append(changes, PakChange{
+			Field:    planField,
+			Message:  fmt.Sprintf("removed plan %s", oldPlan.Id),
+			Breaking: true,
+		})
+	}
+
+	for _, newPlan := range newPlans {
+		if oldIds[newPlan.Id] || oldNames[newPlan.Name] {
+			continue
+		}
+
+		changes = append(changes, PakChange{
+			Field:   fmt.Sprintf("%s.plans[%s]", field, newPlan.Name),
+			Message: fmt.Sprintf("added plan %s", newPlan.Id),
+		})
+	}
+
+	return changes
+}
+
+// diffInputs compares the user input schemas. Removing an input, changing its
+// type or newly requiring it breaks requests that were valid before.
+func diffInputs(field string, oldInputs, newInputs []broker.BrokerVariable) (changes []PakChange) {
+	oldByName, newByName := variablesByName(oldInputs), variablesByName(newInputs)
+
+	for _, name := range sortedKeys(oldByName, newByName) {
+		inputField := fmt.Sprintf("%s[%s]", field, name)
+		oldInput, inOld := oldByName[name]
+		newInput, inNew := newByName[name]
+
+		switch {
+		case !inNew:
+			changes = append(changes, PakChange{Field: inputField, Message: "removed input", Breaking: true})
+		case !inOld:
+			changes = append(changes, PakChange{Field: inputField, Message: "added input", Breaking: newInput.Required})
+		case oldInput.Type != newInput.Type:
+			changes = append(changes, PakChange{
+				Field:    inputField + ".type",
+				Message:  fmt.Sprintf("changed from %s to %s", oldInput.Type, newInput.Type),
+				Breaking: true,
+			})
+		case !oldInput.Required && newInput.Required:
+			changes = append(changes, PakChange{Field: inputField + ".required", Message: "input is now required", Breaking: true})
+		case !reflect.DeepEqual(oldInput, newInput):
+			changes = append(changes, PakChange{Field: inputField, Message: "schema changed"})
+		}
+	}
+
+	return changes
+}
+
+// diffOutputs compares outputs, bindings depend on them so removing one or
+// changing its type is breaking.
+func diffOutputs(field string, oldOutputs, newOutputs []broker.BrokerVariable) (changes []PakChange) {
+	oldByName, newByName := variablesByName(oldOutputs), variablesByName(newOutputs)
+
+	for _, name := range sortedKeys(oldByName, newByName) {
+		outputField := fmt.Sprintf("%s[%s]", field, name)
+		oldOutput, inOld := oldByName[name]
+		newOutput, inNew := newByName[name]
+
+		switch {
+		case !inNew:
+			changes = append(changes, PakChange{Field: outputField, Message: "removed output", Breaking: true})
+		case !inOld:
+			changes = append(changes, PakChange{Field: outputField, Message: "added output"})
+		case oldOutput.Type != newOutput.Type:
+			changes = append(changes, PakChange{
+				Field:    outputField + ".type",
+				Message:  fmt.Sprintf("changed from %s to %s", oldOutput.Type, newOutput.Type),
+				Breaking: true,
+			})
+		}
+	}
+
+	return changes
+}
+
+func variablesByName(vars []broker.BrokerVariable) map[string]broker.BrokerVariable {
+	out := make(map[string]broker.BrokerVariable)
+	for _, v := range vars {
+		out[v.FieldName] = v
+	}
+
+	return out
+}
+
+// sortedKeys gets the union of the keys of the given maps in sorted order so
+// changes are always reported in the same order.
+func sortedKeys(maps ...interface{}) []string {
+	keys := make(map[string]bool)
+	for _, m := range maps {
+		for _, k := range reflect.ValueOf(m).MapKeys() {
+			keys[k.String()] = true
+		}
+	}
+
+	var out []string
+	for k := range keys {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// lineDiff creates a line diff of two texts. Removed lines are prefixed with
+// "-", added lines with "+" and unchanged lines with a space.
+func lineDiff(oldText, newText string) string {
+	a := strings.Split(strings.TrimSuffix(oldText, "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(newText, "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	sb := &strings.Builder{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			fmt.Fprintf(sb, " %s\n", a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(sb, "-%s\n", a[i])
+			i++
+		default:
+			fmt.Fprintf(sb, "+%s\n", b[j])
+			j++
+		}
+	}
+
+	return sb.String()
+}
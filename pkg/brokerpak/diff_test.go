@@ -0,0 +1,273 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package brokerpak
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf"
+)
+
+func TestDiffServices(t *testing.T) {
+	cases := map[string]struct {
+		Change   func(svc *tf.TfServiceDefinitionV1)
+		Expected []PakChange
+	}{
+		"no changes": {
+			Change:   func(svc *tf.TfServiceDefinitionV1) {},
+			Expected: nil,
+		},
+		"plan added": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.Plans = append(svc.Plans, tf.TfServiceDefinitionV1Plan{Name: "large", Id: "large-id"})
+			},
+			Expected: []PakChange{
+				{Field: "services[example].plans[large]", Message: "added plan large-id"},
+			},
+		},
+		"plan removed": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.Plans = nil
+			},
+			Expected: []PakChange{
+				{Field: "services[example].plans[small]", Message: "removed plan small-id", Breaking: true},
+			},
+		},
+		"plan id changed": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.Plans[0].Id = "new-small-id"
+			},
+			Expected: []PakChange{
+				{Field: "services[example].plans[small].id", Message: "changed from small-id to new-small-id", Breaking: true},
+			},
+		},
+		"plan renamed": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.Plans[0].Name = "tiny"
+			},
+			Expected: []PakChange{
+				{Field: "services[example].plans[small].name", Message: `renamed from "small" to "tiny"`},
+			},
+		},
+		"optional input added": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.ProvisionSettings.UserInputs = append(svc.ProvisionSettings.UserInputs, broker.BrokerVariable{FieldName: "versioning", Type: broker.JsonTypeBoolean})
+			},
+			Expected: []PakChange{
+				{Field: "services[example].provision.user_inputs[versioning]", Message: "added input"},
+			},
+		},
+		"required input added": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.ProvisionSettings.UserInputs = append(svc.ProvisionSettings.UserInputs, broker.BrokerVariable{FieldName: "versioning", Type: broker.JsonTypeBoolean, Required: true})
+			},
+			Expected: []PakChange{
+				{Field: "services[example].provision.user_inputs[versioning]", Message: "added input", Breaking: true},
+			},
+		},
+		"input removed": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.ProvisionSettings.UserInputs = nil
+			},
+			Expected: []PakChange{
+				{Field: "services[example].provision.user_inputs[name]", Message: "removed input", Breaking: true},
+			},
+		},
+		"input type changed": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.ProvisionSettings.UserInputs[0].Type = broker.JsonTypeInteger
+			},
+			Expected: []PakChange{
+				{Field: "services[example].provision.user_inputs[name].type", Message: "changed from string to integer", Breaking: true},
+			},
+		},
+		"input now required": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.ProvisionSettings.UserInputs[0].Required = true
+			},
+			Expected: []PakChange{
+				{Field: "services[example].provision.user_inputs[name].required", Message: "input is now required", Breaking: true},
+			},
+		},
+		"input constraints changed": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.ProvisionSettings.UserInputs[0].Constraints = map[string]interface{}{"maxLength": 30}
+			},
+			Expected: []PakChange{
+				{Field: "services[example].provision.user_inputs[name]", Message: "schema changed"},
+			},
+		},
+		"output removed": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.BindSettings.Outputs = nil
+			},
+			Expected: []PakChange{
+				{Field: "services[example].bind.outputs[password]", Message: "removed output", Breaking: true},
+			},
+		},
+		"template changed": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.ProvisionSettings.Template = "variable name {type = string}\n"
+			},
+			Expected: []PakChange{
+				{
+					Field:   "services[example].provision.template",
+					Message: "template changed",
+					Diff:    "-variable name {}\n+variable name {type = string}\n",
+				},
+			},
+		},
+		"service renamed": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.Name = "renamed"
+			},
+			Expected: []PakChange{
+				{Field: "services[renamed].name", Message: `renamed from "example" to "renamed"`},
+			},
+		},
+	}
+
+	newService := func() tf.TfServiceDefinitionV1 {
+		return tf.TfServiceDefinitionV1{
+			Id:    "service-id",
+			Name:  "example",
+			Plans: []tf.TfServiceDefinitionV1Plan{{Name: "small", Id: "small-id"}},
+			ProvisionSettings: tf.TfServiceDefinitionV1Action{
+				UserInputs: []broker.BrokerVariable{{FieldName: "name", Type: broker.JsonTypeString}},
+				Template:   "variable name {}\n",
+			},
+			BindSettings: tf.TfServiceDefinitionV1Action{
+				Outputs: []broker.BrokerVariable{{FieldName: "password", Type: broker.JsonTypeString}},
+			},
+		}
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			changed := newService()
+			tc.Change(&changed)
+
+			actual := diffServices([]tf.TfServiceDefinitionV1{newService()}, []tf.TfServiceDefinitionV1{changed})
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Errorf("Expected changes %#v, got %#v", tc.Expected, actual)
+			}
+		})
+	}
+
+	t.Run("services added and removed", func(t *testing.T) {
+		removed := newService()
+		added := newService()
+		added.Id = "new-service-id"
+		added.Name = "new-example"
+
+		expected := []PakChange{
+			{Field: "services[new-example]", Message: "added service new-service-id"},
+			{Field: "services[example]", Message: "removed service service-id", Breaking: true},
+		}
+
+		actual := diffServices([]tf.TfServiceDefinitionV1{removed}, []tf.TfServiceDefinitionV1{added})
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected changes %#v, got %#v", expected, actual)
+		}
+	})
+}
+
+func TestDiffManifests(t *testing.T) {
+	oldManifest := &Manifest{
+		Name:    "my-pak",
+		Version: "1.0.0",
+		TerraformResources: []TerraformResource{
+			{Name: "terraform", Version: "0.11.9"},
+			{Name: "terraform-provider-google", Version: "1.19.0"},
+		},
+	}
+
+	newManifest := &Manifest{
+		Name:    "my-pak",
+		Version: "2.0.0",
+		TerraformResources: []TerraformResource{
+			{Name: "terraform", Version: "0.12.0"},
+			{Name: "terraform-provider-random", Version: "2.0.0"},
+		},
+	}
+
+	expected := []PakChange{
+		{Field: "version", Message: `changed from "1.0.0" to "2.0.0"`},
+		{Field: "terraform_binaries[terraform].version", Message: "changed from 0.11.9 to 0.12.0"},
+		{Field: "terraform_binaries[terraform-provider-google]", Message: "removed version 1.19.0"},
+		{Field: "terraform_binaries[terraform-provider-random]", Message: "added version 2.0.0"},
+	}
+
+	actual := diffManifests(oldManifest, newManifest)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected changes %#v, got %#v", expected, actual)
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	cases := map[string]struct {
+		Old      string
+		New      string
+		Expected string
+	}{
+		"same":     {Old: "a\nb\n", New: "a\nb\n", Expected: " a\n b\n"},
+		"added":    {Old: "a\nc\n", New: "a\nb\nc\n", Expected: " a\n+b\n c\n"},
+		"removed":  {Old: "a\nb\nc\n", New: "a\nc\n", Expected: " a\n-b\n c\n"},
+		"replaced": {Old: "a\nb\nc\n", New: "a\nx\nc\n", Expected: " a\n-b\n+x\n c\n"},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			if actual := lineDiff(tc.Old, tc.New); actual != tc.Expected {
+				t.Errorf("Expected diff %q, got %q", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diff-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pak, err := fakeBrokerpak()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(pak)
+
+	out := &bytes.Buffer{}
+	breaking, err := Diff(pak, pak, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if breaking || out.Len() != 0 {
+		t.Errorf("Expected no changes between identical brokerpaks, got: %q", out.String())
+	}
+
+	if _, err := Diff(pak, filepath.Join(dir, "missing.brokerpak"), out); err == nil || !strings.Contains(err.Error(), "missing.brokerpak") {
+		t.Errorf("Expected an error opening the missing brokerpak, got: %v", err)
+	}
+}
@@ -16,6 +16,7 @@ package brokerpak
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/url"
@@ -38,6 +39,27 @@ func fetchArchive(src, dest string) error {
 	return newFileGetterClient(src, dest).Get()
 }
 
+// fetchVerifiedArchive downloads the archive like fetchArchive and returns its
+// hex encoded SHA-256 sum. If expectedSha256 isn't blank the archive MUST
+// match it.
+func fetchVerifiedArchive(src, dest, expectedSha256 string) (string, error) {
+	if err := fetchArchive(src, dest); err != nil {
+		return "", err
+	}
+
+	digest, err := fileDigest(dest)
+	if err != nil {
+		return "", err
+	}
+
+	sum := hex.EncodeToString(digest)
+	if expectedSha256 != "" && !strings.EqualFold(sum, expectedSha256) {
+		return "", fmt.Errorf("checksum mismatch for %q: expected sha256 %s got %s", src, strings.ToLower(expectedSha256), sum)
+	}
+
+	return sum, nil
+}
+
 // fetchBrokerpak downloads a local or remote brokerpak; brokerpaks can be
 // fetched remotely using the gs:// prefix which will load them from a
 // Cloud Storage bucket with the broker's credentials.
@@ -56,11 +78,14 @@ func fetchBrokerpak(src, dest string) error {
 	return client.Get()
 }
 
+// defaultGetters gets go-getter's default getters. Local files are copied
+// rather than symlinked so they can't change after they've been verified.
 func defaultGetters() map[string]getter.Getter {
 	getters := map[string]getter.Getter{}
 	for k, g := range getter.Getters {
 		getters[k] = g
 	}
+	getters["file"] = &getter.FileGetter{Copy: true}
 
 	return getters
 }
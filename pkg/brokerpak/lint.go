@@ -0,0 +1,294 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package brokerpak
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/validation"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/varcontext"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/varcontext/interpolation"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/utils"
+)
+
+// LintResult holds the problems found in brokerpaks. Errors will stop a
+// brokerpak from loading or its services from working, warnings are likely
+// to cause problems for users.
+type LintResult struct {
+	Errors   *validation.FieldError
+	Warnings *validation.FieldError
+}
+
+// Lint checks brokerpaks that will be loaded together for problems that
+// Validate can't find, like duplicate IDs across brokerpaks or templates that
+// reference undefined variables.
+func Lint(packs ...string) (*LintResult, error) {
+	paks := make(map[string][]tf.TfServiceDefinitionV1)
+	result := &LintResult{}
+
+	for _, pack := range packs {
+		services, errs, err := readForLint(pack)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read %q: %v", pack, err)
+		}
+
+		paks[pack] = services
+		result.Errors = result.Errors.Also(errs.ViaFieldKey("brokerpaks", pack))
+	}
+
+	for _, pack := range packs {
+		for _, svc := range paks[pack] {
+			errs, warnings := lintService(svc)
+			result.Errors = result.Errors.Also(errs.ViaFieldKey("services", svc.Name).ViaFieldKey("brokerpaks", pack))
+			result.Warnings = result.Warnings.Also(warnings.ViaFieldKey("services", svc.Name).ViaFieldKey("brokerpaks", pack))
+		}
+	}
+
+	result.Errors = result.Errors.Also(lintDuplicateIds(packs, paks))
+
+	return result, nil
+}
+
+// readForLint reads the services in the brokerpak along with any manifest
+// validation errors.
+func readForLint(pack string) ([]tf.TfServiceDefinitionV1, *validation.FieldError, error) {
+	brokerPak, err := OpenBrokerPak(pack)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer brokerPak.Close()
+
+	manifest, err := brokerPak.Manifest()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	services, err := brokerPak.Services()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return services, manifest.Validate().ViaField("manifest"), nil
+}
+
+// lintDuplicateIds finds service and plan IDs that are used more than once,
+// the broker refuses to load services with conflicting IDs.
+func lintDuplicateIds(packs []string, paks map[string][]tf.TfServiceDefinitionV1) (errs *validation.FieldError) {
+	servicePaths := make(map[string][]string)
+	planPaths := make(map[string][]string)
+	var serviceIds, planIds []string
+
+	for _, pack := range packs {
+		for _, svc := range paks[pack] {
+			svcPath := fmt.Sprintf("brokerpaks[%s].services[%s]", pack, svc.Name)
+			if _, ok := servicePaths[svc.Id]; !ok {
+				serviceIds = append(serviceIds, svc.Id)
+			}
+			servicePaths[svc.Id] = append(servicePaths[svc.Id], svcPath+".id")
+
+			for i, plan := range svc.Plans {
+				if _, ok := planPaths[plan.Id]; !ok {
+					planIds = append(planIds, plan.Id)
+				}
+				planPaths[plan.Id] = append(planPaths[plan.Id], fmt.Sprintf("%s.plans[%d].id", svcPath, i))
+			}
+		}
+	}
+
+	for _, id := range serviceIds {
+		if paths := servicePaths[id]; len(paths) > 1 {
+			errs = errs.Also(&validation.FieldError{Message: fmt.Sprintf("duplicate service ID %s", id), Paths: paths})
+		}
+	}
+
+	for _, id := range planIds {
+		if paths := planPaths[id]; len(paths) > 1 {
+			errs = errs.Also(&validation.FieldError{Message: fmt.Sprintf("duplicate plan ID %s", id), Paths: paths})
+		}
+	}
+
+	return errs
+}
+
+// lintService checks a single service definition.
+func lintService(svc tf.TfServiceDefinitionV1) (errs, warnings *validation.FieldError) {
+	errs = errs.Also(svc.Validate())
+
+	planIds := utils.NewStringSet()
+	for i, plan := range svc.Plans {
+		planIds.Add(plan.Id)
+		warnings = warnings.Also(validation.ErrIfNotOSBName(plan.Name, "name").ViaFieldIndex("plans", i))
+	}
+
+	for i, example := range svc.Examples {
+		if example.PlanId != "" && !planIds.Contains(example.PlanId) {
+			errs = errs.Also(&validation.FieldError{
+				Message: fmt.Sprintf("plan %s doesn't exist", example.PlanId),
+				Paths:   []string{"plan_id"},
+			}).ViaFieldIndex("examples", i)
+		}
+	}
+
+	errs = errs.Also(
+		lintAction(svc.ProvisionSettings, broker.ProvisionTemplateVariables).ViaField("provision"),
+		lintAction(svc.BindSettings, broker.BindTemplateVariables).ViaField("bind"),
+	)
+
+	if svc.DashboardUrlTemplate != "" {
+		errs = errs.Also(lintTemplate(svc.DashboardUrlTemplate, utils.NewStringSet(broker.DashboardUrlTemplateVariables...), "dashboard_url_template"))
+	}
+
+	return errs, warnings
+}
+
+// lintAction checks the inputs of a provision or bind action given the
+// constants available to its templates.
+func lintAction(action tf.TfServiceDefinitionV1Action, constants []string) (errs *validation.FieldError) {
+	for i, input := range action.PlanInputs {
+		errs = errs.Also(lintEnum(input).ViaFieldIndex("plan_inputs", i))
+	}
+
+	inScope := utils.NewStringSet(constants...)
+	for _, input := range action.UserInputs {
+		inScope.Add(input.FieldName)
+	}
+
+	for i, input := range action.UserInputs {
+		errs = errs.Also(
+			lintEnum(input).ViaFieldIndex("user_inputs", i),
+			lintDefault(input, inScope).ViaFieldIndex("user_inputs", i),
+		)
+	}
+
+	for _, input := range action.PlanInputs {
+		inScope.Add(input.FieldName)
+	}
+
+	// computed inputs are evaluated in order so they can only reference the
+	// ones before them
+	for i, computed := range action.Computed {
+		errs = errs.Also(lintComputed(computed, inScope).ViaFieldIndex("computed_inputs", i))
+		inScope.Add(computed.Name)
+	}
+
+	return errs
+}
+
+// lintEnum checks the enum values match the variable's type.
+func lintEnum(input broker.BrokerVariable) (errs *validation.FieldError) {
+	for value := range input.Enum {
+		if !isJsonType(value, input.Type) {
+			errs = errs.Also(&validation.FieldError{
+				Message: fmt.Sprintf("enum value %v doesn't match type %s", value, input.Type),
+				Paths:   []string{"enum"},
+			})
+		}
+	}
+
+	return errs
+}
+
+// lintDefault checks default values satisfy the variable's own JSON Schema
+// and that templates only reference variables in scope. Relationships aren't
+// checked because they depend on the other variables.
+func lintDefault(input broker.BrokerVariable, inScope utils.StringSet) *validation.FieldError {
+	if input.Default == nil {
+		return nil
+	}
+
+	if str, ok := input.Default.(string); ok && interpolation.IsHILExpression(str) {
+		return lintTemplate(str, inScope, "default")
+	}
+
+	params := map[string]interface{}{input.FieldName: input.Default}
+	if err := broker.ValidateVariableSchemas(params, []broker.BrokerVariable{input}); err != nil {
+		return &validation.FieldError{
+			Message: "default doesn't satisfy the constraints",
+			Paths:   []string{"default"},
+			Details: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+func lintComputed(computed varcontext.DefaultVariable, inScope utils.StringSet) *validation.FieldError {
+	str, ok := computed.Default.(string)
+	if !ok {
+		return nil
+	}
+
+	return lintTemplate(str, inScope, "default")
+}
+
+// lintTemplate checks the HIL template only references variables in scope.
+func lintTemplate(template string, inScope utils.StringSet, field string) *validation.FieldError {
+	variables, err := interpolation.Variables(template)
+	if err != nil {
+		return &validation.FieldError{
+			Message: "invalid HIL",
+			Paths:   []string{field},
+			Details: err.Error(),
+		}
+	}
+
+	var undefined []string
+	for _, variable := range variables {
+		if !inScope.Contains(variable) {
+			undefined = append(undefined, variable)
+		}
+	}
+
+	if len(undefined) == 0 {
+		return nil
+	}
+
+	return &validation.FieldError{
+		Message: fmt.Sprintf("template references undefined variables: %s", strings.Join(undefined, ", ")),
+		Paths:   []string{field},
+	}
+}
+
+// isJsonType checks if a value parsed from YAML is of the given JSON Schema
+// type. Untyped variables accept any value.
+func isJsonType(value interface{}, jsonType broker.JsonType) bool {
+	kind := reflect.ValueOf(value).Kind()
+
+	switch jsonType {
+	case broker.JsonTypeString:
+		return kind == reflect.String
+	case broker.JsonTypeBoolean:
+		return kind == reflect.Bool
+	case broker.JsonTypeInteger:
+		switch kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return true
+		case reflect.Float32, reflect.Float64:
+			f := reflect.ValueOf(value).Float()
+			return f == math.Trunc(f)
+		}
+		return false
+	case broker.JsonTypeNumeric:
+		return isJsonType(value, broker.JsonTypeInteger) || kind == reflect.Float32 || kind == reflect.Float64
+	default:
+		return true
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package brokerpak
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/varcontext"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/utils/stream"
+)
+
+func TestLintService(t *testing.T) {
+	cases := map[string]struct {
+		Change          func(svc *tf.TfServiceDefinitionV1)
+		ExpectedErr     string
+		ExpectedWarning string
+	}{
+		"valid": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {},
+		},
+		"plan name not OSB safe": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.Plans[0].Name = "Small Plan"
+			},
+			ExpectedWarning: "field must match '^[a-zA-Z0-9-\\.]+$': plans[0].name",
+		},
+		"example plan missing": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.Examples[0].PlanId = "00000000-0000-0000-0000-000000000000"
+			},
+			ExpectedErr: "plan 00000000-0000-0000-0000-000000000000 doesn't exist: examples[0].plan_id",
+		},
+		"default violates constraints": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.ProvisionSettings.UserInputs[0].Default = "this-name-is-far-too-long"
+			},
+			ExpectedErr: "default doesn't satisfy the constraints: provision.user_inputs[0].default",
+		},
+		"default wrong type": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.ProvisionSettings.UserInputs[0].Default = 42
+			},
+			ExpectedErr: "default doesn't satisfy the constraints: provision.user_inputs[0].default",
+		},
+		"enum wrong type": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.ProvisionSettings.UserInputs[0].Enum = map[interface{}]string{1: "one"}
+			},
+			ExpectedErr: "enum value 1 doesn't match type string: provision.user_inputs[0].enum",
+		},
+		"plan input enum wrong type": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.BindSettings.PlanInputs = []broker.BrokerVariable{
+					{FieldName: "role", Type: broker.JsonTypeInteger, Details: "role", Enum: map[interface{}]string{1.5: "one and a half"}},
+				}
+			},
+			ExpectedErr: "enum value 1.5 doesn't match type integer: bind.plan_inputs[0].enum",
+		},
+		"default references undefined variable": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.ProvisionSettings.UserInputs[0].Default = "${request.binding_id}"
+			},
+			ExpectedErr: "template references undefined variables: request.binding_id: provision.user_inputs[0].default",
+		},
+		"computed references later computed": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.ProvisionSettings.Computed = []varcontext.DefaultVariable{
+					{Name: "first", Default: "${second}"},
+					{Name: "second", Default: "${username}"},
+				}
+			},
+			ExpectedErr: "template references undefined variables: second: provision.computed_inputs[0].default",
+		},
+		"dashboard references undefined variable": {
+			Change: func(svc *tf.TfServiceDefinitionV1) {
+				svc.DashboardUrlTemplate = "https://example.com/${instance.bucket}"
+			},
+			ExpectedErr: "template references undefined variables: instance.bucket: dashboard_url_template",
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			svc := tf.NewExampleTfServiceDefinition()
+			svc.ProvisionSettings.UserInputs[0].Constraints = map[string]interface{}{"maxLength": 20}
+			tc.Change(&svc)
+
+			errs, warnings := lintService(svc)
+
+			switch {
+			case tc.ExpectedErr == "" && errs != nil:
+				t.Errorf("Expected no errors, got: %v", errs)
+			case tc.ExpectedErr != "" && (errs == nil || !strings.Contains(errs.Error(), tc.ExpectedErr)):
+				t.Errorf("Expected error containing %q, got: %v", tc.ExpectedErr, errs)
+			}
+
+			switch {
+			case tc.ExpectedWarning == "" && warnings != nil:
+				t.Errorf("Expected no warnings, got: %v", warnings)
+			case tc.ExpectedWarning != "" && (warnings == nil || warnings.Error() != tc.ExpectedWarning):
+				t.Errorf("Expected warning %q, got: %v", tc.ExpectedWarning, warnings)
+			}
+		})
+	}
+}
+
+func TestLintService_googleBrokers(t *testing.T) {
+	// The brokerpak shipped with the broker MUST be lint free.
+	manifest := &Manifest{}
+	dir := filepath.Join("..", "..", "google-brokers")
+	if err := stream.Copy(stream.FromFile(dir, manifestName), stream.ToYaml(manifest)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range manifest.ServiceDefinitions {
+		t.Run(path, func(t *testing.T) {
+			svc := tf.TfServiceDefinitionV1{}
+			if err := stream.Copy(stream.FromFile(dir, path), stream.ToYaml(&svc)); err != nil {
+				t.Fatal(err)
+			}
+
+			if errs, warnings := lintService(svc); errs != nil || warnings != nil {
+				t.Errorf("Expected no problems, got errors: %v, warnings: %v", errs, warnings)
+			}
+		})
+	}
+}
+
+func TestLint(t *testing.T) {
+	pak, err := fakeBrokerpak()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(pak)
+
+	t.Run("single brokerpak", func(t *testing.T) {
+		result, err := Lint(pak)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Errors != nil {
+			t.Errorf("Expected no errors, got: %v", result.Errors)
+		}
+	})
+
+	t.Run("duplicate brokerpaks", func(t *testing.T) {
+		result, err := Lint(pak, pak)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		svc := tf.NewExampleTfServiceDefinition()
+		expected := "duplicate service ID " + svc.Id + ": brokerpaks[" + pak + "].services[" + svc.Name + "].id"
+		if result.Errors == nil || !strings.Contains(result.Errors.Error(), expected) {
+			t.Errorf("Expected error containing %q, got: %v", expected, result.Errors)
+		}
+
+		if !strings.Contains(result.Errors.Error(), "duplicate plan ID "+svc.Plans[0].Id) {
+			t.Errorf("Expected duplicate plan error, got: %v", result.Errors)
+		}
+	})
+
+	t.Run("missing brokerpak", func(t *testing.T) {
+		if _, err := Lint("missing.brokerpak"); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+}
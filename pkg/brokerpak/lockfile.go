@@ -0,0 +1,91 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package brokerpak
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/utils/stream"
+)
+
+// lockfileName is the name of the lockfile included in the root of the
+// brokerpak. Builds also read it from next to the manifest if it exists.
+const lockfileName = "brokerpak.lock"
+
+// Lockfile records every artifact resolved while building a brokerpak so
+// later builds can verify they got the same artifacts.
+type Lockfile struct {
+	Artifacts []LockedArtifact `yaml:"artifacts"`
+}
+
+// LockedArtifact is a single downloaded artifact.
+type LockedArtifact struct {
+	// Name and Version identify the TerraformResource the artifact is for.
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+
+	// Platform holds the platform of a release archive e.g. linux/amd64, it's
+	// blank for source archives.
+	Platform string `yaml:"platform,omitempty"`
+
+	// Url holds the location the artifact was downloaded from.
+	Url string `yaml:"url"`
+
+	// Sha256 holds the hex encoded SHA-256 sum of the artifact.
+	Sha256 string `yaml:"sha256"`
+}
+
+// readLockfile reads the lockfile in the given directory. If there isn't one
+// an empty lockfile is returned.
+func readLockfile(directory string) (*Lockfile, error) {
+	lock := &Lockfile{}
+
+	path := filepath.Join(directory, lockfileName)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return lock, nil
+	}
+
+	if err := stream.Copy(stream.FromFile(path), stream.ToYaml(lock)); err != nil {
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// write saves the lockfile to the given directory.
+func (lock *Lockfile) write(directory string) error {
+	return stream.Copy(stream.FromYaml(lock), stream.ToFile(directory, lockfileName))
+}
+
+// Sha256 gets the locked sum of the artifact with the same name, version,
+// platform and URL or a blank string if it wasn't locked.
+func (lock *Lockfile) Sha256(artifact LockedArtifact) string {
+	for _, locked := range lock.Artifacts {
+		if locked.Name == artifact.Name &&
+			locked.Version == artifact.Version &&
+			locked.Platform == artifact.Platform &&
+			locked.Url == artifact.Url {
+			return locked.Sha256
+		}
+	}
+
+	return ""
+}
+
+// add records a resolved artifact.
+func (lock *Lockfile) add(artifact LockedArtifact) {
+	lock.Artifacts = append(lock.Artifacts, artifact)
+}
@@ -19,14 +19,19 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
 
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/validation"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/utils/stream"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/utils/ziputil"
 
 	getter "github.com/hashicorp/go-getter"
+	"github.com/spf13/cast"
 )
 
 const manifestName = "manifest.yml"
@@ -43,6 +48,10 @@ type Manifest struct {
 	TerraformResources []TerraformResource `yaml:"terraform_binaries"`
 	ServiceDefinitions []string            `yaml:"service_definitions"`
 	Parameters         []ManifestParameter `yaml:"parameters"`
+
+	// GoogleCredentials opts in to having the broker's service account and
+	// project set as GOOGLE_CREDENTIALS and GOOGLE_PROJECT when Terraform runs.
+	GoogleCredentials bool `yaml:"google_credentials,omitempty"`
 }
 
 var _ validation.Validatable = (*Manifest)(nil)
@@ -101,8 +110,9 @@ func (m *Manifest) AppliesToCurrentPlatform() bool {
 	return false
 }
 
-// Pack creates a brokerpak from the manifest and definitions.
-func (m *Manifest) Pack(base, dest string) error {
+// Pack creates a brokerpak from the manifest and definitions. Artifacts are
+// fetched through the cache, which may be nil.
+func (m *Manifest) Pack(base, dest string, cache *ArtifactCache) error {
 	// NOTE: we use "log" rather than Lager because this is used by the CLI and
 	// needs to be human readable rather than JSON.
 	log.Println("Packing...")
@@ -114,13 +124,22 @@ func (m *Manifest) Pack(base, dest string) error {
 	defer os.RemoveAll(dir) // clean up
 	log.Println("Using temp directory:", dir)
 
+	// Artifacts are checked against the lockfile next to the manifest, if
+	// there is one, so changes to upstream releases are caught even if the
+	// manifest doesn't pin them.
+	previous, err := readLockfile(base)
+	if err != nil {
+		return fmt.Errorf("couldn't read %s: %v", lockfileName, err)
+	}
+	lock := &Lockfile{}
+
 	log.Println("Packing sources...")
-	if err := m.packSources(dir); err != nil {
+	if err := m.packSources(dir, cache, previous, lock); err != nil {
 		return err
 	}
 
 	log.Println("Packing binaries...")
-	if err := m.packBinaries(dir); err != nil {
+	if err := m.packBinaries(dir, cache, previous, lock); err != nil {
 		return err
 	}
 
@@ -129,29 +148,96 @@ func (m *Manifest) Pack(base, dest string) error {
 		return err
 	}
 
+	log.Println("Writing lockfile...")
+	if err := lock.write(dir); err != nil {
+		return err
+	}
+
 	log.Println("Creating archive:", dest)
 	return ziputil.Archive(dir, dest)
 }
 
-func (m *Manifest) packSources(tmp string) error {
+func (m *Manifest) packSources(tmp string, cache *ArtifactCache, previous, lock *Lockfile) error {
 	for _, resource := range m.TerraformResources {
 		destination := filepath.Join(tmp, "src", resource.Name+".zip")
+		artifact := LockedArtifact{Name: resource.Name, Version: resource.Version, Url: resource.Source}
 
 		log.Println("\t", resource.Source, "->", destination)
-		if err := fetchArchive(resource.Source, destination); err != nil {
+		sum, err := cache.fetch(resource.Source, destination, expectedSha256(resource.SourceSha256, previous, artifact))
+		if err != nil {
 			return err
 		}
+
+		artifact.Sha256 = sum
+		lock.add(artifact)
 	}
 	return nil
 }
 
-func (m *Manifest) packBinaries(tmp string) error {
+func (m *Manifest) packBinaries(tmp string, cache *ArtifactCache, previous, lock *Lockfile) error {
+	downloads, err := ioutil.TempDir("", "brokerpak-downloads")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(downloads)
+
 	for _, platform := range m.Platforms {
 		platformPath := filepath.Join(tmp, "bin", platform.Os, platform.Arch)
 		for _, resource := range m.TerraformResources {
+			url := resource.Url(platform)
+			artifact := LockedArtifact{Name: resource.Name, Version: resource.Version, Platform: platform.String(), Url: url}
+
+			// Download the archive as-is so it can be checked before it's
+			// decompressed. The name is kept so go-getter can detect the format.
+			archive := filepath.Join(downloads, platform.Os, platform.Arch, resource.Name, archiveName(url))
+			sum, err := cache.fetch(url, archive, expectedSha256(resource.Sha256(platform), previous, artifact))
+			if err != nil {
+				return err
+			}
+
+			log.Println("\t", url, "->", platformPath)
+			client := &getter.Client{
+				Src:     archive,
+				Dst:     platformPath,
+				Mode:    getter.ClientModeAny,
+				Getters: defaultGetters(),
+			}
+			if err := client.Get(); err != nil {
+				return err
+			}
+
+			artifact.Sha256 = sum
+			lock.add(artifact)
+		}
+	}
+
+	return nil
+}
+
+// Vendor downloads every source and binary the manifest references into the
+// cache so the brokerpak can be built offline.
+func (m *Manifest) Vendor(base string, cache *ArtifactCache) error {
+	previous, err := readLockfile(base)
+	if err != nil {
+		return fmt.Errorf("couldn't read %s: %v", lockfileName, err)
+	}
+
+	for _, resource := range m.TerraformResources {
+		artifact := LockedArtifact{Name: resource.Name, Version: resource.Version, Url: resource.Source}
+
+		log.Println("\t", resource.Source)
+		if _, _, err := cache.ensure(resource.Source, expectedSha256(resource.SourceSha256, previous, artifact)); err != nil {
+			return err
+		}
+	}
+
+	for _, platform := range m.Platforms {
+		for _, resource := range m.TerraformResources {
+			url := resource.Url(platform)
+			artifact := LockedArtifact{Name: resource.Name, Version: resource.Version, Platform: platform.String(), Url: url}
 
-			log.Println("\t", resource.Url(platform), "->", platformPath)
-			if err := getter.GetAny(platformPath, resource.Url(platform)); err != nil {
+			log.Println("\t", url)
+			if _, _, err := cache.ensure(url, expectedSha256(resource.Sha256(platform), previous, artifact)); err != nil {
 				return err
 			}
 		}
@@ -160,6 +246,22 @@ func (m *Manifest) packBinaries(tmp string) error {
 	return nil
 }
 
+// expectedSha256 gets the sum an artifact MUST have, sums pinned in the
+// manifest take precedence over the previous lockfile.
+func expectedSha256(pinned string, previous *Lockfile, artifact LockedArtifact) string {
+	if pinned != "" {
+		return pinned
+	}
+
+	return previous.Sha256(artifact)
+}
+
+// archiveName gets the file name of the archive at the URL.
+func archiveName(url string) string {
+	withoutQuery := strings.SplitN(url, "?", 2)[0]
+	return path.Base(withoutQuery)
+}
+
 func (m *Manifest) packDefinitions(tmp, base string) error {
 	// users can place definitions in any directory structure they like, even
 	// above the current directory so we standardize their location and names
@@ -188,6 +290,10 @@ func (m *Manifest) packDefinitions(tmp, base string) error {
 	return stream.Copy(stream.FromYaml(manifestCopy), stream.ToFile(tmp, manifestName))
 }
 
+// parameterTypeRegex matches the types a parameter can have, parameters are
+// environment variables so only scalars are allowed.
+var parameterTypeRegex = regexp.MustCompile(`^(|string|integer|number|boolean)$`)
+
 // ManifestParameter holds environment variables that will be looked up and
 // passed to the executed Terraform instance.
 type ManifestParameter struct {
@@ -195,16 +301,126 @@ type ManifestParameter struct {
 	// solve a similar problem. https://github.com/deislabs/cnab-spec
 	Name        string `yaml:"name"`
 	Description string `yaml:"description"`
+
+	// Type is the JSON Schema type the value must have, it defaults to string.
+	Type broker.JsonType `yaml:"type,omitempty"`
+	// Default is used if the operator doesn't set a value.
+	Default interface{} `yaml:"default,omitempty"`
+	// Required parameters stop the brokerpak from loading if they're missing.
+	Required bool `yaml:"required,omitempty"`
+	// Sensitive parameters hold secrets, they're masked in forms and output.
+	Sensitive bool `yaml:"sensitive,omitempty"`
+	// Enum holds the allowed values, if any.
+	Enum []interface{} `yaml:"enum,omitempty"`
 }
 
 var _ validation.Validatable = (*ManifestParameter)(nil)
 
 // Validate implements validation.Validatable.
 func (param *ManifestParameter) Validate() (errs *validation.FieldError) {
-	return errs.Also(
+	errs = errs.Also(
 		validation.ErrIfBlank(param.Name, "name"),
 		validation.ErrIfBlank(param.Description, "description"),
+		validation.ErrIfNotMatch(string(param.Type), parameterTypeRegex, "type"),
 	)
+
+	if errs != nil {
+		return errs
+	}
+
+	for i, value := range param.Enum {
+		if _, err := param.Parse(value); err != nil {
+			errs = errs.Also(validation.ErrInvalidArrayValue(value, "enum", i))
+		}
+	}
+
+	if param.Sensitive && param.Default != nil {
+		errs = errs.Also(&validation.FieldError{
+			Message: "sensitive parameters can't have a default",
+			Paths:   []string{"default"},
+		})
+	} else if param.Default != nil {
+		if _, err := param.Parse(param.Default); err != nil {
+			errs = errs.Also(&validation.FieldError{
+				Message: "invalid default",
+				Paths:   []string{"default"},
+				Details: err.Error(),
+			})
+		}
+	}
+
+	return errs
+}
+
+// TypeOrDefault gets the parameter's type, defaulting to string.
+func (param *ManifestParameter) TypeOrDefault() broker.JsonType {
+	if param.Type == "" {
+		return broker.JsonTypeString
+	}
+
+	return param.Type
+}
+
+// Parse converts a configured value, which may have been read from a file or
+// environment variable as a string, to the parameter's type and checks it's
+// one of the allowed values.
+func (param *ManifestParameter) Parse(value interface{}) (out interface{}, err error) {
+	paramType := param.TypeOrDefault()
+
+	// values from files and the environment are always strings so they're
+	// parsed, other values must already have the right type
+	_, isString := value.(string)
+	if paramType != broker.JsonTypeString && !isString && !isJsonType(value, paramType) {
+		return nil, fmt.Errorf("expected %s, got %v", paramType, value)
+	}
+
+	switch paramType {
+	case broker.JsonTypeInteger:
+		out, err = cast.ToInt64E(value)
+	case broker.JsonTypeNumeric:
+		out, err = cast.ToFloat64E(value)
+	case broker.JsonTypeBoolean:
+		out, err = cast.ToBoolE(value)
+	default:
+		out, err = cast.ToStringE(value)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("expected %s, got %v", paramType, value)
+	}
+
+	if len(param.Enum) == 0 {
+		return out, nil
+	}
+
+	for _, allowed := range param.Enum {
+		if parsed, err := (&ManifestParameter{Type: param.Type}).Parse(allowed); err == nil && parsed == out {
+			return out, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%v isn't one of the allowed values: %v", value, param.Enum)
+}
+
+// ToBrokerVariable converts the parameter into a BrokerVariable so it can be
+// shown in forms and documentation like service variables.
+func (param *ManifestParameter) ToBrokerVariable() broker.BrokerVariable {
+	variable := broker.BrokerVariable{
+		FieldName: param.Name,
+		Type:      param.TypeOrDefault(),
+		Details:   param.Description,
+		Required:  param.Required,
+		Default:   param.Default,
+	}
+
+	if len(param.Enum) > 0 {
+		variable.Enum = make(map[interface{}]string)
+		for _, value := range param.Enum {
+			variable.Enum[value] = fmt.Sprintf("%v", value)
+		}
+	}
+
+	return variable
 }
 
 // NewExampleManifest creates a new manifest with sample values for the service broker suitable for giving a user a template to manually edit.
@@ -235,6 +451,9 @@ func NewExampleManifest() Manifest {
 		ServiceDefinitions: []string{"example-service-definition.yml"},
 		Parameters: []ManifestParameter{
 			{Name: "MY_ENVIRONMENT_VARIABLE", Description: "Set this to whatever you like."},
+			{Name: "MY_API_KEY", Description: "An API key for the provider.", Required: true, Sensitive: true},
+			{Name: "MY_REGION", Description: "The region to create resources in.", Default: "us-central1", Enum: []interface{}{"us-central1", "us-east1"}},
 		},
+		GoogleCredentials: true,
 	}
 }
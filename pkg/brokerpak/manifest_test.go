@@ -15,10 +15,17 @@
 package brokerpak
 
 import (
+	"bytes"
 	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/validation"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/utils/stream"
 )
 
 func TestNewExampleManifest(t *testing.T) {
@@ -41,6 +48,35 @@ func TestManifestParameter_Validate(t *testing.T) {
 				Description: "Usage goes here",
 			},
 		},
+		"good typed obj": {
+			Object: &ManifestParameter{
+				Name:        "TEST",
+				Description: "Usage goes here",
+				Type:        broker.JsonTypeInteger,
+				Default:     "8080",
+				Enum:        []interface{}{80, 8080},
+			},
+		},
+		"bad type": {
+			Object: &ManifestParameter{Name: "TEST", Description: "Usage goes here", Type: "object"},
+			Expect: errors.New("field must match '^(|string|integer|number|boolean)$': type"),
+		},
+		"default wrong type": {
+			Object: &ManifestParameter{Name: "TEST", Description: "Usage goes here", Type: broker.JsonTypeBoolean, Default: 1},
+			Expect: errors.New("invalid default: default\nexpected boolean, got 1"),
+		},
+		"default not allowed": {
+			Object: &ManifestParameter{Name: "TEST", Description: "Usage goes here", Default: "c", Enum: []interface{}{"a", "b"}},
+			Expect: errors.New("invalid default: default\nc isn't one of the allowed values: [a b]"),
+		},
+		"enum wrong type": {
+			Object: &ManifestParameter{Name: "TEST", Description: "Usage goes here", Type: broker.JsonTypeNumeric, Enum: []interface{}{1, "two"}},
+			Expect: errors.New("invalid value: two: enum[1]"),
+		},
+		"sensitive default": {
+			Object: &ManifestParameter{Name: "TEST", Description: "Usage goes here", Sensitive: true, Default: "hunter2"},
+			Expect: errors.New("sensitive parameters can't have a default: default"),
+		},
 	}
 
 	for tn, tc := range cases {
@@ -49,3 +85,124 @@ func TestManifestParameter_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestManifest_Pack(t *testing.T) {
+	// dummySha256 is the SHA-256 sum of the dummy Terraform resources.
+	const dummySha256 = "dd5e9b25ed0dd1edf92d90d7fd8820fc7c9baff06626616db068e3d6172b23ff"
+
+	cases := map[string]struct {
+		// Setup modifies the manifest and sources, it's called before each build.
+		Setup       func(t *testing.T, dir string, manifest *Manifest, build int)
+		ExpectedErr string
+	}{
+		"unpinned": {},
+		"pinned": {
+			Setup: func(t *testing.T, dir string, manifest *Manifest, build int) {
+				for i := range manifest.TerraformResources {
+					manifest.TerraformResources[i].SourceSha256 = dummySha256
+					manifest.TerraformResources[i].Sha256Sums = map[string]string{"linux/amd64": strings.ToUpper(dummySha256)}
+				}
+			},
+		},
+		"pinned binary mismatch": {
+			Setup: func(t *testing.T, dir string, manifest *Manifest, build int) {
+				manifest.TerraformResources[0].Sha256Sums = map[string]string{"linux/386": strings.Repeat("0", 64)}
+			},
+			ExpectedErr: "checksum mismatch",
+		},
+		"pinned source mismatch": {
+			Setup: func(t *testing.T, dir string, manifest *Manifest, build int) {
+				manifest.TerraformResources[0].SourceSha256 = strings.Repeat("0", 64)
+			},
+			ExpectedErr: "checksum mismatch",
+		},
+		"changed since lock": {
+			Setup: func(t *testing.T, dir string, manifest *Manifest, build int) {
+				if build == 0 {
+					return
+				}
+
+				if err := stream.Copy(stream.FromString("tampered-file"), stream.ToFile(dir, "terraform")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			ExpectedErr: "checksum mismatch",
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "manifest-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			manifest, err := writeFakeBrokerpakSources(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var paks [][]byte
+			for build := 0; build < 2; build++ {
+				if tc.Setup != nil {
+					tc.Setup(t, dir, manifest, build)
+				}
+
+				dest := filepath.Join(dir, "out.brokerpak")
+				err = manifest.Pack(dir, dest, nil)
+				if err != nil {
+					break
+				}
+
+				contents, err := ioutil.ReadFile(dest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				paks = append(paks, contents)
+
+				if build == 0 {
+					if _, err := os.Stat(filepath.Join(dir, lockfileName)); !os.IsNotExist(err) {
+						t.Fatalf("Expected the build not to write %s to the sources, got: %v", lockfileName, err)
+					}
+
+					if err := UpdateLockfile(dest, dir); err != nil {
+						t.Fatal(err)
+					}
+				}
+				os.Remove(dest)
+			}
+
+			if tc.ExpectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.ExpectedErr) {
+					t.Fatalf("Expected error containing %q, got: %v", tc.ExpectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if !bytes.Equal(paks[0], paks[1]) {
+				t.Error("Expected builds from the same inputs to be byte-identical")
+			}
+
+			lock, err := readLockfile(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// one source and two platforms for each of the two resources
+			if len(lock.Artifacts) != 6 {
+				t.Fatalf("Expected 6 locked artifacts, got: %v", lock.Artifacts)
+			}
+
+			for _, artifact := range lock.Artifacts {
+				if artifact.Sha256 != dummySha256 {
+					t.Errorf("Expected %s %s to have sum %s, got %s", artifact.Name, artifact.Platform, dummySha256, artifact.Sha256)
+				}
+			}
+		})
+	}
+}
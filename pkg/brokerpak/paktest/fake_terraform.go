@@ -0,0 +1,172 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package paktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf/wrapper"
+)
+
+const fakeStateFile = "terraform.tfstate"
+
+// FakeTerraform stands in for Terraform so brokerpaks can be tested without
+// creating any resources. Applies record the inputs of each module instance
+// and write the outputs it was given to the state, destroys clear the state
+// and every other command succeeds without doing anything.
+type FakeTerraform struct {
+	mu      sync.Mutex
+	outputs map[string]interface{}
+	applies []map[string]interface{}
+}
+
+// NewFakeTerraform creates a FakeTerraform with no outputs.
+func NewFakeTerraform() *FakeTerraform {
+	return &FakeTerraform{}
+}
+
+// SetOutputs sets the outputs later applies write to the state. Only the ones
+// declared by the module being applied are written.
+func (f *FakeTerraform) SetOutputs(outputs map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.outputs = outputs
+}
+
+// Applies gets the inputs of every module instance applied so far in the
+// order they were applied.
+func (f *FakeTerraform) Applies() []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]map[string]interface{}{}, f.applies...)
+}
+
+// Execute is a wrapper.TerraformExecutor that fakes the Terraform command.
+func (f *FakeTerraform) Execute(c *exec.Cmd) error {
+	if len(c.Args) < 2 {
+		return fmt.Errorf("expected a Terraform sub-command, got: %v", c.Args)
+	}
+
+	switch c.Args[1] {
+	case "apply":
+		return f.apply(c.Dir)
+	case "destroy":
+		return writeFakeState(c.Dir, nil)
+	default:
+		return nil
+	}
+}
+
+func (f *FakeTerraform) apply(dir string) error {
+	instances, err := readInstances(dir)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var modules []interface{}
+	for name, config := range instances {
+		source, _ := config["source"].(string)
+		delete(config, "source")
+		f.applies = append(f.applies, config)
+
+		definition, err := ioutil.ReadFile(filepath.Join(dir, source, "definition.tf"))
+		if err != nil {
+			return err
+		}
+
+		module := wrapper.ModuleDefinition{Name: source, Definition: string(definition)}
+		outputNames, err := module.Outputs()
+		if err != nil {
+			return err
+		}
+
+		outputs := make(map[string]interface{})
+		for _, output := range outputNames {
+			if value, ok := f.outputs[output]; ok {
+				outputs[output] = map[string]interface{}{"type": outputType(value), "value": value}
+			}
+		}
+
+		modules = append(modules, map[string]interface{}{
+			"path":    []string{"root", name},
+			"outputs": outputs,
+		})
+	}
+
+	return writeFakeState(dir, modules)
+}
+
+// readInstances reads the configuration of each module instance in the
+// workspace directory, it includes the module's source.
+func readInstances(dir string) (map[string]map[string]interface{}, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make(map[string]map[string]interface{})
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		defn := struct {
+			Module map[string]map[string]interface{} `json:"module"`
+		}{}
+		if err := json.Unmarshal(contents, &defn); err != nil {
+			return nil, fmt.Errorf("couldn't parse instance %q: %v", filepath.Base(file), err)
+		}
+
+		for name, config := range defn.Module {
+			instances[name] = config
+		}
+	}
+
+	return instances, nil
+}
+
+// writeFakeState writes a tfstate file with the given modules to the directory.
+func writeFakeState(dir string, modules []interface{}) error {
+	state, err := json.Marshal(map[string]interface{}{"version": 3, "modules": modules})
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, fakeStateFile), state, 0644)
+}
+
+// outputType gets the Terraform type of an output value parsed from JSON.
+func outputType(value interface{}) string {
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Slice:
+		return "list"
+	case reflect.Map:
+		return "map"
+	default:
+		return "string"
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package paktest runs the examples in a brokerpak offline, through the real
+// broker with an in-memory database and a fake Terraform, so brokerpak
+// authors can test their variables and templates in CI.
+package paktest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/brokerapi/brokers"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/brokerpak"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/client"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/server"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/utils/stream"
+	"github.com/jinzhu/gorm"
+	"github.com/pivotal-cf/brokerapi"
+)
+
+const (
+	// exampleTimeout is how long a single example can take, the fake
+	// Terraform finishes immediately so this only guards against hangs.
+	exampleTimeout = 2 * time.Minute
+	pollInterval   = 50 * time.Millisecond
+)
+
+// Fixture holds the Terraform outputs to use and the inputs to expect for
+// the steps of an example.
+type Fixture struct {
+	Provision StepFixture `json:"provision"`
+	Bind      StepFixture `json:"bind"`
+}
+
+// StepFixture holds the Terraform outputs to use and the inputs to expect for
+// a provision or bind.
+type StepFixture struct {
+	// Outputs are written to the Terraform state, for example ones recorded
+	// from a real run. Outputs that aren't listed get a stubbed value.
+	Outputs map[string]interface{} `json:"outputs,omitempty"`
+
+	// Inputs are compared to the values passed to Terraform. Inputs that
+	// aren't listed aren't checked.
+	Inputs map[string]interface{} `json:"inputs,omitempty"`
+}
+
+// ReadFixtures reads a JSON file of fixtures keyed by "service/example".
+func ReadFixtures(path string) (map[string]Fixture, error) {
+	var fixtures map[string]Fixture
+	if err := stream.Copy(stream.FromFile(path), stream.ToBuffer(func(buf *bytes.Buffer) error {
+		return json.Unmarshal(buf.Bytes(), &fixtures)
+	})); err != nil {
+		return nil, fmt.Errorf("couldn't read fixtures %q: %v", path, err)
+	}
+
+	return fixtures, nil
+}
+
+// Run provisions, binds, unbinds and deprovisions every example in the
+// brokerpak with a FakeTerraform and reports the results to out. Each step
+// must succeed, the Terraform inputs must match the fixture and the binding
+// credentials must match the service's output schema. Examples with an
+// expected provision error must fail to provision with a matching error.
+//
+// Credential assertions and smoke checks aren't run because the credentials
+// come from the fake Terraform.
+func Run(pack string, fixtures map[string]Fixture, out io.Writer) error {
+	fake := NewFakeTerraform()
+	registry, err := brokerpak.RegistryWithExecutor(pack, fake.Execute)
+	if err != nil {
+		return err
+	}
+
+	examples, err := server.GetAllCompleteServiceExamples(registry)
+	if err != nil {
+		return err
+	}
+
+	// connections share the in-memory database through the cache, it's
+	// deleted when the last one is closed
+	db, err := gorm.Open("sqlite3", fmt.Sprintf("file:paktest-%d?mode=memory&cache=shared", time.Now().UnixNano()))
+	if err != nil {
+		return fmt.Errorf("couldn't create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db_service.RunMigrations(db); err != nil {
+		return fmt.Errorf("couldn't migrate database: %v", err)
+	}
+
+	// shared cache connections fail rather than wait for each other's locks
+	db.DB().SetMaxOpenConns(1)
+	db_service.DbConnection = db
+
+	gcpBroker, err := brokers.New(&brokers.BrokerConfig{
+		ProjectId: "paktest-project",
+		Registry:  registry,
+	}, lager.NewLogger("paktest"))
+	if err != nil {
+		return err
+	}
+
+	r := &runner{broker: gcpBroker, registry: registry, fake: fake}
+
+	failed := 0
+	for i, example := range examples {
+		name := fmt.Sprintf("%s/%s", example.ServiceName, example.ServiceExample.Name)
+
+		if err := r.runExample(i, example, fixtures[name]); err != nil {
+			failed++
+			fmt.Fprintf(out, "FAIL %s: %v\n", name, err)
+		} else {
+			fmt.Fprintf(out, "PASS %s\n", name)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d examples failed", failed, len(examples))
+	}
+
+	return nil
+}
+
+type runner struct {
+	broker   *brokers.GCPServiceBroker
+	registry broker.BrokerRegistry
+	fake     *FakeTerraform
+}
+
+// runExample runs a single example, i is used to give each one unique IDs.
+func (r *runner) runExample(i int, example client.CompleteServiceExample, fixture Fixture) error {
+	ctx, cancel := context.WithTimeout(context.Background(), exampleTimeout)
+	defer cancel()
+
+	service, err := r.registry.GetServiceById(example.ServiceId)
+	if err != nil {
+		return err
+	}
+
+	provisionParams, err := json.Marshal(example.ServiceExample.ProvisionParams)
+	if err != nil {
+		return err
+	}
+
+	bindParams, err := json.Marshal(example.ServiceExample.BindParams)
+	if err != nil {
+		return err
+	}
+
+	instanceId := fmt.Sprintf("paktest-instance-%d", i)
+	bindingId := fmt.Sprintf("paktest-binding-%d", i)
+
+	provision := func() error {
+		spec, err := r.broker.Provision(ctx, instanceId, brokerapi.ProvisionDetails{
+			ServiceID:     example.ServiceId,
+			PlanID:        example.ServiceExample.PlanId,
+			RawParameters: provisionParams,
+		}, true)
+		if err != nil || !spec.IsAsync {
+			return err
+		}
+
+		return r.waitForOperation(ctx, instanceId)
+	}
+
+	if example.ServiceExample.ExpectsProvisionFailure() {
+		r.fake.SetOutputs(stubOutputs(service.BindOutputVariables))
+		return example.ServiceExample.CheckProvisionError(provision())
+	}
+
+	err = r.step("provision", service.BindOutputVariables, fixture.Provision, provision)
+	if err != nil {
+		return err
+	}
+
+	var binding brokerapi.Binding
+	err = r.step("bind", service.BindOutputVariables, fixture.Bind, func() (err error) {
+		binding, err = r.broker.Bind(ctx, instanceId, bindingId, brokerapi.BindDetails{
+			ServiceID:     example.ServiceId,
+			PlanID:        example.ServiceExample.PlanId,
+			RawParameters: bindParams,
+		}, false)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := checkCredentials(binding.Credentials, example.ExpectedOutput); err != nil {
+		return err
+	}
+
+	if _, err := r.broker.Unbind(ctx, instanceId, bindingId, brokerapi.UnbindDetails{
+		ServiceID: example.ServiceId,
+		PlanID:    example.ServiceExample.PlanId,
+	}, false); err != nil {
+		return fmt.Errorf("unbind failed: %v", err)
+	}
+
+	spec, err := r.broker.Deprovision(ctx, instanceId, brokerapi.DeprovisionDetails{
+		ServiceID: example.ServiceId,
+		PlanID:    example.ServiceExample.PlanId,
+	}, true)
+	if err == nil && spec.IsAsync {
+		err = r.waitForOperation(ctx, instanceId)
+	}
+	if err != nil {
+		return fmt.Errorf("deprovision failed: %v", err)
+	}
+
+	return nil
+}
+
+// step runs a provision or bind with stubbed outputs, overridden by the
+// fixture, and checks it applied exactly one workspace whose inputs match the
+// fixture.
+func (r *runner) step(name string, outputVars []broker.BrokerVariable, fixture StepFixture, action func() error) error {
+	outputs := stubOutputs(outputVars)
+	for k, v := range fixture.Outputs {
+		outputs[k] = v
+	}
+	r.fake.SetOutputs(outputs)
+
+	before := len(r.fake.Applies())
+	if err := action(); err != nil {
+		return fmt.Errorf("%s failed: %v", name, err)
+	}
+
+	applies := r.fake.Applies()[before:]
+	if len(applies) != 1 {
+		return fmt.Errorf("%s failed: expected Terraform to be applied once, got %d", name, len(applies))
+	}
+
+	if err := checkInputs(applies[0], fixture.Inputs); err != nil {
+		return fmt.Errorf("%s inputs don't match: %v", name, err)
+	}
+
+	return nil
+}
+
+// waitForOperation polls the instance's last operation until it finishes.
+func (r *runner) waitForOperation(ctx context.Context, instanceId string) error {
+	for {
+		op, err := r.broker.LastOperation(ctx, instanceId, brokerapi.PollDetails{})
+		if err != nil {
+			return err
+		}
+
+		switch op.State {
+		case brokerapi.Succeeded:
+			return nil
+		case brokerapi.Failed:
+			return errors.New(op.Description)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// stubOutputs creates a value for each output that satisfies its type.
+func stubOutputs(outputVars []broker.BrokerVariable) map[string]interface{} {
+	out := make(map[string]interface{})
+	for _, v := range outputVars {
+		switch {
+		case v.Default != nil:
+			out[v.FieldName] = v.Default
+		case v.Type == broker.JsonTypeInteger || v.Type == broker.JsonTypeNumeric:
+			out[v.FieldName] = 0
+		case v.Type == broker.JsonTypeBoolean:
+			out[v.FieldName] = false
+		default:
+			out[v.FieldName] = "stub-" + v.FieldName
+		}
+	}
+
+	return out
+}
+
+// checkInputs compares the inputs Terraform was given to the expected ones.
+func checkInputs(actual, expected map[string]interface{}) error {
+	var mismatched []string
+	for _, name := range sortedKeys(expected) {
+		if !reflect.DeepEqual(actual[name], expected[name]) {
+			mismatched = append(mismatched, fmt.Sprintf("%s: expected %#v, got %#v", name, expected[name], actual[name]))
+		}
+	}
+
+	if len(mismatched) > 0 {
+		return errors.New(strings.Join(mismatched, "; "))
+	}
+
+	return nil
+}
+
+// checkCredentials validates the binding credentials against the schema.
+func checkCredentials(credentials interface{}, schema map[string]interface{}) error {
+	// round trip the credentials through JSON so they have the same types a
+	// client would see
+	serialized, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+
+	var creds map[string]interface{}
+	if err := json.Unmarshal(serialized, &creds); err != nil {
+		return err
+	}
+
+	if err := broker.ValidateVariablesAgainstSchema(creds, schema); err != nil {
+		return fmt.Errorf("credentials don't match the output schema: %v", err)
+	}
+
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
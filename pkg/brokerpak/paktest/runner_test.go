@@ -0,0 +1,216 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package paktest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/brokerpak"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/utils/stream"
+)
+
+func TestRun(t *testing.T) {
+	pak := buildExamplePak(t)
+	defer os.Remove(pak)
+
+	cases := map[string]struct {
+		Fixtures       map[string]Fixture
+		ExpectedOutput string
+		ExpectedErr    string
+	}{
+		"stubbed outputs": {
+			ExpectedOutput: "PASS example-service/Example\n",
+		},
+		"provision outputs are wired to bind inputs": {
+			Fixtures: map[string]Fixture{
+				"example-service/Example": {
+					Provision: StepFixture{
+						Outputs: map[string]interface{}{"email": "my-account@example.com"},
+						Inputs:  map[string]interface{}{"username": "my-account", "domain": "example.com"},
+					},
+					Bind: StepFixture{
+						Inputs: map[string]interface{}{"address": "my-account@example.com", "domain": "example.com"},
+					},
+				},
+			},
+			ExpectedOutput: "PASS example-service/Example\n",
+		},
+		"inputs mismatch": {
+			Fixtures: map[string]Fixture{
+				"example-service/Example": {
+					Provision: StepFixture{
+						Inputs: map[string]interface{}{"username": "someone-else"},
+					},
+				},
+			},
+			ExpectedOutput: `FAIL example-service/Example: provision inputs don't match: username: expected "someone-else", got "my-account"`,
+			ExpectedErr:    "1 of 1 examples failed",
+		},
+		"credentials don't match schema": {
+			Fixtures: map[string]Fixture{
+				"example-service/Example": {
+					Bind: StepFixture{
+						Outputs: map[string]interface{}{"uri": []interface{}{"not", "a", "string"}},
+					},
+				},
+			},
+			ExpectedOutput: "FAIL example-service/Example: credentials don't match the output schema",
+			ExpectedErr:    "1 of 1 examples failed",
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			err := Run(pak, tc.Fixtures, out)
+
+			switch {
+			case tc.ExpectedErr == "" && err != nil:
+				t.Errorf("Expected no error, got: %v", err)
+			case tc.ExpectedErr != "" && (err == nil || err.Error() != tc.ExpectedErr):
+				t.Errorf("Expected error %q, got: %v", tc.ExpectedErr, err)
+			}
+
+			if !strings.HasPrefix(out.String(), tc.ExpectedOutput) {
+				t.Errorf("Expected output starting with %q, got: %q", tc.ExpectedOutput, out.String())
+			}
+		})
+	}
+}
+
+func TestRun_expectedProvisionError(t *testing.T) {
+	pak := buildExamplePak(t, func(svc *tf.TfServiceDefinitionV1) {
+		svc.Examples = append(svc.Examples,
+			broker.ServiceExample{
+				Name:                   "Missing username",
+				Description:            "Fails validation.",
+				PlanId:                 svc.Plans[0].Id,
+				ProvisionParams:        map[string]interface{}{},
+				ExpectedProvisionError: "username is required",
+			},
+			broker.ServiceExample{
+				Name:                   "Valid username",
+				Description:            "Doesn't fail.",
+				PlanId:                 svc.Plans[0].Id,
+				ProvisionParams:        map[string]interface{}{"username": "valid"},
+				ExpectedProvisionError: "username is required",
+			},
+		)
+	})
+	defer os.Remove(pak)
+
+	out := &bytes.Buffer{}
+	err := Run(pak, nil, out)
+
+	expectedErr := "1 of 3 examples failed"
+	if err == nil || err.Error() != expectedErr {
+		t.Errorf("Expected error %q, got: %v", expectedErr, err)
+	}
+
+	expectedOutput := `PASS example-service/Example
+PASS example-service/Missing username
+FAIL example-service/Valid username: expected provision to fail with an error matching "username is required" but it succeeded
+`
+	if out.String() != expectedOutput {
+		t.Errorf("Expected output %q, got: %q", expectedOutput, out.String())
+	}
+}
+
+func TestReadFixtures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "fixtures.json")
+	contents := `{"svc/ex": {"provision": {"outputs": {"email": "a@example.com"}}, "bind": {"inputs": {"length": 16}}}}`
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fixtures, err := ReadFixtures(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixture := fixtures["svc/ex"]
+	if fixture.Provision.Outputs["email"] != "a@example.com" {
+		t.Errorf("Expected provision outputs to be read, got: %v", fixture.Provision.Outputs)
+	}
+
+	if fixture.Bind.Inputs["length"] != 16.0 {
+		t.Errorf("Expected bind inputs to be read, got: %v", fixture.Bind.Inputs)
+	}
+
+	if _, err := ReadFixtures(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected an error reading a missing file")
+	}
+}
+
+// buildExamplePak builds a brokerpak containing the example service with dummy
+// Terraform binaries, the changes are applied to the service first.
+func buildExamplePak(t *testing.T, changes ...func(svc *tf.TfServiceDefinitionV1)) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "paktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tfSrc := filepath.Join(dir, "terraform")
+	if err := stream.Copy(stream.FromString("dummy-file"), stream.ToFile(tfSrc)); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := &brokerpak.Manifest{
+		PackVersion: 1,
+		Name:        "example-pak",
+		Version:     "1.0.0",
+		Platforms:   []brokerpak.Platform{{Os: "linux", Arch: "amd64"}},
+		TerraformResources: []brokerpak.TerraformResource{
+			{Name: "terraform", Version: "0.11.9", Source: tfSrc, UrlTemplate: tfSrc},
+		},
+		ServiceDefinitions: []string{"example-service-definition.yml"},
+	}
+
+	if err := stream.Copy(stream.FromYaml(manifest), stream.ToFile(dir, "manifest.yml")); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := tf.NewExampleTfServiceDefinition()
+	for _, change := range changes {
+		change(&svc)
+	}
+
+	if err := stream.Copy(stream.FromYaml(svc), stream.ToFile(dir, "example-service-definition.yml")); err != nil {
+		t.Fatal(err)
+	}
+
+	pak, err := brokerpak.Pack(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pak
+}
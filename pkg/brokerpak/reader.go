@@ -16,8 +16,10 @@ package brokerpak
 
 import (
 	"archive/zip"
+	"crypto/ed25519"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf"
@@ -28,6 +30,10 @@ import (
 // BrokerPakReader reads bundled together Terraform and service definitions.
 type BrokerPakReader struct {
 	contents *zip.ReadCloser
+
+	// staging holds the directory a downloaded brokerpak was saved to, it's
+	// removed when the reader is closed.
+	staging string
 }
 
 func (pak *BrokerPakReader) readYaml(name string, v interface{}) error {
@@ -50,6 +56,17 @@ func (pak *BrokerPakReader) Manifest() (*Manifest, error) {
 	return manifest, nil
 }
 
+// Lockfile fetches the lockfile recording the artifacts in the package.
+func (pak *BrokerPakReader) Lockfile() (*Lockfile, error) {
+	lock := &Lockfile{}
+
+	if err := pak.readYaml(lockfileName, lock); err != nil {
+		return nil, err
+	}
+
+	return lock, nil
+}
+
 // Services gets the list of services included in the pack.
 func (pak *BrokerPakReader) Services() ([]tf.TfServiceDefinitionV1, error) {
 	manifest, err := pak.Manifest()
@@ -96,9 +113,16 @@ func (pak *BrokerPakReader) Validate() error {
 	return nil
 }
 
-// Close closes the underlying reader for the BrokerPakReader.
+// Close closes the underlying reader for the BrokerPakReader and removes the
+// downloaded copy of the brokerpak if there is one.
 func (pak *BrokerPakReader) Close() error {
-	return pak.contents.Close()
+	err := pak.contents.Close()
+
+	if pak.staging != "" {
+		os.RemoveAll(pak.staging)
+	}
+
+	return err
 }
 
 // ExtractPlatformBins extracts the binaries for the current platform to the
@@ -130,17 +154,65 @@ func OpenBrokerPak(pakPath string) (*BrokerPakReader, error) {
 // DownloadAndOpenBrokerpak downloads a (potentially remote) brokerpak to
 // the local filesystem and opens it.
 func DownloadAndOpenBrokerpak(pakUri string) (*BrokerPakReader, error) {
+	localLocation, err := downloadBrokerpak(pakUri)
+	if err != nil {
+		return nil, err
+	}
+
+	return openStagedBrokerpak(localLocation)
+}
+
+// DownloadVerifyAndOpenBrokerpak downloads a (potentially remote) brokerpak
+// and its detached signature to the local filesystem, checks the signature
+// was made by one of the trusted keys and opens it.
+func DownloadVerifyAndOpenBrokerpak(pakUri, signatureUri string, trustedKeys []ed25519.PublicKey) (*BrokerPakReader, error) {
+	localLocation, err := downloadBrokerpak(pakUri)
+	if err != nil {
+		return nil, err
+	}
+
+	sigLocation := localLocation + SignatureExtension
+	if err := fetchBrokerpak(signatureUri, sigLocation); err != nil {
+		os.RemoveAll(filepath.Dir(localLocation))
+		return nil, fmt.Errorf("couldn't download signature %q for brokerpak %q: %v", signatureUri, pakUri, err)
+	}
+
+	if err := VerifySignature(localLocation, sigLocation, trustedKeys); err != nil {
+		os.RemoveAll(filepath.Dir(localLocation))
+		return nil, fmt.Errorf("couldn't verify brokerpak %q: %v", pakUri, err)
+	}
+
+	return openStagedBrokerpak(localLocation)
+}
+
+// openStagedBrokerpak opens a brokerpak downloaded by downloadBrokerpak so its
+// staging area is removed when the reader is closed.
+func openStagedBrokerpak(localLocation string) (*BrokerPakReader, error) {
+	pak, err := OpenBrokerPak(localLocation)
+	if err != nil {
+		os.RemoveAll(filepath.Dir(localLocation))
+		return nil, err
+	}
+
+	pak.staging = filepath.Dir(localLocation)
+	return pak, nil
+}
+
+// downloadBrokerpak downloads a (potentially remote) brokerpak to a staging
+// area on the local filesystem and returns its path.
+func downloadBrokerpak(pakUri string) (string, error) {
 	// create a temp directory to hold the pak
 	pakDir, err := ioutil.TempDir("", "brokerpak-staging")
 	if err != nil {
-		return nil, fmt.Errorf("couldn't create brokerpak staging area for %q: %v", pakUri, err)
+		return "", fmt.Errorf("couldn't create brokerpak staging area for %q: %v", pakUri, err)
 	}
 
 	// Download the brokerpak
 	localLocation := filepath.Join(pakDir, "pack.brokerpak")
 	if err := fetchBrokerpak(pakUri, localLocation); err != nil {
-		return nil, fmt.Errorf("couldn't download brokerpak %q: %v", pakUri, err)
+		os.RemoveAll(pakDir)
+		return "", fmt.Errorf("couldn't download brokerpak %q: %v", pakUri, err)
 	}
 
-	return OpenBrokerPak(localLocation)
+	return localLocation, nil
 }
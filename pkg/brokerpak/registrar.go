@@ -16,9 +16,12 @@ package brokerpak
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 
 	"code.cloudfoundry.org/lager"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
@@ -27,8 +30,13 @@ import (
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/varcontext"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/utils"
 	"github.com/spf13/cast"
+	"github.com/spf13/viper"
 )
 
+// parameterFileSuffix is added to the name of a parameter to read its value
+// from a file.
+const parameterFileSuffix = "_FILE"
+
 type registrarWalkFunc func(name string, pak BrokerpakSourceConfig, vc *varcontext.VarContext) error
 
 // Registrar is responsible for registering brokerpaks with BrokerRegistries
@@ -36,6 +44,13 @@ type registrarWalkFunc func(name string, pak BrokerpakSourceConfig, vc *varconte
 // environment variables and skipping certain services.
 type Registrar struct {
 	config *ServerConfig
+
+	// executor replaces the Terraform binaries in the brokerpaks if set.
+	executor wrapper.TerraformExecutor
+
+	// workDirs holds the directories the brokerpaks' binaries were extracted
+	// to, they're removed by Cleanup.
+	workDirs []string
 }
 
 // Register fetches the brokerpaks and registers them with the given registry.
@@ -51,15 +66,18 @@ func (r *Registrar) Register(registry broker.BrokerRegistry) error {
 			"prefix":            pak.ServicePrefix,
 		})
 
-		brokerPak, err := DownloadAndOpenBrokerpak(pak.BrokerpakUri)
+		brokerPak, err := r.open(pak)
 		if err != nil {
 			return fmt.Errorf("couldn't open brokerpak: %q: %v", pak.BrokerpakUri, err)
 		}
 		defer brokerPak.Close()
 
-		executor, err := r.createExecutor(brokerPak, vc)
-		if err != nil {
-			return err
+		executor := r.executor
+		if executor == nil {
+			executor, err = r.createExecutor(brokerPak, vc)
+			if err != nil {
+				return fmt.Errorf("couldn't configure brokerpak %q: %v", name, err)
+			}
 		}
 
 		// register the services
@@ -68,19 +86,57 @@ func (r *Registrar) Register(registry broker.BrokerRegistry) error {
 			return err
 		}
 
+		manifest, err := brokerPak.Manifest()
+		if err != nil {
+			return err
+		}
+
+		for i := range services {
+			services[i].PakName = manifest.Name
+			services[i].PakVersion = manifest.Version
+			services[i].GoogleCredentials = manifest.GoogleCredentials || googleCredentialsForAllToggle.IsActive()
+		}
+
 		defns, err := r.toDefinitions(services, pak, executor)
 		if err != nil {
 			return err
 		}
 
 		for _, defn := range defns {
-			registry.Register(defn)
+			if err := registry.TryRegister(defn); err != nil {
+				return err
+			}
 		}
 
 		return nil
 	})
 }
 
+// Cleanup removes the binaries extracted from the brokerpaks. The services the
+// registrar registered can't run Terraform afterwards.
+func (r *Registrar) Cleanup() {
+	for _, dir := range r.workDirs {
+		os.RemoveAll(dir)
+	}
+
+	r.workDirs = nil
+}
+
+// open downloads the brokerpak, verifying its signature unless the pak is
+// trusted or the server allows unsigned paks.
+func (r *Registrar) open(pak BrokerpakSourceConfig) (*BrokerPakReader, error) {
+	if pak.trusted || r.config.AllowUnsigned {
+		return DownloadAndOpenBrokerpak(pak.BrokerpakUri)
+	}
+
+	trustedKeys := r.config.trustedPublicKeys()
+	if len(trustedKeys) == 0 {
+		return nil, fmt.Errorf("no trusted keys are configured to verify the signature, set %s or enable %s", brokerpakTrustedKeysKey, allowUnsignedToggle.EnvironmentVariable())
+	}
+
+	return DownloadVerifyAndOpenBrokerpak(pak.BrokerpakUri, pak.SignatureUriOrDefault(), trustedKeys)
+}
+
 func (Registrar) toDefinitions(services []tf.TfServiceDefinitionV1, config BrokerpakSourceConfig, executor wrapper.TerraformExecutor) ([]*broker.ServiceDefinition, error) {
 	var out []*broker.ServiceDefinition
 
@@ -108,6 +164,7 @@ func (r *Registrar) createExecutor(brokerPak *BrokerPakReader, vc *varcontext.Va
 	if err != nil {
 		return nil, err
 	}
+	r.workDirs = append(r.workDirs, dir)
 
 	// extract the Terraform directory
 	if err := brokerPak.ExtractPlatformBins(dir); err != nil {
@@ -122,31 +179,130 @@ func (r *Registrar) createExecutor(brokerPak *BrokerPakReader, vc *varcontext.Va
 		return nil, err
 	}
 
-	params := r.resolveParameters(manifest.Parameters, vc)
+	params, err := r.resolveParameters(manifest.Parameters, vc)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := r.resolveCredentials(manifest.TerraformResources, vc)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range credentials {
+		params[k] = v
+	}
+
 	executor = wrapper.CustomEnvironmentExecutor(params, executor)
 
 	return executor, nil
 }
 
 // resolveParameters resolves environment variables from the given global and
-// brokerpak specific.
-func (Registrar) resolveParameters(params []ManifestParameter, vc *varcontext.VarContext) map[string]string {
+// brokerpak specific configuration. Rather than setting a value, the
+// configuration can set <name>_FILE to the path of a file holding it so
+// secrets don't need to be stored in the configuration. Parameters that
+// aren't configured are read from the GSB_BROKERPAK_PARAMETERS_<name>
+// environment variable set by the tile, then fall back to their default.
+func (Registrar) resolveParameters(params []ManifestParameter, vc *varcontext.VarContext) (map[string]string, error) {
 	out := make(map[string]string)
 
+	var invalid, missing []string
 	context := vc.ToMap()
 	for _, p := range params {
 		val, ok := context[p.Name]
-		if ok {
-			out[p.Name] = cast.ToString(val)
+
+		if path, hasPath := context[p.Name+parameterFileSuffix]; !ok && hasPath {
+			contents, err := ioutil.ReadFile(cast.ToString(path))
+			if err != nil {
+				return nil, fmt.Errorf("couldn't read %s from file: %v", p.Name, err)
+			}
+
+			val, ok = strings.TrimRight(string(contents), "\r\n"), true
 		}
+
+		if env := viper.GetString(parameterPropertyName(p.Name)); !ok && env != "" {
+			val, ok = env, true
+		}
+
+		if !ok && p.Default != nil {
+			val, ok = p.Default, true
+		}
+
+		if !ok {
+			if p.Required {
+				missing = append(missing, p.Name)
+			}
+			continue
+		}
+
+		parsed, err := p.Parse(val)
+		switch {
+		case err != nil && p.Sensitive:
+			// don't leak secrets into the logs
+			invalid = append(invalid, fmt.Sprintf("%s: value isn't a valid %s", p.Name, p.TypeOrDefault()))
+		case err != nil:
+			invalid = append(invalid, fmt.Sprintf("%s: %v", p.Name, err))
+		default:
+			out[p.Name] = cast.ToString(parsed)
+		}
+	}
+
+	var errs []string
+	if len(missing) > 0 {
+		errs = append(errs, fmt.Sprintf("missing required parameters: %s", strings.Join(missing, ", ")))
+	}
+
+	if len(invalid) > 0 {
+		errs = append(errs, fmt.Sprintf("invalid parameters: %s", strings.Join(invalid, "; ")))
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, ", "))
+	}
+
+	return out, nil
+}
+
+// parameterPropertyName gets the viper key operators can set a parameter with
+// outside of the brokerpak configuration.
+func parameterPropertyName(name string) string {
+	return brokerpakParametersKey + "." + strings.ToLower(name)
+}
+
+// resolveCredentials resolves the credentials of the Terraform resources like
+// parameters, but returns an error if any are missing.
+func (r Registrar) resolveCredentials(resources []TerraformResource, vc *varcontext.VarContext) (map[string]string, error) {
+	var params []ManifestParameter
+	for _, resource := range resources {
+		params = append(params, resource.Credentials...)
+	}
+
+	out, err := r.resolveParameters(params, vc)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, resource := range resources {
+		for _, credential := range resource.Credentials {
+			if _, ok := out[credential.Name]; !ok {
+				missing = append(missing, fmt.Sprintf("%s (for %s)", credential.Name, resource.Name))
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing credentials: %s", strings.Join(missing, ", "))
 	}
 
-	return out
+	return out, nil
 }
 
 func (r *Registrar) walk(callback registrarWalkFunc) error {
 	for name, pak := range r.config.Brokerpaks {
 		vc, err := varcontext.Builder().
+			ResolveReferences().
 			MergeJsonObject(json.RawMessage(r.config.Config)).
 			MergeJsonObject(json.RawMessage(pak.Config)).
 			Build()
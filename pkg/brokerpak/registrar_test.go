@@ -15,16 +15,20 @@
 package brokerpak
 
 import (
+	"encoding/base64"
 	"errors"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/varcontext"
+	"github.com/spf13/viper"
 )
 
 func TestNewRegistrar(t *testing.T) {
@@ -42,7 +46,8 @@ func TestNewRegistrar(t *testing.T) {
 
 	config := newLocalFileServerConfig(abs)
 	registry := broker.BrokerRegistry{}
-	err = NewRegistrar(config).Register(registry)
+	registrar := NewRegistrar(config)
+	err = registrar.Register(registry)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -50,6 +55,104 @@ func TestNewRegistrar(t *testing.T) {
 	if len(registry) != 1 {
 		t.Fatal("Expected length to be 1 got", len(registry))
 	}
+
+	workDirs := registrar.workDirs
+	if len(workDirs) != 1 {
+		t.Fatalf("Expected the brokerpak to be extracted to one directory, got: %v", workDirs)
+	}
+
+	registrar.Cleanup()
+	if _, err := os.Stat(workDirs[0]); !os.IsNotExist(err) {
+		t.Errorf("Expected %q to be removed, got: %v", workDirs[0], err)
+	}
+}
+
+func TestRegistrar_Register_signatures(t *testing.T) {
+	pk, err := fakeBrokerpak()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(pk)
+
+	abs, err := filepath.Abs(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "registrar-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyPath, _ := newSigningKey(t, dir, "signing.key")
+	pubKey, err := ioutil.ReadFile(keyPath + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey := newSigningKey(t, dir, "other.key")
+
+	sigPath, err := Sign(abs, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(sigPath)
+
+	cases := map[string]struct {
+		TrustedKeys   []string
+		AllowUnsigned bool
+		SignatureUri  string
+		ExpectedErr   string
+	}{
+		"trusted signature": {
+			TrustedKeys: []string{string(pubKey)},
+		},
+		"untrusted signature": {
+			TrustedKeys: []string{base64.StdEncoding.EncodeToString(otherKey)},
+			ExpectedErr: "the brokerpak wasn't signed by a trusted key",
+		},
+		"no trusted keys": {
+			ExpectedErr: "no trusted keys are configured",
+		},
+		"missing signature": {
+			TrustedKeys:  []string{string(pubKey)},
+			SignatureUri: filepath.Join(dir, "missing.sig"),
+			ExpectedErr:  "couldn't download signature",
+		},
+		"unsigned allowed": {
+			AllowUnsigned: true,
+			SignatureUri:  filepath.Join(dir, "missing.sig"),
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			config := &ServerConfig{
+				Config: "{}",
+				Brokerpaks: map[string]BrokerpakSourceConfig{
+					"remote-brokerpak": {
+						BrokerpakUri: abs,
+						SignatureUri: tc.SignatureUri,
+						Config:       "{}",
+					},
+				},
+				TrustedKeys:   tc.TrustedKeys,
+				AllowUnsigned: tc.AllowUnsigned,
+			}
+
+			registry := broker.BrokerRegistry{}
+			err := NewRegistrar(config).Register(registry)
+
+			switch {
+			case tc.ExpectedErr == "" && err != nil:
+				t.Fatalf("Expected no error, got: %v", err)
+			case tc.ExpectedErr != "" && (err == nil || !strings.Contains(err.Error(), tc.ExpectedErr)):
+				t.Fatalf("Expected error containing: %q, got: %v", tc.ExpectedErr, err)
+			case tc.ExpectedErr == "" && len(registry) != 1:
+				t.Fatalf("Expected 1 service to be registered, got: %d", len(registry))
+			}
+		})
+	}
 }
 
 func TestRegistrar_toDefinitions(t *testing.T) {
@@ -160,10 +263,23 @@ func TestRegistrar_toDefinitions(t *testing.T) {
 func TestRegistrar_resolveParameters(t *testing.T) {
 	r := NewRegistrar(nil)
 
+	dir, err := ioutil.TempDir("", "params")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secretFile := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secretFile, []byte("s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
 	cases := map[string]struct {
-		Context  map[string]interface{}
-		Params   []ManifestParameter
-		Expected map[string]string
+		Context     map[string]interface{}
+		Env         map[string]string
+		Params      []ManifestParameter
+		Expected    map[string]string
+		ExpectedErr string
 	}{
 		"no-params": {
 			Context:  map[string]interface{}{"n": 1, "s": "two", "b": true},
@@ -186,6 +302,82 @@ func TestRegistrar_resolveParameters(t *testing.T) {
 			},
 			Expected: map[string]string{"s": "two", "b": "true", "n": "1"},
 		},
+		"from-file": {
+			Context: map[string]interface{}{"secret_FILE": secretFile},
+			Params: []ManifestParameter{
+				{Name: "secret", Description: "a param read from a file"},
+			},
+			Expected: map[string]string{"secret": "s3cr3t"},
+		},
+		"value-preferred-to-file": {
+			Context: map[string]interface{}{"secret": "from-config", "secret_FILE": secretFile},
+			Params: []ManifestParameter{
+				{Name: "secret", Description: "a param read from a file"},
+			},
+			Expected: map[string]string{"secret": "from-config"},
+		},
+		"from-environment": {
+			Env: map[string]string{"brokerpak.parameters.region": "us-east1"},
+			Params: []ManifestParameter{
+				{Name: "REGION", Description: "a param set by the tile"},
+			},
+			Expected: map[string]string{"REGION": "us-east1"},
+		},
+		"config-preferred-to-environment": {
+			Context: map[string]interface{}{"REGION": "us-west1"},
+			Env:     map[string]string{"brokerpak.parameters.region": "us-east1"},
+			Params: []ManifestParameter{
+				{Name: "REGION", Description: "a param set by the tile"},
+			},
+			Expected: map[string]string{"REGION": "us-west1"},
+		},
+		"defaults": {
+			Params: []ManifestParameter{
+				{Name: "s", Description: "a string param", Default: "def"},
+				{Name: "n", Description: "an integer param", Type: broker.JsonTypeInteger, Default: 3},
+				{Name: "b", Description: "a bool param", Type: broker.JsonTypeBoolean, Default: false},
+			},
+			Expected: map[string]string{"s": "def", "n": "3", "b": "false"},
+		},
+		"typed-from-strings": {
+			Context: map[string]interface{}{"n": "42", "f": "1.5", "b": "true"},
+			Params: []ManifestParameter{
+				{Name: "n", Description: "an integer param", Type: broker.JsonTypeInteger},
+				{Name: "f", Description: "a number param", Type: broker.JsonTypeNumeric},
+				{Name: "b", Description: "a bool param", Type: broker.JsonTypeBoolean},
+			},
+			Expected: map[string]string{"n": "42", "f": "1.5", "b": "true"},
+		},
+		"missing-required": {
+			Params: []ManifestParameter{
+				{Name: "a", Description: "a required param", Required: true},
+				{Name: "b", Description: "an optional param"},
+				{Name: "c", Description: "a required param", Required: true},
+			},
+			ExpectedErr: "missing required parameters: a, c",
+		},
+		"wrong-type": {
+			Context: map[string]interface{}{"n": "many", "b": 1},
+			Params: []ManifestParameter{
+				{Name: "n", Description: "an integer param", Type: broker.JsonTypeInteger},
+				{Name: "b", Description: "a bool param", Type: broker.JsonTypeBoolean},
+			},
+			ExpectedErr: "invalid parameters: n: expected integer, got many; b: expected boolean, got 1",
+		},
+		"not-allowed": {
+			Context: map[string]interface{}{"REGION": "mars-north1"},
+			Params: []ManifestParameter{
+				{Name: "REGION", Description: "a region", Enum: []interface{}{"us-central1", "us-east1"}},
+			},
+			ExpectedErr: "invalid parameters: REGION: mars-north1 isn't one of the allowed values: [us-central1 us-east1]",
+		},
+		"sensitive-value-not-leaked": {
+			Context: map[string]interface{}{"PORT": "hunter2"},
+			Params: []ManifestParameter{
+				{Name: "PORT", Description: "a secret port", Type: broker.JsonTypeInteger, Sensitive: true},
+			},
+			ExpectedErr: "invalid parameters: PORT: value isn't a valid integer",
+		},
 	}
 
 	for tn, tc := range cases {
@@ -195,12 +387,95 @@ func TestRegistrar_resolveParameters(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			actual := r.resolveParameters(tc.Params, vc)
+			for k, v := range tc.Env {
+				viper.Set(k, v)
+				defer viper.Set(k, nil)
+			}
+
+			actual, err := r.resolveParameters(tc.Params, vc)
+			if tc.ExpectedErr != "" {
+				if err == nil || err.Error() != tc.ExpectedErr {
+					t.Errorf("Expected error %q, got: %v", tc.ExpectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
 			if !reflect.DeepEqual(actual, tc.Expected) {
 				t.Errorf("Expected params to be: %v got %v", tc.Expected, actual)
 			}
 		})
 	}
+
+	t.Run("missing-file", func(t *testing.T) {
+		vc, err := varcontext.Builder().MergeMap(map[string]interface{}{"secret_FILE": filepath.Join(dir, "missing")}).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		params := []ManifestParameter{{Name: "secret", Description: "a param read from a file"}}
+		if _, err := r.resolveParameters(params, vc); err == nil || !strings.Contains(err.Error(), "couldn't read secret from file") {
+			t.Errorf("Expected an error reading the file, got: %v", err)
+		}
+	})
+}
+
+func TestRegistrar_resolveCredentials(t *testing.T) {
+	r := NewRegistrar(nil)
+
+	resources := []TerraformResource{
+		{Name: "terraform"},
+		{
+			Name: "terraform-provider-vault",
+			Credentials: []ManifestParameter{
+				{Name: "VAULT_ADDR", Description: "The address of the Vault server."},
+				{Name: "VAULT_TOKEN", Description: "The token to authenticate with."},
+			},
+		},
+	}
+
+	cases := map[string]struct {
+		Context     map[string]interface{}
+		Expected    map[string]string
+		ExpectedErr string
+	}{
+		"all set": {
+			Context:  map[string]interface{}{"VAULT_ADDR": "https://vault", "VAULT_TOKEN": "t", "OTHER": "o"},
+			Expected: map[string]string{"VAULT_ADDR": "https://vault", "VAULT_TOKEN": "t"},
+		},
+		"missing": {
+			Context:     map[string]interface{}{"VAULT_ADDR": "https://vault"},
+			ExpectedErr: "missing credentials: VAULT_TOKEN (for terraform-provider-vault)",
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			vc, err := varcontext.Builder().MergeMap(tc.Context).Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual, err := r.resolveCredentials(resources, vc)
+			if tc.ExpectedErr != "" {
+				if err == nil || err.Error() != tc.ExpectedErr {
+					t.Errorf("Expected error %q, got: %v", tc.ExpectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Errorf("Expected credentials to be: %v got %v", tc.Expected, actual)
+			}
+		})
+	}
 }
 
 func TestRegistrar_walk(t *testing.T) {
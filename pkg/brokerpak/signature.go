@@ -0,0 +1,158 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package brokerpak
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// SignatureExtension is appended to the path of a brokerpak to get the path
+// of its detached signature.
+const SignatureExtension = ".sig"
+
+// ErrUntrustedSignature is returned when a brokerpak's signature wasn't made
+// by any of the trusted keys.
+var ErrUntrustedSignature = errors.New("the brokerpak wasn't signed by a trusted key")
+
+// GenerateSigningKey creates a new ed25519 key pair for signing brokerpaks.
+// The private key is written to keyPath and the public key, which operators
+// add to their trusted keys, is written to keyPath with a .pub extension.
+func GenerateSigningKey(keyPath string) (publicKeyPath string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(keyPath, []byte(encodeKey(priv)), 0600); err != nil {
+		return "", err
+	}
+
+	publicKeyPath = keyPath + ".pub"
+	return publicKeyPath, ioutil.WriteFile(publicKeyPath, []byte(encodeKey(pub)), 0644)
+}
+
+// ParsePublicKey parses a base64 encoded ed25519 public key.
+func ParsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	raw, err := decodeKey(encoded, ed25519.PublicKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+
+	return ed25519.PublicKey(raw), nil
+}
+
+// ReadPrivateKey reads a base64 encoded ed25519 private key from a file
+// created by GenerateSigningKey.
+func ReadPrivateKey(keyPath string) (ed25519.PrivateKey, error) {
+	contents, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := decodeKey(string(contents), ed25519.PrivateKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key in %q: %v", keyPath, err)
+	}
+
+	return ed25519.PrivateKey(raw), nil
+}
+
+// Sign creates a detached signature for the brokerpak next to it using the
+// private key at keyPath. The path of the signature is returned.
+func Sign(pakPath, keyPath string) (string, error) {
+	key, err := ReadPrivateKey(keyPath)
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := fileDigest(pakPath)
+	if err != nil {
+		return "", err
+	}
+
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, digest))
+	sigPath := pakPath + SignatureExtension
+	return sigPath, ioutil.WriteFile(sigPath, []byte(signature+"\n"), 0644)
+}
+
+// VerifySignature checks that the detached signature at sigPath was made for
+// the brokerpak at pakPath by one of the trusted keys.
+func VerifySignature(pakPath, sigPath string, trustedKeys []ed25519.PublicKey) error {
+	contents, err := ioutil.ReadFile(sigPath)
+	if err != nil {
+		return fmt.Errorf("couldn't read signature: %v", err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return fmt.Errorf("couldn't decode signature: %v", err)
+	}
+
+	digest, err := fileDigest(pakPath)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range trustedKeys {
+		if ed25519.Verify(key, digest, signature) {
+			return nil
+		}
+	}
+
+	return ErrUntrustedSignature
+}
+
+// fileDigest computes the SHA-256 digest of a file, it's signed rather than
+// the file itself so the file doesn't need to be held in memory.
+func fileDigest(path string) ([]byte, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, fd); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+func encodeKey(key []byte) string {
+	return base64.StdEncoding.EncodeToString(key) + "\n"
+}
+
+func decodeKey(encoded string, size int) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) != size {
+		return nil, fmt.Errorf("expected %d bytes, got %d", size, len(raw))
+	}
+
+	return raw, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package brokerpak
+
+import (
+	"crypto/ed25519"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newSigningKey creates a key pair in dir and returns the path of the private
+// key and the public key.
+func newSigningKey(t *testing.T, dir, name string) (string, ed25519.PublicKey) {
+	t.Helper()
+
+	keyPath := filepath.Join(dir, name)
+	pubPath, err := GenerateSigningKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := ioutil.ReadFile(pubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := ParsePublicKey(string(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keyPath, pub
+}
+
+func TestVerifySignature(t *testing.T) {
+	cases := map[string]struct {
+		Tamper      func(pakPath, sigPath string) error
+		UseOtherKey bool
+		ExpectedErr string
+	}{
+		"signed by trusted key": {},
+		"signed by other key": {
+			UseOtherKey: true,
+			ExpectedErr: ErrUntrustedSignature.Error(),
+		},
+		"tampered pak": {
+			Tamper: func(pakPath, sigPath string) error {
+				return ioutil.WriteFile(pakPath, []byte("malicious contents"), 0644)
+			},
+			ExpectedErr: ErrUntrustedSignature.Error(),
+		},
+		"garbled signature": {
+			Tamper: func(pakPath, sigPath string) error {
+				return ioutil.WriteFile(sigPath, []byte("not base64!"), 0644)
+			},
+			ExpectedErr: "couldn't decode signature: illegal base64 data at input byte 3",
+		},
+		"missing signature": {
+			Tamper: func(pakPath, sigPath string) error {
+				return os.Remove(sigPath)
+			},
+			ExpectedErr: "couldn't read signature: open SIGPATH: no such file or directory",
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "signature-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			trustedKeyPath, trustedKey := newSigningKey(t, dir, "trusted.key")
+			otherKeyPath, _ := newSigningKey(t, dir, "other.key")
+
+			pakPath := filepath.Join(dir, "my.brokerpak")
+			if err := ioutil.WriteFile(pakPath, []byte("brokerpak contents"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			keyPath := trustedKeyPath
+			if tc.UseOtherKey {
+				keyPath = otherKeyPath
+			}
+
+			sigPath, err := Sign(pakPath, keyPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if sigPath != pakPath+SignatureExtension {
+				t.Errorf("Expected signature to be next to the pak, got: %q", sigPath)
+			}
+
+			if tc.Tamper != nil {
+				if err := tc.Tamper(pakPath, sigPath); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = VerifySignature(pakPath, sigPath, []ed25519.PublicKey{trustedKey})
+			expectedErr := strings.Replace(tc.ExpectedErr, "SIGPATH", sigPath, 1)
+
+			switch {
+			case expectedErr == "" && err != nil:
+				t.Fatalf("Expected no error, got: %v", err)
+			case expectedErr != "" && (err == nil || err.Error() != expectedErr):
+				t.Fatalf("Expected error: %q, got: %v", expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	cases := map[string]struct {
+		Key         string
+		ExpectedErr string
+	}{
+		"valid": {
+			Key: "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=\n",
+		},
+		"wrong length": {
+			Key:         "c2hvcnQ=",
+			ExpectedErr: "invalid public key: expected 32 bytes, got 5",
+		},
+		"not base64": {
+			Key:         "!!!",
+			ExpectedErr: "invalid public key: illegal base64 data at input byte 0",
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			_, err := ParsePublicKey(tc.Key)
+
+			switch {
+			case tc.ExpectedErr == "" && err != nil:
+				t.Fatalf("Expected no error, got: %v", err)
+			case tc.ExpectedErr != "" && (err == nil || err.Error() != tc.ExpectedErr):
+				t.Fatalf("Expected error: %q, got: %v", tc.ExpectedErr, err)
+			}
+		})
+	}
+}
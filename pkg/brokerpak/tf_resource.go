@@ -15,6 +15,8 @@
 package brokerpak
 
 import (
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/validation"
@@ -23,6 +25,8 @@ import (
 // HashicorpUrlTemplate holds the default template for Hashicorp's terraform binary archive downloads.
 const HashicorpUrlTemplate = "https://releases.hashicorp.com/${name}/${version}/${name}_${version}_${os}_${arch}.zip"
 
+var sha256Regex = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
 // TerraformResource represents a downloadable binary dependency (Terraform
 // version or Provider).
 type TerraformResource struct {
@@ -39,17 +43,57 @@ type TerraformResource struct {
 	// Paramaters available are ${name}, ${version}, ${os}, and ${arch}.
 	// If non is specified HashicorpUrlTemplate is used.
 	UrlTemplate string `yaml:"url_template,omitempty"`
+
+	// SourceSha256 holds the expected hex encoded SHA-256 sum of the Source
+	// archive. If blank the archive isn't checked.
+	SourceSha256 string `yaml:"source_sha256,omitempty"`
+
+	// Sha256Sums holds the expected hex encoded SHA-256 sums of the release
+	// archives keyed by platform e.g. linux/amd64. Platforms without a sum
+	// aren't checked.
+	Sha256Sums map[string]string `yaml:"sha256_sums,omitempty"`
+
+	// Credentials holds the environment variables the provider needs to
+	// authenticate. Unlike parameters they're required, the brokerpak won't
+	// load unless the operator sets them all.
+	Credentials []ManifestParameter `yaml:"credentials,omitempty"`
 }
 
 var _ validation.Validatable = (*TerraformResource)(nil)
 
 // Validate implements validation.Validatable.
 func (tr *TerraformResource) Validate() (errs *validation.FieldError) {
-	return errs.Also(
+	errs = errs.Also(
 		validation.ErrIfBlank(tr.Name, "name"),
 		validation.ErrIfBlank(tr.Version, "version"),
 		validation.ErrIfBlank(tr.Source, "source"),
 	)
+
+	if tr.SourceSha256 != "" {
+		errs = errs.Also(validation.ErrIfNotMatch(tr.SourceSha256, sha256Regex, "source_sha256"))
+	}
+
+	var platforms []string
+	for platform := range tr.Sha256Sums {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+
+	for _, platform := range platforms {
+		errs = errs.Also(validation.ErrIfNotMatch(tr.Sha256Sums[platform], sha256Regex, "").ViaFieldKey("sha256_sums", platform))
+	}
+
+	for i, credential := range tr.Credentials {
+		errs = errs.Also(credential.Validate().ViaFieldIndex("credentials", i))
+	}
+
+	return errs
+}
+
+// Sha256 gets the expected SHA-256 sum of the release archive for the
+// platform or a blank string if there isn't one.
+func (tr *TerraformResource) Sha256(platform Platform) string {
+	return tr.Sha256Sums[platform.String()]
 }
 
 // Url constructs a download URL based on a platform.
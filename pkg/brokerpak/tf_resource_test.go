@@ -34,6 +34,46 @@ func TestTerraformResource_Validate(t *testing.T) {
 				Source:  "github.com/myproject",
 			},
 		},
+		"good sums": {
+			Object: &TerraformResource{
+				Name:         "foo",
+				Version:      "1.0",
+				Source:       "github.com/myproject",
+				SourceSha256: "dd5e9b25ed0dd1edf92d90d7fd8820fc7c9baff06626616db068e3d6172b23ff",
+				Sha256Sums: map[string]string{
+					"linux/amd64": "DD5E9B25ED0DD1EDF92D90D7FD8820FC7C9BAFF06626616DB068E3D6172B23FF",
+				},
+			},
+		},
+		"bad source sum": {
+			Object: &TerraformResource{
+				Name:         "foo",
+				Version:      "1.0",
+				Source:       "github.com/myproject",
+				SourceSha256: "md5:abc",
+			},
+			Expect: errors.New("field must match '^[0-9a-fA-F]{64}$': source_sha256"),
+		},
+		"bad platform sum": {
+			Object: &TerraformResource{
+				Name:    "foo",
+				Version: "1.0",
+				Source:  "github.com/myproject",
+				Sha256Sums: map[string]string{
+					"linux/amd64": "abc",
+				},
+			},
+			Expect: errors.New("field must match '^[0-9a-fA-F]{64}$': sha256_sums[linux/amd64]"),
+		},
+		"bad credential": {
+			Object: &TerraformResource{
+				Name:        "terraform-provider-vault",
+				Version:     "2.0.0",
+				Source:      "github.com/myproject",
+				Credentials: []ManifestParameter{{Name: "VAULT_TOKEN"}},
+			},
+			Expect: errors.New("missing field(s): credentials[0].description"),
+		},
 	}
 
 	for tn, tc := range cases {
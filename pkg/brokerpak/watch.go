@@ -0,0 +1,122 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package brokerpak
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/toggles"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// watchDebounce is how long changes need to settle before reloading so
+// brokerpaks that are still being copied aren't loaded.
+const watchDebounce = 2 * time.Second
+
+var watchBuiltinToggle = toggles.Features.Toggle("watch-builtin-brokerpaks", false, `Reload the broker's services when brokerpaks in the builtin brokerpak directory
+are added, changed or removed.`)
+
+// WatchBuiltin calls onChange when brokerpaks in the builtin brokerpak
+// directory change if the watch-builtin-brokerpaks toggle is enabled.
+// The returned function stops watching.
+func WatchBuiltin(logger lager.Logger, onChange func()) (stop func(), err error) {
+	if !watchBuiltinToggle.IsActive() || !loadBuiltinToggle.IsActive() {
+		return func() {}, nil
+	}
+
+	return Watch(viper.GetString(brokerpakBuiltinPathKey), watchDebounce, logger, onChange)
+}
+
+// Watch calls onChange once changes to brokerpaks in the directory, or any of
+// its sub-directories, have settled for the debounce period.
+// The returned function stops watching.
+func Watch(directory string, debounce time.Duration, logger lager.Logger, onChange func()) (stop func(), err error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.Walk(filepath.FromSlash(directory), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return watcher.Add(path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	logger.Info("watching-brokerpaks", lager.Data{"directory": directory})
+
+	done := make(chan struct{})
+	go func() {
+		var timer *time.Timer
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if event.Op&fsnotify.Create != 0 {
+						watcher.Add(event.Name)
+					}
+					continue
+				}
+
+				if filepath.Ext(event.Name) != ".brokerpak" {
+					continue
+				}
+
+				logger.Info("brokerpak-changed", lager.Data{"path": event.Name, "op": event.Op.String()})
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(debounce, onChange)
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Error("watching-brokerpaks", err)
+
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		watcher.Close()
+	}, nil
+}
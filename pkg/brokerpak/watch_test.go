@@ -0,0 +1,105 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package brokerpak
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/utils"
+)
+
+func TestWatch(t *testing.T) {
+	cases := map[string]struct {
+		Change       func(dir string) error
+		ExpectReload bool
+	}{
+		"new brokerpak": {
+			Change: func(dir string) error {
+				return ioutil.WriteFile(filepath.Join(dir, "new.brokerpak"), []byte("pak"), 0644)
+			},
+			ExpectReload: true,
+		},
+		"removed brokerpak": {
+			Change: func(dir string) error {
+				return os.Remove(filepath.Join(dir, "existing.brokerpak"))
+			},
+			ExpectReload: true,
+		},
+		"brokerpak in sub-directory": {
+			Change: func(dir string) error {
+				return ioutil.WriteFile(filepath.Join(dir, "nested", "new.brokerpak"), []byte("pak"), 0644)
+			},
+			ExpectReload: true,
+		},
+		"other file": {
+			Change: func(dir string) error {
+				return ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("notes"), 0644)
+			},
+			ExpectReload: false,
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "watch-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			if err := os.Mkdir(filepath.Join(dir, "nested"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, "existing.brokerpak"), []byte("pak"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			reloads := make(chan bool, 10)
+			stop, err := Watch(dir, 10*time.Millisecond, utils.NewLogger("watch-test"), func() {
+				reloads <- true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stop()
+
+			if err := tc.Change(dir); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case <-reloads:
+				if !tc.ExpectReload {
+					t.Fatal("Expected no reload")
+				}
+			case <-time.After(500 * time.Millisecond):
+				if tc.ExpectReload {
+					t.Fatal("Expected a reload")
+				}
+			}
+
+			// changes are debounced into a single reload
+			select {
+			case <-reloads:
+				t.Fatal("Expected a single reload")
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
@@ -16,12 +16,16 @@ package client
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"time"
 
+	"github.com/GoogleCloudPlatform/gcp-service-broker/utils"
 	"github.com/pivotal-cf/brokerapi"
 	"github.com/spf13/viper"
 )
@@ -33,8 +37,16 @@ const (
 	// expect to be compatible with to ensure any reverse-compatibility measures
 	// put in place work.
 	ClientsBrokerApiVersion = "2.13"
+
+	clientTLSEnabledProp  = "client.tls.enabled"
+	clientTLSCAFileProp   = "client.tls.ca_file"
+	clientTLSCertFileProp = "client.tls.cert_file"
+	clientTLSKeyFileProp  = "client.tls.key_file"
 )
 
+// examplesTimeout is how long to wait for the broker to return its examples.
+var examplesTimeout = 2 * time.Second
+
 // NewClientFromEnv creates a new client from the client configuration properties.
 func NewClientFromEnv() (*Client, error) {
 	user := viper.GetString("api.user")
@@ -43,22 +55,80 @@ func NewClientFromEnv() (*Client, error) {
 
 	viper.SetDefault("api.hostname", "localhost")
 	host := viper.GetString("api.hostname")
-	return New(user, pass, host, port)
+
+	if !viper.GetBool(clientTLSEnabledProp) {
+		return New(user, pass, host, port)
+	}
+
+	tlsConfig, err := NewTLSConfig(
+		viper.GetString(clientTLSCAFileProp),
+		viper.GetString(clientTLSCertFileProp),
+		viper.GetString(clientTLSKeyFileProp))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTLS(user, pass, host, port, tlsConfig)
+}
+
+// NewTLSConfig creates a TLS configuration for the client. If caFile is blank
+// the system roots are used to verify the server. If certFile and keyFile are
+// set, the client will present that certificate to the server.
+func NewTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if caFile != "" {
+		pool, err := utils.LoadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
 }
 
 // New creates a new OSB Client connected to the given resource.
 func New(username, password, hostname string, port int) (*Client, error) {
-	base := fmt.Sprintf("http://%s:%s@%s:%d/v2/", username, password, hostname, port)
+	return newClient("http", username, password, hostname, port, http.DefaultClient)
+}
+
+// NewTLS creates a new OSB Client connected to the given resource over HTTPS
+// using the given TLS configuration.
+func NewTLS(username, password, hostname string, port int, tlsConfig *tls.Config) (*Client, error) {
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+
+	return newClient("https", username, password, hostname, port, httpClient)
+}
+
+func newClient(scheme, username, password, hostname string, port int, httpClient *http.Client) (*Client, error) {
+	base := fmt.Sprintf("%s://%s:%s@%s:%d/v2/", scheme, username, password, hostname, port)
 	baseUrl, err := url.Parse(base)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Client{BaseUrl: baseUrl}, nil
+	return &Client{BaseUrl: baseUrl, HttpClient: httpClient}, nil
 }
 
 type Client struct {
 	BaseUrl *url.URL
+
+	// HttpClient is used to make requests, if nil http.DefaultClient is used.
+	HttpClient *http.Client
 }
 
 // Catalog fetches the service catalog
@@ -131,7 +201,7 @@ func (client *Client) makeRequest(method, path string, body interface{}) *Broker
 		return &br
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.httpClient().Do(req)
 
 	br.UpdateResponse(resp)
 	br.UpdateError(err)
@@ -139,6 +209,47 @@ func (client *Client) makeRequest(method, path string, body interface{}) *Broker
 	return &br
 }
 
+// Examples fetches the examples the broker publishes on its /examples endpoint.
+func (client *Client) Examples() ([]CompleteServiceExample, error) {
+	url, err := client.BaseUrl.Parse("/examples")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), examplesTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("couldn't get examples, got status: %d", resp.StatusCode)
+	}
+
+	var allExamples []CompleteServiceExample
+	if err := json.NewDecoder(resp.Body).Decode(&allExamples); err != nil {
+		return nil, err
+	}
+
+	return allExamples, nil
+}
+
+func (client *Client) httpClient() *http.Client {
+	if client.HttpClient == nil {
+		return http.DefaultClient
+	}
+
+	return client.HttpClient
+}
+
 func (client *Client) newRequest(method, path string, body interface{}) (*http.Request, error) {
 	url, err := client.BaseUrl.Parse(path)
 	if err != nil {
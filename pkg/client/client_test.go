@@ -0,0 +1,45 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestClient_Examples_timeout(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	defer func(timeout time.Duration) { examplesTimeout = timeout }(examplesTimeout)
+	examplesTimeout = 10 * time.Millisecond
+
+	baseUrl, err := url.Parse(server.URL + "/v2/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &Client{BaseUrl: baseUrl}
+	if _, err := client.Examples(); err == nil {
+		t.Fatal("expected an unresponsive broker to time out")
+	}
+}
@@ -0,0 +1,333 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// ExampleStatus is the outcome of running an example.
+type ExampleStatus string
+
+const (
+	ExamplePassed  ExampleStatus = "passed"
+	ExampleFailed  ExampleStatus = "failed"
+	ExampleSkipped ExampleStatus = "skipped"
+)
+
+// The phases of an example run, in the order they happen.
+const (
+	PhaseProvision   = "provision"
+	PhaseBind        = "bind"
+	PhaseUnbind      = "unbind"
+	PhaseDeprovision = "deprovision"
+)
+
+// PhaseResult holds the outcome of a single phase of an example.
+type PhaseResult struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// AssertionResult holds the outcome of a single check of an example e.g. that
+// the credentials match the output schema.
+type AssertionResult struct {
+	Name   string        `json:"name"`
+	Status ExampleStatus `json:"status"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// String formats the result like "FAIL name: error".
+func (ar AssertionResult) String() string {
+	labels := map[ExampleStatus]string{
+		ExamplePassed:  "PASS",
+		ExampleFailed:  "FAIL",
+		ExampleSkipped: "SKIP",
+	}
+
+	out := fmt.Sprintf("%s %s", labels[ar.Status], ar.Name)
+	if ar.Error != "" {
+		out += ": " + ar.Error
+	}
+
+	return out
+}
+
+// ExampleResult holds the outcome of running a single example.
+type ExampleResult struct {
+	ServiceName string            `json:"service_name"`
+	ExampleName string            `json:"example_name"`
+	InstanceId  string            `json:"instance_id,omitempty"`
+	BindingId   string            `json:"binding_id,omitempty"`
+	Status      ExampleStatus     `json:"status"`
+	Seconds     float64           `json:"seconds"`
+	Phases      []PhaseResult     `json:"phases"`
+	Assertions  []AssertionResult `json:"assertions,omitempty"`
+
+	// Error holds the first failure, or the reason the example was skipped.
+	Error string `json:"error,omitempty"`
+}
+
+func newExampleResult(example CompleteServiceExample) ExampleResult {
+	return ExampleResult{
+		ServiceName: example.ServiceName,
+		ExampleName: example.ServiceExample.Name,
+		Status:      ExamplePassed,
+		Phases:      []PhaseResult{},
+	}
+}
+
+// record runs fn as the named phase, timing it and marking the example as
+// failed if it returns an error.
+func (er *ExampleResult) record(phase string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+
+	result := PhaseResult{Name: phase, Seconds: time.Since(start).Seconds()}
+	if err != nil {
+		result.Error = err.Error()
+		er.fail(fmt.Errorf("%s: %v", phase, err))
+	}
+
+	er.Phases = append(er.Phases, result)
+	return err
+}
+
+// assert runs the check and records the outcome.
+func (er *ExampleResult) assert(logger *log.Logger, name string, check func() error) {
+	result := AssertionResult{Name: name, Status: ExamplePassed}
+	if err := check(); err != nil {
+		result.Status = ExampleFailed
+		result.Error = err.Error()
+	}
+
+	logger.Println(result)
+	er.Assertions = append(er.Assertions, result)
+}
+
+func (er *ExampleResult) skipAssertion(logger *log.Logger, name, reason string) {
+	result := AssertionResult{Name: name, Status: ExampleSkipped, Error: reason}
+
+	logger.Println(result)
+	er.Assertions = append(er.Assertions, result)
+}
+
+// failIfAssertionsFailed marks the example as failed if any of its assertions
+// did, listing the failures.
+func (er *ExampleResult) failIfAssertionsFailed() {
+	var failures []string
+	for _, assertion := range er.Assertions {
+		if assertion.Status == ExampleFailed {
+			failures = append(failures, fmt.Sprintf("%s: %s", assertion.Name, assertion.Error))
+		}
+	}
+
+	if len(failures) > 0 {
+		er.fail(fmt.Errorf("%d of %d assertions failed: %s", len(failures), len(er.Assertions), strings.Join(failures, "; ")))
+	}
+}
+
+// fail marks the example as failed, keeping the first error seen.
+func (er *ExampleResult) fail(err error) {
+	er.Status = ExampleFailed
+	if er.Error == "" {
+		er.Error = err.Error()
+	}
+}
+
+func (er *ExampleResult) skip(reason string) {
+	er.Status = ExampleSkipped
+	er.Error = reason
+}
+
+// ExampleReport is the outcome of a run of examples.
+type ExampleReport struct {
+	Passed  int             `json:"passed"`
+	Failed  int             `json:"failed"`
+	Skipped int             `json:"skipped"`
+	Seconds float64         `json:"seconds"`
+	Results []ExampleResult `json:"results"`
+}
+
+func newExampleReport(results []ExampleResult, elapsed time.Duration) *ExampleReport {
+	report := &ExampleReport{
+		Seconds: elapsed.Seconds(),
+		Results: results,
+	}
+
+	for _, result := range results {
+		switch result.Status {
+		case ExamplePassed:
+			report.Passed++
+		case ExampleFailed:
+			report.Failed++
+		case ExampleSkipped:
+			report.Skipped++
+		}
+	}
+
+	return report
+}
+
+// Err returns an error if any example failed or was skipped.
+func (report *ExampleReport) Err() error {
+	if report.Failed == 0 && report.Skipped == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%d of %d examples passed, %d failed, %d skipped", report.Passed, len(report.Results), report.Failed, report.Skipped)
+}
+
+// WriteJSON writes the report as indented JSON.
+func (report *ExampleReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// WriteJUnit writes the report in the JUnit XML format understood by most CI
+// systems. Each service becomes a test suite and each example a test case
+// with its phase timings as properties and its assertions as output.
+func (report *ExampleReport) WriteJUnit(w io.Writer) error {
+	suites := junitTestSuites{
+		Tests:    len(report.Results),
+		Failures: report.Failed,
+		Skipped:  report.Skipped,
+		Time:     junitTime(report.Seconds),
+	}
+
+	suiteIndexes := make(map[string]int)
+	for _, result := range report.Results {
+		idx, ok := suiteIndexes[result.ServiceName]
+		if !ok {
+			idx = len(suites.Suites)
+			suiteIndexes[result.ServiceName] = idx
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: result.ServiceName})
+		}
+
+		suite := &suites.Suites[idx]
+		suite.Tests++
+		suite.seconds += result.Seconds
+		suite.Time = junitTime(suite.seconds)
+
+		testCase := junitTestCase{
+			Name:      result.ExampleName,
+			ClassName: result.ServiceName,
+			Time:      junitTime(result.Seconds),
+		}
+
+		if len(result.Phases) > 0 {
+			testCase.Properties = &junitProperties{}
+			for _, phase := range result.Phases {
+				testCase.Properties.Properties = append(testCase.Properties.Properties, junitProperty{
+					Name:  phase.Name + ".seconds",
+					Value: junitTime(phase.Seconds),
+				})
+			}
+		}
+
+		if len(result.Assertions) > 0 {
+			var lines []string
+			for _, assertion := range result.Assertions {
+				lines = append(lines, assertion.String())
+			}
+
+			testCase.SystemOut = &junitOutput{Body: strings.Join(lines, "\n")}
+		}
+
+		switch result.Status {
+		case ExampleFailed:
+			suite.Failures++
+			testCase.Failure = &junitMessage{Message: result.Error, Body: result.Error}
+		case ExampleSkipped:
+			suite.Skipped++
+			testCase.Skipped = &junitMessage{Message: result.Error}
+		}
+
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitTime(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+
+	seconds float64
+}
+
+type junitTestCase struct {
+	Name       string           `xml:"name,attr"`
+	ClassName  string           `xml:"classname,attr"`
+	Time       string           `xml:"time,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Failure    *junitMessage    `xml:"failure,omitempty"`
+	Skipped    *junitMessage    `xml:"skipped,omitempty"`
+	SystemOut  *junitOutput     `xml:"system-out,omitempty"`
+}
+
+type junitOutput struct {
+	Body string `xml:",cdata"`
+}
+
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
@@ -0,0 +1,179 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"os"
+	"time"
+)
+
+func exampleReportForTest() *ExampleReport {
+	return newExampleReport([]ExampleResult{
+		{
+			ServiceName: "google-storage",
+			ExampleName: "Basic Configuration",
+			InstanceId:  "ex123",
+			BindingId:   "ex123",
+			Status:      ExamplePassed,
+			Seconds:     4,
+			Phases: []PhaseResult{
+				{Name: PhaseProvision, Seconds: 1.5},
+				{Name: PhaseBind, Seconds: 1},
+				{Name: PhaseUnbind, Seconds: 0.5},
+				{Name: PhaseDeprovision, Seconds: 1},
+			},
+			Assertions: []AssertionResult{
+				{Name: "credentials match the output schema", Status: ExamplePassed},
+				{Name: `$.uri matches "^gs://"`, Status: ExamplePassed},
+				{Name: `smoke check "list"`, Status: ExampleSkipped, Error: "smoke checks are disabled"},
+			},
+		},
+		{
+			ServiceName: "google-storage",
+			ExampleName: "Regional",
+			InstanceId:  "ex456",
+			BindingId:   "ex456",
+			Status:      ExampleFailed,
+			Seconds:     2,
+			Phases: []PhaseResult{
+				{Name: PhaseProvision, Seconds: 1.25, Error: "Unexpected response code 500"},
+				{Name: PhaseDeprovision, Seconds: 0.75},
+			},
+			Error: "provision: Unexpected response code 500",
+		},
+		{
+			ServiceName: "google-pubsub",
+			ExampleName: "Basic Configuration",
+			Status:      ExampleSkipped,
+			Phases:      []PhaseResult{},
+			Error:       "an earlier example failed",
+		},
+	}, 6*time.Second)
+}
+
+func ExampleExampleReport_WriteJUnit() {
+	exampleReportForTest().WriteJUnit(os.Stdout)
+
+	// Output: <?xml version="1.0" encoding="UTF-8"?>
+	// <testsuites tests="3" failures="1" skipped="1" time="6.000">
+	//   <testsuite name="google-storage" tests="2" failures="1" skipped="0" time="6.000">
+	//     <testcase name="Basic Configuration" classname="google-storage" time="4.000">
+	//       <properties>
+	//         <property name="provision.seconds" value="1.500"></property>
+	//         <property name="bind.seconds" value="1.000"></property>
+	//         <property name="unbind.seconds" value="0.500"></property>
+	//         <property name="deprovision.seconds" value="1.000"></property>
+	//       </properties>
+	//       <system-out><![CDATA[PASS credentials match the output schema
+	// PASS $.uri matches "^gs://"
+	// SKIP smoke check "list": smoke checks are disabled]]></system-out>
+	//     </testcase>
+	//     <testcase name="Regional" classname="google-storage" time="2.000">
+	//       <properties>
+	//         <property name="provision.seconds" value="1.250"></property>
+	//         <property name="deprovision.seconds" value="0.750"></property>
+	//       </properties>
+	//       <failure message="provision: Unexpected response code 500">provision: Unexpected response code 500</failure>
+	//     </testcase>
+	//   </testsuite>
+	//   <testsuite name="google-pubsub" tests="1" failures="0" skipped="1" time="0.000">
+	//     <testcase name="Basic Configuration" classname="google-pubsub" time="0.000">
+	//       <skipped message="an earlier example failed"></skipped>
+	//     </testcase>
+	//   </testsuite>
+	// </testsuites>
+}
+
+func ExampleExampleReport_WriteJSON() {
+	exampleReportForTest().WriteJSON(os.Stdout)
+
+	// Output: {
+	//   "passed": 1,
+	//   "failed": 1,
+	//   "skipped": 1,
+	//   "seconds": 6,
+	//   "results": [
+	//     {
+	//       "service_name": "google-storage",
+	//       "example_name": "Basic Configuration",
+	//       "instance_id": "ex123",
+	//       "binding_id": "ex123",
+	//       "status": "passed",
+	//       "seconds": 4,
+	//       "phases": [
+	//         {
+	//           "name": "provision",
+	//           "seconds": 1.5
+	//         },
+	//         {
+	//           "name": "bind",
+	//           "seconds": 1
+	//         },
+	//         {
+	//           "name": "unbind",
+	//           "seconds": 0.5
+	//         },
+	//         {
+	//           "name": "deprovision",
+	//           "seconds": 1
+	//         }
+	//       ],
+	//       "assertions": [
+	//         {
+	//           "name": "credentials match the output schema",
+	//           "status": "passed"
+	//         },
+	//         {
+	//           "name": "$.uri matches \"^gs://\"",
+	//           "status": "passed"
+	//         },
+	//         {
+	//           "name": "smoke check \"list\"",
+	//           "status": "skipped",
+	//           "error": "smoke checks are disabled"
+	//         }
+	//       ]
+	//     },
+	//     {
+	//       "service_name": "google-storage",
+	//       "example_name": "Regional",
+	//       "instance_id": "ex456",
+	//       "binding_id": "ex456",
+	//       "status": "failed",
+	//       "seconds": 2,
+	//       "phases": [
+	//         {
+	//           "name": "provision",
+	//           "seconds": 1.25,
+	//           "error": "Unexpected response code 500"
+	//         },
+	//         {
+	//           "name": "deprovision",
+	//           "seconds": 0.75
+	//         }
+	//       ],
+	//       "error": "provision: Unexpected response code 500"
+	//     },
+	//     {
+	//       "service_name": "google-pubsub",
+	//       "example_name": "Basic Configuration",
+	//       "status": "skipped",
+	//       "seconds": 0,
+	//       "phases": [],
+	//       "error": "an earlier example failed"
+	//     }
+	//   ]
+	// }
+}
@@ -15,13 +15,19 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"math/rand"
+	"net/http"
 	"os"
+	"os/exec"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pivotal-cf/brokerapi"
@@ -29,52 +35,125 @@ import (
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
 )
 
-// RunExamplesForService runs all the examples for a given service name against
-// the service broker pointed to by client. All examples in the registry get run
-// if serviceName is blank. If exampleName is non-blank then only the example
-// with the given name is run.
-func RunExamplesForService(allExamples []CompleteServiceExample, client *Client, serviceName, exampleName string) error {
+// ExampleRunOptions controls how RunExamples executes a set of examples.
+type ExampleRunOptions struct {
+	// Parallelism is the maximum number of examples to run at once. Values
+	// less than 1 run the examples one at a time.
+	Parallelism int
+
+	// ContinueOnFailure keeps starting new examples after one fails rather
+	// than skipping the remaining ones.
+	ContinueOnFailure bool
+
+	// RunSmokeChecks runs the examples' smoke check commands. They're skipped
+	// otherwise because they run arbitrary commands on this machine.
+	RunSmokeChecks bool
+}
 
+// RunExamples runs the given examples against the service broker pointed to
+// by client and reports on the outcome of each one.
+//
+// Examples that have started are always cleaned up, even after ctx is
+// cancelled; examples that haven't started by then are skipped.
+func RunExamples(ctx context.Context, client *Client, examples []CompleteServiceExample, opts ExampleRunOptions) *ExampleReport {
 	rand.Seed(time.Now().UTC().UnixNano())
 
-	for _, completeServiceExample := range FilterMatchingServiceExamples(allExamples, serviceName, exampleName) {
-		if err := RunExample(client, completeServiceExample); err != nil {
-			return err
+	parallelism := opts.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	start := time.Now()
+	results := make([]ExampleResult, len(examples))
+
+	var mu sync.Mutex
+	failed := false
+	skipReason := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case ctx.Err() != nil:
+			return fmt.Sprintf("interrupted: %v", ctx.Err())
+		case failed && !opts.ContinueOnFailure:
+			return "an earlier example failed"
+		default:
+			return ""
 		}
 	}
 
-	return nil
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for idx := range indexes {
+				example := examples[idx]
+
+				if reason := skipReason(); reason != "" {
+					exampleLogger(example).Printf("Skipping: %s\n", reason)
+					results[idx] = newExampleResult(example)
+					results[idx].skip(reason)
+					continue
+				}
+
+				result := RunExample(ctx, client, example, opts)
+				if result.Status == ExampleFailed {
+					mu.Lock()
+					failed = true
+					mu.Unlock()
+				}
+
+				results[idx] = result
+			}
+		}()
+	}
 
+	for idx := range examples {
+		indexes <- idx
+	}
+	close(indexes)
+	wg.Wait()
+
+	return newExampleReport(results, time.Since(start))
+}
+
+// RunExamplesForService runs all the examples for a given service name against
+// the service broker pointed to by client. All examples in the registry get run
+// if serviceName is blank. If exampleName is non-blank then only the example
+// with the given name is run.
+func RunExamplesForService(allExamples []CompleteServiceExample, client *Client, serviceName, exampleName string) error {
+	examples := FilterMatchingServiceExamples(allExamples, serviceName, exampleName)
+	return RunExamples(context.Background(), client, examples, ExampleRunOptions{}).Err()
 }
 
 // RunExamplesFromFile reads a json-encoded list of CompleteServiceExamples.
 // All examples in the list get run if serviceName is blank. If exampleName
 // is non-blank then only the example with the given name is run.
 func RunExamplesFromFile(client *Client, fileName, serviceName, exampleName string) error {
+	allExamples, err := ReadExamplesFromFile(fileName)
+	if err != nil {
+		return err
+	}
 
-	rand.Seed(time.Now().UTC().UnixNano())
-
-	jsonFile, err := os.Open(fileName)
+	return RunExamplesForService(allExamples, client, serviceName, exampleName)
+}
 
+// ReadExamplesFromFile reads a json-encoded list of CompleteServiceExamples.
+func ReadExamplesFromFile(fileName string) ([]CompleteServiceExample, error) {
+	byteValue, err := ioutil.ReadFile(fileName)
 	if err != nil {
-		log.Fatalf("Error opening file: %v", err)
+		return nil, fmt.Errorf("couldn't read examples: %v", err)
 	}
 
-	defer jsonFile.Close()
-
 	var allExamples []CompleteServiceExample
-
-	byteValue, _ := ioutil.ReadAll(jsonFile)
-	json.Unmarshal(byteValue, &allExamples)
-
-	for _, completeServiceExample := range FilterMatchingServiceExamples(allExamples, serviceName, exampleName) {
-		if err := RunExample(client, completeServiceExample); err != nil {
-			return err
-		}
+	if err := json.Unmarshal(byteValue, &allExamples); err != nil {
+		return nil, fmt.Errorf("couldn't parse examples from %q: %v", fileName, err)
 	}
 
-	return nil
-
+	return allExamples, nil
 }
 
 type CompleteServiceExample struct {
@@ -127,61 +206,128 @@ func FilterMatchingServiceExamples(allExamples []CompleteServiceExample, service
 }
 
 // RunExample runs a single example against the given service on the broker
-// pointed to by client.
-func RunExample(client *Client, serviceExample CompleteServiceExample) error {
+// pointed to by client. It goes through a provision/bind/unbind/deprovision
+// cycle, checking the binding credentials against the example's expected
+// output and assertions, and reports the outcome of each phase and assertion.
+//
+// Whatever the example created is torn down before returning, even if ctx was
+// cancelled partway through.
+func RunExample(ctx context.Context, client *Client, serviceExample CompleteServiceExample, opts ExampleRunOptions) (result ExampleResult) {
+	result = newExampleResult(serviceExample)
+	logger := exampleLogger(serviceExample)
 
-	executor, err := newExampleExecutor(client, serviceExample)
+	start := time.Now()
+	defer func() {
+		result.Seconds = time.Since(start).Seconds()
+		logger.Printf("Example %s in %.1fs\n", result.Status, result.Seconds)
+	}()
+
+	executor, err := newExampleExecutor(client, serviceExample, logger)
 	if err != nil {
-		return err
+		result.fail(err)
+		return
 	}
 
+	result.InstanceId = executor.InstanceId
+	result.BindingId = executor.BindingId
 	executor.LogTestInfo()
 
-	// Cleanup the test if it fails partway through
+	// Unbind and deprovision run with their own context so an interrupted run
+	// doesn't leave resources behind.
 	defer func() {
-		log.Println("Cleaning up the environment")
-		executor.Unbind()
-		executor.Deprovision()
+		cleanupCtx := context.Background()
+
+		if executor.bound {
+			result.record(PhaseUnbind, func() error { return executor.Unbind(cleanupCtx) })
+		}
+
+		if executor.provisioned {
+			result.record(PhaseDeprovision, func() error { return executor.Deprovision(cleanupCtx) })
+		}
 	}()
 
-	if err := executor.Provision(); err != nil {
-		return err
+	example := serviceExample.ServiceExample
+	if example.ExpectsProvisionFailure() {
+		var provisionErr error
+		result.record(PhaseProvision, func() error {
+			provisionErr = executor.Provision(ctx)
+			return nil
+		})
+
+		name := fmt.Sprintf("provision fails with an error matching %q", example.ExpectedProvisionError)
+		result.assert(logger, name, func() error { return example.CheckProvisionError(provisionErr) })
+		result.failIfAssertionsFailed()
+		return
 	}
 
-	bindResponse, err := executor.Bind()
-	if err != nil {
-		return err
+	if err := result.record(PhaseProvision, func() error { return executor.Provision(ctx) }); err != nil {
+		return
 	}
 
-	if err := executor.Unbind(); err != nil {
+	var bindResponse json.RawMessage
+	if err := result.record(PhaseBind, func() (err error) {
+		bindResponse, err = executor.Bind(ctx)
 		return err
+	}); err != nil {
+		return
 	}
 
-	if err := executor.Deprovision(); err != nil {
-		return err
+	credentials, err := parseCredentials(bindResponse)
+	if err != nil {
+		result.fail(err)
+		return
 	}
 
-	// Check that the binding response has the same fields as expected
-	var binding brokerapi.Binding
-	err = json.Unmarshal(bindResponse, &binding)
-	if err != nil {
-		return err
+	result.assert(logger, "credentials match the output schema", func() error {
+		return broker.ValidateVariablesAgainstSchema(credentials, serviceExample.ExpectedOutput)
+	})
+
+	for _, assertion := range example.ExpectedCredentials {
+		assertion := assertion
+		result.assert(logger, assertion.String(), func() error { return assertion.Check(credentials) })
 	}
 
-	credentialsEntry := binding.Credentials.(map[string]interface{})
+	for _, check := range example.SmokeChecks {
+		name := fmt.Sprintf("smoke check %q", check.Name)
+		if !opts.RunSmokeChecks {
+			result.skipAssertion(logger, name, "smoke checks are disabled")
+			continue
+		}
 
-	if err := broker.ValidateVariablesAgainstSchema(credentialsEntry, serviceExample.ExpectedOutput); err != nil {
+		check := check
+		result.assert(logger, name, func() error { return executor.SmokeCheck(ctx, check, credentials) })
+	}
 
-		log.Printf("Error: results don't match JSON Schema: %v", err)
-		return err
+	result.failIfAssertionsFailed()
+	return
+}
+
+func exampleLogger(serviceExample CompleteServiceExample) *log.Logger {
+	prefix := fmt.Sprintf("[%s/%s] ", serviceExample.ServiceName, serviceExample.ServiceExample.Name)
+	return log.New(log.Writer(), prefix, log.Flags()|log.Lmsgprefix)
+}
+
+// parseCredentials extracts the credentials object from a bind response.
+func parseCredentials(bindResponse json.RawMessage) (map[string]interface{}, error) {
+	var binding brokerapi.Binding
+	if err := json.Unmarshal(bindResponse, &binding); err != nil {
+		return nil, err
+	}
+
+	credentials, ok := binding.Credentials.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected the binding credentials to be an object, got: %v", binding.Credentials)
 	}
 
-	return nil
+	return credentials, nil
 }
 
-func retry(timeout, period time.Duration, function func() (tryAgain bool, err error)) error {
-	to := time.After(timeout)
-	tick := time.Tick(period)
+func retry(ctx context.Context, timeout, period time.Duration, function func() (tryAgain bool, err error)) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tick := time.NewTicker(period)
+	defer tick.Stop()
 
 	if tryAgain, err := function(); !tryAgain {
 		return err
@@ -190,9 +336,12 @@ func retry(timeout, period time.Duration, function func() (tryAgain bool, err er
 	// Keep trying until we're timed out or got a result or got an error
 	for {
 		select {
-		case <-to:
-			return errors.New("Timeout while waiting for result")
-		case <-tick:
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return errors.New("Timeout while waiting for result")
+			}
+			return ctx.Err()
+		case <-tick.C:
 			tryAgain, err := function()
 
 			if !tryAgain {
@@ -202,17 +351,22 @@ func retry(timeout, period time.Duration, function func() (tryAgain bool, err er
 	}
 }
 
-func pollUntilFinished(client *Client, instanceId string) error {
-	return retry(15*time.Minute, 15*time.Second, func() (bool, error) {
-		log.Println("Polling for async job")
+func pollUntilFinished(ctx context.Context, client *Client, instanceId string, logger *log.Logger) error {
+	return retry(ctx, 15*time.Minute, 15*time.Second, func() (bool, error) {
+		logger.Println("Polling for async job")
 
 		resp := client.LastOperation(instanceId)
 		if resp.InError() {
 			return false, resp.Error
 		}
 
+		// The instance is gone once an asynchronous deprovision finishes.
+		if resp.StatusCode == http.StatusGone {
+			return false, nil
+		}
+
 		if resp.StatusCode != 200 {
-			log.Printf("Bad status code %d, needed 200", resp.StatusCode)
+			logger.Printf("Bad status code %d, needed 200", resp.StatusCode)
 			return true, nil
 		}
 
@@ -223,15 +377,20 @@ func pollUntilFinished(client *Client, instanceId string) error {
 		}
 
 		state := responseBody["state"]
-		eq := state == string(brokerapi.Succeeded)
-		log.Printf("Last operation for %q was %q\n", instanceId, state)
-
-		return !eq, nil
+		logger.Printf("Last operation for %q was %q\n", instanceId, state)
 
+		switch brokerapi.LastOperationState(state) {
+		case brokerapi.Succeeded:
+			return false, nil
+		case brokerapi.Failed:
+			return false, fmt.Errorf("operation failed: %s", responseBody["description"])
+		default:
+			return true, nil
+		}
 	})
 }
 
-func newExampleExecutor(client *Client, serviceExample CompleteServiceExample) (*exampleExecutor, error) {
+func newExampleExecutor(client *Client, serviceExample CompleteServiceExample, logger *log.Logger) (*exampleExecutor, error) {
 	provisionParams, err := json.Marshal(serviceExample.ServiceExample.ProvisionParams)
 	if err != nil {
 		return nil, err
@@ -255,6 +414,7 @@ func newExampleExecutor(client *Client, serviceExample CompleteServiceExample) (
 		BindParams:      bindParams,
 
 		client: client,
+		log:    logger,
 	}, nil
 }
 
@@ -270,6 +430,16 @@ type exampleExecutor struct {
 	BindParams      json.RawMessage
 
 	client *Client
+	log    *log.Logger
+
+	// provisioned and bound are set once the corresponding request has been
+	// sent, so cleanup is only attempted for things that may exist.
+	provisioned bool
+	bound       bool
+
+	// provisionPending is set while an asynchronous provision hasn't been
+	// seen to finish.
+	provisionPending bool
 }
 
 // Provision attempts to create a service instance from the example.
@@ -277,12 +447,17 @@ type exampleExecutor struct {
 // ServiceId and details.
 // If the response is an async result, Provision will attempt to wait until
 // the Provision is complete.
-func (ee *exampleExecutor) Provision() error {
-	log.Printf("Provisioning %s\n", ee.Name)
+func (ee *exampleExecutor) Provision(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ee.log.Printf("Provisioning %s\n", ee.Name)
 
+	ee.provisioned = true
 	resp := ee.client.Provision(ee.InstanceId, ee.ServiceId, ee.PlanId, ee.ProvisionParams)
 
-	log.Println(resp.String())
+	ee.log.Println(resp.String())
 	if resp.InError() {
 		return resp.Error
 	}
@@ -291,54 +466,80 @@ func (ee *exampleExecutor) Provision() error {
 	case 201:
 		return nil
 	case 202:
-		return ee.pollUntilFinished()
+		ee.provisionPending = true
+		err := ee.pollUntilFinished(ctx)
+
+		// If the run was interrupted the operation may still be going.
+		if ctx.Err() == nil {
+			ee.provisionPending = false
+		}
+
+		return err
 	default:
-		return fmt.Errorf("Unexpected response code %d", resp.StatusCode)
+		return unexpectedResponse(resp)
 	}
 }
 
-func (ee *exampleExecutor) pollUntilFinished() error {
-	return pollUntilFinished(ee.client, ee.InstanceId)
+func (ee *exampleExecutor) pollUntilFinished(ctx context.Context) error {
+	return pollUntilFinished(ctx, ee.client, ee.InstanceId, ee.log)
 }
 
 // Deprovision destroys the instance created by a call to Provision.
-func (ee *exampleExecutor) Deprovision() error {
-	log.Printf("Deprovisioning %s\n", ee.Name)
+func (ee *exampleExecutor) Deprovision(ctx context.Context) error {
+	// The broker rejects deprovision requests while another operation is in
+	// progress, which happens if the run was interrupted mid-provision.
+	if ee.provisionPending {
+		ee.log.Printf("Waiting for the provision of %s to finish\n", ee.Name)
+		if err := ee.pollUntilFinished(ctx); err != nil {
+			ee.log.Printf("Provision didn't succeed, deprovisioning anyway: %v\n", err)
+		}
+
+		ee.provisionPending = false
+	}
+
+	ee.log.Printf("Deprovisioning %s\n", ee.Name)
 	resp := ee.client.Deprovision(ee.InstanceId, ee.ServiceId, ee.PlanId)
 
-	log.Println(resp.String())
+	ee.log.Println(resp.String())
 	if resp.InError() {
 		return resp.Error
 	}
 
 	switch resp.StatusCode {
-	case 200:
+	case 200, 410:
+		ee.provisioned = false
 		return nil
 	case 202:
-		return ee.pollUntilFinished()
+		if err := ee.pollUntilFinished(ctx); err != nil {
+			return err
+		}
+
+		ee.provisioned = false
+		return nil
 	default:
-		return fmt.Errorf("Unexpected response code %d", resp.StatusCode)
+		return unexpectedResponse(resp)
 	}
 }
 
 // Unbind unbinds the exact binding created by a call to Bind.
-func (ee *exampleExecutor) Unbind() error {
+func (ee *exampleExecutor) Unbind(ctx context.Context) error {
 	// XXX(josephlewis42) Due to some unknown reason, binding Postgres and MySQL
 	// don't wait for all operations to finish before returning even though it
 	// looks like they do so we can get 500 errors back the first few times we try
 	// to unbind. Issue #222 was opened to address this. In the meantime this
 	// is a hack to get around it that will still fail if the 500 errors truly
 	// occur because of a real, unrecoverable, server error.
-	return retry(15*time.Minute, 15*time.Second, func() (bool, error) {
-		log.Printf("Unbinding %s\n", ee.Name)
+	return retry(ctx, 15*time.Minute, 15*time.Second, func() (bool, error) {
+		ee.log.Printf("Unbinding %s\n", ee.Name)
 		resp := ee.client.Unbind(ee.InstanceId, ee.BindingId, ee.ServiceId, ee.PlanId)
 
-		log.Println(resp.String())
+		ee.log.Println(resp.String())
 		if resp.InError() {
 			return false, resp.Error
 		}
 
-		if resp.StatusCode == 200 {
+		if resp.StatusCode == 200 || resp.StatusCode == 410 {
+			ee.bound = false
 			return false, nil
 		}
 
@@ -346,18 +547,24 @@ func (ee *exampleExecutor) Unbind() error {
 			return true, nil
 		}
 
-		return false, fmt.Errorf("Unexpected response code %d", resp.StatusCode)
+		return false, unexpectedResponse(resp)
 	})
 }
 
 // Bind executes the bind portion of the create, this can only be called
 // once successfully as subsequent binds will attempt to create bindings with
 // the same ID.
-func (ee *exampleExecutor) Bind() (json.RawMessage, error) {
-	log.Printf("Binding %s\n", ee.Name)
+func (ee *exampleExecutor) Bind(ctx context.Context) (json.RawMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ee.log.Printf("Binding %s\n", ee.Name)
+
+	ee.bound = true
 	resp := ee.client.Bind(ee.InstanceId, ee.BindingId, ee.ServiceId, ee.PlanId, ee.BindParams)
 
-	log.Println(resp.String())
+	ee.log.Println(resp.String())
 	if resp.InError() {
 		return nil, resp.Error
 	}
@@ -366,17 +573,77 @@ func (ee *exampleExecutor) Bind() (json.RawMessage, error) {
 		return resp.ResponseBody, nil
 	}
 
-	return nil, fmt.Errorf("Unexpected response code %d", resp.StatusCode)
+	return nil, unexpectedResponse(resp)
+}
+
+// SmokeCheck runs the check's command with the binding credentials.
+func (ee *exampleExecutor) SmokeCheck(ctx context.Context, check broker.SmokeCheck, credentials map[string]interface{}) error {
+	credentialsJson, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+
+	timeout := check.GetTimeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ee.log.Printf("Running smoke check %q: %q\n", check.Name, check.Command)
+	cmd := exec.CommandContext(ctx, check.Command[0], check.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(credentialsJson)
+	cmd.Env = append(os.Environ(),
+		"CREDENTIALS="+string(credentialsJson),
+		"INSTANCE_ID="+ee.InstanceId,
+		"BINDING_ID="+ee.BindingId,
+	)
+
+	output, err := cmd.CombinedOutput()
+	ee.log.Printf("Smoke check %q output:\n%s", check.Name, output)
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return fmt.Errorf("timed out after %s", timeout)
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case err != nil:
+		return fmt.Errorf("%v: %s", err, lastLines(output, 5))
+	default:
+		return nil
+	}
 }
 
 // LogTestInfo writes information about the running example and a manual backout
 // strategy if the test dies part of the way through.
 func (ee *exampleExecutor) LogTestInfo() {
-	log.Printf("Running Example: %s\n", ee.Name)
+	ee.log.Printf("Running Example: %s\n", ee.Name)
 
 	ips := fmt.Sprintf("--instanceid %q --planid %q --serviceid %q", ee.InstanceId, ee.PlanId, ee.ServiceId)
-	log.Printf("gcp-service-broker client provision %s --params %q\n", ips, ee.ProvisionParams)
-	log.Printf("gcp-service-broker client bind %s --bindingid %q --params %q\n", ips, ee.BindingId, ee.BindParams)
-	log.Printf("gcp-service-broker client unbind %s --bindingid %q\n", ips, ee.BindingId)
-	log.Printf("gcp-service-broker client deprovision %s\n", ips)
+	ee.log.Printf("gcp-service-broker client provision %s --params %q\n", ips, ee.ProvisionParams)
+	ee.log.Printf("gcp-service-broker client bind %s --bindingid %q --params %q\n", ips, ee.BindingId, ee.BindParams)
+	ee.log.Printf("gcp-service-broker client unbind %s --bindingid %q\n", ips, ee.BindingId)
+	ee.log.Printf("gcp-service-broker client deprovision %s\n", ips)
+}
+
+// unexpectedResponse creates an error for a response with an unexpected
+// status code, including the broker's description of the problem if it gave
+// one.
+func unexpectedResponse(resp *BrokerResponse) error {
+	var body struct {
+		Description string `json:"description"`
+	}
+
+	if err := json.Unmarshal(resp.ResponseBody, &body); err == nil && body.Description != "" {
+		return fmt.Errorf("Unexpected response code %d: %s", resp.StatusCode, body.Description)
+	}
+
+	return fmt.Errorf("Unexpected response code %d", resp.StatusCode)
+}
+
+// lastLines returns up to the last n non-blank lines of the output.
+func lastLines(output []byte, n int) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return strings.Join(lines, "\n")
 }
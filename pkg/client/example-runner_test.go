@@ -1,12 +1,22 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
+	"github.com/pivotal-cf/brokerapi"
 )
 
 func ExampleGetAllCompleteServiceExamples_jsonSpec() {
@@ -369,3 +379,301 @@ func TestFilterMatchingServiceExamples(t *testing.T) {
 		})
 	}
 }
+
+// fakeBroker is a minimal synchronous OSB broker that fails provisions for
+// the plan "fail-plan" and records which instances and bindings exist.
+type fakeBroker struct {
+	mu         sync.Mutex
+	instances  map[string]bool
+	bindings   map[string]bool
+	running    int
+	maxRunning int
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{instances: map[string]bool{}, bindings: map[string]bool{}}
+}
+
+func (fb *fakeBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v2/service_instances/"), "/")
+	instanceId := parts[0]
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		var details brokerapi.ProvisionDetails
+		json.NewDecoder(r.Body).Decode(&details)
+
+		fb.mu.Lock()
+		fb.instances[instanceId] = true
+		fb.running++
+		if fb.running > fb.maxRunning {
+			fb.maxRunning = fb.running
+		}
+		fb.mu.Unlock()
+
+		// Give the other workers a chance to start.
+		time.Sleep(50 * time.Millisecond)
+
+		if details.PlanID == "fail-plan" {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"description":"provision failed"}`)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		fb.mu.Lock()
+		delete(fb.instances, instanceId)
+		fb.running--
+		fb.mu.Unlock()
+		fmt.Fprint(w, `{}`)
+
+	case len(parts) == 3 && r.Method == http.MethodPut:
+		fb.mu.Lock()
+		fb.bindings[parts[2]] = true
+		fb.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"credentials":{"uri":"fake://uri"}}`)
+
+	case len(parts) == 3 && r.Method == http.MethodDelete:
+		fb.mu.Lock()
+		delete(fb.bindings, parts[2])
+		fb.mu.Unlock()
+		fmt.Fprint(w, `{}`)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRunExamples(t *testing.T) {
+	newExample := func(name, planId string, outputs ...broker.BrokerVariable) CompleteServiceExample {
+		return CompleteServiceExample{
+			ServiceExample: broker.ServiceExample{
+				Name:            name,
+				PlanId:          planId,
+				ProvisionParams: map[string]interface{}{},
+				BindParams:      map[string]interface{}{},
+			},
+			ServiceName:    "fake-service",
+			ServiceId:      "fake-service-id",
+			ExpectedOutput: broker.CreateJsonSchema(outputs),
+		}
+	}
+
+	withChange := func(example CompleteServiceExample, change func(ex *broker.ServiceExample)) CompleteServiceExample {
+		change(&example.ServiceExample)
+		return example
+	}
+
+	exists := false
+	withAssertions := withChange(newExample("a", "ok"), func(ex *broker.ServiceExample) {
+		ex.ExpectedCredentials = []broker.CredentialAssertion{
+			{Path: "$.uri", Matches: "^fake://"},
+			{Path: "$.uri", Equals: "fake://other"},
+			{Path: "$.password", Exists: &exists},
+		}
+	})
+
+	withSmokeChecks := withChange(newExample("a", "ok"), func(ex *broker.ServiceExample) {
+		ex.SmokeChecks = []broker.SmokeCheck{
+			{Name: "stdin", Command: []string{"sh", "-c", `grep -q fake://uri`}},
+			{Name: "env", Command: []string{"sh", "-c", `test "$INSTANCE_ID" = "$BINDING_ID" && echo "$CREDENTIALS" | grep -q fake://uri`}},
+			{Name: "fails", Command: []string{"sh", "-c", `echo "can't connect"; exit 1`}},
+		}
+	})
+
+	allPhases := []string{PhaseProvision, PhaseBind, PhaseUnbind, PhaseDeprovision}
+	failedPhases := []string{PhaseProvision, PhaseDeprovision}
+
+	cases := map[string]struct {
+		Examples  []CompleteServiceExample
+		Options   ExampleRunOptions
+		Cancelled bool
+
+		ExpectedStatuses   []ExampleStatus
+		ExpectedPhases     [][]string
+		ExpectedAssertions []map[string]string
+		ExpectedErr        string
+		ExpectedMaxRunning int
+	}{
+		"serial": {
+			Examples:           []CompleteServiceExample{newExample("a", "ok"), newExample("b", "ok")},
+			ExpectedStatuses:   []ExampleStatus{ExamplePassed, ExamplePassed},
+			ExpectedPhases:     [][]string{allPhases, allPhases},
+			ExpectedMaxRunning: 1,
+		},
+		"parallel": {
+			Examples:           []CompleteServiceExample{newExample("a", "ok"), newExample("b", "ok"), newExample("c", "ok"), newExample("d", "ok")},
+			Options:            ExampleRunOptions{Parallelism: 2},
+			ExpectedStatuses:   []ExampleStatus{ExamplePassed, ExamplePassed, ExamplePassed, ExamplePassed},
+			ExpectedPhases:     [][]string{allPhases, allPhases, allPhases, allPhases},
+			ExpectedMaxRunning: 2,
+		},
+		"stops after failure": {
+			Examples:           []CompleteServiceExample{newExample("a", "fail-plan"), newExample("b", "ok")},
+			ExpectedStatuses:   []ExampleStatus{ExampleFailed, ExampleSkipped},
+			ExpectedPhases:     [][]string{failedPhases, {}},
+			ExpectedErr:        "0 of 2 examples passed, 1 failed, 1 skipped",
+			ExpectedMaxRunning: 1,
+		},
+		"continue on failure": {
+			Examples:           []CompleteServiceExample{newExample("a", "fail-plan"), newExample("b", "ok")},
+			Options:            ExampleRunOptions{ContinueOnFailure: true},
+			ExpectedStatuses:   []ExampleStatus{ExampleFailed, ExamplePassed},
+			ExpectedPhases:     [][]string{failedPhases, allPhases},
+			ExpectedErr:        "1 of 2 examples passed, 1 failed, 0 skipped",
+			ExpectedMaxRunning: 1,
+		},
+		"credentials don't match": {
+			Examples: []CompleteServiceExample{
+				newExample("a", "ok", broker.BrokerVariable{FieldName: "password", Type: "string", Required: true}),
+			},
+			ExpectedStatuses:   []ExampleStatus{ExampleFailed},
+			ExpectedPhases:     [][]string{allPhases},
+			ExpectedErr:        "0 of 1 examples passed, 1 failed, 0 skipped",
+			ExpectedMaxRunning: 1,
+		},
+		"credential assertions": {
+			Examples:         []CompleteServiceExample{withAssertions},
+			ExpectedStatuses: []ExampleStatus{ExampleFailed},
+			ExpectedPhases:   [][]string{allPhases},
+			ExpectedAssertions: []map[string]string{{
+				"credentials match the output schema": "passed",
+				`$.uri matches "^fake://"`:            "passed",
+				`$.uri equals "fake://other"`:         `failed: expected $.uri to equal "fake://other", got "fake://uri"`,
+				"$.password doesn't exist":            "passed",
+			}},
+			ExpectedErr:        "0 of 1 examples passed, 1 failed, 0 skipped",
+			ExpectedMaxRunning: 1,
+		},
+		"expected provision error": {
+			Examples: []CompleteServiceExample{
+				withChange(newExample("a", "fail-plan"), func(ex *broker.ServiceExample) {
+					ex.ExpectedProvisionError = "provision failed$"
+				}),
+				withChange(newExample("b", "ok"), func(ex *broker.ServiceExample) {
+					ex.ExpectedProvisionError = "provision failed$"
+				}),
+			},
+			Options:          ExampleRunOptions{ContinueOnFailure: true},
+			ExpectedStatuses: []ExampleStatus{ExamplePassed, ExampleFailed},
+			ExpectedPhases:   [][]string{failedPhases, failedPhases},
+			ExpectedAssertions: []map[string]string{
+				{`provision fails with an error matching "provision failed$"`: "passed"},
+				{`provision fails with an error matching "provision failed$"`: `failed: expected provision to fail with an error matching "provision failed$" but it succeeded`},
+			},
+			ExpectedErr:        "1 of 2 examples passed, 1 failed, 0 skipped",
+			ExpectedMaxRunning: 1,
+		},
+		"smoke checks": {
+			Examples:         []CompleteServiceExample{withSmokeChecks},
+			Options:          ExampleRunOptions{RunSmokeChecks: true},
+			ExpectedStatuses: []ExampleStatus{ExampleFailed},
+			ExpectedPhases:   [][]string{allPhases},
+			ExpectedAssertions: []map[string]string{{
+				"credentials match the output schema": "passed",
+				`smoke check "stdin"`:                 "passed",
+				`smoke check "env"`:                   "passed",
+				`smoke check "fails"`:                 "failed: exit status 1: can't connect",
+			}},
+			ExpectedErr:        "0 of 1 examples passed, 1 failed, 0 skipped",
+			ExpectedMaxRunning: 1,
+		},
+		"smoke checks disabled": {
+			Examples:         []CompleteServiceExample{withSmokeChecks},
+			ExpectedStatuses: []ExampleStatus{ExamplePassed},
+			ExpectedPhases:   [][]string{allPhases},
+			ExpectedAssertions: []map[string]string{{
+				"credentials match the output schema": "passed",
+				`smoke check "stdin"`:                 "skipped: smoke checks are disabled",
+				`smoke check "env"`:                   "skipped: smoke checks are disabled",
+				`smoke check "fails"`:                 "skipped: smoke checks are disabled",
+			}},
+			ExpectedMaxRunning: 1,
+		},
+		"interrupted": {
+			Examples:         []CompleteServiceExample{newExample("a", "ok"), newExample("b", "ok")},
+			Options:          ExampleRunOptions{Parallelism: 2},
+			Cancelled:        true,
+			ExpectedStatuses: []ExampleStatus{ExampleSkipped, ExampleSkipped},
+			ExpectedPhases:   [][]string{{}, {}},
+			ExpectedErr:      "0 of 2 examples passed, 0 failed, 2 skipped",
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			fake := newFakeBroker()
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			baseUrl, err := url.Parse(server.URL + "/v2/")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.Cancelled {
+				cancel()
+			}
+
+			report := RunExamples(ctx, &Client{BaseUrl: baseUrl}, tc.Examples, tc.Options)
+
+			var statuses []ExampleStatus
+			var phases [][]string
+			for _, result := range report.Results {
+				statuses = append(statuses, result.Status)
+
+				names := []string{}
+				for _, phase := range result.Phases {
+					names = append(names, phase.Name)
+				}
+				phases = append(phases, names)
+			}
+
+			if !reflect.DeepEqual(tc.ExpectedStatuses, statuses) {
+				t.Errorf("Expected statuses: %v got %v", tc.ExpectedStatuses, statuses)
+			}
+
+			if !reflect.DeepEqual(tc.ExpectedPhases, phases) {
+				t.Errorf("Expected phases: %v got %v", tc.ExpectedPhases, phases)
+			}
+
+			if tc.ExpectedAssertions != nil {
+				var assertions []map[string]string
+				for _, result := range report.Results {
+					outcomes := map[string]string{}
+					for _, assertion := range result.Assertions {
+						outcomes[assertion.Name] = string(assertion.Status)
+						if assertion.Error != "" {
+							outcomes[assertion.Name] += ": " + assertion.Error
+						}
+					}
+					assertions = append(assertions, outcomes)
+				}
+
+				if !reflect.DeepEqual(tc.ExpectedAssertions, assertions) {
+					t.Errorf("Expected assertions: %v got %v", tc.ExpectedAssertions, assertions)
+				}
+			}
+
+			if tc.ExpectedErr == "" {
+				expectError(t, nil, report.Err())
+			} else {
+				expectError(t, errors.New(tc.ExpectedErr), report.Err())
+			}
+
+			if fake.maxRunning != tc.ExpectedMaxRunning {
+				t.Errorf("Expected at most %d examples running at once, got %d", tc.ExpectedMaxRunning, fake.maxRunning)
+			}
+
+			if len(fake.instances) != 0 || len(fake.bindings) != 0 {
+				t.Errorf("Expected everything to be cleaned up, got instances: %v bindings: %v", fake.instances, fake.bindings)
+			}
+		})
+	}
+}
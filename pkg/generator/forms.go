@@ -15,6 +15,7 @@
 package generator
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"sort"
@@ -66,9 +67,9 @@ type FormProperty struct {
 }
 
 // GenerateFormsString creates all the forms for the user to fill out in the PCF tile
-// and returns it as a string.
-func GenerateFormsString() string {
-	response, err := yaml.Marshal(GenerateForms())
+// and returns it as a string. Extra forms are added after the builtin ones.
+func GenerateFormsString(extraForms ...Form) string {
+	response, err := yaml.Marshal(GenerateForms(extraForms...))
 	if err != nil {
 		log.Fatalf("Error marshaling YAML: %s", err)
 	}
@@ -77,17 +78,19 @@ func GenerateFormsString() string {
 }
 
 // GenerateForms creates all the forms for the user to fill out in the PCF tile.
-func GenerateForms() TileFormsSections {
+// Extra forms, like ones for brokerpak parameters, are added after the builtin
+// ones.
+func GenerateForms(extraForms ...Form) TileFormsSections {
 	// Add new forms at the bottom of the list because the order is reflected
 	// in the generated UI and we don't want to mix things up on users.
 	return TileFormsSections{
-		Forms: []Form{
+		Forms: append([]Form{
 			generateServiceAccountForm(),
 			generateDatabaseForm(),
 			generateBrokerpakForm(),
 			generateFeatureFlagForm(),
 			generateDefaultOverrideForm(),
-		},
+		}, extraForms...),
 
 		ServicePlanForms: append(generateServicePlanForms(), brokerpakConfigurationForm()),
 	}
@@ -133,7 +136,7 @@ func generateDefaultOverrideForm() Form {
 	return Form{
 		Name:        "default_override",
 		Label:       "Default Overrides",
-		Description: "Override the default values your users get when provisioning.",
+		Description: "Override the default values your users get when provisioning. Values can be secret references like {\"$ref\": \"env://SMTP_PASSWORD\"} or {\"$ref\": \"file:///path/to/secret\"}, the broker resolves them when it uses the value.",
 		Properties:  formElements,
 	}
 }
@@ -269,7 +272,7 @@ func generateServicePlanForm(svc *broker.ServiceDefinition) (Form, error) {
 	// additional properties.
 
 	for _, v := range svc.PlanVariables {
-		prop := brokerVariableToFormProperty(v)
+		prop := BrokerVariableToFormProperty(v)
 		planForm.Properties = append(planForm.Properties, prop)
 	}
 
@@ -287,11 +290,19 @@ A brokerpak is an archive comprised of a versioned Terraform binary and provider
 				Name:         "gsb_brokerpak_config",
 				Type:         "text",
 				Label:        "Global Brokerpak Configuration",
-				Description:  "A JSON map of configuration key/value pairs for all brokerpaks. If a variable isn't found in the specific brokerpak's configuration it's looked up here.",
+				Description:  "A JSON map of configuration key/value pairs for all brokerpaks. If a variable isn't found in the specific brokerpak's configuration it's looked up here. Values can be secret references like {\"$ref\": \"env://LICENSE_KEY\"}.",
 				Default:      "{}",
 				Optional:     false,
 				Configurable: true,
 			},
+			{
+				Name:         "gsb_brokerpak_trusted_keys",
+				Type:         "text",
+				Label:        "Trusted Brokerpak Signing Keys",
+				Description:  "Base64 encoded ed25519 public keys, one per line. Brokerpaks MUST be signed by one of these keys to be loaded unless unsigned brokerpaks are allowed.",
+				Optional:     true,
+				Configurable: true,
+			},
 		},
 	}
 }
@@ -315,6 +326,14 @@ func brokerpakConfigurationForm() Form {
 				Optional:     false,
 				Configurable: true,
 			},
+			{
+				Name:         "signature_uri",
+				Label:        "Signature URI",
+				Type:         "string",
+				Description:  "The URI of the brokerpak's detached signature. Defaults to the brokerpak URI, without query parameters, with a .sig extension.",
+				Optional:     true,
+				Configurable: true,
+			},
 			{
 				Name:         "service_prefix",
 				Label:        "Service Prefix",
@@ -335,7 +354,7 @@ func brokerpakConfigurationForm() Form {
 				Name:         "config",
 				Label:        "Brokerpak Configuration",
 				Type:         "text",
-				Description:  "A JSON map of configuration key/value pairs for the brokerpak. If a variable isn't found here, it's looked up in the global config.",
+				Description:  "A JSON map of configuration key/value pairs for the brokerpak. If a variable isn't found here, it's looked up in the global config. Values can be secret references like {\"$ref\": \"env://LICENSE_KEY\"}.",
 				Default:      "{}",
 				Configurable: true,
 			},
@@ -351,17 +370,30 @@ func brokerpakConfigurationForm() Form {
 	}
 }
 
-func brokerVariableToFormProperty(v broker.BrokerVariable) FormProperty {
+// BrokerVariableToFormProperty converts a BrokerVariable into a form element
+// named after the variable's field.
+func BrokerVariableToFormProperty(v broker.BrokerVariable) FormProperty {
 	formInput := FormProperty{
 		Name:         v.FieldName,
 		Label:        propertyToLabel(v.FieldName),
 		Type:         string(v.Type),
-		Description:  v.Details,
+		Description:  strings.Join(append([]string{v.Details}, v.DescribeRelationships()...), " "),
 		Configurable: true,
 		Optional:     !v.Required,
 		Default:      v.Default,
 	}
 
+	// Tile forms don't have structured inputs so objects and arrays are
+	// entered as JSON.
+	if v.Type == broker.JsonTypeObject || v.Type == broker.JsonTypeArray {
+		formInput.Type = "text"
+
+		if v.Default != nil {
+			defaultJSON, _ := json.Marshal(v.Default)
+			formInput.Default = string(defaultJSON)
+		}
+	}
+
 	if v.Enum != nil {
 		formInput.Type = "dropdown_select"
 
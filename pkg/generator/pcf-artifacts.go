@@ -102,9 +102,9 @@ func GenerateManifest() string {
 	return runPcfTemplate(manifestYmlTemplate)
 }
 
-// GenerateTile creates a tile.yml from a template.
-func GenerateTile() string {
-	return runPcfTemplate(tileYmlTemplate) + GenerateFormsString()
+// GenerateTile creates a tile.yml from a template with the given extra forms.
+func GenerateTile(extraForms ...Form) string {
+	return runPcfTemplate(tileYmlTemplate) + GenerateFormsString(extraForms...)
 }
 
 func runPcfTemplate(templateString string) string {
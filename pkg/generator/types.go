@@ -231,7 +231,9 @@ Uses plan: {{ code $example.PlanId }}.
 **Provision**
 
 {{ jsonCodeBlock $example.ProvisionParams }}
-
+{{ if $example.ExpectedProvisionError }}
+This example should fail to provision with an error matching {{ code $example.ExpectedProvisionError }}.
+{{ else }}
 **Bind**
 
 {{ jsonCodeBlock $example.BindParams }}
@@ -241,7 +243,7 @@ Uses plan: {{ code $example.PlanId }}.
 <pre>
 {{exampleCommands $example}}
 </pre>
-
+{{ end }}
 {{ end }}
 `
 
@@ -269,6 +271,12 @@ func mdCode(text interface{}) string {
 }
 
 func varNotes(variable broker.BrokerVariable) string {
+	return nestedVarNotes(variable, "    ")
+}
+
+// nestedVarNotes documents the variable with its constraints, properties and
+// items as bullets at the given indent.
+func nestedVarNotes(variable broker.BrokerVariable, indent string) string {
 	out := fmt.Sprintf("`%s` _%s_ - ", variable.FieldName, variable.Type)
 
 	if variable.Required {
@@ -277,14 +285,31 @@ func varNotes(variable broker.BrokerVariable) string {
 
 	out += cleanLines(variable.Details)
 
-	if variable.Default != nil {
+	switch {
+	case variable.Default == nil:
+		// no default
+	case variable.Type == broker.JsonTypeObject || variable.Type == broker.JsonTypeArray:
+		defaultJSON, _ := json.Marshal(variable.Default)
+		out += fmt.Sprintf(" Default: `%s`.", defaultJSON)
+	default:
 		out += fmt.Sprintf(" Default: `%v`.", variable.Default)
 	}
 
 	bullets := constraintsToDoc(variable.ToSchema())
-	if len(bullets) > 0 {
-		out += "\n    * "
-		out += strings.Join(bullets, "\n    * ")
+	bullets = append(bullets, variable.DescribeRelationships()...)
+
+	for _, property := range variable.Properties {
+		bullets = append(bullets, nestedVarNotes(property, indent+"    "))
+	}
+
+	if variable.Items != nil {
+		items := *variable.Items
+		items.FieldName = variable.FieldName + "[]"
+		bullets = append(bullets, nestedVarNotes(items, indent+"    "))
+	}
+
+	for _, bullet := range bullets {
+		out += "\n" + indent + "* " + bullet
 	}
 
 	return out
@@ -327,19 +352,38 @@ func constraintsToDoc(schema map[string]interface{}) []string {
 		{validation.KeyMaxProperties, "The object must have at most %v properties."},
 		{validation.KeyMinProperties, "The object must have at least %v properties."},
 		{validation.KeyRequired, "The following properties are required: %v."},
-		{validation.KeyMaxProperties, "Property names must match the JSON Schema: `%+v`."},
+		{validation.KeyPropertyNames, "Property names must match the JSON Schema: `%+v`."},
+		{validation.KeyAdditionalProperties, "Property values must match the JSON Schema: `%+v`."},
 	}
 
 	var bullets []string
 	for _, formatter := range constraintFormatters {
 		if v, ok := schema[formatter.SchemaKey]; ok {
-			bullets = append(bullets, fmt.Sprintf(formatter.DocString, v))
+			bullets = append(bullets, fmt.Sprintf(formatter.DocString, docValue(v)))
 		}
 	}
 
 	return bullets
 }
 
+// docValue formats maps in constraint values as JSON so nested schemas and
+// object examples are readable, other values are left for fmt.
+func docValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out, _ := json.Marshal(v)
+		return string(out)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, elem := range v {
+			out[i] = docValue(elem)
+		}
+		return out
+	default:
+		return value
+	}
+}
+
 // cleanLines concatenates multiple lines of text, trimming any leading/trailing
 // whitespace
 func cleanLines(text string) string {
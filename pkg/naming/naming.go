@@ -0,0 +1,191 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package naming derives stable names for GCP resources from service instance
+// IDs.
+//
+// Names are built from a prefix and a hash of the instance ID so the same
+// instance always gets the same name, no matter which broker replica creates
+// it or how many times the broker restarted in between.
+package naming
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// hashLength is the number of base32 characters of the instance ID hash
+	// included in names, 12 characters hold 60 bits.
+	hashLength = 12
+
+	// maxAttempts is the number of alternative names tried if the preferred
+	// name is taken by another instance.
+	maxAttempts = 10
+)
+
+// Rule holds the constraints GCP puts on the name of a type of resource.
+// All names start with a lowercase letter, contain only lowercase letters,
+// digits and the separator, and end with a letter or digit.
+type Rule struct {
+	// MaxLength is the maximum number of characters in the name.
+	MaxLength int
+	// Separator is placed between the prefix and the hash and replaces
+	// characters in the prefix that aren't allowed.
+	Separator string
+}
+
+// DefaultResourceType is the type of resource used if a rule for the
+// requested one doesn't exist. Its rule produces valid DNS labels.
+const DefaultResourceType = "default"
+
+var rules = map[string]Rule{
+	DefaultResourceType:   {MaxLength: 63, Separator: "-"},
+	"bigquery_dataset":    {MaxLength: 1024, Separator: "_"},
+	"bigtable_instance":   {MaxLength: 33, Separator: "-"},
+	"cloudsql_instance":   {MaxLength: 63, Separator: "-"},
+	"dataproc_cluster":    {MaxLength: 51, Separator: "-"},
+	"pubsub_subscription": {MaxLength: 255, Separator: "_"},
+	"pubsub_topic":        {MaxLength: 255, Separator: "_"},
+	"redis_instance":      {MaxLength: 40, Separator: "-"},
+	"service_account":     {MaxLength: 30, Separator: "-"},
+	"spanner_instance":    {MaxLength: 30, Separator: "-"},
+	"storage_bucket":      {MaxLength: 63, Separator: "_"},
+}
+
+// ResourceTypes gets the types of resources that have naming rules, sorted by
+// name.
+func ResourceTypes() []string {
+	var out []string
+	for name := range rules {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// RuleFor gets the naming rule for the resource type, falling back to the
+// rule for DefaultResourceType if the type is unknown.
+func RuleFor(resourceType string) Rule {
+	if rule, ok := rules[resourceType]; ok {
+		return rule
+	}
+
+	return rules[DefaultResourceType]
+}
+
+// TakenFunc checks whether a service instance other than the one with the
+// given ID already uses the name.
+type TakenFunc func(name, instanceId string) (bool, error)
+
+var (
+	takenMu sync.RWMutex
+	taken   TakenFunc
+)
+
+// SetTakenFunc sets the function used to check that generated names are
+// unique. Until it's set, names are generated without checking.
+func SetTakenFunc(fn TakenFunc) {
+	takenMu.Lock()
+	defer takenMu.Unlock()
+
+	taken = fn
+}
+
+func getTakenFunc() TakenFunc {
+	takenMu.RLock()
+	defer takenMu.RUnlock()
+
+	return taken
+}
+
+var (
+	leadingNonLetters = regexp.MustCompile(`^[^a-z]+`)
+	invalidChars      = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// Generate creates a name for the service instance that follows the rule for
+// the resource type.
+//
+// The name is the sanitized prefix followed by a hash of the instance ID.
+// If the name is used by another instance, a different hash is tried until
+// a free name is found.
+func Generate(resourceType, prefix, instanceId string) (string, error) {
+	if instanceId == "" {
+		return "", fmt.Errorf("an instance ID is required to generate a name")
+	}
+
+	rule := RuleFor(resourceType)
+	isTaken := getTakenFunc()
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		name, err := rule.name(prefix, instanceId, attempt)
+		if err != nil {
+			return "", err
+		}
+
+		if isTaken == nil {
+			return name, nil
+		}
+
+		used, err := isTaken(name, instanceId)
+		if err != nil {
+			return "", fmt.Errorf("couldn't check if the name %q is in use: %v", name, err)
+		}
+
+		if !used {
+			return name, nil
+		}
+	}
+
+	return "", fmt.Errorf("couldn't find an unused name for instance %q after %d attempts", instanceId, maxAttempts)
+}
+
+// name creates the candidate name for the given attempt.
+func (rule Rule) name(prefix, instanceId string, attempt int) (string, error) {
+	seed := instanceId
+	if attempt > 0 {
+		seed = fmt.Sprintf("%s/%d", instanceId, attempt)
+	}
+
+	sum := sha256.Sum256([]byte(seed))
+	hash := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(sum[:]))
+
+	hashLen := hashLength
+	if hashLen > rule.MaxLength-len(rule.Separator)-1 {
+		hashLen = rule.MaxLength - len(rule.Separator) - 1
+	}
+	if hashLen < 1 {
+		return "", fmt.Errorf("names can't fit in %d characters", rule.MaxLength)
+	}
+
+	cleanPrefix := leadingNonLetters.ReplaceAllString(strings.ToLower(prefix), "")
+	cleanPrefix = invalidChars.ReplaceAllString(cleanPrefix, rule.Separator)
+	if cleanPrefix == "" {
+		return "", fmt.Errorf("the name prefix %q needs at least one letter", prefix)
+	}
+
+	if maxPrefix := rule.MaxLength - len(rule.Separator) - hashLen; len(cleanPrefix) > maxPrefix {
+		cleanPrefix = cleanPrefix[:maxPrefix]
+	}
+	cleanPrefix = strings.TrimRight(cleanPrefix, rule.Separator)
+
+	return cleanPrefix + rule.Separator + hash[:hashLen], nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package naming
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	cases := map[string]struct {
+		ResourceType  string
+		Prefix        string
+		InstanceId    string
+		Taken         map[string]bool
+		TakenErr      error
+		Expected      string
+		ErrorContains string
+	}{
+		"basic": {
+			ResourceType: "redis_instance",
+			Prefix:       "pcf-sb",
+			InstanceId:   "abc",
+			Expected:     "pcf-sb-xj4bnp4pahh6",
+		},
+		"unknown type uses default": {
+			ResourceType: "unknown",
+			Prefix:       "pcf-sb",
+			InstanceId:   "abc",
+			Expected:     "pcf-sb-xj4bnp4pahh6",
+		},
+		"underscore separator": {
+			ResourceType: "storage_bucket",
+			Prefix:       "pcf-sb",
+			InstanceId:   "abc",
+			Expected:     "pcf_sb_xj4bnp4pahh6",
+		},
+		"prefix sanitized": {
+			ResourceType: "redis_instance",
+			Prefix:       "123 My  Prefix!",
+			InstanceId:   "abc",
+			Expected:     "my-prefix-xj4bnp4pahh6",
+		},
+		"prefix truncated": {
+			ResourceType: "service_account",
+			Prefix:       "a-very-long-prefix-for-an-account",
+			InstanceId:   "abc",
+			Expected:     "a-very-long-prefi-xj4bnp4pahh6",
+		},
+		"taken name skipped": {
+			ResourceType: "redis_instance",
+			Prefix:       "pcf-sb",
+			InstanceId:   "abc",
+			Taken:        map[string]bool{"pcf-sb-xj4bnp4pahh6": true},
+			Expected:     "pcf-sb-xv5xoy2qsznd",
+		},
+		"check fails": {
+			ResourceType:  "redis_instance",
+			Prefix:        "pcf-sb",
+			InstanceId:    "abc",
+			TakenErr:      errors.New("db down"),
+			ErrorContains: "db down",
+		},
+		"no letters in prefix": {
+			ResourceType:  "redis_instance",
+			Prefix:        "123",
+			InstanceId:    "abc",
+			ErrorContains: "needs at least one letter",
+		},
+		"no instance id": {
+			ResourceType:  "redis_instance",
+			Prefix:        "pcf-sb",
+			ErrorContains: "instance ID is required",
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			if tc.Taken != nil || tc.TakenErr != nil {
+				SetTakenFunc(func(name, instanceId string) (bool, error) {
+					return tc.Taken[name], tc.TakenErr
+				})
+				defer SetTakenFunc(nil)
+			}
+
+			actual, err := Generate(tc.ResourceType, tc.Prefix, tc.InstanceId)
+			if tc.ErrorContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.ErrorContains) {
+					t.Fatalf("Expected error containing %q, got: %v", tc.ErrorContains, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if actual != tc.Expected {
+				t.Errorf("Expected name %q, got %q", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func TestGenerate_allTaken(t *testing.T) {
+	SetTakenFunc(func(name, instanceId string) (bool, error) { return true, nil })
+	defer SetTakenFunc(nil)
+
+	_, err := Generate("redis_instance", "pcf-sb", "abc")
+	if err == nil || !strings.Contains(err.Error(), "couldn't find an unused name") {
+		t.Errorf("Expected an error about unused names, got: %v", err)
+	}
+}
+
+func TestGenerate_followsRules(t *testing.T) {
+	prefix := strings.Repeat("Long Prefix ", 100)
+
+	for _, resourceType := range ResourceTypes() {
+		t.Run(resourceType, func(t *testing.T) {
+			rule := RuleFor(resourceType)
+			sep := regexp.QuoteMeta(rule.Separator)
+			valid := regexp.MustCompile(`^[a-z]([a-z0-9` + sep + `]*[a-z0-9])?$`)
+
+			name, err := Generate(resourceType, prefix, "some-instance-id")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(name) > rule.MaxLength {
+				t.Errorf("Expected at most %d characters, got %d: %q", rule.MaxLength, len(name), name)
+			}
+
+			if !valid.MatchString(name) {
+				t.Errorf("Expected %q to match %v", name, valid)
+			}
+		})
+	}
+}
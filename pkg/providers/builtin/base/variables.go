@@ -56,7 +56,7 @@ func InstanceID(minLength, maxLength int, uniqueArea UniqueArea) broker.BrokerVa
 		FieldName: InstanceIDKey,
 		Type:      broker.JsonTypeString,
 		Details:   fmt.Sprintf("The name of the instance. The name must be unique %s.", uniqueArea),
-		Default:   "gsb-${counter.next()}-${time.nano()}",
+		Default:   `${name.resource("default", "gsb", request.instance_id)}`,
 		Constraints: validation.NewConstraintBuilder().
 			MinLength(minLength).
 			MaxLength(maxLength).
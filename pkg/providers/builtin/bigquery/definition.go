@@ -62,7 +62,7 @@ func ServiceDefinition() *broker.ServiceDefinition {
 				FieldName: "name",
 				Type:      broker.JsonTypeString,
 				Details:   "The name of the BigQuery dataset.",
-				Default:   "pcf_sb_${counter.next()}_${time.nano()}",
+				Default:   `${name.resource("bigquery_dataset", "pcf_sb", request.instance_id)}`,
 				Constraints: validation.NewConstraintBuilder().
 					Pattern("^[A-Za-z0-9_]+$").
 					MaxLength(1024).
@@ -68,7 +68,7 @@ func ServiceDefinition() *broker.ServiceDefinition {
 				FieldName: "name",
 				Type:      broker.JsonTypeString,
 				Details:   "The name of the Cloud Bigtable instance.",
-				Default:   "pcf-sb-${counter.next()}-${time.nano()}",
+				Default:   `${name.resource("bigtable_instance", "pcf-sb", request.instance_id)}`,
 				Constraints: validation.NewConstraintBuilder().
 					MinLength(6).
 					MaxLength(33).
@@ -19,7 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"strings"
+	"sort"
 	"time"
 
 	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service/models"
@@ -110,12 +110,7 @@ func createProvisionRequest(vars *varcontext.VarContext) (*googlecloudsql.Databa
 
 func varctxGetAcls(vars *varcontext.VarContext) []*googlecloudsql.AclEntry {
 	openAcls := []*googlecloudsql.AclEntry{}
-	authorizedNetworkCsv := vars.GetString("authorized_networks")
-	if authorizedNetworkCsv == "" {
-		return openAcls
-	}
-
-	for _, v := range strings.Split(authorizedNetworkCsv, ",") {
+	for _, v := range vars.GetStringSlice("authorized_networks") {
 		openAcls = append(openAcls, &googlecloudsql.AclEntry{Value: v})
 	}
 
@@ -124,8 +119,7 @@ func varctxGetAcls(vars *varcontext.VarContext) []*googlecloudsql.AclEntry {
 
 func createInstanceRequest(vars *varcontext.VarContext) *googlecloudsql.DatabaseInstance {
 
-	// Split and parse DatabaseFlags
-	databaseFlags := parseDatabaseFlags(vars.GetString("database_flags"))
+	databaseFlags := varctxGetDatabaseFlags(vars)
 
 	autoResize := vars.GetBool("auto_resize")
 
@@ -183,24 +177,22 @@ func createInstanceRequest(vars *varcontext.VarContext) *googlecloudsql.Database
 	}
 }
 
-func parseDatabaseFlags(flagsvar string) []*googlecloudsql.DatabaseFlags {
-	databaseFlags := []*googlecloudsql.DatabaseFlags{}
+// varctxGetDatabaseFlags gets the database flags sorted by name so requests
+// are deterministic.
+func varctxGetDatabaseFlags(vars *varcontext.VarContext) []*googlecloudsql.DatabaseFlags {
+	flags := vars.GetStringMapString("database_flags")
 
-	// Return empty DatabaseFlags when none is defined
-	if flagsvar == "" {
-		return databaseFlags
+	var names []string
+	for name := range flags {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	// Get each separate flag
-	flags := strings.Split(flagsvar, ",")
-
-	// Separate the flags into name and value
-	for _, f := range flags {
-		flag := strings.Split(f, "=")
-
+	databaseFlags := []*googlecloudsql.DatabaseFlags{}
+	for _, name := range names {
 		databaseFlags = append(databaseFlags, &googlecloudsql.DatabaseFlags{
-			Name:            flag[0],
-			Value:           flag[1],
+			Name:            name,
+			Value:           flags[name],
 			ForceSendFields: []string{"Value"},
 		})
 	}
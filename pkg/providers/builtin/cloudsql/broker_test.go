@@ -207,6 +207,65 @@ func TestCreateProvisionRequest(t *testing.T) {
 			},
 		},
 
+		"authorized networks as a list": {
+			Service:    MysqlServiceDefinition(),
+			PlanId:     mysqlSecondGenPlan,
+			UserParams: `{"authorized_networks":["10.0.0.0/8","203.0.113.7/32"]}`,
+			Validate: func(t *testing.T, di googlecloudsql.DatabaseInstance, ii InstanceInformation) {
+				expectAcls(t, di, "10.0.0.0/8", "203.0.113.7/32")
+			},
+		},
+
+		"authorized networks as a legacy string": {
+			Service:    MysqlServiceDefinition(),
+			PlanId:     mysqlSecondGenPlan,
+			UserParams: `{"authorized_networks":"10.0.0.0/8,203.0.113.7/32"}`,
+			Validate: func(t *testing.T, di googlecloudsql.DatabaseInstance, ii InstanceInformation) {
+				expectAcls(t, di, "10.0.0.0/8", "203.0.113.7/32")
+			},
+		},
+
+		"authorized networks must be CIDRs": {
+			Service:     MysqlServiceDefinition(),
+			PlanId:      mysqlSecondGenPlan,
+			UserParams:  `{"authorized_networks":["everywhere"]}`,
+			ErrContains: "authorized_networks.0",
+		},
+
+		"database flags as an object": {
+			Service:    MysqlServiceDefinition(),
+			PlanId:     mysqlSecondGenPlan,
+			UserParams: `{"database_flags":{"long_query_time":"10","general_log":"on"}}`,
+			Validate: func(t *testing.T, di googlecloudsql.DatabaseInstance, ii InstanceInformation) {
+				expectDatabaseFlags(t, di, "general_log=on", "long_query_time=10")
+			},
+		},
+
+		"database flags as a legacy string": {
+			Service:    PostgresServiceDefinition(),
+			PlanId:     postgresPlan,
+			UserParams: `{"database_flags":"long_query_time=10,general_log=on"}`,
+			Validate: func(t *testing.T, di googlecloudsql.DatabaseInstance, ii InstanceInformation) {
+				expectDatabaseFlags(t, di, "general_log=on", "long_query_time=10")
+			},
+		},
+
+		"database flags default to none": {
+			Service:    MysqlServiceDefinition(),
+			PlanId:     mysqlSecondGenPlan,
+			UserParams: `{}`,
+			Validate: func(t *testing.T, di googlecloudsql.DatabaseInstance, ii InstanceInformation) {
+				expectDatabaseFlags(t, di)
+			},
+		},
+
+		"database flag names must be valid": {
+			Service:     MysqlServiceDefinition(),
+			PlanId:      mysqlSecondGenPlan,
+			UserParams:  `{"database_flags":{"Long-Query-Time":"10"}}`,
+			ErrContains: "Does not match pattern '^[a-z_]+$'",
+		},
+
 		"mysql disk size greater than operator specified max fails": {
 			Service:     MysqlServiceDefinition(),
 			PlanId:      mysqlSecondGenPlan,
@@ -436,6 +495,32 @@ func TestBuildInstanceCredentials(t *testing.T) {
 	}
 }
 
+func expectAcls(t *testing.T, di googlecloudsql.DatabaseInstance, expected ...string) {
+	t.Helper()
+
+	var actual []string
+	for _, acl := range di.Settings.IpConfiguration.AuthorizedNetworks {
+		actual = append(actual, acl.Value)
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected authorized networks %v, got %v", expected, actual)
+	}
+}
+
+func expectDatabaseFlags(t *testing.T, di googlecloudsql.DatabaseInstance, expected ...string) {
+	t.Helper()
+
+	var actual []string
+	for _, flag := range di.Settings.DatabaseFlags {
+		actual = append(actual, flag.Name+"="+flag.Value)
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected database flags %v, got %v", expected, actual)
+	}
+}
+
 func Test_createProvisionRequest(t *testing.T) {
 	services := []*broker.ServiceDefinition{
 		MysqlServiceDefinition(),
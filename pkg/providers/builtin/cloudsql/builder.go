@@ -96,6 +96,7 @@ func buildDatabase(opts cloudSQLOptions) *broker.ServiceDefinition {
 		BindOutputVariables:   commonBindOutputVariables(),
 		BindComputedVariables: commonBindComputedVariables(),
 
+		DashboardUrlTemplate: "https://console.cloud.google.com/sql/instances/${instance.name}/overview?project=${broker.project_id}",
 		ProviderBuilder: func(projectId string, auth *jwt.Config, logger lager.Logger) broker.ServiceProvider {
 			bb := base.NewBrokerBase(projectId, auth, logger)
 			return &CloudSQLBroker{
@@ -229,20 +230,37 @@ func buildDatabase(opts cloudSQLOptions) *broker.ServiceDefinition {
 
 		defn.ProvisionComputedVariables = append(defn.ProvisionComputedVariables, varcontext.DefaultVariable{
 			Name:      "authorized_networks",
-			Default:   ``,
+			Default:   []interface{}{},
 			Overwrite: true,
+			Type:      "array",
 		})
 	} else {
 		defn.ProvisionInputVariables = append(
 			defn.ProvisionInputVariables,
 			broker.BrokerVariable{
 				FieldName: "authorized_networks",
-				Type:      broker.JsonTypeString,
-				Details:   "A comma separated list without spaces.",
-				Default:   "",
+				Type:      broker.JsonTypeArray,
+				Details:   "The networks allowed to connect to the instance. A comma separated string is also accepted for compatibility with older versions.",
+				Default:   []interface{}{},
+				Items: &broker.BrokerVariable{
+					Type:    broker.JsonTypeString,
+					Details: "A network in CIDR notation.",
+					Constraints: validation.NewConstraintBuilder().
+						Pattern(`^[0-9a-fA-F:.]+(/[0-9]+)?$`).
+						Examples("10.0.0.0/8", "203.0.113.7/32").
+						Build(),
+				},
 			},
 		)
 
+		// legacy behavior accepted a comma separated string
+		defn.ProvisionComputedVariables = append(defn.ProvisionComputedVariables, varcontext.DefaultVariable{
+			Name:      "authorized_networks",
+			Default:   `${list.parse(",", authorized_networks)}`,
+			Overwrite: true,
+			Type:      "array",
+		})
+
 		defn.ProvisionComputedVariables = append(defn.ProvisionComputedVariables, varcontext.DefaultVariable{
 			Name:      "private_network",
 			Default:   ``,
@@ -251,5 +269,14 @@ func buildDatabase(opts cloudSQLOptions) *broker.ServiceDefinition {
 	}
 
 	defn.ProvisionInputVariables = append(defn.ProvisionInputVariables, commonProvisionVariables()...)
+
+	// legacy behavior accepted a comma separated string of name=value pairs
+	defn.ProvisionComputedVariables = append(defn.ProvisionComputedVariables, varcontext.DefaultVariable{
+		Name:      "database_flags",
+		Default:   `${map.parse("=", ",", database_flags)}`,
+		Overwrite: true,
+		Type:      "object",
+	})
+
 	return defn
 }
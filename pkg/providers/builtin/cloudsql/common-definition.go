@@ -24,7 +24,7 @@ import (
 const (
 	passwordTemplate   = "${rand.base64(32)}"
 	usernameTemplate   = `sb${str.truncate(14, time.nano())}`
-	identifierTemplate = `sb-${counter.next()}-${time.nano()}`
+	identifierTemplate = `${name.resource("cloudsql_instance", "sb", request.instance_id)}`
 )
 
 func roleWhitelist() []string {
@@ -102,12 +102,19 @@ func commonProvisionVariables() []broker.BrokerVariable {
 		},
 		{
 			FieldName: "database_flags",
-			Type:      broker.JsonTypeString,
-			Details:   "The database flags passed to the instance at startup (comma separated list of flags, e.g. general_log=on,skip_show_database=off).",
-			Default:   "",
+			Type:      broker.JsonTypeObject,
+			Details:   "The database flags passed to the instance at startup as an object of flag names and values. A comma separated string of flags like general_log=on,skip_show_database=off is also accepted for compatibility with older versions.",
+			Default:   map[string]interface{}{},
 			Constraints: validation.NewConstraintBuilder().
-				Pattern(`^(|([a-z_]+=[a-zA-Z0-9\.\+\:-]+)(,[a-z_]+=[a-zA-Z0-9\.\+\:-]+)*)$`).
-				Examples("long_query_time=10", "general_log=on,skip_show_database=off").
+				PropertyNames(validation.NewConstraintBuilder().Pattern(`^[a-z_]+$`).Build()).
+				AdditionalProperties(validation.NewConstraintBuilder().
+					Type("string").
+					Pattern(`^[a-zA-Z0-9\.\+\:-]+$`).
+					Build()).
+				Examples(
+					map[string]interface{}{"long_query_time": "10"},
+					map[string]interface{}{"general_log": "on", "skip_show_database": "off"},
+				).
 				Build(),
 		},
 		{
@@ -61,7 +61,7 @@ func ServiceDefinition() *broker.ServiceDefinition {
 				FieldName: "topic_name",
 				Type:      broker.JsonTypeString,
 				Details:   `Name of the topic. Must not start with "goog".`,
-				Default:   "pcf_sb_${counter.next()}_${time.nano()}",
+				Default:   `${name.resource("pubsub_topic", "pcf_sb", request.instance_id)}`,
 				Constraints: validation.NewConstraintBuilder().
 					MinLength(3).
 					MaxLength(255).
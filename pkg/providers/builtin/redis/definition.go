@@ -143,6 +143,7 @@ func ServiceDefinition() *broker.ServiceDefinition {
 				BindParams:      map[string]interface{}{},
 			},
 		},
+		DashboardUrlTemplate: "https://console.cloud.google.com/memorystore/redis/locations/${instance.location}/instances/${instance.name}/details?project=${broker.project_id}",
 		ProviderBuilder: func(projectID string, auth *jwt.Config, logger lager.Logger) broker.ServiceProvider {
 			return &Broker{
 				PeeredNetworkServiceBase: base.NewPeeredNetworkServiceBase(projectID, auth, logger),
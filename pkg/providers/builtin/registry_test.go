@@ -89,8 +89,8 @@ func validateServiceDefinition(t *testing.T, svc *broker.ServiceDefinition) {
 			t.Error("Expected PlanUpdatable to be false")
 		}
 
-		if catalog.InstancesRetrievable {
-			t.Error("Expected InstancesRetrievable to be false")
+		if !catalog.InstancesRetrievable {
+			t.Error("Expected InstancesRetrievable to be true")
 		}
 
 		if catalog.BindingsRetrievable {
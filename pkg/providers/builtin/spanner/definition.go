@@ -70,7 +70,7 @@ func ServiceDefinition() *broker.ServiceDefinition {
 				FieldName: "name",
 				Type:      broker.JsonTypeString,
 				Details:   "A unique identifier for the instance, which cannot be changed after the instance is created.",
-				Default:   "pcf-sb-${counter.next()}-${time.nano()}",
+				Default:   `${name.resource("spanner_instance", "pcf-sb", request.instance_id)}`,
 				Constraints: validation.NewConstraintBuilder().
 					MinLength(6).
 					MaxLength(30).
@@ -145,6 +145,7 @@ func ServiceDefinition() *broker.ServiceDefinition {
 				BindParams:      map[string]interface{}{"role": "spanner.databaseAdmin"},
 			},
 		},
+		DashboardUrlTemplate: "https://console.cloud.google.com/spanner/instances/${instance.name}/details/databases?project=${broker.project_id}",
 		ProviderBuilder: func(projectId string, auth *jwt.Config, logger lager.Logger) broker.ServiceProvider {
 			bb := base.NewBrokerBase(projectId, auth, logger)
 			return &SpannerBroker{BrokerBase: bb}
@@ -107,7 +107,7 @@ func ServiceDefinition() *broker.ServiceDefinition {
 				FieldName: "name",
 				Type:      broker.JsonTypeString,
 				Details:   "The name of the bucket. There is a single global namespace shared by all buckets so it MUST be unique.",
-				Default:   "pcf_sb_${counter.next()}_${time.nano()}",
+				Default:   `${name.resource("storage_bucket", "pcf_sb", request.instance_id)}`,
 				Constraints: validation.NewConstraintBuilder(). // https://cloud.google.com/storage/docs/naming
 										Pattern("^[a-z0-9_.-]+$").
 										MinLength(3).
@@ -209,6 +209,7 @@ func ServiceDefinition() *broker.ServiceDefinition {
 			},
 		},
 		BindComputedVariables: accountmanagers.ServiceAccountBindComputedVariables(),
+		DashboardUrlTemplate:  "https://console.cloud.google.com/storage/browser/${instance.name}?project=${broker.project_id}",
 		ProviderBuilder: func(projectId string, auth *jwt.Config, logger lager.Logger) broker.ServiceProvider {
 			bb := base.NewBrokerBase(projectId, auth, logger)
 			return &StorageBroker{BrokerBase: bb}
@@ -16,6 +16,7 @@ package tf
 
 import (
 	"fmt"
+	"strings"
 
 	"code.cloudfoundry.org/lager"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
@@ -43,8 +44,22 @@ type TfServiceDefinitionV1 struct {
 	BindSettings      TfServiceDefinitionV1Action `yaml:"bind"`
 	Examples          []broker.ServiceExample     `yaml:"examples"`
 
+	// DashboardUrlTemplate is an optional HIL template for a URL users can
+	// visit to manage an instance, it can reference the provision outputs
+	// through instance.details e.g. ${instance.details["bucket_name"]}.
+	DashboardUrlTemplate string `yaml:"dashboard_url_template,omitempty"`
+
 	// Internal SHOULD be set to true for Google maintained services.
 	Internal bool `yaml:"-"`
+
+	// PakName and PakVersion identify the brokerpak the service was loaded
+	// from so instances can be upgraded when a new version is loaded.
+	PakName    string `yaml:"-"`
+	PakVersion string `yaml:"-"`
+
+	// GoogleCredentials is set if the brokerpak opted in to having the
+	// broker's Google credentials in Terraform's environment.
+	GoogleCredentials bool `yaml:"-"`
 }
 
 // TfServiceDefinitionV1Plan represents a service plan in a human-friendly format
@@ -116,6 +131,11 @@ func (action *TfServiceDefinitionV1Action) Validate() (errs *validation.FieldErr
 		errs = errs.Also(v.Validate().ViaFieldIndex("user_inputs", i))
 	}
 
+	errs = errs.Also(
+		broker.ValidateVariableRelationships(action.PlanInputs, nil).ViaField("plan_inputs"),
+		broker.ValidateVariableRelationships(action.UserInputs, action.PlanInputs).ViaField("user_inputs"),
+	)
+
 	for i, v := range action.Computed {
 		errs = errs.Also(v.Validate().ViaFieldIndex("computed_inputs", i))
 	}
@@ -133,6 +153,51 @@ func (action *TfServiceDefinitionV1Action) Validate() (errs *validation.FieldErr
 	return errs
 }
 
+// computedTypes holds the types computed inputs can be converted to.
+var computedTypes = map[string]bool{
+	string(broker.JsonTypeString):  true,
+	string(broker.JsonTypeNumeric): true,
+	string(broker.JsonTypeInteger): true,
+	string(broker.JsonTypeBoolean): true,
+	string(broker.JsonTypeObject):  true,
+	string(broker.JsonTypeArray):   true,
+}
+
+// validateComputedTypes checks that every computed input has a known type and
+// that it matches the type of any input with the same name. It's required for
+// version 2 definitions.
+func (action *TfServiceDefinitionV1Action) validateComputedTypes() (errs *validation.FieldError) {
+	inputTypes := make(map[string]broker.JsonType)
+	for _, in := range action.PlanInputs {
+		inputTypes[in.FieldName] = in.Type
+	}
+
+	for _, in := range action.UserInputs {
+		inputTypes[in.FieldName] = in.Type
+	}
+
+	for i, v := range action.Computed {
+		if v.Type == "" {
+			errs = errs.Also(validation.ErrMissingField("type").ViaFieldIndex("computed_inputs", i))
+			continue
+		}
+
+		if !computedTypes[v.Type] {
+			errs = errs.Also(validation.ErrInvalidValue(v.Type, "type").ViaFieldIndex("computed_inputs", i))
+			continue
+		}
+
+		if inputType, ok := inputTypes[v.Name]; ok && string(inputType) != v.Type {
+			errs = errs.Also((&validation.FieldError{
+				Message: fmt.Sprintf("type %q doesn't match the input with the same name, which is %q", v.Type, inputType),
+				Paths:   []string{"type"},
+			}).ViaFieldIndex("computed_inputs", i))
+		}
+	}
+
+	return errs
+}
+
 func (action *TfServiceDefinitionV1Action) ValidateTemplateIO() (errs *validation.FieldError) {
 	return errs.Also(
 		action.validateTemplateInputs().ViaField("template"),
@@ -207,7 +272,15 @@ var _ validation.Validatable = (*TfServiceDefinitionV1)(nil)
 // Validate checks the service definition for semantic errors.
 func (tfb *TfServiceDefinitionV1) Validate() (errs *validation.FieldError) {
 
-	if tfb.Version != 1 {
+	switch tfb.Version {
+	case 1:
+		// computed inputs may be untyped for compatibility
+	case 2:
+		errs = errs.Also(
+			tfb.ProvisionSettings.validateComputedTypes().ViaField("provision"),
+			tfb.BindSettings.validateComputedTypes().ViaField("bind"),
+		)
+	default:
 		errs = errs.Also(validation.ErrInvalidValue(tfb.Version, "version"))
 	}
 
@@ -221,6 +294,10 @@ func (tfb *TfServiceDefinitionV1) Validate() (errs *validation.FieldError) {
 		validation.ErrIfNotURL(tfb.SupportUrl, "support_url"),
 	)
 
+	if tfb.DashboardUrlTemplate != "" {
+		errs = errs.Also(validation.ErrIfNotHIL(tfb.DashboardUrlTemplate, "dashboard_url_template"))
+	}
+
 	for i, v := range tfb.Plans {
 		errs = errs.Also(v.Validate().ViaFieldIndex("plans", i))
 	}
@@ -268,6 +345,16 @@ func (tfb *TfServiceDefinitionV1) ToService(executor wrapper.TerraformExecutor)
 		Overwrite: true,
 	})
 
+	var maintenanceInfo *brokerapi.MaintenanceInfo
+	if tfb.PakVersion != "" {
+		maintenanceInfo = &brokerapi.MaintenanceInfo{
+			Public: map[string]string{
+				"brokerpak": tfb.PakName,
+				"version":   tfb.PakVersion,
+			},
+		}
+	}
+
 	constDefn := *tfb
 	return &broker.ServiceDefinition{
 		Id:               tfb.Id,
@@ -293,9 +380,12 @@ func (tfb *TfServiceDefinitionV1) ToService(executor wrapper.TerraformExecutor)
 		BindOutputVariables:   append(tfb.ProvisionSettings.Outputs, tfb.BindSettings.Outputs...),
 		PlanVariables:         append(tfb.ProvisionSettings.PlanInputs, tfb.BindSettings.PlanInputs...),
 		Examples:              tfb.Examples,
+		DashboardUrlTemplate:  tfb.DashboardUrlTemplate,
+		MaintenanceInfo:       maintenanceInfo,
 		ProviderBuilder: func(projectId string, auth *jwt.Config, logger lager.Logger) broker.ServiceProvider {
 			jobRunner := NewTfJobRunnerForProject(projectId)
 			jobRunner.Executor = executor
+			jobRunner.GoogleCredentials = constDefn.GoogleCredentials
 			return NewTerraformProvider(jobRunner, logger, constDefn)
 		},
 	}, nil
@@ -308,12 +398,23 @@ func generateTfId(instanceId, bindingId string) string {
 	return fmt.Sprintf("tf:%s:%s", instanceId, bindingId)
 }
 
+// ParseTfId gets the instance and binding IDs from an ID created by
+// generateTfId. The binding ID is blank for instance deployments.
+func ParseTfId(tfId string) (instanceId, bindingId string, err error) {
+	parts := strings.Split(tfId, ":")
+	if len(parts) != 3 || parts[0] != "tf" || parts[1] == "" {
+		return "", "", fmt.Errorf("malformed Terraform deployment ID: %q", tfId)
+	}
+
+	return parts[1], parts[2], nil
+}
+
 // NewExampleTfServiceDefinition creates a new service defintition with sample
 // values for the service broker suitable to give a user a template to manually
 // edit.
 func NewExampleTfServiceDefinition() TfServiceDefinitionV1 {
 	return TfServiceDefinitionV1{
-		Version:          1,
+		Version:          2,
 		Name:             "example-service",
 		Id:               "00000000-0000-0000-0000-000000000000",
 		Description:      "a longer service description",
@@ -378,8 +479,8 @@ func NewExampleTfServiceDefinition() TfServiceDefinitionV1 {
 				},
 			},
 			Computed: []varcontext.DefaultVariable{
-				{Name: "domain", Default: `${request.plan_properties["domain"]}`, Overwrite: true},
-				{Name: "address", Default: `${instance.details["email"]}`, Overwrite: true},
+				{Name: "domain", Default: `${request.plan_properties["domain"]}`, Overwrite: true, Type: "string"},
+				{Name: "address", Default: `${instance.details["email"]}`, Overwrite: true, Type: "string"},
 			},
 			Template: `
 			variable domain {type = "string"}
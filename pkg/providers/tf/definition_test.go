@@ -122,6 +122,71 @@ func TestNewExampleTfServiceDefinition(t *testing.T) {
 	}
 }
 
+func TestTfServiceDefinitionV1_Validate_version(t *testing.T) {
+	untyped := []varcontext.DefaultVariable{{Name: "domain", Default: "${1}"}}
+	mistyped := []varcontext.DefaultVariable{{Name: "username", Default: "${1}", Type: "integer"}}
+	unknownType := []varcontext.DefaultVariable{{Name: "domain", Default: "${1}", Type: "int"}}
+
+	cases := map[string]struct {
+		Version     int
+		Computed    []varcontext.DefaultVariable
+		ErrContains string
+	}{
+		"v1 untyped":      {Version: 1, Computed: untyped},
+		"v2 untyped":      {Version: 2, Computed: untyped, ErrContains: "missing field(s): provision.computed_inputs[0].type"},
+		"v2 mistyped":     {Version: 2, Computed: mistyped, ErrContains: `type "integer" doesn't match the input with the same name, which is "string": provision.computed_inputs[0].type`},
+		"v2 unknown type": {Version: 2, Computed: unknownType, ErrContains: "invalid value: int: provision.computed_inputs[0].type"},
+		"v3":              {Version: 3, ErrContains: "invalid value: 3: version"},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			definition := NewExampleTfServiceDefinition()
+			definition.Version = tc.Version
+			definition.ProvisionSettings.Computed = tc.Computed
+
+			err := definition.Validate()
+			switch {
+			case tc.ErrContains == "" && err != nil:
+				t.Fatalf("Expected no error, got: %v", err)
+			case tc.ErrContains != "" && (err == nil || !strings.Contains(err.Error(), tc.ErrContains)):
+				t.Fatalf("Expected error to contain %q, got: %v", tc.ErrContains, err)
+			}
+		})
+	}
+}
+
+func TestTfServiceDefinitionV1_Validate_relationships(t *testing.T) {
+	cases := map[string]struct {
+		DependsOn   []string
+		ErrContains string
+	}{
+		"no relationships": {},
+		"user input":       {DependsOn: []string{"username"}},
+		"plan input":       {DependsOn: []string{"domain"}, ErrContains: `invalid reference to variable "domain": provision.user_inputs[1].depends_on[0]`},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			definition := NewExampleTfServiceDefinition()
+			definition.ProvisionSettings.UserInputs = append(definition.ProvisionSettings.UserInputs, broker.BrokerVariable{
+				FieldName: "nickname",
+				Type:      broker.JsonTypeString,
+				Details:   "A nickname for the user",
+				DependsOn: tc.DependsOn,
+			})
+
+			err := definition.Validate()
+			switch {
+			case tc.ErrContains == "" && err != nil:
+				t.Fatalf("Expected no error, got: %v", err)
+			case tc.ErrContains != "" && (err == nil || !strings.Contains(err.Error(), tc.ErrContains)):
+				t.Fatalf("Expected error to contain %q, got: %v", tc.ErrContains, err)
+			}
+		})
+	}
+}
+
 func TestTfServiceDefinitionV1Plan_ToPlan(t *testing.T) {
 	cases := map[string]struct {
 		Definition TfServiceDefinitionV1Plan
@@ -177,6 +242,8 @@ func TestTfServiceDefinitionV1_ToService(t *testing.T) {
 		DocumentationUrl: "https://example.com/docs",
 		Plans:            []TfServiceDefinitionV1Plan{},
 
+		DashboardUrlTemplate: `https://example.com/dashboard/${instance.details["name"]}`,
+
 		ProvisionSettings: TfServiceDefinitionV1Action{
 			PlanInputs: []broker.BrokerVariable{
 				{
@@ -238,6 +305,7 @@ func TestTfServiceDefinitionV1_ToService(t *testing.T) {
 		expectEqual("SupportUrl", definition.SupportUrl, service.SupportUrl)
 		expectEqual("ImageUrl", definition.ImageUrl, service.ImageUrl)
 		expectEqual("Tags", definition.Tags, service.Tags)
+		expectEqual("DashboardUrlTemplate", definition.DashboardUrlTemplate, service.DashboardUrlTemplate)
 	})
 
 	t.Run("vars", func(t *testing.T) {
@@ -273,4 +341,47 @@ func TestTfServiceDefinitionV1_ToService(t *testing.T) {
 			t.Fatal("Expected provider builder to not be nil")
 		}
 	})
+
+	t.Run("maintenance-info", func(t *testing.T) {
+		expectEqual("MaintenanceInfo", (*brokerapi.MaintenanceInfo)(nil), service.MaintenanceInfo)
+
+		versioned := definition
+		versioned.PakName = "my-pak"
+		versioned.PakVersion = "1.2.3"
+		versionedService, err := versioned.ToService(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := &brokerapi.MaintenanceInfo{Public: map[string]string{"brokerpak": "my-pak", "version": "1.2.3"}}
+		expectEqual("MaintenanceInfo", expected, versionedService.MaintenanceInfo)
+	})
+}
+
+func TestParseTfId(t *testing.T) {
+	cases := map[string]struct {
+		TfId           string
+		ExpectInstance string
+		ExpectBinding  string
+		ExpectErr      bool
+	}{
+		"instance":     {TfId: generateTfId("instance", ""), ExpectInstance: "instance", ExpectBinding: ""},
+		"binding":      {TfId: generateTfId("instance", "binding"), ExpectInstance: "instance", ExpectBinding: "binding"},
+		"bad prefix":   {TfId: "xx:instance:", ExpectErr: true},
+		"no instance":  {TfId: "tf::binding", ExpectErr: true},
+		"wrong length": {TfId: "tf:instance", ExpectErr: true},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			instanceId, bindingId, err := ParseTfId(tc.TfId)
+			if (err != nil) != tc.ExpectErr {
+				t.Fatalf("Expected error? %t, got: %v", tc.ExpectErr, err)
+			}
+
+			if instanceId != tc.ExpectInstance || bindingId != tc.ExpectBinding {
+				t.Errorf("Expected (%q, %q) got (%q, %q)", tc.ExpectInstance, tc.ExpectBinding, instanceId, bindingId)
+			}
+		})
+	}
 }
@@ -67,6 +67,10 @@ type TfJobRunner struct {
 
 	// Executor holds a custom executor that will be called when commands are run.
 	Executor wrapper.TerraformExecutor
+
+	// GoogleCredentials sets GOOGLE_CREDENTIALS to the ServiceAccount and
+	// GOOGLE_PROJECT to the ProjectId in Terraform's environment.
+	GoogleCredentials bool
 }
 
 // StageJob stages a job to be executed. Before the workspace is saved to the
@@ -112,15 +116,15 @@ func (runner *TfJobRunner) hydrateWorkspace(ctx context.Context, deployment *mod
 		return nil, err
 	}
 
-	// TODO(josephlewis42) don't assume every pak needs Google specific creds
-	// GOOGLE_CREDENTIALS needs to be set to the JSON key and GOOGLE_PROJECT
-	// needs to be set to the project
-	env := map[string]string{
-		"GOOGLE_CREDENTIALS": runner.ServiceAccount,
-		"GOOGLE_PROJECT":     runner.ProjectId,
-	}
+	ws.Executor = runner.Executor
+	if runner.GoogleCredentials {
+		env := map[string]string{
+			"GOOGLE_CREDENTIALS": runner.ServiceAccount,
+			"GOOGLE_PROJECT":     runner.ProjectId,
+		}
 
-	ws.Executor = wrapper.CustomEnvironmentExecutor(env, runner.Executor)
+		ws.Executor = wrapper.CustomEnvironmentExecutor(env, runner.Executor)
+	}
 
 	logger := utils.NewLogger("job-runner")
 	logger.Info("wrapping", lager.Data{
@@ -143,16 +147,105 @@ func (runner *TfJobRunner) Create(ctx context.Context, id string) error {
 		return err
 	}
 
-	if err := runner.markJobStarted(ctx, deployment, models.ProvisionOperationType); err != nil {
+	return runner.apply(ctx, deployment, workspace, models.ProvisionOperationType)
+}
+
+// PlanUpgrade replaces the module in the given workspace with the template
+// and its inputs with templateVars then returns the output of
+// `terraform plan`. Nothing is saved.
+func (runner *TfJobRunner) PlanUpgrade(ctx context.Context, id, template string, templateVars map[string]interface{}) (string, error) {
+	deployment, err := db_service.GetTerraformDeploymentById(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	workspace, err := runner.hydrateWorkspace(ctx, deployment)
+	if err != nil {
+		return "", err
+	}
+
+	if err := workspace.UpgradeModule(template, templateVars); err != nil {
+		return "", err
+	}
+
+	return workspace.Plan()
+}
+
+// Upgrade replaces the module in the given workspace with the template from
+// the given brokerpak version and its inputs with templateVars then runs
+// `terraform apply` in the background.
+// The status of the job can be found by polling the Status function.
+func (runner *TfJobRunner) Upgrade(ctx context.Context, id, template string, templateVars map[string]interface{}, pakName, pakVersion string) error {
+	deployment, err := db_service.GetTerraformDeploymentById(ctx, id)
+	if err != nil {
 		return err
 	}
 
+	if deployment.LastOperationState == InProgress {
+		return fmt.Errorf("the %s operation on %q is still in progress", deployment.LastOperationType, id)
+	}
+
+	workspace, err := runner.hydrateWorkspace(ctx, deployment)
+	if err != nil {
+		return err
+	}
+
+	if err := workspace.UpgradeModule(template, templateVars); err != nil {
+		return err
+	}
+	workspace.PakName = pakName
+	workspace.PakVersion = pakVersion
+
+	return runner.apply(ctx, deployment, workspace, models.UpgradeOperationType)
+}
+
+// Update sets the given inputs of the workspace then runs `terraform apply`
+// in the background.
+// The status of the job can be found by polling the Status function.
+func (runner *TfJobRunner) Update(ctx context.Context, id string, inputs map[string]interface{}) error {
+	deployment, err := db_service.GetTerraformDeploymentById(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if deployment.LastOperationState == InProgress {
+		return fmt.Errorf("the %s operation on %q is still in progress", deployment.LastOperationType, id)
+	}
+
+	workspace, err := runner.hydrateWorkspace(ctx, deployment)
+	if err != nil {
+		return err
+	}
+
+	if err := workspace.UpdateInputs(inputs); err != nil {
+		return err
+	}
+
+	return runner.apply(ctx, deployment, workspace, models.UpdateOperationType)
+}
+
+// apply runs `terraform apply` on the workspace in the background and saves
+// it, including any changes to its modules, when it finishes.
+func (runner *TfJobRunner) apply(ctx context.Context, deployment *models.TerraformDeployment, workspace *wrapper.TerraformWorkspace, operationType string) error {
+	if err := runner.markJobStarted(ctx, deployment, operationType); err != nil {
+		return err
+	}
+
+	runner.runInBackground(workspace, deployment, workspace.Apply)
+
+	return nil
+}
+
+// runInBackground runs the Terraform operation in a goroutine tracked by
+// runningJobs and saves the workspace when it finishes.
+func (runner *TfJobRunner) runInBackground(workspace *wrapper.TerraformWorkspace, deployment *models.TerraformDeployment, operation func() error) {
+	runningJobs.start(deployment.ID)
 	go func() {
-		err := workspace.Apply()
+		defer runningJobs.finish(deployment.ID)
+
+		err := operation()
 		runner.operationFinished(err, workspace, deployment)
 	}()
-
-	return nil
 }
 
 // Destroy runs `terraform destroy` on the given workspace in the background.
@@ -172,14 +265,41 @@ func (runner *TfJobRunner) Destroy(ctx context.Context, id string) error {
 		return err
 	}
 
-	go func() {
-		err := workspace.Destroy()
-		runner.operationFinished(err, workspace, deployment)
-	}()
+	runner.runInBackground(workspace, deployment, workspace.Destroy)
 
 	return nil
 }
 
+// Retry re-runs the last operation of a failed job in the background.
+// Only provision, update, upgrade and deprovision operations can be retried.
+func (runner *TfJobRunner) Retry(ctx context.Context, id string) error {
+	deployment, err := db_service.GetTerraformDeploymentById(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if deployment.LastOperationState != Failed {
+		return fmt.Errorf("only failed jobs can be retried, the last %s operation on %q is %s", deployment.LastOperationType, id, deployment.LastOperationState)
+	}
+
+	switch deployment.LastOperationType {
+	case models.ProvisionOperationType:
+		return runner.Create(ctx, id)
+	case models.UpdateOperationType, models.UpgradeOperationType:
+		// failed updates and upgrades are saved with the new inputs and modules
+		// so they only need to be applied again
+		workspace, err := runner.hydrateWorkspace(ctx, deployment)
+		if err != nil {
+			return err
+		}
+		return runner.apply(ctx, deployment, workspace, deployment.LastOperationType)
+	case models.DeprovisionOperationType:
+		return runner.Destroy(ctx, id)
+	default:
+		return fmt.Errorf("%s operations can't be retried", deployment.LastOperationType)
+	}
+}
+
 // operationFinished closes out the state of the background job so clients that
 // are polling can get the results.
 func (runner *TfJobRunner) operationFinished(err error, workspace *wrapper.TerraformWorkspace, deployment *models.TerraformDeployment) error {
@@ -194,7 +314,7 @@ func (runner *TfJobRunner) operationFinished(err error, workspace *wrapper.Terra
 	workspaceString, err := workspace.Serialize()
 	if err != nil {
 		deployment.LastOperationState = Failed
-		deployment.LastOperationMessage = fmt.Sprintf("couldn't serialize workspace, contact your operator for cleanup: %s", err.Error())
+		deployment.LastOperationMessage = fmt.Sprintf("couldn't serialize workspace, the Terraform state was lost and resources must be cleaned up manually: %s", err.Error())
 	}
 
 	deployment.Workspace = workspaceString
@@ -236,6 +356,43 @@ func (runner *TfJobRunner) Outputs(ctx context.Context, id, instanceName string)
 	return ws.Outputs(instanceName)
 }
 
+// Inputs gets the inputs of the given instance in the workspace.
+func (runner *TfJobRunner) Inputs(ctx context.Context, id, instanceName string) (map[string]interface{}, error) {
+	deployment, err := db_service.GetTerraformDeploymentById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ws, err := wrapper.DeserializeWorkspace(deployment.Workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, instance := range ws.Instances {
+		if instance.InstanceName == instanceName {
+			return instance.Configuration, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no instance %q in the workspace of %q", instanceName, id)
+}
+
+// PakVersion gets the version of the brokerpak the workspace was last created
+// or upgraded with, it's blank for workspaces that predate versioning.
+func (runner *TfJobRunner) PakVersion(ctx context.Context, id string) (string, error) {
+	deployment, err := db_service.GetTerraformDeploymentById(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	ws, err := wrapper.DeserializeWorkspace(deployment.Workspace)
+	if err != nil {
+		return "", err
+	}
+
+	return ws.PakVersion, nil
+}
+
 // Wait waits for an operation to complete, polling its status once per second.
 func (runner *TfJobRunner) Wait(ctx context.Context, id string) error {
 	for {
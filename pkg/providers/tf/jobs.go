@@ -0,0 +1,203 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tf
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service"
+)
+
+// InterruptedMessage is set as the LastOperationMessage of jobs that were
+// still running when the broker shut down. The job is left in the InProgress
+// state so other brokers sharing the database don't see a result until
+// RecoverInterruptedJobs runs.
+const InterruptedMessage = "interrupted by broker shutdown"
+
+// runningJobs holds the background jobs started by every TfJobRunner in the
+// process.
+var runningJobs = newJobTracker()
+
+// jobTracker keeps track of background Terraform jobs so they can be drained
+// before the process exits.
+type jobTracker struct {
+	mu sync.Mutex
+	// jobs holds the number of running jobs per deployment ID.
+	jobs map[string]int
+}
+
+func newJobTracker() *jobTracker {
+	return &jobTracker{jobs: make(map[string]int)}
+}
+
+// start records that a job for the deployment with the given ID is running.
+func (tracker *jobTracker) start(id string) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.jobs[id]++
+}
+
+// finish records that the job for the deployment with the given ID is done.
+func (tracker *jobTracker) finish(id string) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	if tracker.jobs[id] == 0 {
+		return
+	}
+
+	tracker.jobs[id]--
+	if tracker.jobs[id] == 0 {
+		delete(tracker.jobs, id)
+	}
+}
+
+// runningOf returns the IDs of the given deployments that have a job running.
+func (tracker *jobTracker) runningOf(ids []string) []string {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	var running []string
+	for _, id := range ids {
+		if tracker.jobs[id] > 0 {
+			running = append(running, id)
+		}
+	}
+
+	return running
+}
+
+// running returns the IDs of the jobs that haven't finished sorted
+// lexicographically.
+func (tracker *jobTracker) running() []string {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	var ids []string
+	for id := range tracker.jobs {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+// wait blocks until all jobs finish or the context is done, polling every
+// interval. It returns the IDs of the jobs that were still running.
+func (tracker *jobTracker) wait(ctx context.Context, interval time.Duration) []string {
+	for {
+		running := tracker.running()
+		if len(running) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return running
+		case <-time.After(interval):
+		}
+	}
+}
+
+// waitFor blocks until none of the jobs with the given IDs are running or the
+// context is done, polling every interval. It returns the IDs of the jobs that
+// were still running.
+func (tracker *jobTracker) waitFor(ctx context.Context, ids []string, interval time.Duration) []string {
+	for {
+		running := tracker.runningOf(ids)
+		if len(running) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return running
+		case <-time.After(interval):
+		}
+	}
+}
+
+// WaitForRunningJobs blocks until the background Terraform jobs that are
+// running when it's called have finished or the context is done. Jobs started
+// afterwards aren't waited for. It returns the IDs of the jobs that were still
+// running when the context was done.
+func WaitForRunningJobs(ctx context.Context) []string {
+	return runningJobs.waitFor(ctx, runningJobs.running(), 100*time.Millisecond)
+}
+
+// WaitForJobs blocks until every background Terraform job has saved its
+// results or the context is done. Jobs still running when the context is done
+// are marked as interrupted so RecoverInterruptedJobs can close them out when
+// the broker restarts.
+//
+// The Terraform processes of interrupted jobs aren't signalled, they're
+// orphaned when the broker exits and keep running until they finish but
+// their state is never saved. Killing them part way through an apply would
+// leave the resources in a worse state than letting them finish.
+func WaitForJobs(ctx context.Context, logger lager.Logger) error {
+	logger.Info("waiting-for-jobs", lager.Data{"jobs": runningJobs.running()})
+
+	interrupted := runningJobs.wait(ctx, 100*time.Millisecond)
+	if len(interrupted) == 0 {
+		return nil
+	}
+
+	for _, id := range interrupted {
+		logger.Info("job-interrupted", lager.Data{"id": id})
+
+		// The job may finish between the deadline and now so only the message
+		// is set and only if it's still running.
+		if _, err := db_service.UpdateTerraformDeploymentMessage(context.Background(), id, InProgress, InterruptedMessage); err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("%d Terraform job(s) were interrupted: %v", len(interrupted), interrupted)
+}
+
+// RecoverInterruptedJobs fails jobs that were interrupted by a previous broker
+// shutdown so the platform stops polling them and the operation can be
+// retried.
+func RecoverInterruptedJobs(ctx context.Context, logger lager.Logger) error {
+	deployments, err := db_service.ListTerraformDeploymentsByState(ctx, InProgress)
+	if err != nil {
+		return err
+	}
+
+	for _, deployment := range deployments {
+		if deployment.LastOperationMessage != InterruptedMessage {
+			continue
+		}
+
+		logger.Info("recovering-interrupted-job", lager.Data{
+			"id":        deployment.ID,
+			"operation": deployment.LastOperationType,
+		})
+
+		deployment.LastOperationState = Failed
+		deployment.LastOperationMessage = fmt.Sprintf("the %s operation was interrupted by a broker shutdown, the Terraform state may be incomplete", deployment.LastOperationType)
+		if err := db_service.SaveTerraformDeployment(ctx, &deployment); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tf
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJobTracker(t *testing.T) {
+	cases := map[string]struct {
+		Started  []string
+		Finished []string
+		Expected []string
+	}{
+		"no jobs": {
+			Expected: nil,
+		},
+		"all finished": {
+			Started:  []string{"a", "b"},
+			Finished: []string{"b", "a"},
+			Expected: nil,
+		},
+		"some running": {
+			Started:  []string{"c", "b", "a"},
+			Finished: []string{"b"},
+			Expected: []string{"a", "c"},
+		},
+		"same deployment twice": {
+			Started:  []string{"a", "a"},
+			Finished: []string{"a"},
+			Expected: []string{"a"},
+		},
+		"unknown finished": {
+			Started:  []string{"a"},
+			Finished: []string{"z", "z"},
+			Expected: []string{"a"},
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			tracker := newJobTracker()
+			for _, id := range tc.Started {
+				tracker.start(id)
+			}
+			for _, id := range tc.Finished {
+				tracker.finish(id)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			actual := tracker.wait(ctx, time.Millisecond)
+			if !reflect.DeepEqual(tc.Expected, actual) {
+				t.Errorf("Expected running jobs: %v got: %v", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func TestJobTracker_waitForFinish(t *testing.T) {
+	tracker := newJobTracker()
+	tracker.start("a")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		tracker.finish("a")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if running := tracker.wait(ctx, time.Millisecond); running != nil {
+		t.Errorf("Expected all jobs to finish, got: %v", running)
+	}
+}
+
+func TestJobTracker_waitFor(t *testing.T) {
+	tracker := newJobTracker()
+	tracker.start("a")
+	tracker.start("b")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		tracker.finish("a")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if running := tracker.waitFor(ctx, []string{"a"}, time.Millisecond); running != nil {
+		t.Fatalf("Expected waitFor to return when job a finished, got: %v", running)
+	}
+
+	if running := tracker.running(); !reflect.DeepEqual(running, []string{"b"}) {
+		t.Errorf("Expected job b to still be running, got: %v", running)
+	}
+}
+
+func TestJobTracker_waitForTimeout(t *testing.T) {
+	tracker := newJobTracker()
+	tracker.start("a")
+	tracker.start("b")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if running := tracker.waitFor(ctx, []string{"b"}, time.Millisecond); !reflect.DeepEqual(running, []string{"b"}) {
+		t.Errorf("Expected job b to still be running, got: %v", running)
+	}
+}
@@ -16,8 +16,12 @@ package tf
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 
 	"code.cloudfoundry.org/lager"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service/models"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/builtin/base"
@@ -47,7 +51,7 @@ type terraformProvider struct {
 // needs to operate.
 func (provider *terraformProvider) Provision(ctx context.Context, provisionContext *varcontext.VarContext) (models.ServiceInstanceDetails, error) {
 	provider.logger.Info("provision", lager.Data{
-		"context": provisionContext.ToMap(),
+		"context": provisionContext.Redacted(),
 	})
 
 	tfId, err := provider.create(ctx, provisionContext, provider.serviceDefinition.ProvisionSettings)
@@ -64,7 +68,7 @@ func (provider *terraformProvider) Provision(ctx context.Context, provisionConte
 // Bind creates a new backing Terraform job and executes it, waiting on the result.
 func (provider *terraformProvider) Bind(ctx context.Context, bindContext *varcontext.VarContext) (map[string]interface{}, error) {
 	provider.logger.Info("bind", lager.Data{
-		"context": bindContext.ToMap(),
+		"context": bindContext.Redacted(),
 	})
 
 	tfId, err := provider.create(ctx, bindContext, provider.serviceDefinition.BindSettings)
@@ -79,6 +83,18 @@ func (provider *terraformProvider) Bind(ctx context.Context, bindContext *varcon
 	return provider.jobRunner.Outputs(ctx, tfId, wrapper.DefaultInstanceName)
 }
 
+// ProvisionDefinition gets the Terraform instance definition a provision with
+// the given variables would apply, without running anything. Secrets are
+// redacted so the definition is safe to print.
+func (provider *terraformProvider) ProvisionDefinition(vars *varcontext.VarContext) (json.RawMessage, error) {
+	workspace, err := wrapper.NewWorkspace(vars.Redacted(), provider.serviceDefinition.ProvisionSettings.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	return workspace.Instances[0].MarshalDefinition()
+}
+
 func (provider *terraformProvider) create(ctx context.Context, vars *varcontext.VarContext, action TfServiceDefinitionV1Action) (string, error) {
 	tfId := vars.GetString("tf_id")
 	if err := vars.Error(); err != nil {
@@ -89,6 +105,8 @@ func (provider *terraformProvider) create(ctx context.Context, vars *varcontext.
 	if err != nil {
 		return tfId, err
 	}
+	workspace.PakName = provider.serviceDefinition.PakName
+	workspace.PakVersion = provider.serviceDefinition.PakVersion
 
 	if err := provider.jobRunner.StageJob(ctx, tfId, workspace); err != nil {
 		return tfId, err
@@ -156,3 +174,258 @@ func (provider *terraformProvider) UpdateInstanceDetails(ctx context.Context, in
 
 	return instance.SetOtherDetails(outs)
 }
+
+// RetryJob re-runs the last failed operation on the Terraform deployment with
+// the given ID.
+func (provider *terraformProvider) RetryJob(ctx context.Context, deploymentId string) error {
+	provider.logger.Info("retry-job", lager.Data{
+		"deployment_id": deploymentId,
+	})
+
+	return provider.jobRunner.Retry(ctx, deploymentId)
+}
+
+// UpgradeStatus describes the brokerpak version a Terraform deployment was
+// created with and the changes upgrading it would make.
+type UpgradeStatus struct {
+	CurrentVersion   string `json:"current_version"`
+	AvailableVersion string `json:"available_version"`
+	Plan             string `json:"plan"`
+}
+
+// PlanUpgrade shows the changes upgrading the Terraform deployment to the
+// version of the brokerpak the service was loaded from would make.
+func (provider *terraformProvider) PlanUpgrade(ctx context.Context, deploymentId string) (*UpgradeStatus, error) {
+	action, err := provider.actionFor(deploymentId)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := provider.jobRunner.PakVersion(ctx, deploymentId)
+	if err != nil {
+		return nil, err
+	}
+
+	templateVars, err := provider.upgradeVariables(ctx, deploymentId)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := provider.jobRunner.PlanUpgrade(ctx, deploymentId, action.Template, templateVars)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UpgradeStatus{
+		CurrentVersion:   current,
+		AvailableVersion: provider.serviceDefinition.PakVersion,
+		Plan:             plan,
+	}, nil
+}
+
+// UpgradeJob upgrades the Terraform deployment to the version of the
+// brokerpak the service was loaded from in the background.
+func (provider *terraformProvider) UpgradeJob(ctx context.Context, deploymentId string) error {
+	provider.logger.Info("upgrade-job", lager.Data{
+		"deployment_id": deploymentId,
+		"version":       provider.serviceDefinition.PakVersion,
+	})
+
+	action, err := provider.actionFor(deploymentId)
+	if err != nil {
+		return err
+	}
+
+	templateVars, err := provider.upgradeVariables(ctx, deploymentId)
+	if err != nil {
+		return err
+	}
+
+	return provider.jobRunner.Upgrade(ctx, deploymentId, action.Template, templateVars, provider.serviceDefinition.PakName, provider.serviceDefinition.PakVersion)
+}
+
+// upgradeVariables resolves the variables of the Terraform deployment through
+// the service definition the provider was loaded from so inputs added by the
+// upgrade get values.
+//
+// Instances are resolved against their stored provision request. Bind
+// requests aren't stored so bindings are resolved against the user inputs
+// their workspace already has.
+func (provider *terraformProvider) upgradeVariables(ctx context.Context, deploymentId string) (map[string]interface{}, error) {
+	instanceId, bindingId, err := ParseTfId(deploymentId)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, err := db_service.GetServiceInstanceDetailsById(ctx, instanceId)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get instance %q: %v", instanceId, err)
+	}
+
+	svc, err := provider.serviceDefinition.ToService(provider.jobRunner.Executor)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := svc.GetPlanById(instance.PlanId)
+	if err != nil {
+		return nil, err
+	}
+
+	var vars *varcontext.VarContext
+	if bindingId == "" {
+		vars, err = provisionUpgradeVariables(ctx, svc, *instance, *plan)
+	} else {
+		vars, err = provider.bindUpgradeVariables(ctx, svc, *instance, bindingId, plan)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't resolve the variables of %q with version %q: %v", deploymentId, provider.serviceDefinition.PakVersion, err)
+	}
+
+	return vars.ToMap(), nil
+}
+
+// provisionUpgradeVariables resolves the variables of the instance against its
+// stored provision request.
+func provisionUpgradeVariables(ctx context.Context, svc *broker.ServiceDefinition, instance models.ServiceInstanceDetails, plan broker.ServicePlan) (*varcontext.VarContext, error) {
+	request, err := db_service.GetProvisionRequestDetailsByServiceInstanceId(ctx, instance.ID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get the provision request: %v", err)
+	}
+
+	return svc.ProvisionVariables(instance.ID, brokerapi.ProvisionDetails{
+		ServiceID:        instance.ServiceId,
+		PlanID:           instance.PlanId,
+		OrganizationGUID: instance.OrganizationGuid,
+		SpaceGUID:        instance.SpaceGuid,
+		RawParameters:    json.RawMessage(request.RequestDetails),
+	}, plan)
+}
+
+// bindUpgradeVariables resolves the variables of the binding against the user
+// inputs its workspace already has.
+func (provider *terraformProvider) bindUpgradeVariables(ctx context.Context, svc *broker.ServiceDefinition, instance models.ServiceInstanceDetails, bindingId string, plan *broker.ServicePlan) (*varcontext.VarContext, error) {
+	inputs, err := provider.jobRunner.Inputs(ctx, generateTfId(instance.ID, bindingId), wrapper.DefaultInstanceName)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make(map[string]interface{})
+	for _, v := range svc.BindInputVariables {
+		if val, ok := inputs[v.FieldName]; ok && val != nil {
+			params[v.FieldName] = val
+		}
+	}
+
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.BindVariables(instance, bindingId, brokerapi.BindDetails{
+		ServiceID:     instance.ServiceId,
+		PlanID:        instance.PlanId,
+		RawParameters: rawParams,
+	}, plan)
+}
+
+// UpgradeInstance upgrades the instance to the version of the brokerpak the
+// service was loaded from. The ID of the upgrade operation is returned or nil
+// if the instance is already up to date.
+//
+// Only the instance's deployment is upgraded. The upgrade is refused until
+// each of its bindings has been upgraded through the admin API so the
+// instance never runs a newer version than its bindings expect.
+func (provider *terraformProvider) UpgradeInstance(ctx context.Context, instance models.ServiceInstanceDetails) (*string, error) {
+	tfId := generateTfId(instance.ID, "")
+	version := provider.serviceDefinition.PakVersion
+
+	current, err := provider.jobRunner.PakVersion(ctx, tfId)
+	if err != nil {
+		return nil, err
+	}
+
+	if current == version {
+		return nil, nil
+	}
+
+	bindings, err := db_service.ListServiceBindingCredentialsByServiceInstanceId(ctx, instance.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var outdated []string
+	for _, binding := range bindings {
+		bindingTfId := generateTfId(instance.ID, binding.BindingId)
+		bindingVersion, err := provider.jobRunner.PakVersion(ctx, bindingTfId)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get the version of binding %q: %v", binding.BindingId, err)
+		}
+
+		if bindingVersion != version {
+			outdated = append(outdated, bindingTfId)
+		}
+	}
+
+	if len(outdated) > 0 {
+		return nil, fmt.Errorf("can't upgrade instance %q to version %q while its bindings are on older versions, upgrade them first with POST /admin/tf/{deployment_id}/upgrade: %s", instance.ID, version, strings.Join(outdated, ", "))
+	}
+
+	if err := provider.UpgradeJob(ctx, tfId); err != nil {
+		return nil, err
+	}
+
+	return &tfId, nil
+}
+
+// UpdateInstance sets the changed inputs of the instance's deployment to their
+// values in vars and applies it. Inputs that weren't changed, including
+// computed ones, keep their existing values.
+//
+// The instance must already be on the version of the brokerpak the service
+// was loaded from so its parameters match the published update schema.
+func (provider *terraformProvider) UpdateInstance(ctx context.Context, instance models.ServiceInstanceDetails, vars *varcontext.VarContext, changed []string) (*string, error) {
+	tfId := generateTfId(instance.ID, "")
+	version := provider.serviceDefinition.PakVersion
+
+	current, err := provider.jobRunner.PakVersion(ctx, tfId)
+	if err != nil {
+		return nil, err
+	}
+
+	if current != version {
+		return nil, fmt.Errorf("instance %q must be upgraded to version %q before its parameters can be changed", instance.ID, version)
+	}
+
+	values := vars.ToMap()
+	inputs := make(map[string]interface{})
+	for _, name := range changed {
+		inputs[name] = values[name]
+	}
+
+	provider.logger.Info("update-instance", lager.Data{
+		"instance": instance.ID,
+		"changed":  changed,
+	})
+
+	if err := provider.jobRunner.Update(ctx, tfId, inputs); err != nil {
+		return nil, err
+	}
+
+	return &tfId, nil
+}
+
+// actionFor gets the action that created the Terraform deployment.
+func (provider *terraformProvider) actionFor(deploymentId string) (*TfServiceDefinitionV1Action, error) {
+	_, bindingId, err := ParseTfId(deploymentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if bindingId == "" {
+		return &provider.serviceDefinition.ProvisionSettings, nil
+	}
+
+	return &provider.serviceDefinition.BindSettings, nil
+}
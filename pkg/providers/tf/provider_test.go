@@ -0,0 +1,262 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tf
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service/models"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf/wrapper"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/varcontext"
+	"github.com/jinzhu/gorm"
+)
+
+func TestTerraformProvider_ProvisionDefinition(t *testing.T) {
+	provider := NewTerraformProvider(nil, lager.NewLogger("test"), NewExampleTfServiceDefinition()).(*terraformProvider)
+
+	vc, err := varcontext.Builder().MergeMap(map[string]interface{}{
+		"domain":   "example.com",
+		"username": "someone",
+		"tf_id":    "tf:instance:",
+	}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	definition, err := provider.ProvisionDefinition(vc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual map[string]interface{}
+	if err := json.Unmarshal(definition, &actual); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the inputs the template declares are passed to Terraform
+	expected := map[string]interface{}{
+		"module": map[string]interface{}{
+			"instance": map[string]interface{}{
+				"domain":   "example.com",
+				"username": "someone",
+				"source":   "brokertemplate",
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected definition %v, got %v", expected, actual)
+	}
+}
+
+func TestTerraformProvider_ProvisionDefinition_redacted(t *testing.T) {
+	os.Setenv("PROVIDER_TEST_USERNAME", "hunter2")
+	defer os.Unsetenv("PROVIDER_TEST_USERNAME")
+
+	provider := NewTerraformProvider(nil, lager.NewLogger("test"), NewExampleTfServiceDefinition()).(*terraformProvider)
+
+	vc, err := varcontext.Builder().
+		ResolveReferences().
+		MergeMap(map[string]interface{}{
+			"username": map[string]interface{}{"$ref": "env://PROVIDER_TEST_USERNAME"},
+			"tf_id":    "tf:instance:",
+		}).
+		MergeDefaults([]varcontext.DefaultVariable{{Name: "domain", Default: "${username}.example.com"}}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	definition, err := provider.ProvisionDefinition(vc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(definition), "hunter2") {
+		t.Errorf("Expected the definition not to hold the secret, got %s", definition)
+	}
+
+	var actual map[string]interface{}
+	if err := json.Unmarshal(definition, &actual); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"module": map[string]interface{}{
+			"instance": map[string]interface{}{
+				"domain":   map[string]interface{}{"$computed_from": []interface{}{"username"}},
+				"username": map[string]interface{}{"$ref": "env://PROVIDER_TEST_USERNAME"},
+				"source":   "brokertemplate",
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected definition %v, got %v", expected, actual)
+	}
+}
+
+// newUpgradeTestProvider creates a provider for version 2.0 of the example
+// service backed by a database holding an instance and a binding that were
+// created with version 1.0.
+func newUpgradeTestProvider(t *testing.T) (provider *terraformProvider, closer func()) {
+	dir, err := ioutil.TempDir("", "provider-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := gorm.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("couldn't create database: %v", err)
+	}
+	if err := db_service.RunMigrations(db); err != nil {
+		t.Fatalf("couldn't migrate database: %v", err)
+	}
+	db_service.DbConnection = db
+
+	defn := NewExampleTfServiceDefinition()
+	defn.PakVersion = "2.0"
+
+	ctx := context.Background()
+	instance := models.ServiceInstanceDetails{
+		ID:           "upgrade-instance",
+		ServiceId:    defn.Id,
+		PlanId:       defn.Plans[0].Id,
+		OtherDetails: `{"email":"alice@example.com"}`,
+	}
+	if err := db_service.CreateServiceInstanceDetails(ctx, &instance); err != nil {
+		t.Fatal(err)
+	}
+
+	request := models.ProvisionRequestDetails{ServiceInstanceId: instance.ID, RequestDetails: `{"username":"alice"}`}
+	if err := db_service.CreateProvisionRequestDetails(ctx, &request); err != nil {
+		t.Fatal(err)
+	}
+
+	binding := models.ServiceBindingCredentials{ServiceInstanceId: instance.ID, BindingId: "upgrade-binding"}
+	if err := db_service.CreateServiceBindingCredentials(ctx, &binding); err != nil {
+		t.Fatal(err)
+	}
+
+	// version 1.0 of the instance didn't have the username input
+	workspaces := map[string]*wrapper.TerraformWorkspace{}
+	workspaces["tf:upgrade-instance:"], err = wrapper.NewWorkspace(map[string]interface{}{"domain": "example.com"}, `variable domain {type = "string"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	workspaces["tf:upgrade-instance:upgrade-binding"], err = wrapper.NewWorkspace(map[string]interface{}{"domain": "example.com"}, `variable domain {type = "string"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, ws := range workspaces {
+		ws.PakVersion = "1.0"
+		serialized, err := ws.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		deployment := models.TerraformDeployment{ID: id, Workspace: serialized, LastOperationState: Succeeded}
+		if err := db_service.CreateTerraformDeployment(ctx, &deployment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	provider = NewTerraformProvider(NewTfJobRunnerForProject("test-project"), lager.NewLogger("test"), defn).(*terraformProvider)
+	return provider, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestTerraformProvider_upgradeVariables(t *testing.T) {
+	cases := map[string]struct {
+		DeploymentId string
+		Expected     map[string]interface{}
+	}{
+		"instance": {
+			DeploymentId: "tf:upgrade-instance:",
+			Expected:     map[string]interface{}{"domain": "example.com", "username": "alice"},
+		},
+		"binding": {
+			DeploymentId: "tf:upgrade-instance:upgrade-binding",
+			Expected:     map[string]interface{}{"domain": "example.com", "address": "alice@example.com", "password_special_chars": `@/ \"?`},
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			provider, closer := newUpgradeTestProvider(t)
+			defer closer()
+
+			actual, err := provider.upgradeVariables(context.Background(), tc.DeploymentId)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for k, v := range tc.Expected {
+				if !reflect.DeepEqual(actual[k], v) {
+					t.Errorf("Expected %s to be %v, got %v", k, v, actual[k])
+				}
+			}
+		})
+	}
+}
+
+func TestTerraformProvider_UpgradeInstance_outdatedBindings(t *testing.T) {
+	provider, closer := newUpgradeTestProvider(t)
+	defer closer()
+
+	instance, err := db_service.GetServiceInstanceDetailsById(context.Background(), "upgrade-instance")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = provider.UpgradeInstance(context.Background(), *instance)
+	expected := `can't upgrade instance "upgrade-instance" to version "2.0" while its bindings are on older versions, upgrade them first with POST /admin/tf/{deployment_id}/upgrade: tf:upgrade-instance:upgrade-binding`
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error: %q, got: %v", expected, err)
+	}
+}
+
+func TestTerraformProvider_UpdateInstance_outdated(t *testing.T) {
+	provider, closer := newUpgradeTestProvider(t)
+	defer closer()
+
+	instance, err := db_service.GetServiceInstanceDetailsById(context.Background(), "upgrade-instance")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars, err := varcontext.Builder().MergeMap(map[string]interface{}{"username": "bob"}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = provider.UpdateInstance(context.Background(), *instance, vars, []string{"username"})
+	expected := `instance "upgrade-instance" must be upgraded to version "2.0" before its parameters can be changed`
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error: %q, got: %v", expected, err)
+	}
+}
@@ -48,6 +48,33 @@ func (module *ModuleDefinition) Inputs() ([]string, error) {
 	return sortedKeys(defn.Inputs), nil
 }
 
+// RequiredInputs gets the names of the module's input parameters that don't
+// have a default.
+func (module *ModuleDefinition) RequiredInputs() ([]string, error) {
+	defn := terraformModuleHcl{}
+	if err := hcl.Decode(&defn, module.Definition); err != nil {
+		return nil, err
+	}
+
+	var required []string
+	for _, name := range sortedKeys(defn.Inputs) {
+		blocks, _ := defn.Inputs[name].([]map[string]interface{})
+
+		hasDefault := false
+		for _, block := range blocks {
+			if _, ok := block["default"]; ok {
+				hasDefault = true
+			}
+		}
+
+		if !hasDefault {
+			required = append(required, name)
+		}
+	}
+
+	return required, nil
+}
+
 // Outputs gets the output parameter names for the module.
 func (module *ModuleDefinition) Outputs() ([]string, error) {
 	defn := terraformModuleHcl{}
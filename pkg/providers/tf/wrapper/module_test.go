@@ -43,6 +43,25 @@ func ExampleModuleDefinition_Inputs() {
 	// Output: [name storage_class]
 }
 
+func ExampleModuleDefinition_RequiredInputs() {
+	module := ModuleDefinition{
+		Name: "cloud_storage",
+		Definition: `
+    variable name {type = "string"}
+    variable storage_class {type = "string" default = "STANDARD"}
+    variable labels {type = "map"}
+`,
+	}
+
+	inputs, err := module.RequiredInputs()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%v\n", inputs)
+
+	// Output: [labels name]
+}
+
 func ExampleModuleDefinition_Outputs() {
 	module := ModuleDefinition{
 		Name: "cloud_storage",
@@ -15,9 +15,11 @@
 package wrapper
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -102,6 +104,12 @@ type TerraformWorkspace struct {
 	Instances []ModuleInstance   `json:"instances"`
 	State     []byte             `json:"tfstate"`
 
+	// PakName and PakVersion identify the brokerpak the modules came from so
+	// the workspace can be upgraded when a new version is installed. They're
+	// blank for workspaces created before they were recorded.
+	PakName    string `json:"pak_name,omitempty"`
+	PakVersion string `json:"pak_version,omitempty"`
+
 	// Executor is a function that gets invoked to shell out to Terraform.
 	// If left nil, the default executor is used.
 	Executor TerraformExecutor `json:"-"`
@@ -274,17 +282,121 @@ func (workspace *TerraformWorkspace) Destroy() error {
 	return workspace.runTf("destroy", "-auto-approve", "-no-color")
 }
 
+// Plan runs `terraform plan` on this workspace and returns its output.
+// This funciton blocks if another Terraform command is running on this workspace.
+func (workspace *TerraformWorkspace) Plan() (string, error) {
+	err := workspace.initializeFs()
+	defer workspace.teardownFs()
+	if err != nil {
+		return "", err
+	}
+
+	var output bytes.Buffer
+	err = workspace.runTfWithOutput(&output, "plan", "-input=false", "-no-color")
+	return output.String(), err
+}
+
+// UpgradeModule replaces the definition of the workspace's module with the
+// template and sets each instance's inputs from templateVars, which should be
+// resolved against the service definition the template came from.
+//
+// Inputs the instance already had keep their values so computed values like
+// generated passwords aren't replaced. The upgrade is rejected if an input
+// without a default in the template can't be resolved.
+func (workspace *TerraformWorkspace) UpgradeModule(terraformTemplate string, templateVars map[string]interface{}) error {
+	if len(workspace.Modules) != 1 {
+		return fmt.Errorf("only workspaces with a single module can be upgraded, got %d", len(workspace.Modules))
+	}
+
+	module := ModuleDefinition{
+		Name:       workspace.Modules[0].Name,
+		Definition: terraformTemplate,
+	}
+
+	inputList, err := module.Inputs()
+	if err != nil {
+		return err
+	}
+
+	requiredList, err := module.RequiredInputs()
+	if err != nil {
+		return err
+	}
+
+	for i, instance := range workspace.Instances {
+		upgradedConfig := make(map[string]interface{})
+		for _, name := range inputList {
+			if val, ok := instance.Configuration[name]; ok && val != nil {
+				upgradedConfig[name] = val
+			} else if val, ok := templateVars[name]; ok && val != nil {
+				upgradedConfig[name] = val
+			}
+		}
+
+		var unresolved []string
+		for _, name := range requiredList {
+			if _, ok := upgradedConfig[name]; !ok {
+				unresolved = append(unresolved, name)
+			}
+		}
+
+		if len(unresolved) > 0 {
+			return fmt.Errorf("the upgrade adds required inputs that can't be resolved: %s", strings.Join(unresolved, ", "))
+		}
+
+		workspace.Instances[i].Configuration = upgradedConfig
+	}
+
+	workspace.Modules[0] = module
+	return nil
+}
+
+// UpdateInputs sets the inputs of each instance that are in values, other
+// inputs keep their existing values.
+func (workspace *TerraformWorkspace) UpdateInputs(values map[string]interface{}) error {
+	if len(workspace.Modules) != 1 {
+		return fmt.Errorf("only workspaces with a single module can be updated, got %d", len(workspace.Modules))
+	}
+
+	inputList, err := workspace.Modules[0].Inputs()
+	if err != nil {
+		return err
+	}
+
+	for i, instance := range workspace.Instances {
+		if instance.Configuration == nil {
+			workspace.Instances[i].Configuration = make(map[string]interface{})
+		}
+
+		for _, name := range inputList {
+			if val, ok := values[name]; ok {
+				workspace.Instances[i].Configuration[name] = val
+			}
+		}
+	}
+
+	return nil
+}
+
 func (workspace *TerraformWorkspace) tfStatePath() string {
 	return path.Join(workspace.dir, "terraform.tfstate")
 }
 
 func (workspace *TerraformWorkspace) runTf(subCommand string, args ...string) error {
+	return workspace.runTfWithOutput(nil, subCommand, args...)
+}
+
+// runTfWithOutput runs Terraform, copying its combined output to out if it's
+// not nil.
+func (workspace *TerraformWorkspace) runTfWithOutput(out io.Writer, subCommand string, args ...string) error {
 	sub := []string{subCommand}
 	sub = append(sub, args...)
 
 	c := exec.Command("terraform", sub...)
-	c.Env = os.Environ()
+	c.Env = baseEnvironment()
 	c.Dir = workspace.dir
+	c.Stdout = out
+	c.Stderr = out
 
 	executor := DefaultExecutor
 	if workspace.Executor != nil {
@@ -294,6 +406,31 @@ func (workspace *TerraformWorkspace) runTf(subCommand string, args ...string) er
 	return executor(c)
 }
 
+// inheritedEnvironment is the list of the broker's environment variables
+// Terraform inherits. Everything else, including the broker's own credentials,
+// must be passed explicitly with a CustomEnvironmentExecutor.
+//
+// The proxy and CA variables are needed for the providers to reach their APIs
+// from networks that require them.
+var inheritedEnvironment = []string{
+	"PATH", "HOME", "TMPDIR",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY",
+	"http_proxy", "https_proxy", "no_proxy",
+	"SSL_CERT_FILE", "SSL_CERT_DIR",
+}
+
+// baseEnvironment gets the minimal environment Terraform runs with.
+func baseEnvironment() []string {
+	var env []string
+	for _, name := range inheritedEnvironment {
+		if val, ok := os.LookupEnv(name); ok {
+			env = append(env, fmt.Sprintf("%s=%s", name, val))
+		}
+	}
+
+	return env
+}
+
 // CustomEnvironmentExecutor sets custom environment variables on the Terraform
 // execution.
 func CustomEnvironmentExecutor(environment map[string]string, wrapped TerraformExecutor) TerraformExecutor {
@@ -325,12 +462,15 @@ func CustomTerraformExecutor(tfBinaryPath, tfPluginDir string, wrapped Terraform
 		newCmd := exec.Command(tfBinaryPath, allArgs...)
 		newCmd.Dir = c.Dir
 		newCmd.Env = c.Env
+		newCmd.Stdout = c.Stdout
+		newCmd.Stderr = c.Stderr
 		return wrapped(newCmd)
 	}
 }
 
 // DefaultExecutor is the default executor that shells out to Terraform
-// and logs results to stdout.
+// and logs results to stdout. If the command's Stdout is set, the combined
+// output is also copied to it.
 func DefaultExecutor(c *exec.Cmd) error {
 	logger := utils.NewLogger("terraform@" + c.Dir)
 
@@ -339,9 +479,20 @@ func DefaultExecutor(c *exec.Cmd) error {
 		"args": c.Args,
 		"dir":  c.Dir,
 	})
-	output, err := c.CombinedOutput()
+
+	// Stdout and Stderr are set to the same writer so exec copies them with a
+	// single goroutine.
+	var output bytes.Buffer
+	var combined io.Writer = &output
+	if c.Stdout != nil {
+		combined = io.MultiWriter(&output, c.Stdout)
+	}
+	c.Stdout = combined
+	c.Stderr = combined
+
+	err := c.Run()
 	logger.Info("results", lager.Data{
-		"output": string(output),
+		"output": output.String(),
 		"error":  err,
 	})
 
@@ -21,6 +21,7 @@ import (
 	"os/exec"
 	"path"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -42,6 +43,9 @@ func TestTerraformWorkspace_Invariants(t *testing.T) {
 		"destroy": {Exec: func(ws *TerraformWorkspace) {
 			ws.Destroy()
 		}},
+		"plan": {Exec: func(ws *TerraformWorkspace) {
+			ws.Plan()
+		}},
 	}
 
 	for tn, tc := range cases {
@@ -161,3 +165,183 @@ func TestCustomEnvironmentExecutor(t *testing.T) {
 		fmt.Errorf("Expected %v actual %v", expected, actual)
 	}
 }
+
+func TestTerraformWorkspace_environment(t *testing.T) {
+	os.Setenv("ROOT_SERVICE_ACCOUNT_JSON", "broker-secret")
+	defer os.Unsetenv("ROOT_SERVICE_ACCOUNT_JSON")
+	os.Setenv("HTTPS_PROXY", "http://proxy.example.com:3128")
+	defer os.Unsetenv("HTTPS_PROXY")
+	os.Setenv("SSL_CERT_FILE", "/etc/ssl/custom.pem")
+	defer os.Unsetenv("SSL_CERT_FILE")
+
+	ws, err := NewWorkspace(map[string]interface{}{}, ``)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var env []string
+	ws.Executor = CustomEnvironmentExecutor(map[string]string{"GOOGLE_CREDENTIALS": "declared"}, func(c *exec.Cmd) error {
+		env = c.Env
+		return ioutil.WriteFile(path.Join(c.Dir, "terraform.tfstate"), []byte("{}"), 0755)
+	})
+
+	if err := ws.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	vars := make(map[string]string)
+	for _, kv := range env {
+		split := strings.SplitN(kv, "=", 2)
+		vars[split[0]] = split[1]
+	}
+
+	if _, ok := vars["ROOT_SERVICE_ACCOUNT_JSON"]; ok {
+		t.Errorf("Expected the broker's credentials not to be passed to Terraform, got env: %v", env)
+	}
+
+	if vars["GOOGLE_CREDENTIALS"] != "declared" {
+		t.Errorf("Expected declared credentials to be passed to Terraform, got env: %v", env)
+	}
+
+	for _, name := range []string{"PATH", "HTTPS_PROXY", "SSL_CERT_FILE"} {
+		if vars[name] != os.Getenv(name) {
+			t.Errorf("Expected %s to be passed to Terraform, got env: %v", name, env)
+		}
+	}
+}
+
+func TestTerraformWorkspace_Plan(t *testing.T) {
+	ws, err := NewWorkspace(map[string]interface{}{}, ``)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws.Executor = func(cmd *exec.Cmd) error {
+		// substitute Terraform with a command that prints a fake plan
+		fake := exec.Command("echo", "1 to add, 0 to change, 0 to destroy.")
+		fake.Dir = cmd.Dir
+		fake.Stdout = cmd.Stdout
+		fake.Stderr = cmd.Stderr
+
+		if err := DefaultExecutor(fake); err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(path.Join(cmd.Dir, "terraform.tfstate"), []byte("{}"), 0755)
+	}
+
+	output, err := ws.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "1 to add, 0 to change, 0 to destroy.\n"; output != expected {
+		t.Errorf("Expected plan output %q, got %q", expected, output)
+	}
+}
+
+func TestTerraformWorkspace_UpgradeModule(t *testing.T) {
+	cases := map[string]struct {
+		Template       string
+		TemplateVars   map[string]interface{}
+		ExpectedConfig map[string]interface{}
+		ExpectedErr    string
+	}{
+		"same inputs": {
+			Template:       `variable name {type = "string"} variable size {type = "string"}`,
+			ExpectedConfig: map[string]interface{}{"name": "foo", "size": "small"},
+		},
+		"removed input": {
+			Template:       `variable name {type = "string"}`,
+			ExpectedConfig: map[string]interface{}{"name": "foo"},
+		},
+		"added input with default": {
+			Template:       `variable name {type = "string"} variable size {type = "string"} variable region {default = "us"}`,
+			ExpectedConfig: map[string]interface{}{"name": "foo", "size": "small"},
+		},
+		"added input resolved": {
+			Template:       `variable name {type = "string"} variable size {type = "string"} variable region {type = "string"}`,
+			TemplateVars:   map[string]interface{}{"name": "bar", "region": "eu"},
+			ExpectedConfig: map[string]interface{}{"name": "foo", "size": "small", "region": "eu"},
+		},
+		"added input unresolved": {
+			Template:     `variable name {type = "string"} variable region {type = "string"} variable zone {type = "string"}`,
+			TemplateVars: map[string]interface{}{"zone": nil},
+			ExpectedErr:  "the upgrade adds required inputs that can't be resolved: region, zone",
+		},
+		"bad template": {
+			Template:    `variable name {`,
+			ExpectedErr: "At 1:17: object expected closing RBRACE got: EOF",
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			vars := map[string]interface{}{"name": "foo", "size": "small"}
+			ws, err := NewWorkspace(vars, `variable name {type = "string"} variable size {type = "string"}`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ws.State = []byte("state")
+
+			err = ws.UpgradeModule(tc.Template, tc.TemplateVars)
+			switch {
+			case tc.ExpectedErr == "" && err != nil:
+				t.Fatalf("Expected no error, got: %v", err)
+			case tc.ExpectedErr != "" && (err == nil || err.Error() != tc.ExpectedErr):
+				t.Fatalf("Expected error: %q, got: %v", tc.ExpectedErr, err)
+			case tc.ExpectedErr != "":
+				return
+			}
+
+			if ws.Modules[0].Definition != tc.Template {
+				t.Errorf("Expected module to be replaced, got: %q", ws.Modules[0].Definition)
+			}
+
+			if !reflect.DeepEqual(ws.Instances[0].Configuration, tc.ExpectedConfig) {
+				t.Errorf("Expected config %v, got %v", tc.ExpectedConfig, ws.Instances[0].Configuration)
+			}
+
+			if string(ws.State) != "state" {
+				t.Errorf("Expected state to be kept, got: %q", ws.State)
+			}
+		})
+	}
+}
+
+func TestTerraformWorkspace_UpdateInputs(t *testing.T) {
+	cases := map[string]struct {
+		Values         map[string]interface{}
+		ExpectedConfig map[string]interface{}
+	}{
+		"no values": {
+			ExpectedConfig: map[string]interface{}{"name": "foo", "size": "small"},
+		},
+		"changed input": {
+			Values:         map[string]interface{}{"size": "large"},
+			ExpectedConfig: map[string]interface{}{"name": "foo", "size": "large"},
+		},
+		"unknown input": {
+			Values:         map[string]interface{}{"region": "eu"},
+			ExpectedConfig: map[string]interface{}{"name": "foo", "size": "small"},
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			vars := map[string]interface{}{"name": "foo", "size": "small"}
+			ws, err := NewWorkspace(vars, `variable name {type = "string"} variable size {type = "string"}`)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ws.UpdateInputs(tc.Values); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if !reflect.DeepEqual(ws.Instances[0].Configuration, tc.ExpectedConfig) {
+				t.Errorf("Expected config %v, got %v", tc.ExpectedConfig, ws.Instances[0].Configuration)
+			}
+		})
+	}
+}
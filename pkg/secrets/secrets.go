@@ -0,0 +1,212 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secrets resolves references to secret values so operators don't
+// have to put the secrets themselves in the broker's configuration.
+//
+// A reference is an object with a single "$ref" key holding a URI, for example
+// {"$ref": "file:///etc/secrets/smtp-password"} or {"$ref": "env://SMTP_PASSWORD"}.
+// The scheme of the URI selects the Resolver used to look up the value.
+package secrets
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cast"
+)
+
+// RefKey is the key of the object holding a reference URI.
+const RefKey = "$ref"
+
+// Resolver looks up the value a reference points to.
+type Resolver interface {
+	Resolve(ref *url.URL) (string, error)
+}
+
+// ResolverFunc adapts a function to the Resolver interface.
+type ResolverFunc func(ref *url.URL) (string, error)
+
+// Resolve implements Resolver.
+func (fn ResolverFunc) Resolve(ref *url.URL) (string, error) {
+	return fn(ref)
+}
+
+var (
+	resolversMu sync.RWMutex
+	resolvers   = map[string]Resolver{
+		"env":  ResolverFunc(resolveEnv),
+		"file": ResolverFunc(resolveFile),
+	}
+)
+
+// Register makes the resolver handle references with the given URI scheme,
+// replacing any resolver already registered for it.
+func Register(scheme string, resolver Resolver) {
+	resolversMu.Lock()
+	defer resolversMu.Unlock()
+
+	resolvers[strings.ToLower(scheme)] = resolver
+}
+
+// Schemes gets the URI schemes that have a resolver, sorted by name.
+func Schemes() []string {
+	resolversMu.RLock()
+	defer resolversMu.RUnlock()
+
+	var out []string
+	for scheme := range resolvers {
+		out = append(out, scheme)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+func getResolver(scheme string) (Resolver, bool) {
+	resolversMu.RLock()
+	defer resolversMu.RUnlock()
+
+	resolver, ok := resolvers[strings.ToLower(scheme)]
+	return resolver, ok
+}
+
+// Reference gets the URI if the value is a reference.
+func Reference(value interface{}) (string, bool) {
+	if value == nil || reflect.TypeOf(value).Kind() != reflect.Map {
+		return "", false
+	}
+
+	obj, err := cast.ToStringMapE(value)
+	if err != nil || len(obj) != 1 {
+		return "", false
+	}
+
+	uri, ok := obj[RefKey].(string)
+	return uri, ok
+}
+
+// ResolveReference looks up the value the reference URI points to.
+func ResolveReference(uri string) (string, error) {
+	ref, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid reference %q: %v", uri, err)
+	}
+
+	resolver, ok := getResolver(ref.Scheme)
+	if !ok {
+		return "", fmt.Errorf("invalid reference %q: unknown scheme %q, expected one of: %s", uri, ref.Scheme, strings.Join(Schemes(), ", "))
+	}
+
+	value, err := resolver.Resolve(ref)
+	if err != nil {
+		return "", fmt.Errorf("couldn't resolve %q: %v", uri, err)
+	}
+
+	return value, nil
+}
+
+// Resolve replaces the references in the value, including ones nested in
+// objects and arrays, with the values they point to. It reports whether the
+// value contained any references.
+func Resolve(value interface{}) (interface{}, bool, error) {
+	if uri, ok := Reference(value); ok {
+		resolved, err := ResolveReference(uri)
+		return resolved, true, err
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+		obj, err := cast.ToStringMapE(v)
+		if err != nil {
+			return nil, false, err
+		}
+
+		out := make(map[string]interface{})
+		found := false
+		for key, elem := range obj {
+			resolved, ok, err := Resolve(elem)
+			if err != nil {
+				return nil, false, err
+			}
+
+			out[key] = resolved
+			found = found || ok
+		}
+
+		// return the original so values without references are untouched
+		if !found {
+			return value, false, nil
+		}
+		return out, true, nil
+
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		found := false
+		for i, elem := range v {
+			resolved, ok, err := Resolve(elem)
+			if err != nil {
+				return nil, false, err
+			}
+
+			out[i] = resolved
+			found = found || ok
+		}
+
+		if !found {
+			return value, false, nil
+		}
+		return out, true, nil
+
+	default:
+		return value, false, nil
+	}
+}
+
+// resolveEnv resolves env://NAME references to the value of the environment
+// variable NAME.
+func resolveEnv(ref *url.URL) (string, error) {
+	name := ref.Host
+	if name == "" || (ref.Path != "" && ref.Path != "/") {
+		return "", fmt.Errorf("expected a reference like env://VARIABLE_NAME")
+	}
+
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("the environment variable %s isn't set", name)
+	}
+
+	return value, nil
+}
+
+// resolveFile resolves file:///path references to the contents of the file
+// without trailing newlines.
+func resolveFile(ref *url.URL) (string, error) {
+	if ref.Host != "" || ref.Path == "" {
+		return "", fmt.Errorf("expected a reference with an absolute path like file:///path/to/secret")
+	}
+
+	contents, err := ioutil.ReadFile(ref.Path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(contents), "\r\n"), nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secretFile := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(secretFile, []byte("file-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("SECRETS_TEST_VALUE", "env-secret")
+	defer os.Unsetenv("SECRETS_TEST_VALUE")
+
+	ref := func(uri string) map[string]interface{} {
+		return map[string]interface{}{RefKey: uri}
+	}
+
+	cases := map[string]struct {
+		Value         interface{}
+		Expected      interface{}
+		ExpectedFound bool
+		ErrContains   string
+	}{
+		"plain string": {
+			Value:    "hello",
+			Expected: "hello",
+		},
+		"plain map": {
+			Value:    map[string]interface{}{"a": "b"},
+			Expected: map[string]interface{}{"a": "b"},
+		},
+		"env": {
+			Value:         ref("env://SECRETS_TEST_VALUE"),
+			Expected:      "env-secret",
+			ExpectedFound: true,
+		},
+		"file": {
+			Value:         ref("file://" + secretFile),
+			Expected:      "file-secret",
+			ExpectedFound: true,
+		},
+		"nested": {
+			Value:         map[string]interface{}{"a": []interface{}{"b", ref("env://SECRETS_TEST_VALUE")}},
+			Expected:      map[string]interface{}{"a": []interface{}{"b", "env-secret"}},
+			ExpectedFound: true,
+		},
+		"yaml map": {
+			Value:         map[interface{}]interface{}{RefKey: "env://SECRETS_TEST_VALUE"},
+			Expected:      "env-secret",
+			ExpectedFound: true,
+		},
+		"extra keys aren't references": {
+			Value:    map[string]interface{}{RefKey: "env://SECRETS_TEST_VALUE", "b": "c"},
+			Expected: map[string]interface{}{RefKey: "env://SECRETS_TEST_VALUE", "b": "c"},
+		},
+		"unknown scheme": {
+			Value:       ref("vault://secret/smtp"),
+			ErrContains: `unknown scheme "vault", expected one of: env, file`,
+		},
+		"missing env": {
+			Value:       ref("env://SECRETS_TEST_MISSING"),
+			ErrContains: "the environment variable SECRETS_TEST_MISSING isn't set",
+		},
+		"relative file": {
+			Value:       ref("file://password"),
+			ErrContains: "expected a reference with an absolute path",
+		},
+		"missing file": {
+			Value:       ref("file://" + filepath.Join(dir, "missing")),
+			ErrContains: "no such file or directory",
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			actual, found, err := Resolve(tc.Value)
+			if tc.ErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.ErrContains) {
+					t.Fatalf("Expected error containing %q, got: %v", tc.ErrContains, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if found != tc.ExpectedFound {
+				t.Errorf("Expected found? %t got %t", tc.ExpectedFound, found)
+			}
+
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Errorf("Expected %#v, got %#v", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func TestResolve_doesNotModifyInput(t *testing.T) {
+	os.Setenv("SECRETS_TEST_VALUE", "env-secret")
+	defer os.Unsetenv("SECRETS_TEST_VALUE")
+
+	input := map[string]interface{}{"password": map[string]interface{}{RefKey: "env://SECRETS_TEST_VALUE"}}
+	if _, _, err := Resolve(input); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{"password": map[string]interface{}{RefKey: "env://SECRETS_TEST_VALUE"}}
+	if !reflect.DeepEqual(input, expected) {
+		t.Errorf("Expected input to be unchanged, got %v", input)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("test", ResolverFunc(func(ref *url.URL) (string, error) {
+		return "resolved " + ref.Host + ref.Path, nil
+	}))
+	defer func() {
+		resolversMu.Lock()
+		delete(resolvers, "test")
+		resolversMu.Unlock()
+	}()
+
+	actual, err := ResolveReference("test://secret/smtp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual != "resolved secret/smtp" {
+		t.Errorf("Expected the registered resolver to be used, got %q", actual)
+	}
+}
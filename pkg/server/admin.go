@@ -0,0 +1,486 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service/models"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/toggles"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"golang.org/x/oauth2/jwt"
+)
+
+// jobRetrier is implemented by service providers that run background jobs
+// which can be retried after failing.
+type jobRetrier interface {
+	RetryJob(ctx context.Context, deploymentId string) error
+}
+
+// jobUpgrader is implemented by service providers that can upgrade jobs to
+// the version of the service that's currently loaded.
+type jobUpgrader interface {
+	PlanUpgrade(ctx context.Context, deploymentId string) (*tf.UpgradeStatus, error)
+	UpgradeJob(ctx context.Context, deploymentId string) error
+}
+
+// RegistryReloader holds the services the broker is serving and can replace
+// them while the broker is running.
+type RegistryReloader interface {
+	// Registry gets the services the broker is currently serving.
+	Registry() broker.BrokerRegistry
+
+	// Reload loads the services again, returning an error and leaving the
+	// current services in place if the new ones can't be served.
+	Reload(ctx context.Context) error
+}
+
+// ReloadStatus describes the services being served after a reload.
+type ReloadStatus struct {
+	Services []string `json:"services"`
+}
+
+// ToggleStatus describes a feature toggle and its resolved value.
+type ToggleStatus struct {
+	Name                string `json:"name"`
+	EnvironmentVariable string `json:"environment_variable"`
+	Description         string `json:"description"`
+	Default             bool   `json:"default"`
+	Enabled             bool   `json:"enabled"`
+}
+
+// includeSecretsParam is the query parameter that makes the admin API return
+// binding credentials and Terraform state, which are redacted by default.
+const includeSecretsParam = "include_secrets"
+
+// BindingRecord is a binding returned by the admin API. OtherDetails holds the
+// binding's credentials so it's blank unless they were requested.
+type BindingRecord struct {
+	models.ServiceBindingCredentials
+	HasCredentials bool `json:"has_credentials"`
+}
+
+// DeploymentRecord is a Terraform deployment returned by the admin API.
+// Workspace holds the Terraform state, which can include generated passwords
+// and keys, so it's blank unless it was requested.
+type DeploymentRecord struct {
+	models.TerraformDeployment
+	HasState bool `json:"has_state"`
+}
+
+// AdminAPI exposes the broker's database records to operators so they can
+// inspect and repair them without needing direct database access.
+type AdminAPI struct {
+	reloader  RegistryReloader
+	projectId string
+	jwtConfig *jwt.Config
+	logger    lager.Logger
+}
+
+// NewAdminHandler creates a handler for the admin API with routes under
+// /admin. The project and credentials are used to build service providers
+// when retrying jobs. The handler does not authenticate requests, callers MUST
+// wrap it.
+func NewAdminHandler(reloader RegistryReloader, projectId string, jwtConfig *jwt.Config, logger lager.Logger) http.Handler {
+	api := &AdminAPI{
+		reloader:  reloader,
+		projectId: projectId,
+		jwtConfig: jwtConfig,
+		logger:    logger.Session("admin"),
+	}
+
+	router := mux.NewRouter()
+	admin := router.PathPrefix("/admin").Subrouter()
+
+	admin.HandleFunc("/instances", api.listInstances).Methods(http.MethodGet)
+	admin.HandleFunc("/instances/{instance_id}", api.getInstance).Methods(http.MethodGet)
+	admin.HandleFunc("/instances/{instance_id}", api.deleteInstance).Methods(http.MethodDelete)
+	admin.HandleFunc("/instances/{instance_id}/clear-operation", api.clearInstanceOperation).Methods(http.MethodPost)
+
+	admin.HandleFunc("/bindings", api.listBindings).Methods(http.MethodGet)
+	admin.HandleFunc("/bindings/{binding_id}", api.getBinding).Methods(http.MethodGet)
+	admin.HandleFunc("/bindings/{binding_id}", api.deleteBinding).Methods(http.MethodDelete)
+
+	admin.HandleFunc("/tf", api.listDeployments).Methods(http.MethodGet)
+	admin.HandleFunc("/tf/{deployment_id}", api.getDeployment).Methods(http.MethodGet)
+	admin.HandleFunc("/tf/{deployment_id}", api.deleteDeployment).Methods(http.MethodDelete)
+	admin.HandleFunc("/tf/{deployment_id}/retry", api.retryDeployment).Methods(http.MethodPost)
+	admin.HandleFunc("/tf/{deployment_id}/upgrade", api.planDeploymentUpgrade).Methods(http.MethodGet)
+	admin.HandleFunc("/tf/{deployment_id}/upgrade", api.upgradeDeployment).Methods(http.MethodPost)
+
+	admin.HandleFunc("/toggles", api.listToggles).Methods(http.MethodGet)
+	admin.HandleFunc("/reload", api.reload).Methods(http.MethodPost)
+
+	return router
+}
+
+func (api *AdminAPI) listInstances(w http.ResponseWriter, req *http.Request) {
+	instances, err := db_service.ListServiceInstanceDetails(req.Context())
+	writeAdminResponse(w, instances, err)
+}
+
+func (api *AdminAPI) getInstance(w http.ResponseWriter, req *http.Request) {
+	instance, err := db_service.GetServiceInstanceDetailsById(req.Context(), mux.Vars(req)["instance_id"])
+	writeAdminResponse(w, instance, err)
+}
+
+// deleteInstance removes the instance and its bindings from the database
+// without touching the underlying resources.
+func (api *AdminAPI) deleteInstance(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	instanceId := mux.Vars(req)["instance_id"]
+
+	instance, err := db_service.GetServiceInstanceDetailsById(ctx, instanceId)
+	if err != nil {
+		writeAdminResponse(w, nil, err)
+		return
+	}
+
+	bindings, err := db_service.ListServiceBindingCredentialsByServiceInstanceId(ctx, instanceId)
+	if err != nil {
+		writeAdminResponse(w, nil, err)
+		return
+	}
+
+	for i := range bindings {
+		api.logger.Info("force-delete-binding", lager.Data{"instance_id": instanceId, "binding_id": bindings[i].BindingId})
+		if err := db_service.DeleteServiceBindingCredentials(ctx, &bindings[i]); err != nil {
+			writeAdminResponse(w, nil, err)
+			return
+		}
+	}
+
+	api.logger.Info("force-delete-instance", lager.Data{"instance_id": instanceId})
+	err = db_service.DeleteServiceInstanceDetails(ctx, instance)
+	writeAdminResponse(w, instance, err)
+}
+
+// clearInstanceOperation unlocks an instance that is stuck waiting on an
+// operation that will never finish.
+func (api *AdminAPI) clearInstanceOperation(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	instanceId := mux.Vars(req)["instance_id"]
+
+	instance, err := db_service.GetServiceInstanceDetailsById(ctx, instanceId)
+	if err != nil {
+		writeAdminResponse(w, nil, err)
+		return
+	}
+
+	api.logger.Info("clear-instance-operation", lager.Data{
+		"instance_id":    instanceId,
+		"operation_type": instance.OperationType,
+		"operation_id":   instance.OperationId,
+	})
+
+	instance.OperationType = models.ClearOperationType
+	instance.OperationId = ""
+	err = db_service.SaveServiceInstanceDetails(ctx, instance)
+	writeAdminResponse(w, instance, err)
+}
+
+func (api *AdminAPI) listBindings(w http.ResponseWriter, req *http.Request) {
+	bindings, err := db_service.ListServiceBindingCredentials(req.Context())
+	if err != nil {
+		writeAdminResponse(w, nil, err)
+		return
+	}
+
+	secrets := api.includeSecrets(req)
+	out := []BindingRecord{}
+	for _, binding := range bindings {
+		out = append(out, newBindingRecord(binding, secrets))
+	}
+
+	writeAdminResponse(w, out, nil)
+}
+
+func (api *AdminAPI) getBinding(w http.ResponseWriter, req *http.Request) {
+	binding, err := db_service.GetServiceBindingCredentialsByBindingId(req.Context(), mux.Vars(req)["binding_id"])
+	if err != nil {
+		writeAdminResponse(w, nil, err)
+		return
+	}
+
+	writeAdminResponse(w, newBindingRecord(*binding, api.includeSecrets(req)), nil)
+}
+
+// deleteBinding removes the binding from the database without revoking the
+// credentials.
+func (api *AdminAPI) deleteBinding(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	bindingId := mux.Vars(req)["binding_id"]
+
+	binding, err := db_service.GetServiceBindingCredentialsByBindingId(ctx, bindingId)
+	if err != nil {
+		writeAdminResponse(w, nil, err)
+		return
+	}
+
+	api.logger.Info("force-delete-binding", lager.Data{"instance_id": binding.ServiceInstanceId, "binding_id": bindingId})
+	if err := db_service.DeleteServiceBindingCredentials(ctx, binding); err != nil {
+		writeAdminResponse(w, nil, err)
+		return
+	}
+
+	writeAdminResponse(w, newBindingRecord(*binding, false), nil)
+}
+
+func (api *AdminAPI) listDeployments(w http.ResponseWriter, req *http.Request) {
+	deployments, err := db_service.ListTerraformDeployments(req.Context())
+	if err != nil {
+		writeAdminResponse(w, nil, err)
+		return
+	}
+
+	secrets := api.includeSecrets(req)
+	out := []DeploymentRecord{}
+	for _, deployment := range deployments {
+		out = append(out, newDeploymentRecord(deployment, secrets))
+	}
+
+	writeAdminResponse(w, out, nil)
+}
+
+func (api *AdminAPI) getDeployment(w http.ResponseWriter, req *http.Request) {
+	deployment, err := db_service.GetTerraformDeploymentById(req.Context(), mux.Vars(req)["deployment_id"])
+	api.writeDeployment(w, req, deployment, err)
+}
+
+// deleteDeployment removes the Terraform deployment from the database without
+// destroying the resources in its state.
+func (api *AdminAPI) deleteDeployment(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	deploymentId := mux.Vars(req)["deployment_id"]
+
+	deployment, err := db_service.GetTerraformDeploymentById(ctx, deploymentId)
+	if err != nil {
+		writeAdminResponse(w, nil, err)
+		return
+	}
+
+	api.logger.Info("force-delete-deployment", lager.Data{"deployment_id": deploymentId})
+	if err := db_service.DeleteTerraformDeployment(ctx, deployment); err != nil {
+		writeAdminResponse(w, nil, err)
+		return
+	}
+
+	writeAdminResponse(w, newDeploymentRecord(*deployment, false), nil)
+}
+
+// retryDeployment re-runs the last failed operation on a Terraform deployment
+// using the provider of the service instance it belongs to.
+func (api *AdminAPI) retryDeployment(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	deploymentId := mux.Vars(req)["deployment_id"]
+
+	defn, provider, ok := api.deploymentProvider(w, req, deploymentId)
+	if !ok {
+		return
+	}
+
+	retrier, ok := provider.(jobRetrier)
+	if !ok {
+		http.Error(w, fmt.Sprintf("the service %q doesn't support retrying jobs", defn.Name), http.StatusBadRequest)
+		return
+	}
+
+	if err := retrier.RetryJob(ctx, deploymentId); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deployment, err := db_service.GetTerraformDeploymentById(ctx, deploymentId)
+	api.writeDeployment(w, req, deployment, err)
+}
+
+// planDeploymentUpgrade shows the changes upgrading a Terraform deployment to
+// the currently loaded version of its brokerpak would make.
+func (api *AdminAPI) planDeploymentUpgrade(w http.ResponseWriter, req *http.Request) {
+	deploymentId := mux.Vars(req)["deployment_id"]
+
+	upgrader, ok := api.deploymentUpgrader(w, req, deploymentId)
+	if !ok {
+		return
+	}
+
+	status, err := upgrader.PlanUpgrade(req.Context(), deploymentId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeAdminResponse(w, status, nil)
+}
+
+// upgradeDeployment upgrades a Terraform deployment to the currently loaded
+// version of its brokerpak in the background.
+func (api *AdminAPI) upgradeDeployment(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	deploymentId := mux.Vars(req)["deployment_id"]
+
+	upgrader, ok := api.deploymentUpgrader(w, req, deploymentId)
+	if !ok {
+		return
+	}
+
+	if err := upgrader.UpgradeJob(ctx, deploymentId); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deployment, err := db_service.GetTerraformDeploymentById(ctx, deploymentId)
+	api.writeDeployment(w, req, deployment, err)
+}
+
+func (api *AdminAPI) deploymentUpgrader(w http.ResponseWriter, req *http.Request, deploymentId string) (jobUpgrader, bool) {
+	defn, provider, ok := api.deploymentProvider(w, req, deploymentId)
+	if !ok {
+		return nil, false
+	}
+
+	upgrader, ok := provider.(jobUpgrader)
+	if !ok {
+		http.Error(w, fmt.Sprintf("the service %q doesn't support upgrading jobs", defn.Name), http.StatusBadRequest)
+		return nil, false
+	}
+
+	return upgrader, true
+}
+
+// deploymentProvider builds the provider of the service instance the
+// Terraform deployment belongs to. If it can't, an error is written to the
+// response and false is returned.
+func (api *AdminAPI) deploymentProvider(w http.ResponseWriter, req *http.Request, deploymentId string) (*broker.ServiceDefinition, broker.ServiceProvider, bool) {
+	instanceId, _, err := tf.ParseTfId(deploymentId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	instance, err := db_service.GetServiceInstanceDetailsById(req.Context(), instanceId)
+	if err != nil {
+		writeAdminResponse(w, nil, err)
+		return nil, nil, false
+	}
+
+	defn, err := api.reloader.Registry().GetServiceById(instance.ServiceId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	return defn, defn.ProviderBuilder(api.projectId, api.jwtConfig, api.logger), true
+}
+
+func (api *AdminAPI) listToggles(w http.ResponseWriter, req *http.Request) {
+	var out []ToggleStatus
+	for _, toggle := range toggles.Features.Toggles() {
+		out = append(out, ToggleStatus{
+			Name:                toggle.Name,
+			EnvironmentVariable: toggle.EnvironmentVariable(),
+			Description:         toggle.Description,
+			Default:             toggle.Default,
+			Enabled:             toggle.IsActive(),
+		})
+	}
+
+	writeAdminResponse(w, out, nil)
+}
+
+// reload replaces the broker's services with freshly loaded ones, e.g. after
+// adding a brokerpak.
+func (api *AdminAPI) reload(w http.ResponseWriter, req *http.Request) {
+	api.logger.Info("reload")
+	if err := api.reloader.Reload(req.Context()); err != nil {
+		api.logger.Error("reload", err)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	status := ReloadStatus{Services: []string{}}
+	for _, svc := range api.reloader.Registry().GetAllServices() {
+		status.Services = append(status.Services, svc.Name)
+	}
+
+	writeAdminResponse(w, status, nil)
+}
+
+// includeSecrets checks if the request asked for credentials and Terraform
+// state to be included in the response. Requests that do are logged.
+func (api *AdminAPI) includeSecrets(req *http.Request) bool {
+	include, _ := strconv.ParseBool(req.URL.Query().Get(includeSecretsParam))
+	if include {
+		api.logger.Info("include-secrets", lager.Data{"path": req.URL.Path})
+	}
+
+	return include
+}
+
+// writeDeployment writes the deployment like writeAdminResponse, redacting
+// its Terraform state unless it was requested.
+func (api *AdminAPI) writeDeployment(w http.ResponseWriter, req *http.Request, deployment *models.TerraformDeployment, err error) {
+	if err != nil {
+		writeAdminResponse(w, nil, err)
+		return
+	}
+
+	writeAdminResponse(w, newDeploymentRecord(*deployment, api.includeSecrets(req)), nil)
+}
+
+func newBindingRecord(binding models.ServiceBindingCredentials, includeSecrets bool) BindingRecord {
+	record := BindingRecord{ServiceBindingCredentials: binding, HasCredentials: binding.OtherDetails != ""}
+	if !includeSecrets {
+		record.OtherDetails = ""
+	}
+
+	return record
+}
+
+func newDeploymentRecord(deployment models.TerraformDeployment, includeSecrets bool) DeploymentRecord {
+	record := DeploymentRecord{TerraformDeployment: deployment, HasState: deployment.Workspace != ""}
+	if !includeSecrets {
+		record.Workspace = ""
+	}
+
+	return record
+}
+
+// writeAdminResponse writes the value as JSON if err is nil, otherwise it
+// writes the error with a status code matching its type.
+func writeAdminResponse(w http.ResponseWriter, value interface{}, err error) {
+	switch {
+	case gorm.IsRecordNotFoundError(err):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,442 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/db_service/models"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker/brokerfakes"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/tf"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/utils"
+	"github.com/jinzhu/gorm"
+	"golang.org/x/oauth2/jwt"
+)
+
+// retryingProvider is a fake ServiceProvider that records retried and
+// upgraded jobs.
+type retryingProvider struct {
+	brokerfakes.FakeServiceProvider
+	retried  []string
+	upgraded []string
+}
+
+func (p *retryingProvider) RetryJob(ctx context.Context, deploymentId string) error {
+	p.retried = append(p.retried, deploymentId)
+	return nil
+}
+
+func (p *retryingProvider) PlanUpgrade(ctx context.Context, deploymentId string) (*tf.UpgradeStatus, error) {
+	return &tf.UpgradeStatus{CurrentVersion: "1.0", AvailableVersion: "2.0", Plan: "No changes."}, nil
+}
+
+func (p *retryingProvider) UpgradeJob(ctx context.Context, deploymentId string) error {
+	p.upgraded = append(p.upgraded, deploymentId)
+	return nil
+}
+
+// fakeReloader is a RegistryReloader that serves a fixed registry.
+type fakeReloader struct {
+	registry  broker.BrokerRegistry
+	reloadErr error
+	reloads   int
+}
+
+func (f *fakeReloader) Registry() broker.BrokerRegistry {
+	return f.registry
+}
+
+func (f *fakeReloader) Reload(ctx context.Context) error {
+	f.reloads++
+	return f.reloadErr
+}
+
+func newAdminTestServer(t *testing.T) (handler http.Handler, provider *retryingProvider, closer func()) {
+	dir, err := ioutil.TempDir("", "admin-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := gorm.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("couldn't create database: %v", err)
+	}
+	if err := db_service.RunMigrations(db); err != nil {
+		t.Fatalf("couldn't migrate database: %v", err)
+	}
+	db_service.DbConnection = db
+
+	ctx := context.Background()
+	instances := []models.ServiceInstanceDetails{
+		{ID: "stuck-instance", ServiceId: "retry-service", OperationType: models.ProvisionOperationType, OperationId: "tf:stuck-instance:"},
+		{ID: "plain-instance", ServiceId: "plain-service"},
+	}
+	for i := range instances {
+		if err := db_service.CreateServiceInstanceDetails(ctx, &instances[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bindings := []models.ServiceBindingCredentials{
+		{ServiceInstanceId: "stuck-instance", BindingId: "stuck-binding", OtherDetails: `{"password":"binding-secret"}`},
+		{ServiceInstanceId: "plain-instance", BindingId: "plain-binding"},
+	}
+	for i := range bindings {
+		if err := db_service.CreateServiceBindingCredentials(ctx, &bindings[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deployments := []models.TerraformDeployment{
+		{ID: "tf:stuck-instance:", Workspace: `{"tfstate":"state-secret"}`, LastOperationType: models.ProvisionOperationType, LastOperationState: "failed"},
+		{ID: "tf:plain-instance:", LastOperationType: models.ProvisionOperationType, LastOperationState: "failed"},
+	}
+	for i := range deployments {
+		if err := db_service.CreateTerraformDeployment(ctx, &deployments[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	provider = &retryingProvider{}
+	registry := broker.BrokerRegistry{
+		"retry-service": &broker.ServiceDefinition{
+			Id:   "retry-service",
+			Name: "retry-service",
+			ProviderBuilder: func(projectId string, auth *jwt.Config, logger lager.Logger) broker.ServiceProvider {
+				return provider
+			},
+		},
+		"plain-service": &broker.ServiceDefinition{
+			Id:   "plain-service",
+			Name: "plain-service",
+			ProviderBuilder: func(projectId string, auth *jwt.Config, logger lager.Logger) broker.ServiceProvider {
+				return &brokerfakes.FakeServiceProvider{}
+			},
+		},
+	}
+
+	handler = NewAdminHandler(&fakeReloader{registry: registry}, "test-project", nil, utils.NewLogger("admin-test"))
+	return handler, provider, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestNewAdminHandler(t *testing.T) {
+	cases := map[string]struct {
+		Method         string
+		Endpoint       string
+		ExpectedStatus int
+		ExpectedBody   string
+	}{
+		"list instances": {
+			Method:         http.MethodGet,
+			Endpoint:       "/admin/instances",
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   `"ID":"stuck-instance"`,
+		},
+		"get instance": {
+			Method:         http.MethodGet,
+			Endpoint:       "/admin/instances/plain-instance",
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   `"ID":"plain-instance"`,
+		},
+		"get missing instance": {
+			Method:         http.MethodGet,
+			Endpoint:       "/admin/instances/missing",
+			ExpectedStatus: http.StatusNotFound,
+		},
+		"clear operation": {
+			Method:         http.MethodPost,
+			Endpoint:       "/admin/instances/stuck-instance/clear-operation",
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   `"OperationType":"","OperationId":""`,
+		},
+		"list bindings": {
+			Method:         http.MethodGet,
+			Endpoint:       "/admin/bindings",
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   `"BindingId":"plain-binding"`,
+		},
+		"get binding": {
+			Method:         http.MethodGet,
+			Endpoint:       "/admin/bindings/stuck-binding",
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   `"ServiceInstanceId":"stuck-instance"`,
+		},
+		"list deployments": {
+			Method:         http.MethodGet,
+			Endpoint:       "/admin/tf",
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   `"ID":"tf:plain-instance:"`,
+		},
+		"get deployment": {
+			Method:         http.MethodGet,
+			Endpoint:       "/admin/tf/tf:stuck-instance:",
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   `"LastOperationState":"failed"`,
+		},
+		"retry unsupported": {
+			Method:         http.MethodPost,
+			Endpoint:       "/admin/tf/tf:plain-instance:/retry",
+			ExpectedStatus: http.StatusBadRequest,
+			ExpectedBody:   `doesn't support retrying jobs`,
+		},
+		"retry malformed": {
+			Method:         http.MethodPost,
+			Endpoint:       "/admin/tf/bad-id/retry",
+			ExpectedStatus: http.StatusBadRequest,
+			ExpectedBody:   `malformed Terraform deployment ID`,
+		},
+		"plan upgrade": {
+			Method:         http.MethodGet,
+			Endpoint:       "/admin/tf/tf:stuck-instance:/upgrade",
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   `{"current_version":"1.0","available_version":"2.0","plan":"No changes."}`,
+		},
+		"upgrade": {
+			Method:         http.MethodPost,
+			Endpoint:       "/admin/tf/tf:stuck-instance:/upgrade",
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   `"ID":"tf:stuck-instance:"`,
+		},
+		"upgrade unsupported": {
+			Method:         http.MethodPost,
+			Endpoint:       "/admin/tf/tf:plain-instance:/upgrade",
+			ExpectedStatus: http.StatusBadRequest,
+			ExpectedBody:   `doesn't support upgrading jobs`,
+		},
+		"toggles": {
+			Method:         http.MethodGet,
+			Endpoint:       "/admin/toggles",
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   `[`,
+		},
+		"reload": {
+			Method:         http.MethodPost,
+			Endpoint:       "/admin/reload",
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   `{"services":["plain-service","retry-service"]}`,
+		},
+		"wrong method": {
+			Method:         http.MethodPut,
+			Endpoint:       "/admin/instances",
+			ExpectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			handler, _, closer := newAdminTestServer(t)
+			defer closer()
+
+			req := httptest.NewRequest(tc.Method, tc.Endpoint, nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.ExpectedStatus {
+				t.Errorf("Expected response code: %v got: %v (%s)", tc.ExpectedStatus, w.Code, w.Body.String())
+			}
+
+			if !strings.Contains(w.Body.String(), tc.ExpectedBody) {
+				t.Errorf("Expected body to contain: %s got: %s", tc.ExpectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestNewAdminHandler_secrets(t *testing.T) {
+	cases := map[string]struct {
+		Method       string
+		Endpoint     string
+		Secret       string
+		ExpectedFlag string
+		Included     bool
+	}{
+		"list bindings": {
+			Method:       http.MethodGet,
+			Endpoint:     "/admin/bindings",
+			Secret:       "binding-secret",
+			ExpectedFlag: `"has_credentials":true`,
+		},
+		"get binding": {
+			Method:       http.MethodGet,
+			Endpoint:     "/admin/bindings/stuck-binding",
+			Secret:       "binding-secret",
+			ExpectedFlag: `"has_credentials":true`,
+		},
+		"get binding with secrets": {
+			Method:       http.MethodGet,
+			Endpoint:     "/admin/bindings/stuck-binding?include_secrets=true",
+			Secret:       "binding-secret",
+			ExpectedFlag: `"has_credentials":true`,
+			Included:     true,
+		},
+		"delete binding with secrets": {
+			Method:       http.MethodDelete,
+			Endpoint:     "/admin/bindings/stuck-binding?include_secrets=true",
+			Secret:       "binding-secret",
+			ExpectedFlag: `"has_credentials":true`,
+		},
+		"list deployments": {
+			Method:       http.MethodGet,
+			Endpoint:     "/admin/tf",
+			Secret:       "state-secret",
+			ExpectedFlag: `"has_state":true`,
+		},
+		"list deployments with secrets": {
+			Method:       http.MethodGet,
+			Endpoint:     "/admin/tf?include_secrets=true",
+			Secret:       "state-secret",
+			ExpectedFlag: `"has_state":true`,
+			Included:     true,
+		},
+		"get deployment": {
+			Method:       http.MethodGet,
+			Endpoint:     "/admin/tf/tf:stuck-instance:",
+			Secret:       "state-secret",
+			ExpectedFlag: `"has_state":true`,
+		},
+		"get deployment without state": {
+			Method:       http.MethodGet,
+			Endpoint:     "/admin/tf/tf:plain-instance:?include_secrets=true",
+			ExpectedFlag: `"has_state":false`,
+		},
+		"delete deployment": {
+			Method:       http.MethodDelete,
+			Endpoint:     "/admin/tf/tf:stuck-instance:",
+			Secret:       "state-secret",
+			ExpectedFlag: `"has_state":true`,
+		},
+		"upgrade": {
+			Method:       http.MethodPost,
+			Endpoint:     "/admin/tf/tf:stuck-instance:/upgrade",
+			Secret:       "state-secret",
+			ExpectedFlag: `"has_state":true`,
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			handler, _, closer := newAdminTestServer(t)
+			defer closer()
+
+			req := httptest.NewRequest(tc.Method, tc.Endpoint, nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected response code: %v got: %v (%s)", http.StatusOK, w.Code, w.Body.String())
+			}
+
+			body := w.Body.String()
+			if !strings.Contains(body, tc.ExpectedFlag) {
+				t.Errorf("Expected body to contain: %s got: %s", tc.ExpectedFlag, body)
+			}
+
+			if tc.Secret != "" && strings.Contains(body, tc.Secret) != tc.Included {
+				t.Errorf("Expected secret included: %v got: %s", tc.Included, body)
+			}
+		})
+	}
+}
+
+func TestNewAdminHandler_deleteInstance(t *testing.T) {
+	handler, _, closer := newAdminTestServer(t)
+	defer closer()
+
+	req := httptest.NewRequest(http.MethodDelete, "/admin/instances/stuck-instance", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected response code: %v got: %v (%s)", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	ctx := context.Background()
+	if exists, _ := db_service.ExistsServiceInstanceDetailsById(ctx, "stuck-instance"); exists {
+		t.Error("Expected instance to be deleted")
+	}
+
+	if exists, _ := db_service.ExistsServiceBindingCredentialsByBindingId(ctx, "stuck-binding"); exists {
+		t.Error("Expected the instance's binding to be deleted")
+	}
+
+	if exists, _ := db_service.ExistsServiceBindingCredentialsByBindingId(ctx, "plain-binding"); !exists {
+		t.Error("Expected other bindings to remain")
+	}
+}
+
+func TestNewAdminHandler_retryDeployment(t *testing.T) {
+	handler, provider, closer := newAdminTestServer(t)
+	defer closer()
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/tf/tf:stuck-instance:/retry", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected response code: %v got: %v (%s)", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	if len(provider.retried) != 1 || provider.retried[0] != "tf:stuck-instance:" {
+		t.Errorf("Expected the deployment to be retried, got: %v", provider.retried)
+	}
+
+	deployment := models.TerraformDeployment{}
+	if err := json.Unmarshal(w.Body.Bytes(), &deployment); err != nil {
+		t.Fatal(err)
+	}
+
+	if deployment.ID != "tf:stuck-instance:" {
+		t.Errorf("Expected the deployment to be returned, got: %q", deployment.ID)
+	}
+}
+
+func TestNewAdminHandler_reloadRefused(t *testing.T) {
+	reloader := &fakeReloader{
+		registry:  broker.BrokerRegistry{},
+		reloadErr: errors.New("refusing to reload, instances still exist for: service \"abc\""),
+	}
+	handler := NewAdminHandler(reloader, "test-project", nil, utils.NewLogger("admin-test"))
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected response code: %v got: %v", http.StatusConflict, w.Code)
+	}
+
+	if !strings.Contains(w.Body.String(), "refusing to reload") {
+		t.Errorf("Expected the reload error in the body, got: %s", w.Body.String())
+	}
+
+	if reloader.reloads != 1 {
+		t.Errorf("Expected 1 reload, got: %d", reloader.reloads)
+	}
+}
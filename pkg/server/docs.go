@@ -62,13 +62,17 @@ var pageTemplate = template.Must(template.New("docs-page").Parse(`
 `))
 
 // AddDocsHandler creates a handler func that generates HTML documentation for
-// the given registry and adds it to the /docs and / routes.
-func AddDocsHandler(router *mux.Router, registry broker.BrokerRegistry) {
-	docsPageMd := generator.CatalogDocumentation(registry)
-	handler := renderAsPage("Service Broker Documents", docsPageMd)
+// the registry returned by getRegistry and adds it to the /docs and / routes.
+// The documentation is generated for each request so it reflects the current
+// registry after brokerpaks are reloaded.
+func AddDocsHandler(router *mux.Router, getRegistry func() broker.BrokerRegistry) {
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		docsPageMd := generator.CatalogDocumentation(getRegistry())
+		renderAsPage("Service Broker Documents", docsPageMd)(w, req)
+	}
 
-	router.Handle("/docs", handler)
-	router.Handle("/", handler)
+	router.HandleFunc("/docs", handler)
+	router.HandleFunc("/", handler)
 }
 
 func renderAsPage(title, markdownContents string) http.HandlerFunc {
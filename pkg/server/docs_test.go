@@ -20,6 +20,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/builtin"
 	"github.com/gorilla/mux"
 )
@@ -29,7 +30,7 @@ func TestNewDocsHandler(t *testing.T) {
 	router := mux.NewRouter()
 	// Test that the handler sets the correct header and contains some imporant
 	// strings that will indicate (but not prove!) that the rendering was correct.
-	AddDocsHandler(router, registry)
+	AddDocsHandler(router, func() broker.BrokerRegistry { return registry })
 	request := httptest.NewRequest(http.MethodGet, "/docs", nil)
 	w := httptest.NewRecorder()
 
@@ -57,3 +58,24 @@ func TestNewDocsHandler(t *testing.T) {
 		}
 	}
 }
+
+func TestNewDocsHandler_reload(t *testing.T) {
+	registry := builtin.BuiltinBrokerRegistry()
+	router := mux.NewRouter()
+	AddDocsHandler(router, func() broker.BrokerRegistry { return registry })
+
+	get := func() []byte {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+		return w.Body.Bytes()
+	}
+
+	if !bytes.Contains(get(), []byte("google-storage")) {
+		t.Fatal("Expected the docs to contain the storage service")
+	}
+
+	registry = broker.BrokerRegistry{}
+	if bytes.Contains(get(), []byte("google-storage")) {
+		t.Error("Expected the docs to reflect the replaced registry")
+	}
+}
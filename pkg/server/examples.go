@@ -16,15 +16,11 @@ package server
 
 import (
 	"encoding/json"
-	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"sort"
 	"strings"
-	"time"
 
-	"github.com/spf13/viper"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/client"
 )
@@ -58,31 +54,15 @@ func GetAllCompleteServiceExamples(registry broker.BrokerRegistry) ([]client.Com
 	return allExamples, nil
 }
 
+// GetExamplesFromServer fetches the examples from the broker configured in the
+// environment and exits if they couldn't be retrieved.
 func GetExamplesFromServer() []client.CompleteServiceExample {
-
-	var allExamples []client.CompleteServiceExample
-	url := fmt.Sprintf("http://%s:%d/examples", viper.GetString("api.hostname"), viper.GetInt("api.port"))
-
-	serverClient := http.Client{
-		Timeout: time.Second * 2,
-	}
-
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	resp, err := serverClient.Do(req)
+	apiClient, err := client.NewClientFromEnv()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	err = json.Unmarshal(body, &allExamples)
+	allExamples, err := apiClient.Examples()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -90,24 +70,23 @@ func GetExamplesFromServer() []client.CompleteServiceExample {
 	return allExamples
 }
 
-func NewExampleHandler(registry broker.BrokerRegistry) http.HandlerFunc {
-	allExamples, err := GetAllCompleteServiceExamples(registry)
-
-	if err != nil {
-		return func(w http.ResponseWriter, rep *http.Request) {
+// NewExampleHandler creates a handler that lists the examples of every service
+// in the registry returned by getRegistry, which is called for each request
+// so the examples reflect the current registry after brokerpaks are reloaded.
+func NewExampleHandler(getRegistry func() broker.BrokerRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		allExamples, err := GetAllCompleteServiceExamples(getRegistry())
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
-	}
 
-	exampleJSON, err := json.Marshal(allExamples)
-
-	if err != nil {
-		return func(w http.ResponseWriter, rep *http.Request) {
+		exampleJSON, err := json.Marshal(allExamples)
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
-	}
 
-	return func(w http.ResponseWriter, req *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		w.Write(exampleJSON)
@@ -21,6 +21,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/broker"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/client"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/providers/builtin"
 )
@@ -38,7 +39,8 @@ func ExampleGetAllCompleteServiceExamples() {
 func TestNewExampleHandler(t *testing.T) {
 
 	// Validate that the handler returns the correct Content-Type
-	handler := NewExampleHandler(builtin.BuiltinBrokerRegistry())
+	registry := builtin.BuiltinBrokerRegistry()
+	handler := NewExampleHandler(func() broker.BrokerRegistry { return registry })
 	request := httptest.NewRequest(http.MethodGet, "/examples", nil)
 	w := httptest.NewRecorder()
 
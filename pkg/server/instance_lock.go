@@ -0,0 +1,207 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pivotal-cf/brokerapi"
+)
+
+// ErrConcurrentInstanceAccess is returned when a request tries to mutate an
+// instance or binding that another request is already mutating.
+var ErrConcurrentInstanceAccess = brokerapi.ErrConcurrentInstanceAccess.Build()
+
+// InstanceLockWrapper rejects concurrent requests that mutate the same service
+// instance with a 422 ConcurrencyError as described by the OSB spec.
+//
+// Provision, update and deprovision hold an exclusive lock on the instance.
+// Bind and unbind hold a shared lock on the instance, so an instance can have
+// multiple bindings created at once, and an exclusive lock on the binding.
+//
+// Locks are held in memory so they only protect against concurrent requests
+// to the same broker process.
+type InstanceLockWrapper struct {
+	brokerapi.ServiceBroker
+
+	locks *lockTable
+}
+
+// NewInstanceLockWrapper wraps the given ServiceBroker so mutating requests
+// on the same instance are mutually exclusive.
+func NewInstanceLockWrapper(wrapped brokerapi.ServiceBroker) brokerapi.ServiceBroker {
+	return &InstanceLockWrapper{
+		ServiceBroker: wrapped,
+		locks:         newLockTable(),
+	}
+}
+
+// Provision implements brokerapi.ServiceBroker.
+func (w *InstanceLockWrapper) Provision(ctx context.Context, instanceID string, details brokerapi.ProvisionDetails, asyncAllowed bool) (brokerapi.ProvisionedServiceSpec, error) {
+	unlock, ok := w.locks.lockInstance(instanceID)
+	if !ok {
+		return brokerapi.ProvisionedServiceSpec{}, ErrConcurrentInstanceAccess
+	}
+	defer unlock()
+
+	return w.ServiceBroker.Provision(ctx, instanceID, details, asyncAllowed)
+}
+
+// Update implements brokerapi.ServiceBroker.
+func (w *InstanceLockWrapper) Update(ctx context.Context, instanceID string, details brokerapi.UpdateDetails, asyncAllowed bool) (brokerapi.UpdateServiceSpec, error) {
+	unlock, ok := w.locks.lockInstance(instanceID)
+	if !ok {
+		return brokerapi.UpdateServiceSpec{}, ErrConcurrentInstanceAccess
+	}
+	defer unlock()
+
+	return w.ServiceBroker.Update(ctx, instanceID, details, asyncAllowed)
+}
+
+// Deprovision implements brokerapi.ServiceBroker.
+func (w *InstanceLockWrapper) Deprovision(ctx context.Context, instanceID string, details brokerapi.DeprovisionDetails, asyncAllowed bool) (brokerapi.DeprovisionServiceSpec, error) {
+	unlock, ok := w.locks.lockInstance(instanceID)
+	if !ok {
+		return brokerapi.DeprovisionServiceSpec{}, ErrConcurrentInstanceAccess
+	}
+	defer unlock()
+
+	return w.ServiceBroker.Deprovision(ctx, instanceID, details, asyncAllowed)
+}
+
+// Bind implements brokerapi.ServiceBroker.
+func (w *InstanceLockWrapper) Bind(ctx context.Context, instanceID, bindingID string, details brokerapi.BindDetails, asyncAllowed bool) (brokerapi.Binding, error) {
+	unlock, ok := w.locks.lockBinding(instanceID, bindingID)
+	if !ok {
+		return brokerapi.Binding{}, ErrConcurrentInstanceAccess
+	}
+	defer unlock()
+
+	return w.ServiceBroker.Bind(ctx, instanceID, bindingID, details, asyncAllowed)
+}
+
+// Unbind implements brokerapi.ServiceBroker.
+func (w *InstanceLockWrapper) Unbind(ctx context.Context, instanceID, bindingID string, details brokerapi.UnbindDetails, asyncAllowed bool) (brokerapi.UnbindSpec, error) {
+	unlock, ok := w.locks.lockBinding(instanceID, bindingID)
+	if !ok {
+		return brokerapi.UnbindSpec{}, ErrConcurrentInstanceAccess
+	}
+	defer unlock()
+
+	return w.ServiceBroker.Unbind(ctx, instanceID, bindingID, details, asyncAllowed)
+}
+
+// lockState holds the holders of a single lock.
+type lockState struct {
+	exclusive bool
+	shared    int
+}
+
+// lockTable is a set of non-blocking reader/writer locks keyed by name.
+// Unused entries are removed so the table doesn't grow with every instance
+// the broker has seen.
+type lockTable struct {
+	mu    sync.Mutex
+	locks map[string]*lockState
+}
+
+func newLockTable() *lockTable {
+	return &lockTable{locks: make(map[string]*lockState)}
+}
+
+// lockInstance tries to get an exclusive lock on the instance.
+func (table *lockTable) lockInstance(instanceID string) (unlock func(), ok bool) {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	key := "instance:" + instanceID
+	if !table.canLock(key, true) {
+		return nil, false
+	}
+
+	table.acquire(key, true)
+	return func() { table.release(key, true) }, true
+}
+
+// lockBinding tries to get a shared lock on the instance and an exclusive
+// lock on the binding.
+func (table *lockTable) lockBinding(instanceID, bindingID string) (unlock func(), ok bool) {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	instanceKey := "instance:" + instanceID
+	bindingKey := "binding:" + instanceID + ":" + bindingID
+	if !table.canLock(instanceKey, false) || !table.canLock(bindingKey, true) {
+		return nil, false
+	}
+
+	table.acquire(instanceKey, false)
+	table.acquire(bindingKey, true)
+	return func() {
+		table.release(bindingKey, true)
+		table.release(instanceKey, false)
+	}, true
+}
+
+// canLock returns true if the lock could be acquired. The caller MUST hold mu.
+func (table *lockTable) canLock(key string, exclusive bool) bool {
+	state, ok := table.locks[key]
+	if !ok {
+		return true
+	}
+
+	if exclusive {
+		return !state.exclusive && state.shared == 0
+	}
+
+	return !state.exclusive
+}
+
+// acquire takes the lock. The caller MUST hold mu and check canLock first.
+func (table *lockTable) acquire(key string, exclusive bool) {
+	state, ok := table.locks[key]
+	if !ok {
+		state = &lockState{}
+		table.locks[key] = state
+	}
+
+	if exclusive {
+		state.exclusive = true
+	} else {
+		state.shared++
+	}
+}
+
+// release gives up the lock.
+func (table *lockTable) release(key string, exclusive bool) {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	state, ok := table.locks[key]
+	if !ok {
+		return
+	}
+
+	if exclusive {
+		state.exclusive = false
+	} else if state.shared > 0 {
+		state.shared--
+	}
+
+	if !state.exclusive && state.shared == 0 {
+		delete(table.locks, key)
+	}
+}
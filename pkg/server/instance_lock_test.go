@@ -0,0 +1,167 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/server/fakes"
+	"github.com/pivotal-cf/brokerapi"
+)
+
+func TestLockTable(t *testing.T) {
+	lockInstance := func(id string) func(*lockTable) (func(), bool) {
+		return func(table *lockTable) (func(), bool) { return table.lockInstance(id) }
+	}
+
+	lockBinding := func(instanceId, bindingId string) func(*lockTable) (func(), bool) {
+		return func(table *lockTable) (func(), bool) { return table.lockBinding(instanceId, bindingId) }
+	}
+
+	cases := map[string]struct {
+		Held     func(*lockTable) (func(), bool)
+		Attempt  func(*lockTable) (func(), bool)
+		Expected bool
+	}{
+		"same instance": {
+			Held:     lockInstance("a"),
+			Attempt:  lockInstance("a"),
+			Expected: false,
+		},
+		"different instance": {
+			Held:     lockInstance("a"),
+			Attempt:  lockInstance("b"),
+			Expected: true,
+		},
+		"bind during instance operation": {
+			Held:     lockInstance("a"),
+			Attempt:  lockBinding("a", "1"),
+			Expected: false,
+		},
+		"instance operation during bind": {
+			Held:     lockBinding("a", "1"),
+			Attempt:  lockInstance("a"),
+			Expected: false,
+		},
+		"different bindings": {
+			Held:     lockBinding("a", "1"),
+			Attempt:  lockBinding("a", "2"),
+			Expected: true,
+		},
+		"same binding": {
+			Held:     lockBinding("a", "1"),
+			Attempt:  lockBinding("a", "1"),
+			Expected: false,
+		},
+		"same binding id different instance": {
+			Held:     lockBinding("a", "1"),
+			Attempt:  lockBinding("b", "1"),
+			Expected: true,
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			table := newLockTable()
+
+			unlock, ok := tc.Held(table)
+			if !ok {
+				t.Fatal("couldn't get initial lock")
+			}
+
+			if _, actual := tc.Attempt(table); actual != tc.Expected {
+				t.Errorf("Expected lock acquired: %t got: %t", tc.Expected, actual)
+			}
+
+			unlock()
+			if _, ok := tc.Attempt(newLockTable()); !ok {
+				t.Error("Expected lock to be available on a new table")
+			}
+		})
+	}
+}
+
+func TestLockTable_release(t *testing.T) {
+	table := newLockTable()
+
+	unlockBinding, _ := table.lockBinding("a", "1")
+	unlockOther, _ := table.lockBinding("a", "2")
+	unlockBinding()
+
+	if _, ok := table.lockInstance("a"); ok {
+		t.Fatal("Expected instance to stay locked while a binding is in progress")
+	}
+
+	unlockOther()
+
+	unlockInstance, ok := table.lockInstance("a")
+	if !ok {
+		t.Fatal("Expected instance to be unlocked after all bindings finished")
+	}
+	unlockInstance()
+
+	if len(table.locks) != 0 {
+		t.Errorf("Expected all locks to be cleaned up, got: %v", table.locks)
+	}
+}
+
+func TestInstanceLockWrapper(t *testing.T) {
+	started := make(chan struct{})
+	finish := make(chan struct{})
+
+	wrapped := &fakes.FakeServiceBroker{}
+	wrapped.ProvisionStub = func(ctx context.Context, instanceID string, details brokerapi.ProvisionDetails, asyncAllowed bool) (brokerapi.ProvisionedServiceSpec, error) {
+		close(started)
+		<-finish
+		return brokerapi.ProvisionedServiceSpec{}, nil
+	}
+
+	lw := NewInstanceLockWrapper(wrapped)
+	ctx := context.Background()
+
+	done := make(chan error)
+	go func() {
+		_, err := lw.Provision(ctx, "instance", brokerapi.ProvisionDetails{}, true)
+		done <- err
+	}()
+	<-started
+
+	if _, err := lw.Deprovision(ctx, "instance", brokerapi.DeprovisionDetails{}, true); err != ErrConcurrentInstanceAccess {
+		t.Errorf("Expected concurrent deprovision to fail with %v, got: %v", ErrConcurrentInstanceAccess, err)
+	}
+
+	if _, err := lw.Bind(ctx, "instance", "binding", brokerapi.BindDetails{}, false); err != ErrConcurrentInstanceAccess {
+		t.Errorf("Expected concurrent bind to fail with %v, got: %v", ErrConcurrentInstanceAccess, err)
+	}
+
+	if _, err := lw.Deprovision(ctx, "other-instance", brokerapi.DeprovisionDetails{}, true); err != nil {
+		t.Errorf("Expected deprovision of another instance to succeed, got: %v", err)
+	}
+
+	close(finish)
+	if err := <-done; err != nil {
+		t.Fatalf("Expected provision to succeed, got: %v", err)
+	}
+
+	if _, err := lw.Deprovision(ctx, "instance", brokerapi.DeprovisionDetails{}, true); err != nil {
+		t.Errorf("Expected deprovision after provision to succeed, got: %v", err)
+	}
+
+	if wrapped.ProvisionCallCount() != 1 || wrapped.DeprovisionCallCount() != 2 || wrapped.BindCallCount() != 0 {
+		t.Errorf("Unexpected calls to the wrapped broker: provision %d, deprovision %d, bind %d",
+			wrapped.ProvisionCallCount(), wrapped.DeprovisionCallCount(), wrapped.BindCallCount())
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/validation"
+	"github.com/gorilla/mux"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/spf13/viper"
+)
+
+const (
+	rateLimitPropPrefix  = "api.rate_limit."
+	rateLimitDefaultProp = rateLimitPropPrefix + "default"
+
+	// otherEndpoint is used for requests that don't match an OSB endpoint.
+	otherEndpoint = "other"
+)
+
+// osbEndpoints maps the method and path template of each OSB route to a
+// short name used in configuration.
+var osbEndpoints = map[string]string{
+	"GET /v2/catalog":                                                                      "catalog",
+	"GET /v2/service_instances/{instance_id}":                                              "get_instance",
+	"PUT /v2/service_instances/{instance_id}":                                              "provision",
+	"PATCH /v2/service_instances/{instance_id}":                                            "update",
+	"DELETE /v2/service_instances/{instance_id}":                                           "deprovision",
+	"GET /v2/service_instances/{instance_id}/last_operation":                               "last_operation",
+	"GET /v2/service_instances/{instance_id}/service_bindings/{binding_id}":                "get_binding",
+	"PUT /v2/service_instances/{instance_id}/service_bindings/{binding_id}":                "bind",
+	"DELETE /v2/service_instances/{instance_id}/service_bindings/{binding_id}":             "unbind",
+	"GET /v2/service_instances/{instance_id}/service_bindings/{binding_id}/last_operation": "last_binding_operation",
+}
+
+// RateLimitEndpoints returns the names of the endpoints that can have their
+// own rate limit.
+func RateLimitEndpoints() []string {
+	var out []string
+	for _, name := range osbEndpoints {
+		out = append(out, name)
+	}
+
+	sort.Strings(out)
+	return out
+}
+
+// RateLimitConfig holds the number of requests per minute each credential can
+// make to each endpoint. A limit of 0 means requests are unlimited.
+type RateLimitConfig struct {
+	// Default holds the limit for endpoints without their own limit.
+	Default int
+	// Endpoints holds the limits for individual endpoints keyed by name
+	// e.g. last_operation.
+	Endpoints map[string]int
+}
+
+// NewRateLimitConfigFromEnv loads the rate limits from Viper. The default
+// limit is read from api.rate_limit.default and individual endpoints from
+// api.rate_limit.<endpoint> e.g. api.rate_limit.last_operation.
+func NewRateLimitConfigFromEnv() *RateLimitConfig {
+	cfg := &RateLimitConfig{
+		Default:   viper.GetInt(rateLimitDefaultProp),
+		Endpoints: make(map[string]int),
+	}
+
+	for _, name := range RateLimitEndpoints() {
+		prop := rateLimitPropPrefix + name
+		if viper.IsSet(prop) {
+			cfg.Endpoints[name] = viper.GetInt(prop)
+		}
+	}
+
+	return cfg
+}
+
+var _ validation.Validatable = (*RateLimitConfig)(nil)
+
+// Validate implements validation.Validatable.
+func (cfg *RateLimitConfig) Validate() (errs *validation.FieldError) {
+	if cfg.Default < 0 {
+		errs = errs.Also(validation.ErrInvalidValue(cfg.Default, rateLimitDefaultProp))
+	}
+
+	for name, limit := range cfg.Endpoints {
+		if limit < 0 {
+			errs = errs.Also(validation.ErrInvalidValue(limit, rateLimitPropPrefix+name))
+		}
+	}
+
+	return errs
+}
+
+// limitFor gets the requests per minute allowed for the endpoint.
+func (cfg *RateLimitConfig) limitFor(endpoint string) int {
+	if limit, ok := cfg.Endpoints[endpoint]; ok {
+		return limit
+	}
+
+	return cfg.Default
+}
+
+// Enabled returns true if any endpoint is limited.
+func (cfg *RateLimitConfig) Enabled() bool {
+	if cfg.Default > 0 {
+		return true
+	}
+
+	for _, limit := range cfg.Endpoints {
+		if limit > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewRateLimitMiddleware creates a middleware that limits the requests each
+// credential can make to each endpoint. It MUST be installed on the router
+// the OSB routes are attached to, after authentication, so the route and
+// credential can be determined.
+func NewRateLimitMiddleware(cfg *RateLimitConfig) func(http.Handler) http.Handler {
+	limiter := newRateLimiter(cfg, time.Now)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			endpoint := requestEndpoint(req)
+			ok, retryAfter := limiter.allow(requestCredential(req), endpoint)
+			if !ok {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Retry-After", fmt.Sprintf("%d", seconds))
+				w.WriteHeader(http.StatusTooManyRequests)
+				json.NewEncoder(w).Encode(brokerapi.ErrorResponse{
+					Description: fmt.Sprintf("rate limit exceeded for the %s endpoint, retry in %d seconds", endpoint, seconds),
+				})
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// requestEndpoint gets the name of the OSB endpoint the request was routed to.
+func requestEndpoint(req *http.Request) string {
+	route := mux.CurrentRoute(req)
+	if route == nil {
+		return otherEndpoint
+	}
+
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return otherEndpoint
+	}
+
+	if name, ok := osbEndpoints[req.Method+" "+template]; ok {
+		return name
+	}
+
+	return otherEndpoint
+}
+
+// requestCredential identifies who made the request. Verified client
+// certificates are identified by their subject's common name, otherwise the
+// basic auth username is used.
+func requestCredential(req *http.Request) string {
+	if hasVerifiedClientCert(req) {
+		return "cert:" + req.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+
+	if user, _, ok := req.BasicAuth(); ok {
+		return "user:" + user
+	}
+
+	return "anonymous"
+}
+
+// rateLimiter holds a token bucket for every credential and endpoint pair.
+type rateLimiter struct {
+	cfg *RateLimitConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter(cfg *RateLimitConfig, now func() time.Time) *rateLimiter {
+	return &rateLimiter{
+		cfg:     cfg,
+		now:     now,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow returns true if the credential can make a request to the endpoint,
+// otherwise it returns how long until the next request is allowed.
+func (limiter *rateLimiter) allow(credential, endpoint string) (bool, time.Duration) {
+	limit := limiter.cfg.limitFor(endpoint)
+	if limit <= 0 {
+		return true, 0
+	}
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	key := credential + " " + endpoint
+	bucket, ok := limiter.buckets[key]
+	if !ok {
+		bucket = newTokenBucket(limit, limiter.now())
+		limiter.buckets[key] = bucket
+	}
+
+	return bucket.take(limiter.now())
+}
+
+// tokenBucket allows bursts of up to capacity requests, refilling at
+// capacity tokens per minute.
+type tokenBucket struct {
+	capacity   float64
+	tokens     float64
+	perSecond  float64
+	lastRefill time.Time
+}
+
+func newTokenBucket(perMinute int, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		capacity:   float64(perMinute),
+		tokens:     float64(perMinute),
+		perSecond:  float64(perMinute) / 60,
+		lastRefill: now,
+	}
+}
+
+// take removes a token from the bucket if one is available, otherwise it
+// returns how long until one will be.
+func (bucket *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	elapsed := now.Sub(bucket.lastRefill).Seconds()
+	if elapsed > 0 {
+		bucket.tokens = math.Min(bucket.capacity, bucket.tokens+elapsed*bucket.perSecond)
+		bucket.lastRefill = now
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := (1 - bucket.tokens) / bucket.perSecond
+	return false, time.Duration(wait * float64(time.Second))
+}
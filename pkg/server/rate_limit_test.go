@@ -0,0 +1,134 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/validation"
+	"github.com/gorilla/mux"
+)
+
+func TestRateLimitConfig_Validate(t *testing.T) {
+	cases := map[string]validation.ValidatableTest{
+		"disabled": {
+			Object: &RateLimitConfig{},
+			Expect: nil,
+		},
+		"good": {
+			Object: &RateLimitConfig{Default: 60, Endpoints: map[string]int{"last_operation": 0}},
+			Expect: nil,
+		},
+		"negative default": {
+			Object: &RateLimitConfig{Default: -1},
+			Expect: validation.ErrInvalidValue(-1, "api.rate_limit.default"),
+		},
+		"negative endpoint": {
+			Object: &RateLimitConfig{Endpoints: map[string]int{"provision": -5}},
+			Expect: validation.ErrInvalidValue(-5, "api.rate_limit.provision"),
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			tc.Assert(t)
+		})
+	}
+}
+
+func TestRateLimiter_allow(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	clock := func() time.Time { return now }
+
+	cfg := &RateLimitConfig{
+		Default:   2,
+		Endpoints: map[string]int{"catalog": 0, "provision": 1},
+	}
+	limiter := newRateLimiter(cfg, clock)
+
+	steps := []struct {
+		Elapsed    time.Duration
+		Credential string
+		Endpoint   string
+		Allowed    bool
+		RetryAfter time.Duration
+	}{
+		{Credential: "a", Endpoint: "bind", Allowed: true},
+		{Credential: "a", Endpoint: "bind", Allowed: true},
+		{Credential: "a", Endpoint: "bind", Allowed: false, RetryAfter: 30 * time.Second},
+		{Credential: "b", Endpoint: "bind", Allowed: true},
+		{Credential: "a", Endpoint: "unbind", Allowed: true},
+		{Credential: "a", Endpoint: "catalog", Allowed: true},
+		{Credential: "a", Endpoint: "catalog", Allowed: true},
+		{Credential: "a", Endpoint: "catalog", Allowed: true},
+		{Credential: "a", Endpoint: "provision", Allowed: true},
+		{Credential: "a", Endpoint: "provision", Allowed: false, RetryAfter: 60 * time.Second},
+		{Elapsed: 30 * time.Second, Credential: "a", Endpoint: "bind", Allowed: true},
+		{Elapsed: 30 * time.Second, Credential: "a", Endpoint: "provision", Allowed: false, RetryAfter: 30 * time.Second},
+		{Elapsed: 60 * time.Second, Credential: "a", Endpoint: "provision", Allowed: true},
+	}
+
+	for i, step := range steps {
+		now = start.Add(step.Elapsed)
+		allowed, retryAfter := limiter.allow(step.Credential, step.Endpoint)
+
+		if allowed != step.Allowed {
+			t.Errorf("step %d: expected allowed: %t got: %t", i, step.Allowed, allowed)
+		}
+
+		if retryAfter != step.RetryAfter {
+			t.Errorf("step %d: expected retry after: %v got: %v", i, step.RetryAfter, retryAfter)
+		}
+	}
+}
+
+func TestNewRateLimitMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	ok := func(w http.ResponseWriter, req *http.Request) { w.WriteHeader(http.StatusOK) }
+	router.HandleFunc("/v2/catalog", ok).Methods("GET")
+	router.HandleFunc("/v2/service_instances/{instance_id}/last_operation", ok).Methods("GET")
+	router.Use(NewRateLimitMiddleware(&RateLimitConfig{Endpoints: map[string]int{"last_operation": 1}}))
+
+	cases := []struct {
+		Path           string
+		User           string
+		ExpectedStatus int
+	}{
+		{Path: "/v2/service_instances/a/last_operation", User: "user", ExpectedStatus: http.StatusOK},
+		{Path: "/v2/service_instances/b/last_operation", User: "user", ExpectedStatus: http.StatusTooManyRequests},
+		{Path: "/v2/service_instances/b/last_operation", User: "other", ExpectedStatus: http.StatusOK},
+		{Path: "/v2/catalog", User: "user", ExpectedStatus: http.StatusOK},
+		{Path: "/v2/catalog", User: "user", ExpectedStatus: http.StatusOK},
+	}
+
+	for i, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.Path, nil)
+		req.SetBasicAuth(tc.User, "pass")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tc.ExpectedStatus {
+			t.Errorf("request %d: expected response code: %v got: %v", i, tc.ExpectedStatus, w.Code)
+		}
+
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "60" {
+			t.Errorf("request %d: expected Retry-After: 60 got: %q", i, w.Header().Get("Retry-After"))
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/validation"
+	"github.com/GoogleCloudPlatform/gcp-service-broker/utils"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/auth"
+	"github.com/spf13/viper"
+)
+
+const (
+	tlsCertFileProp     = "api.tls.cert_file"
+	tlsKeyFileProp      = "api.tls.key_file"
+	tlsMinVersionProp   = "api.tls.min_version"
+	tlsClientCAFileProp = "api.tls.client_ca_file"
+)
+
+// tlsVersions maps human readable TLS versions to their crypto/tls constants.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func init() {
+	viper.SetDefault(tlsMinVersionProp, "1.2")
+}
+
+// TLSConfig holds the settings needed to serve the broker over TLS and
+// optionally verify client certificates.
+type TLSConfig struct {
+	// CertFile holds the path to a PEM encoded certificate chain for the server.
+	CertFile string
+	// KeyFile holds the path to the PEM encoded private key for CertFile.
+	KeyFile string
+	// MinVersion holds the lowest TLS version the server will negotiate e.g. 1.2
+	MinVersion string
+	// ClientCAFile holds the path to a PEM encoded CA bundle. If set, clients
+	// presenting a certificate signed by one of these CAs are authenticated
+	// without needing basic auth.
+	ClientCAFile string
+}
+
+// NewTLSConfigFromEnv loads the TLS settings for the server from Viper.
+func NewTLSConfigFromEnv() *TLSConfig {
+	return &TLSConfig{
+		CertFile:     viper.GetString(tlsCertFileProp),
+		KeyFile:      viper.GetString(tlsKeyFileProp),
+		MinVersion:   viper.GetString(tlsMinVersionProp),
+		ClientCAFile: viper.GetString(tlsClientCAFileProp),
+	}
+}
+
+var _ validation.Validatable = (*TLSConfig)(nil)
+
+// Validate implements validation.Validatable.
+func (cfg *TLSConfig) Validate() (errs *validation.FieldError) {
+	if !cfg.Enabled() {
+		if cfg.CertFile != "" || cfg.KeyFile != "" {
+			errs = errs.Also(validation.ErrMissingOneOf(tlsCertFileProp, tlsKeyFileProp))
+		}
+
+		if cfg.ClientCAFile != "" {
+			errs = errs.Also(&validation.FieldError{
+				Message: "client certificate verification requires TLS to be enabled",
+				Paths:   []string{tlsClientCAFileProp},
+			})
+		}
+
+		return errs
+	}
+
+	if _, ok := tlsVersions[cfg.MinVersion]; !ok {
+		errs = errs.Also(validation.ErrInvalidValue(cfg.MinVersion, tlsMinVersionProp))
+	}
+
+	return errs
+}
+
+// Enabled returns true if the server has a certificate and key to serve TLS.
+func (cfg *TLSConfig) Enabled() bool {
+	return cfg.CertFile != "" && cfg.KeyFile != ""
+}
+
+// VerifiesClients returns true if client certificates will be checked against
+// a CA bundle.
+func (cfg *TLSConfig) VerifiesClients() bool {
+	return cfg.Enabled() && cfg.ClientCAFile != ""
+}
+
+// ServerConfig creates a crypto/tls configuration for the server. Client
+// certificates are requested but not required so platforms that only
+// support basic auth continue to work.
+func (cfg *TLSConfig) ServerConfig() (*tls.Config, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load server certificate: %v", err)
+	}
+
+	out := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tlsVersions[cfg.MinVersion],
+	}
+
+	if cfg.VerifiesClients() {
+		pool, err := utils.LoadCertPool(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		out.ClientCAs = pool
+		out.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return out, nil
+}
+
+// NewAuthMiddleware creates a middleware that lets a request through if it
+// presented a client certificate that was verified during the TLS handshake,
+// otherwise it falls back to checking the basic auth credentials.
+func NewAuthMiddleware(credentials brokerapi.BrokerCredentials) func(http.Handler) http.Handler {
+	basicAuth := auth.NewWrapper(credentials.Username, credentials.Password)
+
+	return func(next http.Handler) http.Handler {
+		withBasicAuth := basicAuth.Wrap(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if hasVerifiedClientCert(req) {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			withBasicAuth.ServeHTTP(w, req)
+		})
+	}
+}
+
+// hasVerifiedClientCert returns true if the TLS handshake for the request
+// included a client certificate that chained to a trusted CA.
+func hasVerifiedClientCert(req *http.Request) bool {
+	return req.TLS != nil && len(req.TLS.VerifiedChains) > 0
+}
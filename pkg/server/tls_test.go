@@ -0,0 +1,123 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/validation"
+	"github.com/pivotal-cf/brokerapi"
+)
+
+func TestTLSConfig_Validate(t *testing.T) {
+	cases := map[string]validation.ValidatableTest{
+		"disabled": {
+			Object: &TLSConfig{MinVersion: "1.2"},
+			Expect: nil,
+		},
+		"enabled": {
+			Object: &TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: "1.2"},
+			Expect: nil,
+		},
+		"enabled with client certs": {
+			Object: &TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: "1.3", ClientCAFile: "ca.pem"},
+			Expect: nil,
+		},
+		"missing key": {
+			Object: &TLSConfig{CertFile: "cert.pem", MinVersion: "1.2"},
+			Expect: validation.ErrMissingOneOf("api.tls.cert_file", "api.tls.key_file"),
+		},
+		"client certs without tls": {
+			Object: &TLSConfig{ClientCAFile: "ca.pem", MinVersion: "1.2"},
+			Expect: &validation.FieldError{
+				Message: "client certificate verification requires TLS to be enabled",
+				Paths:   []string{"api.tls.client_ca_file"},
+			},
+		},
+		"bad version": {
+			Object: &TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: "2.0"},
+			Expect: validation.ErrInvalidValue("2.0", "api.tls.min_version"),
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			tc.Assert(t)
+		})
+	}
+}
+
+func TestNewAuthMiddleware(t *testing.T) {
+	verifiedState := &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{&x509.Certificate{}}},
+	}
+
+	cases := map[string]struct {
+		User           string
+		Password       string
+		TLS            *tls.ConnectionState
+		ExpectedStatus int
+	}{
+		"no credentials": {
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		"good basic auth": {
+			User:           "user",
+			Password:       "pass",
+			ExpectedStatus: http.StatusOK,
+		},
+		"bad basic auth": {
+			User:           "user",
+			Password:       "wrong",
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		"verified client cert": {
+			TLS:            verifiedState,
+			ExpectedStatus: http.StatusOK,
+		},
+		"unverified client cert": {
+			TLS:            &tls.ConnectionState{},
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	middleware := NewAuthMiddleware(brokerapi.BrokerCredentials{Username: "user", Password: "pass"})
+	handler := middleware(ok)
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v2/catalog", nil)
+			if tc.User != "" {
+				req.SetBasicAuth(tc.User, tc.Password)
+			}
+			req.TLS = tc.TLS
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.ExpectedStatus {
+				t.Errorf("Expected response code: %v got: %v", tc.ExpectedStatus, w.Code)
+			}
+		})
+	}
+}
@@ -14,28 +14,60 @@
 
 package validation
 
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+)
+
 const (
-	KeyDefault          = "default"
-	KeyExamples         = "examples"
-	KeyDescription      = "description"
-	KeyTitle            = "title"
-	KeyType             = "type"
-	KeyConst            = "const"
-	KeyEnum             = "enum"
-	KeyMultipleOf       = "multipleOf"
-	KeyMaximum          = "maximum"
-	KeyMinimum          = "minimum"
-	KeyExclusiveMaximum = "exclusiveMaximum"
-	KeyExclusiveMinimum = "exclusiveMinimum"
-	KeyMaxLength        = "maxLength"
-	KeyMinLength        = "minLength"
-	KeyPattern          = "pattern"
-	KeyMaxItems         = "maxItems"
-	KeyMinItems         = "minItems"
-	KeyMaxProperties    = "maxProperties"
-	KeyMinProperties    = "minProperties"
-	KeyRequired         = "required"
-	KeyPropertyNames    = "propertyNames"
+	KeyDefault              = "default"
+	KeyExamples             = "examples"
+	KeyDescription          = "description"
+	KeyTitle                = "title"
+	KeyType                 = "type"
+	KeyConst                = "const"
+	KeyEnum                 = "enum"
+	KeyMultipleOf           = "multipleOf"
+	KeyMaximum              = "maximum"
+	KeyMinimum              = "minimum"
+	KeyExclusiveMaximum     = "exclusiveMaximum"
+	KeyExclusiveMinimum     = "exclusiveMinimum"
+	KeyMaxLength            = "maxLength"
+	KeyMinLength            = "minLength"
+	KeyPattern              = "pattern"
+	KeyMaxItems             = "maxItems"
+	KeyMinItems             = "minItems"
+	KeyMaxProperties        = "maxProperties"
+	KeyMinProperties        = "minProperties"
+	KeyRequired             = "required"
+	KeyPropertyNames        = "propertyNames"
+	KeyDependencies         = "dependencies"
+	KeyProperties           = "properties"
+	KeyItems                = "items"
+	KeyAdditionalProperties = "additionalProperties"
+	KeyAllOf                = "allOf"
+	KeyOneOf                = "oneOf"
+	KeyNot                  = "not"
+	KeyIf                   = "if"
+	KeyThen                 = "then"
+	KeyElse                 = "else"
+	KeyReadOnly             = "readOnly"
+	KeyWriteOnly            = "writeOnly"
+	KeySchema               = "$schema"
+	KeyId                   = "$id"
+	KeyRef                  = "$ref"
+	KeyComment              = "$comment"
+	KeyDefinitions          = "definitions"
+	KeyFormat               = "format"
+	KeyContentMediaType     = "contentMediaType"
+	KeyContentEncoding      = "contentEncoding"
+	KeyUniqueItems          = "uniqueItems"
+	KeyContains             = "contains"
+	KeyAdditionalItems      = "additionalItems"
+	KeyPatternProperties    = "patternProperties"
+	KeyAnyOf                = "anyOf"
 )
 
 //  NewConstraintBuilder creates a builder for JSON Schema compliant constraint
@@ -189,6 +221,273 @@ func (cb ConstraintBuilder) PropertyNames(properties map[string]interface{}) Con
 	return cb
 }
 
+// AdditionalProperties adds a constraint that the values of object properties
+// without their own schema must match the given schema.
+func (cb ConstraintBuilder) AdditionalProperties(schema map[string]interface{}) ConstraintBuilder {
+	cb[KeyAdditionalProperties] = schema
+
+	return cb
+}
+
+// ReadOnly annotates that the value is set by the broker and ignored if
+// sent by a client.
+func (cb ConstraintBuilder) ReadOnly(value bool) ConstraintBuilder {
+	cb[KeyReadOnly] = value
+
+	return cb
+}
+
+// WriteOnly annotates that the value is sent by a client but never returned
+// by the broker, like a password.
+func (cb ConstraintBuilder) WriteOnly(value bool) ConstraintBuilder {
+	cb[KeyWriteOnly] = value
+
+	return cb
+}
+
 func (cb ConstraintBuilder) Build() map[string]interface{} {
 	return cb
 }
+
+var _ Validatable = (ConstraintBuilder)(nil)
+
+// constraintKinds maps the draft-07 keywords to a check for their values.
+// Unknown keys are rejected so typos like "maxlength" aren't silently ignored.
+var constraintKinds = map[string]func(value interface{}) string{
+	KeyDefault:              isAny,
+	KeyExamples:             isList,
+	KeyDescription:          isString,
+	KeyTitle:                isString,
+	KeyType:                 isJSONSchemaTypeOrList,
+	KeyConst:                isAny,
+	KeyEnum:                 isList,
+	KeyMultipleOf:           isPositiveNumber,
+	KeyMaximum:              isNumber,
+	KeyMinimum:              isNumber,
+	KeyExclusiveMaximum:     isNumber,
+	KeyExclusiveMinimum:     isNumber,
+	KeyMaxLength:            isNonNegativeInteger,
+	KeyMinLength:            isNonNegativeInteger,
+	KeyPattern:              isRegexp,
+	KeyMaxItems:             isNonNegativeInteger,
+	KeyMinItems:             isNonNegativeInteger,
+	KeyMaxProperties:        isNonNegativeInteger,
+	KeyMinProperties:        isNonNegativeInteger,
+	KeyRequired:             isStringList,
+	KeyPropertyNames:        isSchema,
+	KeyDependencies:         isMap,
+	KeyProperties:           isMap,
+	KeyItems:                isSchemaOrList,
+	KeyAdditionalProperties: isSchemaOrBool,
+	KeyAllOf:                isList,
+	KeyOneOf:                isList,
+	KeyNot:                  isSchema,
+	KeyIf:                   isSchema,
+	KeyThen:                 isSchema,
+	KeyElse:                 isSchema,
+	KeyReadOnly:             isBool,
+	KeyWriteOnly:            isBool,
+	KeySchema:               isString,
+	KeyId:                   isString,
+	KeyRef:                  isString,
+	KeyComment:              isString,
+	KeyDefinitions:          isMap,
+	KeyFormat:               isString,
+	KeyContentMediaType:     isString,
+	KeyContentEncoding:      isString,
+	KeyUniqueItems:          isBool,
+	KeyContains:             isSchemaOrBool,
+	KeyAdditionalItems:      isSchemaOrBool,
+	KeyPatternProperties:    isMap,
+	KeyAnyOf:                isList,
+}
+
+// Validate implements Validatable. It checks every key is one the builder
+// supports and its value has the right type so mistakes in constraints
+// written by hand, like in YAML service definitions, are caught early.
+func (cb ConstraintBuilder) Validate() (errs *FieldError) {
+	var keys []string
+	for key := range cb {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		check, ok := constraintKinds[key]
+		if !ok {
+			errs = errs.Also(ErrInvalidKeyName(key, CurrentField, "the key isn't a supported JSON Schema constraint"))
+			continue
+		}
+
+		if expected := check(cb[key]); expected != "" {
+			errs = errs.Also(&FieldError{
+				Message: fmt.Sprintf("invalid value: %v", cb[key]),
+				Paths:   []string{key},
+				Details: fmt.Sprintf("expected %s", expected),
+			})
+		}
+	}
+
+	return errs
+}
+
+func isAny(value interface{}) string {
+	return ""
+}
+
+func isString(value interface{}) string {
+	if _, ok := value.(string); ok {
+		return ""
+	}
+
+	return "a string"
+}
+
+func isBool(value interface{}) string {
+	if _, ok := value.(bool); ok {
+		return ""
+	}
+
+	return "a boolean"
+}
+
+func isJSONSchemaType(value interface{}) string {
+	if str, ok := value.(string); ok && jsonSchemaTypeRegex.MatchString(str) {
+		return ""
+	}
+
+	return "a JSON Schema type"
+}
+
+// isJSONSchemaTypeOrList checks for a type or a list of types, draft-07 also
+// allows "null".
+func isJSONSchemaTypeOrList(value interface{}) string {
+	isType := func(v interface{}) bool {
+		return isJSONSchemaType(v) == "" || v == "null"
+	}
+
+	if isType(value) {
+		return ""
+	}
+
+	if isList(value) == "" {
+		list := reflect.ValueOf(value)
+		for i := 0; i < list.Len(); i++ {
+			if !isType(list.Index(i).Interface()) {
+				return "a JSON Schema type or list of types"
+			}
+		}
+
+		return ""
+	}
+
+	return "a JSON Schema type or list of types"
+}
+
+func isRegexp(value interface{}) string {
+	if str, ok := value.(string); ok {
+		if _, err := regexp.Compile(str); err == nil {
+			return ""
+		}
+	}
+
+	return "a regular expression"
+}
+
+func isList(value interface{}) string {
+	if value != nil && reflect.TypeOf(value).Kind() == reflect.Slice {
+		return ""
+	}
+
+	return "a list"
+}
+
+func isStringList(value interface{}) string {
+	if isList(value) == "" {
+		list := reflect.ValueOf(value)
+		for i := 0; i < list.Len(); i++ {
+			if isString(list.Index(i).Interface()) != "" {
+				return "a list of strings"
+			}
+		}
+
+		return ""
+	}
+
+	return "a list of strings"
+}
+
+func isMap(value interface{}) string {
+	if value != nil && reflect.TypeOf(value).Kind() == reflect.Map {
+		return ""
+	}
+
+	return "an object"
+}
+
+func isSchema(value interface{}) string {
+	if isMap(value) == "" {
+		return ""
+	}
+
+	return "a schema"
+}
+
+func isSchemaOrBool(value interface{}) string {
+	if isSchema(value) == "" || isBool(value) == "" {
+		return ""
+	}
+
+	return "a schema or boolean"
+}
+
+func isSchemaOrList(value interface{}) string {
+	if isSchema(value) == "" || isList(value) == "" {
+		return ""
+	}
+
+	return "a schema or list of schemas"
+}
+
+// toFloat converts numbers of any Go type to a float64.
+func toFloat(value interface{}) (float64, bool) {
+	if value == nil {
+		return 0, false
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+func isNumber(value interface{}) string {
+	if _, ok := toFloat(value); ok {
+		return ""
+	}
+
+	return "a number"
+}
+
+func isPositiveNumber(value interface{}) string {
+	if f, ok := toFloat(value); ok && f > 0 {
+		return ""
+	}
+
+	return "a number greater than 0"
+}
+
+func isNonNegativeInteger(value interface{}) string {
+	if f, ok := toFloat(value); ok && f >= 0 && f == float64(int64(f)) {
+		return ""
+	}
+
+	return "a non-negative integer"
+}
@@ -15,6 +15,7 @@
 package validation
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 )
@@ -105,6 +106,16 @@ func TestConstraintBuilder(t *testing.T) {
 			},
 		},
 
+		"annotations for access": {
+			Constraints: NewConstraintBuilder().
+				ReadOnly(true).
+				WriteOnly(false),
+			Expected: map[string]interface{}{
+				"readOnly":  true,
+				"writeOnly": false,
+			},
+		},
+
 		"secondOverwritesFirst": {
 			Constraints: NewConstraintBuilder().MaxLength(3).MaxLength(5).Build(),
 			Expected: map[string]interface{}{
@@ -123,3 +134,79 @@ func TestConstraintBuilder(t *testing.T) {
 		})
 	}
 }
+
+func TestConstraintBuilder_Validate(t *testing.T) {
+	cases := map[string]ValidatableTest{
+		"empty": {
+			Object: NewConstraintBuilder(),
+		},
+		"built": {
+			Object: NewConstraintBuilder().
+				Examples("a").
+				Pattern("^[a-z]+$").
+				MaxLength(10).
+				Minimum(-1).
+				Required("a").
+				PropertyNames(NewConstraintBuilder().Pattern("^a$").Build()).
+				ReadOnly(true),
+		},
+		"yaml and json types": {
+			Object: ConstraintBuilder{
+				"maxLength":            float64(10),
+				"maximum":              2.5,
+				"required":             []interface{}{"a", "b"},
+				"examples":             []interface{}{1, "two"},
+				"additionalProperties": false,
+				"items":                map[interface{}]interface{}{"type": "string"},
+			},
+		},
+		"draft-07 keywords": {
+			Object: ConstraintBuilder{
+				"$ref":              "#/definitions/name",
+				"definitions":       map[string]interface{}{"name": map[string]interface{}{"type": "string"}},
+				"format":            "email",
+				"uniqueItems":       true,
+				"contains":          map[string]interface{}{"const": "a"},
+				"anyOf":             []interface{}{map[string]interface{}{"minLength": 1}},
+				"patternProperties": map[string]interface{}{"^a": map[string]interface{}{"type": "string"}},
+				"type":              []interface{}{"string", "null"},
+				"items":             []interface{}{map[string]interface{}{"type": "string"}},
+			},
+		},
+		"unknown key": {
+			Object: ConstraintBuilder{"maxlength": 10},
+			Expect: errors.New(`invalid key name "maxlength": ` + "\nthe key isn't a supported JSON Schema constraint"),
+		},
+		"bad values": {
+			Object: ConstraintBuilder{
+				"maxLength":   -1,
+				"multipleOf":  0,
+				"pattern":     "(",
+				"required":    []interface{}{1},
+				"type":        "list",
+				"writeOnly":   "yes",
+				"uniqueItems": "no",
+			},
+			Expect: errors.New(`invalid value: (: pattern
+expected a regular expression
+invalid value: -1: maxLength
+expected a non-negative integer
+invalid value: 0: multipleOf
+expected a number greater than 0
+invalid value: [1]: required
+expected a list of strings
+invalid value: list: type
+expected a JSON Schema type or list of types
+invalid value: no: uniqueItems
+expected a boolean
+invalid value: yes: writeOnly
+expected a boolean`),
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			tc.Assert(t)
+		})
+	}
+}
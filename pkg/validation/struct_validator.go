@@ -21,6 +21,7 @@ import (
 	"regexp"
 
 	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hil"
 )
 
 var (
@@ -42,6 +43,18 @@ func ErrIfNotHCL(value string, field string) *FieldError {
 	}
 }
 
+// ErrIfNotHIL returns an error if the value is not a valid HIL template.
+func ErrIfNotHIL(value string, field string) *FieldError {
+	if _, err := hil.Parse(value); err == nil {
+		return nil
+	}
+
+	return &FieldError{
+		Message: "invalid HIL",
+		Paths:   []string{field},
+	}
+}
+
 // ErrIfNotJSON returns an error if the value is not valid JSON.
 func ErrIfNotJSON(value json.RawMessage, field string) *FieldError {
 	if json.Valid(value) {
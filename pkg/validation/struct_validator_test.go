@@ -51,6 +51,16 @@ func ExampleErrIfNotHCL() {
 	// Bad: invalid HCL: my-field
 }
 
+func ExampleErrIfNotHIL() {
+	fmt.Println("Good HIL is nil:", ErrIfNotHIL("https://example.com/${instance.name}", "my-field") == nil)
+	fmt.Println("Plain text is nil:", ErrIfNotHIL("https://example.com", "my-field") == nil)
+	fmt.Println("Bad:", ErrIfNotHIL("${instance.name", "my-field"))
+
+	// Output: Good HIL is nil: true
+	// Plain text is nil: true
+	// Bad: invalid HIL: my-field
+}
+
 func ExampleErrIfNotTerraformIdentifier() {
 	fmt.Println("Good is nil:", ErrIfNotTerraformIdentifier("good_id", "my-field") == nil)
 	fmt.Println("Bad:", ErrIfNotTerraformIdentifier("bad id", "my-field"))
@@ -17,8 +17,9 @@ package varcontext
 import (
 	"encoding/json"
 	"fmt"
-	"reflect"
+	"sort"
 
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/secrets"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/validation"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/varcontext/interpolation"
 	"github.com/GoogleCloudPlatform/gcp-service-broker/utils"
@@ -40,13 +41,34 @@ type ContextBuilder struct {
 	errors    *multierror.Error
 	context   map[string]interface{}
 	constants map[string]interface{}
+
+	// templates holds the template each value in the context was computed
+	// from, values that weren't computed from a template aren't present.
+	templates map[string]string
+
+	// resolveRefs is set if secret references in the current layer should be
+	// resolved, secrets maps keys holding resolved secrets to the references
+	// they came from.
+	resolveRefs bool
+	secrets     map[string]interface{}
+
+	// layer is the name of the source values are currently being merged from.
+	layer   string
+	tracing bool
+	trace   Trace
 }
 
+// ComputedFromKey is the key of the object that replaces values computed from
+// secrets in redacted output, it holds the names of the secrets.
+const ComputedFromKey = "$computed_from"
+
 // Builder creates a new ContextBuilder for constructing VariableContexts.
 func Builder() *ContextBuilder {
 	return &ContextBuilder{
 		context:   make(map[string]interface{}),
 		constants: make(map[string]interface{}),
+		templates: make(map[string]string),
+		secrets:   make(map[string]interface{}),
 	}
 }
 
@@ -59,6 +81,121 @@ func (builder *ContextBuilder) SetEvalConstants(constants map[string]interface{}
 	return builder
 }
 
+// EnableTrace makes the builder record every change to the context, see Trace.
+func (builder *ContextBuilder) EnableTrace() *ContextBuilder {
+	builder.tracing = true
+
+	return builder
+}
+
+// Layer names the source of the values merged after it, like user parameters
+// or plan overrides. The name is recorded in the trace.
+// Secret references aren't resolved in a new layer until ResolveReferences
+// is called.
+func (builder *ContextBuilder) Layer(name string) *ContextBuilder {
+	builder.layer = name
+	builder.resolveRefs = false
+
+	return builder
+}
+
+// ResolveReferences makes the builder replace secret references like
+// {"$ref": "env://PASSWORD"} with the values they point to when maps are
+// merged into the current layer, see the secrets package.
+//
+// Only call it for values set by operators, resolving references in user
+// input would let users read the broker's files and environment.
+func (builder *ContextBuilder) ResolveReferences() *ContextBuilder {
+	builder.resolveRefs = true
+
+	return builder
+}
+
+// Trace gets the changes recorded since EnableTrace was called in the order
+// they happened.
+func (builder *ContextBuilder) Trace() Trace {
+	return builder.trace
+}
+
+// TemplateFor gets the template the current value of the key was computed
+// from. It returns false if the value wasn't computed from a template.
+func (builder *ContextBuilder) TemplateFor(key string) (string, bool) {
+	template, ok := builder.templates[key]
+	return template, ok
+}
+
+// set sets the value of a key in the context and records it in the trace,
+// template is the one the value was evaluated from, if any.
+func (builder *ContextBuilder) set(key string, value interface{}, template string) {
+	builder.setSecret(key, value, nil, template)
+}
+
+// setSecret is like set, but if ref is non-nil the value is a secret resolved
+// from it and the trace only holds the reference.
+func (builder *ContextBuilder) setSecret(key string, value, ref interface{}, template string) {
+	if builder.tracing {
+		previous, overwrote := builder.context[key]
+		if previousRef, ok := builder.secrets[key]; ok {
+			previous = previousRef
+		}
+
+		traced := value
+		if ref != nil {
+			traced = ref
+		}
+
+		builder.trace = append(builder.trace, TraceEntry{
+			Key:       key,
+			Layer:     builder.layer,
+			Template:  template,
+			Value:     traced,
+			Previous:  previous,
+			Overwrote: overwrote,
+		})
+	}
+
+	builder.context[key] = value
+
+	if ref != nil {
+		builder.secrets[key] = ref
+	} else {
+		delete(builder.secrets, key)
+	}
+
+	if template != "" {
+		builder.templates[key] = template
+	} else {
+		delete(builder.templates, key)
+	}
+}
+
+// record adds an entry for a change that didn't happen to the trace.
+func (builder *ContextBuilder) record(entry TraceEntry) {
+	if builder.tracing {
+		entry.Layer = builder.layer
+		builder.trace = append(builder.trace, entry)
+	}
+}
+
+// EvaluationError is the error for a variable whose template couldn't be
+// evaluated or whose result couldn't be converted to the variable's type.
+type EvaluationError struct {
+	// Key is the name of the variable being computed.
+	Key string
+	// Template is the template the value was computed from.
+	Template string
+	// Type is the JSON Schema type the result was converted to, it's blank
+	// for untyped variables.
+	Type string
+	// Err is the underlying evaluation or conversion error.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *EvaluationError) Error() string {
+	return fmt.Sprintf("couldn't compute the value for %q from template %q: %v", e.Key, e.Template, e.Err)
+}
+
 // DefaultVariable holds a value that may or may not be evaluated.
 // If the value is a string then it will be evaluated.
 type DefaultVariable struct {
@@ -88,13 +225,14 @@ func (builder *ContextBuilder) MergeDefaults(brokerVariables []DefaultVariable)
 		}
 
 		if _, exists := builder.context[v.Name]; exists && !v.Overwrite {
+			builder.record(TraceEntry{Key: v.Name, Template: fmt.Sprintf("%v", v.Default), Skipped: true})
 			continue
 		}
 
 		if strVal, ok := v.Default.(string); ok {
 			builder.MergeEvalResult(v.Name, strVal, v.Type)
 		} else {
-			builder.context[v.Name] = v.Default
+			builder.set(v.Name, v.Default, "")
 		}
 
 		if _, exists := builder.context[v.Name]; exists && !v.Overwrite {
@@ -107,6 +245,10 @@ func (builder *ContextBuilder) MergeDefaults(brokerVariables []DefaultVariable)
 
 // MergeEvalResult evaluates the template against the templating engine and
 // merges in the value if the result is not an error.
+//
+// Lists and maps returned by the template are kept as-is, strings are parsed
+// as JSON if resultType is an array or object. If the result can't be
+// converted to resultType, an EvaluationError is added to the builder.
 func (builder *ContextBuilder) MergeEvalResult(key, template, resultType string) *ContextBuilder {
 	evaluationContext := make(map[string]interface{})
 	for k, v := range builder.context {
@@ -117,59 +259,157 @@ func (builder *ContextBuilder) MergeEvalResult(key, template, resultType string)
 	}
 
 	result, err := interpolation.Eval(template, evaluationContext)
-	if err != nil {
-		builder.errors = multierror.Append(fmt.Errorf("couldn't compute the value for %q, template: %q, %v", key, template, err))
-		return builder
+	if err == nil {
+		result, err = castTo(result, resultType)
 	}
 
-	converted, err := castTo(result, resultType)
 	if err != nil {
-		builder.errors = multierror.Append(err)
+		builder.errors = multierror.Append(builder.errors, &EvaluationError{Key: key, Template: template, Type: resultType, Err: err})
+		builder.record(TraceEntry{Key: key, Template: template, Error: err.Error()})
 		return builder
 	}
 
-	builder.context[key] = converted
+	if ref := builder.computedSecretRef(template); ref != nil {
+		builder.setSecret(key, result, ref, template)
+	} else {
+		builder.set(key, result, template)
+	}
 
 	return builder
 }
 
+// computedSecretRef gets the redacted form of a value computed from the
+// template if the template references any secrets, otherwise nil.
+// The redacted form names the secrets so they can be traced back.
+func (builder *ContextBuilder) computedSecretRef(template string) interface{} {
+	names, err := interpolation.Variables(template)
+	if err != nil {
+		return nil
+	}
+
+	var computedFrom []interface{}
+	for _, name := range names {
+		if _, ok := builder.secrets[name]; ok {
+			computedFrom = append(computedFrom, name)
+		}
+	}
+
+	if computedFrom == nil {
+		return nil
+	}
+
+	return map[string]interface{}{ComputedFromKey: computedFrom}
+}
+
 func toSliceE(value interface{}) ([]interface{}, error) {
-	kind := reflect.TypeOf(value).Kind()
-	switch kind {
-	case reflect.String:
+	if str, ok := value.(string); ok {
 		out := []interface{}{}
-		err := json.Unmarshal([]byte(value.(string)), &out)
+		err := json.Unmarshal([]byte(str), &out)
+		return out, err
+	}
+
+	out, err := cast.ToSliceE(value)
+	if out == nil && err == nil {
+		// cast drops empty lists to nil
+		out = []interface{}{}
+	}
+
+	return out, err
+}
+
+func toStringMapE(value interface{}) (map[string]interface{}, error) {
+	if str, ok := value.(string); ok {
+		out := map[string]interface{}{}
+		err := json.Unmarshal([]byte(str), &out)
 		return out, err
-	default:
-		return cast.ToSliceE(value)
 	}
+
+	return cast.ToStringMapE(value)
 }
 
+// castTo converts the result of a template to the JSON Schema type, a blank
+// type leaves the value as-is.
 func castTo(value interface{}, jsonType string) (interface{}, error) {
+	var (
+		out interface{}
+		err error
+	)
+
 	switch jsonType {
 	case TypeObject:
-		return cast.ToStringMapE(value)
+		out, err = toStringMapE(value)
 	case TypeBoolean:
-		return cast.ToBoolE(value)
+		out, err = cast.ToBoolE(value)
 	case TypeArray:
-		return toSliceE(value)
+		out, err = toSliceE(value)
 	case TypeNumber:
-		return cast.ToFloat64E(value)
+		out, err = cast.ToFloat64E(value)
 	case TypeString:
-		return cast.ToStringE(value)
+		out, err = cast.ToStringE(value)
 	case TypeInteger:
-		return cast.ToIntE(value)
+		out, err = cast.ToIntE(value)
 	case "": // for legacy compatibility
 		return value, nil
 	default:
-		return nil, fmt.Errorf("couldn't cast %v to %s, unknown type", value, jsonType)
+		return nil, fmt.Errorf("unknown type %q", jsonType)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("expected %s, got %s", withArticle(jsonType), describeValue(value))
+	}
+
+	return out, nil
+}
+
+// withArticle prefixes the JSON Schema type with "a" or "an".
+func withArticle(jsonType string) string {
+	switch jsonType {
+	case TypeObject, TypeArray, TypeInteger:
+		return "an " + jsonType
+	default:
+		return "a " + jsonType
+	}
+}
+
+// describeValue formats a template result for error messages.
+func describeValue(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return fmt.Sprintf("%q", value)
+	case []interface{}:
+		return fmt.Sprintf("a list %v", value)
+	case map[string]interface{}:
+		return fmt.Sprintf("a map %v", value)
+	default:
+		return fmt.Sprintf("%v", value)
 	}
 }
 
 // MergeMap inserts all the keys and values from the map into the context.
 func (builder *ContextBuilder) MergeMap(data map[string]interface{}) *ContextBuilder {
-	for k, v := range data {
-		builder.context[k] = v
+	// sorted so the trace is deterministic
+	var keys []string
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if !builder.resolveRefs {
+			builder.set(k, data[k], "")
+			continue
+		}
+
+		resolved, found, err := secrets.Resolve(data[k])
+		switch {
+		case err != nil:
+			builder.errors = multierror.Append(builder.errors, fmt.Errorf("couldn't resolve the secret reference for %q: %v", k, err))
+			builder.record(TraceEntry{Key: k, Value: data[k], Error: err.Error()})
+		case found:
+			builder.setSecret(k, resolved, data[k], "")
+		default:
+			builder.set(k, data[k], "")
+		}
 	}
 
 	return builder
@@ -211,7 +451,7 @@ func (builder *ContextBuilder) Build() (*VarContext, error) {
 		return nil, builder.errors
 	}
 
-	return &VarContext{context: builder.context}, nil
+	return &VarContext{context: builder.context, secrets: builder.secrets}, nil
 }
 
 // BuildMap is a shorthand of calling build then turning the returned varcontext
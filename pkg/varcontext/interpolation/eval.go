@@ -16,6 +16,7 @@ package interpolation
 
 import (
 	"reflect"
+	"sort"
 
 	"github.com/hashicorp/hil"
 	"github.com/hashicorp/hil/ast"
@@ -50,6 +51,14 @@ func Eval(templateString string, variables map[string]interface{}) (interface{},
 		return nil, err
 	}
 
+	// hil converts empty lists and maps to nil, but they're still values
+	switch {
+	case result.Type == hil.TypeList && result.Value == nil:
+		return []interface{}{}, nil
+	case result.Type == hil.TypeMap && result.Value == nil:
+		return map[string]interface{}{}, nil
+	}
+
 	return result.Value, err
 }
 
@@ -72,3 +81,29 @@ func IsHILExpression(template string) bool {
 	// evaluated
 	return !reflect.DeepEqual(template, result.Value)
 }
+
+// Variables gets the names of the variables the template references, sorted
+// and without duplicates.
+func Variables(template string) ([]string, error) {
+	tree, err := hil.Parse(template)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	tree.Accept(func(node ast.Node) ast.Node {
+		if access, ok := node.(*ast.VariableAccess); ok {
+			names[access.Name] = true
+		}
+
+		return node
+	})
+
+	var out []string
+	for name := range names {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+
+	return out, nil
+}
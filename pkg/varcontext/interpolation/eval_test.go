@@ -15,7 +15,9 @@
 package interpolation
 
 import (
+	"fmt"
 	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -59,6 +61,34 @@ func TestEval(t *testing.T) {
 		"map flatten blank":     {Template: `${map.flatten(":", ";", mapval)}`, Variables: map[string]interface{}{"mapval": map[string]string{}}, Expected: ``},
 		"map flatten one":       {Template: `${map.flatten(":", ";", mapval)}`, Variables: map[string]interface{}{"mapval": map[string]string{"key1": "val1"}}, Expected: `key1:val1`},
 		"map flatten":           {Template: `${map.flatten(":", ";", mapval)}`, Variables: map[string]interface{}{"mapval": map[string]string{"key1": "val1", "key2": "val2"}}, Expected: `key1:val1;key2:val2`},
+		"sha256":                {Template: `${hash.sha256("hello")}`, Expected: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		"md5":                   {Template: `${hash.md5("hello")}`, Expected: "5d41402abc4b2a76b9719d911017c592"},
+		"lower":                 {Template: `${str.lower("HeLLo")}`, Expected: "hello"},
+		"upper":                 {Template: `${str.upper("HeLLo")}`, Expected: "HELLO"},
+		"replace":               {Template: `${str.replace("_", "-", "a_b_c")}`, Expected: "a-b-c"},
+		"trim":                  {Template: `${str.trim(padded)}`, Variables: map[string]interface{}{"padded": " \t hello \n"}, Expected: "hello"},
+		"slug":                  {Template: `${str.slug(63, "My Service_Instance!")}`, Expected: "my-service-instance"},
+		"slug leading digits":   {Template: `${str.slug(63, "123-abc")}`, Expected: "abc"},
+		"slug truncated":        {Template: `${str.slug(6, "abcde fghij")}`, Expected: "abcde"},
+		"slug no letters":       {Template: `${str.slug(63, "123_456")}`, ErrorContains: "needs at least one letter"},
+		"split join":            {Template: `${list.join(",", str.split(" ", "a b c"))}`, Expected: "a,b,c"},
+		"join list":             {Template: `${list.join("-", list)}`, Variables: map[string]interface{}{"list": []interface{}{"a", 2}}, Expected: "a-2"},
+		"coalesce":              {Template: `${coalesce("", "b", "c")}`, Expected: "b"},
+		"coalesce empty":        {Template: `${coalesce("", "")}`, Expected: ""},
+		"map lookup":            {Template: `${map.lookup("a", "x", mapval)}`, Variables: map[string]interface{}{"mapval": map[string]interface{}{"a": 1}}, Expected: "1"},
+		"map lookup default":    {Template: `${map.lookup("b", "x", mapval)}`, Variables: map[string]interface{}{"mapval": map[string]interface{}{"a": 1}}, Expected: "x"},
+		"map merge":             {Template: `${map.flatten("=", ",", map.merge(a, b))}`, Variables: map[string]interface{}{"a": map[string]string{"x": "1", "y": "1"}, "b": map[string]string{"y": "2"}}, Expected: "x=1,y=2"},
+		"name resource":         {Template: `${name.resource("redis_instance", "pcf-sb", id)}`, Variables: map[string]interface{}{"id": "abc"}, Expected: "pcf-sb-xj4bnp4pahh6"},
+		"time format":           {Template: `${time.format("no layout")}`, Expected: "no layout"},
+		"list parse string":     {Template: `${list.parse(",", value)}`, Variables: map[string]interface{}{"value": "a, b,,c"}, Expected: []interface{}{"a", "b", "c"}},
+		"list parse empty":      {Template: `${list.parse(",", "")}`, Expected: []interface{}{}},
+		"list parse list":       {Template: `${list.parse(",", value)}`, Variables: map[string]interface{}{"value": []interface{}{"a,b"}}, Expected: []interface{}{"a,b"}},
+		"list parse empty list": {Template: `${list.parse(",", value)}`, Variables: map[string]interface{}{"value": []interface{}{}}, Expected: []interface{}{}},
+		"list parse map":        {Template: `${list.parse(",", value)}`, Variables: map[string]interface{}{"value": map[string]interface{}{}}, ErrorContains: "expected a list or string"},
+		"map parse string":      {Template: `${map.parse("=", ",", value)}`, Variables: map[string]interface{}{"value": "a=1, b=x=y"}, Expected: map[string]interface{}{"a": "1", "b": "x=y"}},
+		"map parse empty":       {Template: `${map.parse("=", ",", "")}`, Expected: map[string]interface{}{}},
+		"map parse map":         {Template: `${map.parse("=", ",", value)}`, Variables: map[string]interface{}{"value": map[string]interface{}{"a": "1"}}, Expected: map[string]interface{}{"a": "1"}},
+		"map parse invalid":     {Template: `${map.parse("=", ",", "a=1,b")}`, ErrorContains: `expected "b" to be a key and value separated by "="`},
 	}
 
 	for tn, tc := range tests {
@@ -108,6 +138,70 @@ func TestHilFuncRandBase64(t *testing.T) {
 	}
 }
 
+func TestHilFuncUuidV4(t *testing.T) {
+	uuidRegex := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	first, _ := Eval("${uuid.v4()}", nil)
+	second, _ := Eval("${uuid.v4()}", nil)
+
+	for _, result := range []interface{}{first, second} {
+		if !uuidRegex.MatchString(result.(string)) {
+			t.Errorf("Expected %q to be a v4 UUID", result)
+		}
+	}
+
+	if first == second {
+		t.Errorf("Expected different UUIDs, got %q twice", first)
+	}
+}
+
+func TestHilFuncRandIds(t *testing.T) {
+	cases := map[string]struct {
+		Template string
+		Pattern  string
+	}{
+		"base32": {Template: "${rand.base32(5)}", Pattern: "^[a-z2-7]{8}$"},
+		"hex":    {Template: "${rand.hex(4)}", Pattern: "^[0-9a-f]{8}$"},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			result, err := Eval(tc.Template, nil)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if !regexp.MustCompile(tc.Pattern).MatchString(result.(string)) {
+				t.Errorf("Expected %q to match %s", result, tc.Pattern)
+			}
+		})
+	}
+}
+
+func TestHilFuncTimeFormat(t *testing.T) {
+	result, err := Eval(`${time.format("2006")}`, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// allow the year to roll over between the two calls
+	if expected := time.Now().UTC().Format("2006"); result != expected && result != fmt.Sprint(cast.ToInt(expected)-1) {
+		t.Errorf("Expected the current year %s, got %v", expected, result)
+	}
+}
+
+func TestStandardLibraryDocumented(t *testing.T) {
+	for _, fn := range standardLibrary {
+		if fn.Signature == "" || fn.Description == "" {
+			t.Errorf("Expected %s to have a signature and description", fn.Name)
+		}
+
+		if !strings.HasPrefix(fn.Signature, fn.Name+"(") {
+			t.Errorf("Expected the signature of %s to start with its name, got %q", fn.Name, fn.Signature)
+		}
+	}
+}
+
 func TestHilToInterface(t *testing.T) {
 	// This function tests hilToInterface operates correctly with regards to
 	// taking valid user inputs (i.e. only JSON values), converting them to HIL
@@ -169,3 +263,32 @@ func TestIsHILExpression(t *testing.T) {
 		})
 	}
 }
+
+func TestVariables(t *testing.T) {
+	cases := map[string]struct {
+		expr     string
+		expected []string
+		err      bool
+	}{
+		"plain string":   {expr: "abcd", expected: nil},
+		"bad expression": {expr: "${", err: true},
+		"variable":       {expr: "${a}", expected: []string{"a"}},
+		"duplicates":     {expr: "${a}-${a}", expected: []string{"a"}},
+		"function args":  {expr: `${str.truncate(10, b)}-${a}`, expected: []string{"a", "b"}},
+		"index":          {expr: `${instance.details["name"]}`, expected: []string{"instance.details"}},
+		"conditional":    {expr: `${a ? b : "c"}`, expected: []string{"a", "b"}},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			actual, err := Variables(tc.expr)
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error? %t got: %v", tc.err, err)
+			}
+
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected variables: %v got %v for %v", tc.expected, actual, tc.expr)
+			}
+		})
+	}
+}
@@ -15,8 +15,12 @@
 package interpolation
 
 import (
+	"crypto/md5"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -26,6 +30,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/GoogleCloudPlatform/gcp-service-broker/pkg/naming"
 	"github.com/hashicorp/hil"
 	"github.com/hashicorp/hil/ast"
 	"github.com/spf13/cast"
@@ -33,20 +38,242 @@ import (
 
 var hilStandardLibrary = createStandardLibrary()
 
+// libraryFunction holds a function in the standard library along with its
+// documentation.
+type libraryFunction struct {
+	// Name is the name the function is called by.
+	Name string
+	// Signature shows the function's arguments and return type.
+	Signature string
+	// Description is a Markdown description of the function.
+	Description string
+	// Build creates the function, functions with state like counters get new
+	// state each time.
+	Build func() ast.Function
+}
+
+// standardLibrary holds the functions available to templates in the order
+// they're documented.
+var standardLibrary = []libraryFunction{
+	{
+		Name:      "assert",
+		Signature: "assert(condition_bool, message_string) -> bool",
+		Description: `If the condition is false, then an error will be raised to the user containing ` + "`message_string`" + `.
+Avoid using this function. Instead, try to make it so your users can't get into a bad state to begin with.
+In the words of [PEP-20](https://www.python.org/dev/peps/pep-0020/): if the implementation is hard to explain, it's a bad idea.`,
+		Build: hilFuncAssert,
+	},
+	{
+		Name:      "coalesce",
+		Signature: "coalesce(string...) -> string",
+		Description: "Returns the first argument that isn't an empty string, or an empty string if they all are.\n" +
+			"Example: `coalesce(name, \"default\")`.",
+		Build: hilFuncCoalesce,
+	},
+	{
+		Name:      "counter.next",
+		Signature: "counter.next() -> int",
+		Description: `Provides a counter that increments once per call within the same call context.
+The counter is reset on restart of the application.`,
+		Build: hilFuncCounterNext,
+	},
+	{
+		Name:        "hash.md5",
+		Signature:   "hash.md5(string) -> string",
+		Description: "Returns the hex encoded MD5 sum of the string. Don't use it for anything security sensitive.",
+		Build:       hilFuncHashMd5,
+	},
+	{
+		Name:        "hash.sha256",
+		Signature:   "hash.sha256(string) -> string",
+		Description: "Returns the hex encoded SHA-256 sum of the string.",
+		Build:       hilFuncHashSha256,
+	},
+	{
+		Name:        "json.marshal",
+		Signature:   "json.marshal(type) -> string",
+		Description: "Returns a JSON marshaled string of the given type.",
+		Build:       hilFuncJSONMarshal,
+	},
+	{
+		Name:      "list.join",
+		Signature: "list.join(separator, list) -> string",
+		Description: "Joins the elements of the list into a string with the separator between them.\n" +
+			"Example: `list.join(\",\", str.split(\" \", \"a b c\"))` produces `a,b,c`.",
+		Build: hilFuncListJoin,
+	},
+	{
+		Name:      "list.parse",
+		Signature: "list.parse(separator, value) -> list",
+		Description: "Returns the value if it's a list, otherwise splits the string on the separator and trims whitespace from the elements.\n" +
+			"Empty elements are dropped so an empty string produces an empty list.\n" +
+			"Use it to accept both lists and the delimited strings older versions of an input took.\n" +
+			"Example: `list.parse(\",\", \"a, b\")` and `list.parse(\",\", [\"a\", \"b\"])` both produce `[\"a\", \"b\"]`.",
+		Build: hilFuncListParse,
+	},
+	{
+		Name:      "map.flatten",
+		Signature: "map.flatten(keyValueSeparator, tupleSeparator, map) -> string",
+		Description: "Converts a map into a string with each key/value pair separated by `keyValueSeparator` and each entry separated by `tupleSeparator`.\n" +
+			"The output is deterministic.\n" +
+			"Example: if `labels = {\"key1\":\"val1\", \"key2\":\"val2\"}` then `map.flatten(\":\", \";\", labels)` produces `key1:val1;key2:val2`.",
+		Build: hilFuncMapFlatten,
+	},
+	{
+		Name:      "map.lookup",
+		Signature: "map.lookup(key, default, map) -> string",
+		Description: "Returns the value of the key in the map, or the default if the map doesn't contain it.\n" +
+			"Example: `map.lookup(\"pcf-space-guid\", \"\", request.default_labels)` produces the space GUID label, or an empty string if the instance wasn't created in a space.",
+		Build: hilFuncMapLookup,
+	},
+	{
+		Name:        "map.merge",
+		Signature:   "map.merge(map, map) -> map",
+		Description: "Returns a map with the keys of both maps, values in the second map take precedence.",
+		Build:       hilFuncMapMerge,
+	},
+	{
+		Name:      "map.parse",
+		Signature: "map.parse(keyValueSeparator, tupleSeparator, value) -> map",
+		Description: "Returns the value if it's a map, otherwise parses the string produced by `map.flatten`.\n" +
+			"Use it to accept both maps and the delimited strings older versions of an input took.\n" +
+			"Example: `map.parse(\"=\", \",\", \"a=1,b=2\")` produces `{\"a\":\"1\", \"b\":\"2\"}`.",
+		Build: hilFuncMapParse,
+	},
+	{
+		Name:        "name.resource",
+		Signature:   "name.resource(resource_type, prefix, instance_id) -> string",
+		Description: nameResourceDescription(),
+		Build:       hilFuncNameResource,
+	},
+	{
+		Name:      "rand.base32",
+		Signature: "rand.base32(count) -> string",
+		Description: "Generates `count` bytes of cryptographically secure randomness and converts it to lowercase [Base32](https://tools.ietf.org/html/rfc4648) without padding.\n" +
+			"The output only contains the characters `a-z` and `2-7` so it's safe to use in resource names.",
+		Build: hilFuncRandBase32,
+	},
+	{
+		Name:      "rand.base64",
+		Signature: "rand.base64(count) -> string",
+		Description: "Generates `count` bytes of cryptographically secure randomness and converts it to [URL Encoded Base64](https://tools.ietf.org/html/rfc4648).\n" +
+			"The randomness makes it suitable for using as passwords.",
+		Build: hilFuncRandBase64,
+	},
+	{
+		Name:        "rand.hex",
+		Signature:   "rand.hex(count) -> string",
+		Description: "Generates `count` bytes of cryptographically secure randomness and converts it to lowercase hex.",
+		Build:       hilFuncRandHex,
+	},
+	{
+		Name:        "regexp.matches",
+		Signature:   "regexp.matches(regex_string, string) -> bool",
+		Description: "Checks if the string matches the given regex.",
+		Build:       hilFuncRegexpMatches,
+	},
+	{
+		Name:        "str.lower",
+		Signature:   "str.lower(string) -> string",
+		Description: "Converts the string to lowercase.",
+		Build:       hilFuncStrLower,
+	},
+	{
+		Name:        "str.queryEscape",
+		Signature:   "str.queryEscape(string) -> string",
+		Description: "Escapes the string so it can be safely placed inside a URL query.",
+		Build:       hilFuncStrQueryEscape,
+	},
+	{
+		Name:      "str.replace",
+		Signature: "str.replace(old, new, string) -> string",
+		Description: "Replaces every occurrence of `old` in the string with `new`.\n" +
+			"Example: `str.replace(\"_\", \"-\", \"my_name\")` produces `my-name`.",
+		Build: hilFuncStrReplace,
+	},
+	{
+		Name:      "str.slug",
+		Signature: "str.slug(max_length, string) -> string",
+		Description: "Converts the string into a name that's safe to use as a DNS label and follows the naming rules of most GCP resources: " +
+			"it only contains lowercase letters, digits and hyphens, starts with a letter, doesn't end with a hyphen and is at most `max_length` characters long.\n" +
+			"Runs of other characters become a single hyphen and leading characters that aren't letters are removed.\n" +
+			"It's an error if nothing is left.\n" +
+			"Example: `str.slug(63, \"My Service_Instance!\")` produces `my-service-instance`.",
+		Build: hilFuncStrSlug,
+	},
+	{
+		Name:        "str.split",
+		Signature:   "str.split(separator, string) -> list",
+		Description: "Splits the string into a list of the substrings between each separator.",
+		Build:       hilFuncStrSplit,
+	},
+	{
+		Name:        "str.trim",
+		Signature:   "str.trim(string) -> string",
+		Description: "Removes leading and trailing whitespace from the string.",
+		Build:       hilFuncStrTrim,
+	},
+	{
+		Name:      "str.truncate",
+		Signature: "str.truncate(count, string) -> string",
+		Description: "Trims the given string to be at most `count` characters long.\n" +
+			"If the string is already shorter, nothing is changed.",
+		Build: hilFuncStrTruncate,
+	},
+	{
+		Name:        "str.upper",
+		Signature:   "str.upper(string) -> string",
+		Description: "Converts the string to uppercase.",
+		Build:       hilFuncStrUpper,
+	},
+	{
+		Name:      "time.format",
+		Signature: "time.format(layout) -> string",
+		Description: "Formats the current UTC time using a [Go time layout](https://golang.org/pkg/time/#pkg-constants).\n" +
+			"Example: `time.format(\"20060102\")` produces the date like `20200131`.",
+		Build: hilFuncTimeFormat,
+	},
+	{
+		Name:      "time.nano",
+		Signature: "time.nano() -> string",
+		Description: "Returns the current time as a Unix time, the number of nanoseconds elapsed since January 1, 1970 UTC, as a decimal string.\n" +
+			"The result is undefined if the Unix time in nanoseconds cannot be represented by an int64 (a date before the year 1678 or after 2262).",
+		Build: hilFuncTimeNano,
+	},
+	{
+		Name:        "uuid.v4",
+		Signature:   "uuid.v4() -> string",
+		Description: "Generates a random version 4 UUID like `0b6f2c8e-1e4a-4d0b-9a7f-3c2d1e0f9a8b`.",
+		Build:       hilFuncUuidV4,
+	},
+}
+
 // createStandardLibrary instantiates all the functions and associates them
 // to their names in a lookup table for our standard library.
 func createStandardLibrary() map[string]ast.Function {
-	return map[string]ast.Function{
-		"time.nano":       hilFuncTimeNano(),
-		"str.truncate":    hilFuncStrTruncate(),
-		"str.queryEscape": hilFuncStrQueryEscape(),
-		"regexp.matches":  hilFuncRegexpMatches(),
-		"counter.next":    hilFuncCounterNext(),
-		"rand.base64":     hilFuncRandBase64(),
-		"assert":          hilFuncAssert(),
-		"json.marshal":    hilFuncJSONMarshal(),
-		"map.flatten":     hilFuncMapFlatten(),
+	out := make(map[string]ast.Function)
+	for _, fn := range standardLibrary {
+		out[fn.Name] = fn.Build()
 	}
+
+	return out
+}
+
+// FunctionDocumentation generates Markdown documentation for the functions
+// available to templates.
+func FunctionDocumentation() string {
+	var b strings.Builder
+	b.WriteString("# Expression language functions\n\n")
+	b.WriteString("The following functions are available to [HIL](https://github.com/hashicorp/hil) templates in brokerpaks.\n")
+
+	for _, fn := range standardLibrary {
+		fmt.Fprintf(&b, "\n## %s\n\n`%s`\n\n%s\n", fn.Name, fn.Signature, fn.Description)
+	}
+
+	b.WriteString("\n---------------------------------------\n\n")
+	b.WriteString("_Note: **Do not edit this file**, it was auto-generated by running <code>gcp-service-broker generate functions</code>. If you find an error, change the source code in <tt>funcs.go</tt> or file a bug._\n")
+
+	return b.String()
 }
 
 // hilFuncTimeNano creates a function that returns the current UNIX timestamp
@@ -200,6 +427,358 @@ func hilFuncMapFlatten() ast.Function {
 	}
 }
 
+// hilFuncUuidV4 generates a random version 4 UUID.
+// uuid.v4() -> "0b6f2c8e-1e4a-4d0b-9a7f-3c2d1e0f9a8b"
+func hilFuncUuidV4() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				return "", err
+			}
+
+			// set the version (4) and variant (RFC 4122) bits
+			b[6] = (b[6] & 0x0f) | 0x40
+			b[8] = (b[8] & 0x3f) | 0x80
+
+			return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+		},
+	}
+}
+
+// hilFuncHashSha256 hashes a string with SHA-256 and hex encodes the sum.
+// hash.sha256("hello") -> "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+func hilFuncHashSha256() ast.Function {
+	return hilStringFunc(func(s string) (string, error) {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(s))), nil
+	})
+}
+
+// hilFuncHashMd5 hashes a string with MD5 and hex encodes the sum.
+// hash.md5("hello") -> "5d41402abc4b2a76b9719d911017c592"
+func hilFuncHashMd5() ast.Function {
+	return hilStringFunc(func(s string) (string, error) {
+		return fmt.Sprintf("%x", md5.Sum([]byte(s))), nil
+	})
+}
+
+// hilFuncStrLower converts a string to lowercase. str.lower("Hi") -> "hi"
+func hilFuncStrLower() ast.Function {
+	return hilStringFunc(func(s string) (string, error) {
+		return strings.ToLower(s), nil
+	})
+}
+
+// hilFuncStrUpper converts a string to uppercase. str.upper("Hi") -> "HI"
+func hilFuncStrUpper() ast.Function {
+	return hilStringFunc(func(s string) (string, error) {
+		return strings.ToUpper(s), nil
+	})
+}
+
+// hilFuncStrTrim removes leading and trailing whitespace from a string.
+// str.trim(" hi ") -> "hi"
+func hilFuncStrTrim() ast.Function {
+	return hilStringFunc(func(s string) (string, error) {
+		return strings.TrimSpace(s), nil
+	})
+}
+
+// hilFuncStrReplace replaces all occurrences of a substring.
+// str.replace("_", "-", "a_b") -> "a-b"
+func hilFuncStrReplace() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString, ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			return strings.Replace(args[2].(string), args[0].(string), args[1].(string), -1), nil
+		},
+	}
+}
+
+var (
+	slugInvalidChars  = regexp.MustCompile(`[^a-z0-9]+`)
+	slugLeadingChars  = regexp.MustCompile(`^[^a-z]+`)
+	slugValidationRgx = regexp.MustCompile(`^[a-z]([-a-z0-9]*[a-z0-9])?$`)
+)
+
+// hilFuncStrSlug converts a string into a DNS label that follows GCP naming
+// rules with the given maximum length.
+// str.slug(63, "My Instance!") -> "my-instance"
+func hilFuncStrSlug() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeInt, ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			maxLength := args[0].(int)
+			str := args[1].(string)
+
+			slug := slugInvalidChars.ReplaceAllString(strings.ToLower(str), "-")
+			slug = slugLeadingChars.ReplaceAllString(slug, "")
+			if maxLength >= 0 && len(slug) > maxLength {
+				slug = slug[:maxLength]
+			}
+			slug = strings.TrimRight(slug, "-")
+
+			if !slugValidationRgx.MatchString(slug) {
+				return nil, fmt.Errorf("couldn't make a name from %q, it needs at least one letter", str)
+			}
+
+			return slug, nil
+		},
+	}
+}
+
+// hilFuncRandBase32 creates n cryptographically-secure random bytes and
+// converts them to lowercase unpadded Base32 rand.base32(5) -> "mfrggzdf".
+func hilFuncRandBase32() ast.Function {
+	return hilRandFunc(func(rb []byte) string {
+		return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(rb))
+	})
+}
+
+// hilFuncRandHex creates n cryptographically-secure random bytes and
+// converts them to hex rand.hex(4) -> "9f86d081".
+func hilFuncRandHex() ast.Function {
+	return hilRandFunc(hex.EncodeToString)
+}
+
+// hilFuncTimeFormat formats the current UTC time with the given Go layout.
+// time.format("2006") -> "2020"
+func hilFuncTimeFormat() ast.Function {
+	return hilStringFunc(func(layout string) (string, error) {
+		return time.Now().UTC().Format(layout), nil
+	})
+}
+
+// hilFuncStrSplit splits a string into a list on a separator.
+// str.split(",", "a,b") -> ["a", "b"]
+func hilFuncStrSplit() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString},
+		ReturnType: ast.TypeList,
+		Callback: func(args []interface{}) (interface{}, error) {
+			var out []ast.Variable
+			for _, part := range strings.Split(args[1].(string), args[0].(string)) {
+				out = append(out, ast.Variable{Type: ast.TypeString, Value: part})
+			}
+
+			return out, nil
+		},
+	}
+}
+
+// hilFuncListJoin joins the elements of a list with a separator.
+// list.join(",", ["a", "b"]) -> "a,b"
+func hilFuncListJoin() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeList},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			unwrapped, err := hilToInterface(args[1])
+			if err != nil {
+				return nil, err
+			}
+
+			var parts []string
+			for _, v := range unwrapped.([]interface{}) {
+				parts = append(parts, fmt.Sprintf("%v", v))
+			}
+
+			return strings.Join(parts, args[0].(string)), nil
+		},
+	}
+}
+
+// hilFuncListParse passes lists through and splits strings into lists.
+// list.parse(",", "a, b") -> ["a", "b"]
+func hilFuncListParse() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeAny},
+		ReturnType: ast.TypeList,
+		Callback: func(args []interface{}) (interface{}, error) {
+			switch value := args[1].(type) {
+			case []ast.Variable:
+				return value, nil
+
+			case string:
+				out := []ast.Variable{}
+				for _, part := range strings.Split(value, args[0].(string)) {
+					if part = strings.TrimSpace(part); part != "" {
+						out = append(out, ast.Variable{Type: ast.TypeString, Value: part})
+					}
+				}
+				return out, nil
+
+			default:
+				return nil, fmt.Errorf("expected a list or string, got %T", value)
+			}
+		},
+	}
+}
+
+// hilFuncCoalesce returns the first non-empty string argument.
+// coalesce("", "b", "c") -> "b"
+func hilFuncCoalesce() ast.Function {
+	return ast.Function{
+		ArgTypes:     []ast.Type{},
+		Variadic:     true,
+		VariadicType: ast.TypeString,
+		ReturnType:   ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			for _, arg := range args {
+				if str := arg.(string); str != "" {
+					return str, nil
+				}
+			}
+
+			return "", nil
+		},
+	}
+}
+
+// hilFuncMapMerge combines two maps, values from the second take precedence.
+// map.merge({"a":"1"}, {"b":"2"}) -> {"a":"1", "b":"2"}
+func hilFuncMapMerge() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeMap, ast.TypeMap},
+		ReturnType: ast.TypeMap,
+		Callback: func(args []interface{}) (interface{}, error) {
+			out := make(map[string]ast.Variable)
+			for _, arg := range args {
+				for k, v := range arg.(map[string]ast.Variable) {
+					out[k] = v
+				}
+			}
+
+			return out, nil
+		},
+	}
+}
+
+// hilFuncMapParse passes maps through and parses strings like the ones
+// map.flatten produces into maps.
+// map.parse("=", ",", "a=1,b=2") -> {"a":"1", "b":"2"}
+func hilFuncMapParse() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString, ast.TypeAny},
+		ReturnType: ast.TypeMap,
+		Callback: func(args []interface{}) (interface{}, error) {
+			kvSep, tupleSep := args[0].(string), args[1].(string)
+
+			switch value := args[2].(type) {
+			case map[string]ast.Variable:
+				return value, nil
+
+			case string:
+				out := make(map[string]ast.Variable)
+				for _, tuple := range strings.Split(value, tupleSep) {
+					if strings.TrimSpace(tuple) == "" {
+						continue
+					}
+
+					kv := strings.SplitN(tuple, kvSep, 2)
+					if len(kv) != 2 {
+						return nil, fmt.Errorf("expected %q to be a key and value separated by %q", tuple, kvSep)
+					}
+
+					out[strings.TrimSpace(kv[0])] = ast.Variable{Type: ast.TypeString, Value: strings.TrimSpace(kv[1])}
+				}
+				return out, nil
+
+			default:
+				return nil, fmt.Errorf("expected a map or string, got %T", value)
+			}
+		},
+	}
+}
+
+// hilFuncMapLookup gets the value of a key in a map or a default if it's
+// missing. map.lookup("a", "x", {"a":"1"}) -> "1"
+func hilFuncMapLookup() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString, ast.TypeMap},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			value, ok := args[2].(map[string]ast.Variable)[args[0].(string)]
+			if !ok {
+				return args[1].(string), nil
+			}
+
+			unwrapped, err := hilToInterface(value)
+			if err != nil {
+				return nil, err
+			}
+
+			return cast.ToStringE(unwrapped)
+		},
+	}
+}
+
+// hilFuncNameResource generates a stable name for a resource from the ID of
+// the instance it belongs to.
+// name.resource("redis_instance", "pcf-sb", "abc") -> "pcf-sb-xj4bnp4pahh6"
+func hilFuncNameResource() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString, ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			return naming.Generate(args[0].(string), args[1].(string), args[2].(string))
+		},
+	}
+}
+
+// nameResourceDescription documents name.resource along with the rules for
+// each resource type.
+func nameResourceDescription() string {
+	var b strings.Builder
+	b.WriteString("Generates a name for a resource from the prefix and a hash of the instance ID, usually `request.instance_id`.\n")
+	b.WriteString("The same instance always gets the same name, even across broker restarts and replicas.\n")
+	b.WriteString("When the broker is serving requests, names used by other service instances are skipped.\n")
+	b.WriteString("Names start with a letter and contain only lowercase letters, digits and the separator for the resource type.\n")
+	b.WriteString("The prefix is truncated so the name fits in the maximum length.\n")
+	b.WriteString("Unknown resource types use the `default` rule.\n")
+	b.WriteString("Example: `name.resource(\"redis_instance\", \"pcf-sb\", request.instance_id)`.\n\n")
+	b.WriteString("| Resource type | Max length | Separator |\n")
+	b.WriteString("|---|---|---|\n")
+	for _, resourceType := range naming.ResourceTypes() {
+		rule := naming.RuleFor(resourceType)
+		fmt.Fprintf(&b, "| `%s` | %d | `%s` |\n", resourceType, rule.MaxLength, rule.Separator)
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// hilStringFunc creates a hil function that transforms a single string.
+func hilStringFunc(transform func(string) (string, error)) ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			return transform(args[0].(string))
+		},
+	}
+}
+
+// hilRandFunc creates a hil function that generates n cryptographically-secure
+// random bytes and encodes them as a string.
+func hilRandFunc(encode func([]byte) string) ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeInt},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			rb := make([]byte, args[0].(int))
+			if _, err := rand.Read(rb); err != nil {
+				return "", err
+			}
+
+			return encode(rb), nil
+		},
+	}
+}
+
 func hilToInterface(arg interface{}) (interface{}, error) {
 	// The types here cover what HIL supports.
 	switch arg.(type) {
@@ -0,0 +1,63 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package varcontext
+
+// TraceEntry records a single change, or attempted change, to a key in a
+// ContextBuilder.
+type TraceEntry struct {
+	// Key is the variable that was changed.
+	Key string `json:"key"`
+	// Layer is the source of the change set with ContextBuilder.Layer.
+	Layer string `json:"layer,omitempty"`
+	// Template is the HIL template the value was evaluated from, if any.
+	Template string `json:"template,omitempty"`
+	// Value is the value the key was set to.
+	Value interface{} `json:"value,omitempty"`
+	// Previous is the value that was overwritten if Overwrote is true.
+	Previous  interface{} `json:"previous,omitempty"`
+	Overwrote bool        `json:"overwrote,omitempty"`
+	// Skipped is true if a default wasn't applied because the key was
+	// already set and the default doesn't overwrite.
+	Skipped bool `json:"skipped,omitempty"`
+	// Error holds the reason the template couldn't be evaluated.
+	Error string `json:"error,omitempty"`
+}
+
+// Trace holds the changes made by a ContextBuilder in order.
+type Trace []TraceEntry
+
+// ForKey gets the entries that changed the given key.
+func (t Trace) ForKey(key string) Trace {
+	var out Trace
+	for _, entry := range t {
+		if entry.Key == key {
+			out = append(out, entry)
+		}
+	}
+
+	return out
+}
+
+// SetBy gets the entry that set the final value of the key, if any.
+func (t Trace) SetBy(key string) (TraceEntry, bool) {
+	entries := t.ForKey(key)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Skipped && entries[i].Error == "" {
+			return entries[i], true
+		}
+	}
+
+	return TraceEntry{}, false
+}
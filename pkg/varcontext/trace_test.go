@@ -0,0 +1,91 @@
+// Copyright 2020 the Service Broker Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package varcontext
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestContextBuilder_Trace(t *testing.T) {
+	builder := Builder().
+		EnableTrace().
+		SetEvalConstants(map[string]interface{}{"request.instance_id": "abc"}).
+		Layer("user").
+		MergeMap(map[string]interface{}{"name": "user-name", "size": 1}).
+		Layer("defaults").
+		MergeDefaults([]DefaultVariable{
+			{Name: "name", Default: "default-name"},
+			{Name: "region", Default: "us-central1"},
+		}).
+		Layer("computed").
+		MergeDefaults([]DefaultVariable{
+			{Name: "size", Default: "${size + 1}", Overwrite: true, Type: TypeInteger},
+			{Name: "id", Default: "${request.instance_id}-${name}"},
+			{Name: "bad", Default: "${missing}"},
+		})
+
+	expected := Trace{
+		{Key: "name", Layer: "user", Value: "user-name"},
+		{Key: "size", Layer: "user", Value: 1},
+		{Key: "name", Layer: "defaults", Template: "default-name", Skipped: true},
+		{Key: "region", Layer: "defaults", Template: "us-central1", Value: "us-central1"},
+		{Key: "size", Layer: "computed", Template: "${size + 1}", Value: 2, Previous: 1, Overwrote: true},
+		{Key: "id", Layer: "computed", Template: "${request.instance_id}-${name}", Value: "abc-user-name"},
+		{Key: "bad", Layer: "computed", Template: "${missing}", Error: builder.Trace()[6].Error},
+	}
+
+	if actual := builder.Trace(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected trace:\n%#v\ngot:\n%#v", expected, actual)
+	}
+
+	if builder.Trace()[6].Error == "" {
+		t.Error("Expected the failed evaluation to record an error")
+	}
+
+	t.Run("ForKey", func(t *testing.T) {
+		if actual := builder.Trace().ForKey("size"); !reflect.DeepEqual(actual, Trace{expected[1], expected[4]}) {
+			t.Errorf("Expected the entries for size, got: %#v", actual)
+		}
+	})
+
+	t.Run("SetBy", func(t *testing.T) {
+		cases := map[string]struct {
+			Key      string
+			Expected TraceEntry
+			Found    bool
+		}{
+			"skipped default":  {Key: "name", Expected: expected[0], Found: true},
+			"overwritten":      {Key: "size", Expected: expected[4], Found: true},
+			"failed":           {Key: "bad"},
+			"never referenced": {Key: "other"},
+		}
+
+		for tn, tc := range cases {
+			t.Run(tn, func(t *testing.T) {
+				actual, found := builder.Trace().SetBy(tc.Key)
+				if found != tc.Found || !reflect.DeepEqual(actual, tc.Expected) {
+					t.Errorf("Expected %#v (%t), got %#v (%t)", tc.Expected, tc.Found, actual, found)
+				}
+			})
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		if trace := Builder().MergeMap(map[string]interface{}{"a": 1}).Trace(); trace != nil {
+			t.Errorf("Expected no trace unless enabled, got: %v", trace)
+		}
+	})
+}
@@ -26,6 +26,10 @@ import (
 type VarContext struct {
 	errors  *multierror.Error
 	context map[string]interface{}
+
+	// secrets maps keys holding values resolved from secret references to the
+	// references.
+	secrets map[string]interface{}
 }
 
 func (vc *VarContext) validate(key, typeName string, validator func(interface{}) error) {
@@ -86,6 +90,22 @@ func (vc *VarContext) GetStringMapString(key string) (res map[string]string) {
 	return
 }
 
+// GetStringSlice gets []string from the context, storing an error if the key
+// doesn't exist or the variable isn't a list.
+func (vc *VarContext) GetStringSlice(key string) (res []string) {
+	vc.validate(key, "[]string", func(val interface{}) (err error) {
+		// cast splits strings on whitespace, but a string isn't a list
+		if _, ok := val.(string); ok {
+			return fmt.Errorf("%q is a string", val)
+		}
+
+		res, err = cast.ToStringSliceE(val)
+		return err
+	})
+
+	return
+}
+
 // ToMap gets the underlying map representaiton of the variable context.
 func (vc *VarContext) ToMap() map[string]interface{} {
 	output := make(map[string]interface{})
@@ -97,6 +117,18 @@ func (vc *VarContext) ToMap() map[string]interface{} {
 	return output
 }
 
+// Redacted is like ToMap, but values resolved from secret references are
+// replaced by the references so the map is safe to log or print.
+func (vc *VarContext) Redacted() map[string]interface{} {
+	output := vc.ToMap()
+
+	for k, ref := range vc.secrets {
+		output[k] = ref
+	}
+
+	return output
+}
+
 // ToJson gets the underlying JSON representaiton of the variable context.
 func (vc *VarContext) ToJson() (json.RawMessage, error) {
 	return json.Marshal(vc.ToMap())
@@ -206,3 +206,45 @@ func TestVarContext_ToJson(t *testing.T) {
 		t.Fatalf("Expected: %#v, Got: %#v", expected, actual)
 	}
 }
+
+func TestVarContext_GetStringSlice(t *testing.T) {
+	testContext := map[string]interface{}{
+		"strings":    []string{"a", "b"},
+		"interfaces": []interface{}{"a", "b"},
+		"empty":      []interface{}{},
+		"aString":    "a b",
+	}
+
+	tests := map[string]struct {
+		Key      string
+		Expected []string
+		Error    string
+	}{
+		"strings":    {"strings", []string{"a", "b"}, ""},
+		"interfaces": {"interfaces", []string{"a", "b"}, ""},
+		"empty":      {"empty", nil, ""},
+		"string":     {"aString", nil, `value for "aString" must be a []string`},
+		"missing":    {"missing", nil, `missing value for key "missing"`},
+	}
+
+	for tn, tc := range tests {
+		t.Run(tn, func(t *testing.T) {
+			vc := &VarContext{context: testContext}
+
+			result := vc.GetStringSlice(tc.Key)
+			if !reflect.DeepEqual(result, tc.Expected) {
+				t.Errorf("Expected to get: %#v actual: %#v", tc.Expected, result)
+			}
+
+			expectedErrors := tc.Error != ""
+			hasError := vc.Error() != nil
+			if hasError != expectedErrors {
+				t.Fatalf("Got error when not expecting or missing error that was expected: %v", vc.Error())
+			}
+
+			if tc.Error != "" && !strings.Contains(vc.Error().Error(), tc.Error) {
+				t.Errorf("Expected error to contain %q, but got: %v", tc.Error, vc.Error())
+			}
+		})
+	}
+}
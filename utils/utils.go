@@ -15,8 +15,10 @@
 package utils
 
 import (
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"regexp"
@@ -257,3 +259,18 @@ func CopyStringMap(m map[string]string) map[string]string {
 
 	return out
 }
+
+// LoadCertPool reads a PEM encoded bundle of certificates into a new pool.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read CA bundle: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if ok := pool.AppendCertsFromPEM(pem); !ok {
+		return nil, fmt.Errorf("couldn't parse any certificates from %q", path)
+	}
+
+	return pool, nil
+}
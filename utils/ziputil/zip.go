@@ -22,6 +22,7 @@ import (
 	"path/filepath"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/GoogleCloudPlatform/gcp-service-broker/utils/stream"
 )
@@ -132,8 +133,18 @@ func Unarchive(zipFile, destination string) error {
 	return Extract(&rdc.Reader, "", destination)
 }
 
+// archiveModTime is the modification time of every file in archives so they
+// don't depend on when their contents were created. It's the earliest time
+// zip files can represent.
+var archiveModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
 // Archive creates a zip from the contents of the sourceFolder at the
 // destinationZip location.
+//
+// Archives are deterministic: files are added in lexical order with a fixed
+// modification time and normalized permissions so archiving the same contents
+// produces byte-identical zips. Symlinks are replaced by the files they
+// point to.
 func Archive(sourceFolder, destinationZip string) error {
 	fd, err := os.Create(destinationZip)
 	if err != nil {
@@ -149,12 +160,20 @@ func Archive(sourceFolder, destinationZip string) error {
 			return err
 		}
 
+		if info.Mode()&os.ModeSymlink != 0 {
+			if info, err = os.Stat(path); err != nil {
+				return err
+			}
+		}
+
 		header, err := zip.FileInfoHeader(info)
 		if err != nil {
 			return err
 		}
 		header.Name = Clean(strings.TrimPrefix(path, sourceFolder))
 		header.Method = zip.Deflate
+		header.Modified = archiveModTime
+		header.SetMode(normalizeMode(info.Mode()))
 
 		if info.IsDir() {
 			w.CreateHeader(header)
@@ -172,3 +191,16 @@ func Archive(sourceFolder, destinationZip string) error {
 		return nil
 	})
 }
+
+// normalizeMode strips everything but the type and executable bit from a
+// file mode so archives don't depend on the umask they were created with.
+func normalizeMode(mode os.FileMode) os.FileMode {
+	switch {
+	case mode.IsDir():
+		return os.ModeDir | 0755
+	case mode&0111 != 0:
+		return 0755
+	default:
+		return 0644
+	}
+}
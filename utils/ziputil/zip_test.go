@@ -22,6 +22,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/GoogleCloudPlatform/gcp-service-broker/utils/stream"
 )
@@ -151,3 +152,57 @@ func TestContainsDotDot(t *testing.T) {
 		}
 	}
 }
+
+func TestArchive_deterministic(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "ziptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// createSource creates the same files with different permissions and
+	// modification times each time it's called.
+	createSource := func(name string, mode os.FileMode, modTime time.Time) string {
+		dir := filepath.Join(tmp, name)
+		files := map[string]string{
+			"manifest.yml":            "name: example",
+			"bin/linux/amd64/tool":    "#!/bin/sh",
+			"definitions/service.yml": "id: 1234",
+		}
+
+		for path, contents := range files {
+			fullPath := filepath.Join(dir, filepath.FromSlash(path))
+			if err := stream.Copy(stream.FromString(contents), stream.ToModeFile(mode, fullPath)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.Chtimes(fullPath, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return dir
+	}
+
+	first := createSource("first", 0600, time.Now())
+	second := createSource("second", 0644, time.Now().Add(-time.Hour))
+
+	var archives [][]byte
+	for _, source := range []string{first, second} {
+		dest := source + ".zip"
+		if err := Archive(source, dest); err != nil {
+			t.Fatal(err)
+		}
+
+		contents, err := ioutil.ReadFile(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		archives = append(archives, contents)
+	}
+
+	if !bytes.Equal(archives[0], archives[1]) {
+		t.Error("Expected archives of the same contents to be identical")
+	}
+}